@@ -1,49 +1,202 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	// 服务器配置
-	Host  string
-	Port  int
-	Debug bool
+	Host         string
+	Port         int
+	Debug        bool
+	MaxBodyBytes int
+	StaticGzip   bool
+	// 允许跨域访问的来源，为空时允许所有来源（旧行为），"*" 允许所有来源但不允许携带凭据
+	CorsAllowedOrigins []string
+	// 可信的反向代理（IP 或 CIDR），只有来自这些地址的请求才采信 X-Forwarded-* 请求头
+	TrustedProxies []string
+	// HTTP服务器超时（秒），0 不限制；视频流和导出接口使用单独的写超时
+	HTTPReadHeaderTimeout int
+	HTTPIdleTimeout       int
+	HTTPWriteTimeout      int
+	StreamWriteTimeout    int
 
 	// 访问密码
 	AccessPassword string
 	AdminPassword  string
 
 	// 目标网站配置
-	TargetBaseURL  string
-	VideoListPath  string
+	TargetBaseURL    string
+	TargetMirrors    []string
+	VideoListPath    string
+	SiteLocaleCookie string
+	SiteLocale       string
+	// 浏览器和HTTP请求使用的 Accept-Language，navigator.languages 由其得出
+	AcceptLanguage string
 
 	// 浏览器配置
-	Headless    bool
-	BrowserType string
-	BrowserMode string
-	CdpURL      string
+	Headless     bool
+	BrowserType  string
+	BrowserMode  string
+	CdpURL       string
 	BrowserProxy string
 
+	// Chrome启动配置（auto模式）
+	ChromeFlags       string
+	ChromePath        string
+	ChromeUserDataDir string
+
+	// 列表抓取使用独立页面，避免长时间占用主页面锁
+	ListDedicatedPage bool
+	// 等待其他列表抓取的最长时间（秒），超时返回繁忙，0 为一直等待
+	ListLockTimeout int
+	// 列表提取到0个视频且不是验证页面时，等待该时间（毫秒）后重新提取一次，0 不重试
+	ListEmptyRetryDelayMs int
+	// 同时进行的详情获取数上限，超出时直接返回繁忙而不是再打开标签页，0 不限制
+	MaxPendingDetailRequests int
+
+	// 定期访问首页刷新cookies的间隔（秒），0 关闭
+	CookieRefreshInterval int
+	// cookies.json 的加密密钥，留空时以明文保存
+	CookieSecret string
+	// 启动时使用的cookies配置名，留空使用默认的 cookies.json
+	CookieProfile string
+
+	// 浏览器连续多久（分钟）没有抓取后关闭，下次抓取时重新启动，0 关闭
+	BrowserIdleTimeout int
+
+	// 启动时浏览器初始化失败是否终止启动；不终止时按间隔（秒）在后台重试，0 不重试
+	RequireBrowserOnStart    bool
+	BrowserInitRetryInterval int
+
+	// 详情页等待视频元素出现的最长时间（秒），超时后退回固定等待，0 始终使用固定等待
+	VideoElementTimeout int
+	// 后台新标签页抓取详情的整体超时（秒），0 不限制
+	DetailPageTimeout int
+	// 详情页是否点击播放按钮（选择器为 SELECTORS 中的 play_button），以及固定等待时点击后等待的毫秒数
+	PlayButtonClick  bool
+	PlayButtonWaitMs int
+	// 保存抓取到的列表页和详情页HTML的目录，用于离线回放提取逻辑，留空不保存
+	ScrapeFixtureDir string
+
+	// 抓取熔断：窗口（秒）内连续失败达到阈值后暂停抓取一段时间（秒），阈值为 0 关闭
+	BreakerThreshold int
+	BreakerWindow    int
+	BreakerCooldown  int
+
 	// 代理服务配置
-	ProxyBaseURL string
+	ProxyBaseURL         string
+	ProxyAllowedHosts    []string
+	DirectStreamCacheTTL int
+	VideoURLCacheTTL     int
+	URLSigningSecret     string
+	SignedURLTTL         int
+	// 签名链接绑定签发时的会话 cookie，其他客户端拿到链接也无法使用
+	SignedURLBindSession bool
+	M3u8MaxRedirects     int
+	ImageProxyConcurrent int
+	ImageMemoryCacheTTL  int
+	ImageMemoryCacheMB   int
+	ThumbnailFallback    bool
+	ThumbnailPlaceholder string
+	ThumbnailFailureTTL  int
+	ThumbnailHostCheck   bool
+	// 已缓存播放列表的分片地址始终按请求推导，忽略 ProxyBaseURL
+	CachedPlaylistBaseFromRequest bool
+
+	// 流式传输配置
+	StreamBufferKB        int
+	StreamFlushKB         int
+	StreamFlushIntervalMs int
+	// 同时进行的MP4流式代理响应数上限，0 不限制
+	MaxConcurrentStreams int
+
+	// 分片内存缓存和预取配置
+	SegmentCacheMaxMB     int
+	SegmentPrefetchCount  int
+	SegmentPrefetchOffset int
+	// 同一观看者播放同一视频时同时向上游请求的分片数上限，0 不限制
+	SegmentSessionConcurrency int
 
 	// 选择器配置
-	Selectors map[string]string
+	Selectors          map[string]string
+	ListExtractProfile string
 
 	// 缓存配置
-	CacheEnabled       bool
-	CacheTTL           int
-	VideoCacheEnabled  bool
-	VideoCacheDir      string
-	CacheDBPath        string
-	VideoListCacheTTL  int
-	CachePageSize      int
-	AutoPrecache       bool
-	PrecacheConcurrent int
+	CacheEnabled      bool
+	CacheTTL          int
+	VideoCacheEnabled bool
+	// 纯代理模式：不写入任何缓存文件，也不使用缓存数据库
+	PureProxy           bool
+	VideoCacheDir       string
+	CacheDBPath         string
+	CacheNamespace      string
+	VideoListCacheTTL   int
+	DetailStaleWindow   int
+	ListRefreshInterval int
+	ListMaxPage         int
+	ListPageOverflow    string
+	ListDedupeWindow    int
+	// 各分类总页数的记录上限和有效期（秒），0 不限制
+	TotalPagesCacheSize    int
+	TotalPagesCacheTTL     int
+	CacheReconcileInterval int
+	// 定期清理遗留的MP4临时文件的间隔和文件最短保留时间（秒）
+	Mp4TempSweepInterval int
+	Mp4TempMaxAge        int
+	// 未完成的M3U8缓存目录超过该时间（秒）未更新时随临时文件一起清理，0 不清理
+	HlsPartialMaxAge      int
+	ListCacheMaxFiles     int
+	ListCacheMaxAge       int
+	CachePageSize         int
+	AutoPrecache          bool
+	PrecacheConcurrent    int
+	PrecacheSettingsFile  string
+	PrecacheMaxVideos     int
+	PrecacheDailyBudgetMB int
+	PreloadViewkeys       []string
+	PreloadFile           string
+	FFprobeEnabled        bool
+	FFprobePath           string
+
+	// 边下边播配置
+	PartialM3u8Enabled     bool
+	PartialM3u8MinSegments int
+	CachedPreloadSegments  int
+	Mp4TeeCache            bool
+	Mp4TeeKeepOnDisconnect bool
+	// 下载中视频的分片尚未缓存时从上游获取，以及是否同时保存到缓存目录
+	SegmentMissUpstream bool
+	SegmentMissStore    bool
+
+	// 缓存分片保留原始扩展名（如 .m4s），关闭时统一命名为 .ts
+	PreserveSegmentExt bool
+	// 分片连续下载失败达到该次数后放弃 M3U8 缓存，详情中有 MP4 地址时改为缓存 MP4，0 不放弃
+	HlsSegmentFailureLimit int
+
+	// 下载写入缓冲区大小（KB），以及重命名和写入完成标记前是否 fsync
+	DownloadWriteBufferKB int
+	DownloadFsync         bool
+	// 同时进行的缓存下载数上限，超出时按优先级排队（用户播放触发的下载不受限制），0 不限制
+	MaxConcurrentDownloads int
+
+	// 可缓存视频的上限：时长（秒，按 M3U8 的 #EXTINF 估算）、M3U8 分片数、MP4 大小（MB），超出时不缓存，0 不限制
+	MaxCacheDuration int
+	MaxCacheSegments int
+	MaxCacheSizeMB   int
+
+	// video.m3u8 和详情JSON以 gzip 压缩保存，读取时自动识别
+	CompressMetadata bool
+
+	// 维护模式：只提供已缓存的内容，需要访问站点的请求返回 503（可通过管理接口切换）
+	MaintenanceMode       bool
+	MaintenanceMessage    string
+	MaintenanceRetryAfter int
 }
 
 var Settings *Config
@@ -52,16 +205,39 @@ func Load() {
 	// 尝试加载 .env 文件
 	godotenv.Load()
 
+	// 可选的 JSON/YAML 配置文件，环境变量优先
+	fileValues = nil
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadConfigFile(path); err != nil {
+			log.Printf("警告: 读取配置文件失败: %v", err)
+		}
+	}
+
 	Settings = &Config{
-		Host:  getEnv("HOST", "0.0.0.0"),
-		Port:  getEnvInt("PORT", 8000),
-		Debug: getEnvBool("DEBUG", true),
+		Host:         getEnv("HOST", "0.0.0.0"),
+		Port:         getEnvInt("PORT", 8000),
+		Debug:        getEnvBool("DEBUG", true),
+		MaxBodyBytes: getEnvInt("MAX_BODY_BYTES", 1024*1024),
+		StaticGzip:   getEnvBool("STATIC_GZIP", true),
+
+		CorsAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", nil),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES", []string{"127.0.0.1", "::1"}),
+
+		HTTPReadHeaderTimeout: getEnvInt("HTTP_READ_HEADER_TIMEOUT", 10),
+		HTTPIdleTimeout:       getEnvInt("HTTP_IDLE_TIMEOUT", 120),
+		HTTPWriteTimeout:      getEnvInt("HTTP_WRITE_TIMEOUT", 300),
+		StreamWriteTimeout:    getEnvInt("STREAM_WRITE_TIMEOUT", 0),
 
 		AccessPassword: getEnv("ACCESS_PASSWORD", "changeme"),
 		AdminPassword:  getEnv("ADMIN_PASSWORD", "admin123"),
 
-		TargetBaseURL:  getEnv("TARGET_BASE_URL", "https://91porn.com"),
-		VideoListPath:  getEnv("VIDEO_LIST_PATH", "/v.php?category=rf&viewtype=basic"),
+		TargetBaseURL:    getEnv("TARGET_BASE_URL", "https://91porn.com"),
+		TargetMirrors:    getEnvList("TARGET_MIRRORS", nil),
+		VideoListPath:    getEnv("VIDEO_LIST_PATH", "/v.php?category=rf&viewtype=basic"),
+		SiteLocaleCookie: getEnv("SITE_LOCALE_COOKIE", "language"),
+		SiteLocale:       getEnv("SITE_LOCALE", "cn_CN"),
+		// 请求语言
+		AcceptLanguage: getEnv("ACCEPT_LANGUAGE", "zh-CN,zh;q=0.9,en-US;q=0.8,en;q=0.7"),
 
 		Headless:     getEnvBool("HEADLESS", false),
 		BrowserType:  getEnv("BROWSER_TYPE", "chromium"),
@@ -69,38 +245,156 @@ func Load() {
 		CdpURL:       getEnv("CDP_URL", "http://127.0.0.1:9222"),
 		BrowserProxy: getEnv("BROWSER_PROXY", ""),
 
-		ProxyBaseURL: getEnv("PROXY_BASE_URL", "http://localhost:8000"),
+		ChromeFlags:       getEnv("CHROME_FLAGS", ""),
+		ChromePath:        getEnv("CHROME_PATH", ""),
+		ChromeUserDataDir: getEnv("CHROME_USER_DATA_DIR", ""),
+
+		ListDedicatedPage:        getEnvBool("LIST_DEDICATED_PAGE", true),
+		ListLockTimeout:          getEnvInt("LIST_LOCK_TIMEOUT", 15),
+		ListEmptyRetryDelayMs:    getEnvInt("LIST_EMPTY_RETRY_DELAY_MS", 2000),
+		MaxPendingDetailRequests: getEnvInt("MAX_PENDING_DETAIL_REQUESTS", 0),
+
+		CookieRefreshInterval: getEnvInt("COOKIE_REFRESH_INTERVAL", 0),
+		CookieSecret:          getEnv("COOKIE_SECRET", ""),
+		// cookies配置
+		CookieProfile: getEnv("COOKIE_PROFILE", ""),
 
-		Selectors: map[string]string{
+		BrowserIdleTimeout: getEnvInt("BROWSER_IDLE_TIMEOUT", 0),
+
+		RequireBrowserOnStart:    getEnvBool("REQUIRE_BROWSER_ON_START", false),
+		BrowserInitRetryInterval: getEnvInt("BROWSER_INIT_RETRY_INTERVAL", 60),
+
+		VideoElementTimeout: getEnvInt("VIDEO_ELEMENT_TIMEOUT", 10),
+		DetailPageTimeout:   getEnvInt("DETAIL_PAGE_TIMEOUT", 60),
+		// 点击播放
+		PlayButtonClick:  getEnvBool("PLAY_BUTTON_CLICK", true),
+		PlayButtonWaitMs: getEnvInt("PLAY_BUTTON_WAIT_MS", 2000),
+		// 抓取页面录制
+		ScrapeFixtureDir: getEnv("SCRAPE_FIXTURE_DIR", ""),
+
+		BreakerThreshold: getEnvInt("SCRAPER_BREAKER_THRESHOLD", 5),
+		BreakerWindow:    getEnvInt("SCRAPER_BREAKER_WINDOW", 300),
+		BreakerCooldown:  getEnvInt("SCRAPER_BREAKER_COOLDOWN", 60),
+
+		ProxyBaseURL:         getEnv("PROXY_BASE_URL", "http://localhost:8000"),
+		ProxyAllowedHosts:    getEnvList("PROXY_ALLOWED_HOSTS", nil),
+		DirectStreamCacheTTL: getEnvInt("DIRECT_STREAM_CACHE_TTL", 5),
+		VideoURLCacheTTL:     getEnvInt("VIDEO_URL_CACHE_TTL", 1800),
+		URLSigningSecret:     getEnv("URL_SIGNING_SECRET", ""),
+		SignedURLTTL:         getEnvInt("SIGNED_URL_TTL", 6*60*60),
+		SignedURLBindSession: getEnvBool("SIGNED_URL_BIND_SESSION", true),
+		M3u8MaxRedirects:     getEnvInt("M3U8_MAX_REDIRECTS", 3),
+		ImageProxyConcurrent: getEnvInt("IMAGE_PROXY_CONCURRENT", 6),
+		ImageMemoryCacheTTL:  getEnvInt("IMAGE_MEMORY_CACHE_TTL", 300),
+		ImageMemoryCacheMB:   getEnvInt("IMAGE_MEMORY_CACHE_MB", 32),
+		ThumbnailFallback:    getEnvBool("THUMBNAIL_FALLBACK", false),
+		ThumbnailPlaceholder: getEnv("THUMBNAIL_PLACEHOLDER", ""),
+		ThumbnailFailureTTL:  getEnvInt("THUMBNAIL_FAILURE_TTL", 24*60*60),
+		ThumbnailHostCheck:   getEnvBool("THUMBNAIL_HOST_CHECK", true),
+		// 已缓存播放列表的分片地址按请求推导
+		CachedPlaylistBaseFromRequest: getEnvBool("CACHED_PLAYLIST_BASE_FROM_REQUEST", false),
+
+		StreamBufferKB:        getEnvInt("STREAM_BUFFER_KB", 512),
+		StreamFlushKB:         getEnvInt("STREAM_FLUSH_KB", 1024),
+		StreamFlushIntervalMs: getEnvInt("STREAM_FLUSH_INTERVAL_MS", 200),
+		// 流式代理并发上限
+		MaxConcurrentStreams: getEnvInt("MAX_CONCURRENT_STREAMS", 0),
+
+		SegmentCacheMaxMB:     getEnvInt("SEGMENT_CACHE_MAX_MB", 64),
+		SegmentPrefetchCount:  getEnvInt("SEGMENT_PREFETCH_COUNT", 0),
+		SegmentPrefetchOffset: getEnvInt("SEGMENT_PREFETCH_OFFSET", 0),
+		// 每个播放会话的分片并发
+		SegmentSessionConcurrency: getEnvInt("SEGMENT_SESSION_CONCURRENCY", 4),
+
+		Selectors: getEnvMap("SELECTORS", map[string]string{
 			"video_item":      ".listchannel .well",
 			"video_title":     ".video-title",
 			"video_thumbnail": "img.img-responsive",
 			"video_link":      "a",
 			"video_duration":  ".duration",
 			"m3u8_source":     "video source, video",
-		},
-
-		CacheEnabled:       getEnvBool("CACHE_ENABLED", true),
-		CacheTTL:           getEnvInt("CACHE_TTL", 300),
-		VideoCacheEnabled:  getEnvBool("VIDEO_CACHE_ENABLED", true),
-		VideoCacheDir:      getEnv("VIDEO_CACHE_DIR", "cache/videos"),
-		CacheDBPath:        getEnv("CACHE_DB_PATH", ""),
-		VideoListCacheTTL:  getEnvInt("VIDEO_LIST_CACHE_TTL", 12*60*60),
-		CachePageSize:      getEnvInt("CACHE_PAGE_SIZE", 20),
-		AutoPrecache:       getEnvBool("AUTO_PRECACHE", true),
-		PrecacheConcurrent: getEnvInt("PRECACHE_CONCURRENT", 2),
+			"video_tags":      ".video-tags a, .tags a",
+			"play_button":     ".vjs-big-play-button, .play-button, #player",
+		}),
+		ListExtractProfile: getEnv("LIST_EXTRACT_PROFILE", ""),
+
+		CacheEnabled:        getEnvBool("CACHE_ENABLED", true),
+		CacheTTL:            getEnvInt("CACHE_TTL", 300),
+		VideoCacheEnabled:   getEnvBool("VIDEO_CACHE_ENABLED", true),
+		PureProxy:           getEnvBool("PURE_PROXY", false),
+		VideoCacheDir:       getEnv("VIDEO_CACHE_DIR", "cache/videos"),
+		CacheDBPath:         getEnv("CACHE_DB_PATH", ""),
+		CacheNamespace:      getEnv("CACHE_NAMESPACE", ""),
+		VideoListCacheTTL:   getEnvInt("VIDEO_LIST_CACHE_TTL", 12*60*60),
+		DetailStaleWindow:   getEnvInt("DETAIL_STALE_WINDOW", 0),
+		ListRefreshInterval: getEnvInt("LIST_REFRESH_INTERVAL", 60),
+		ListMaxPage:         getEnvInt("LIST_MAX_PAGE", 0),
+		ListPageOverflow:    getEnv("LIST_PAGE_OVERFLOW", "clamp"),
+		ListDedupeWindow:    getEnvInt("LIST_DEDUPE_WINDOW", 0),
+		// 各分类总页数
+		TotalPagesCacheSize:    getEnvInt("TOTAL_PAGES_CACHE_SIZE", 50),
+		TotalPagesCacheTTL:     getEnvInt("TOTAL_PAGES_CACHE_TTL", 24*60*60),
+		CacheReconcileInterval: getEnvInt("CACHE_RECONCILE_INTERVAL", 60*60),
+		// 遗留的MP4临时文件
+		Mp4TempSweepInterval: getEnvInt("MP4_TEMP_SWEEP_INTERVAL", 60*60),
+		Mp4TempMaxAge:        getEnvInt("MP4_TEMP_MAX_AGE", 60*60),
+		// 未完成的M3U8缓存目录
+		HlsPartialMaxAge:      getEnvInt("HLS_PARTIAL_MAX_AGE", 7*24*60*60),
+		ListCacheMaxFiles:     getEnvInt("LIST_CACHE_MAX_FILES", 100),
+		ListCacheMaxAge:       getEnvInt("LIST_CACHE_MAX_AGE", 7*24*60*60),
+		CachePageSize:         getEnvInt("CACHE_PAGE_SIZE", 20),
+		AutoPrecache:          getEnvBool("AUTO_PRECACHE", true),
+		PrecacheConcurrent:    getEnvInt("PRECACHE_CONCURRENT", 2),
+		PrecacheSettingsFile:  getEnv("PRECACHE_SETTINGS_FILE", ""),
+		PrecacheMaxVideos:     getEnvInt("PRECACHE_MAX_VIDEOS", 0),
+		PrecacheDailyBudgetMB: getEnvInt("PRECACHE_DAILY_BUDGET_MB", 0),
+		PreloadViewkeys:       getEnvList("PRELOAD_VIEWKEYS", nil),
+		PreloadFile:           getEnv("PRELOAD_FILE", ""),
+		FFprobeEnabled:        getEnvBool("FFPROBE_ENABLED", false),
+		FFprobePath:           getEnv("FFPROBE_PATH", "ffprobe"),
+
+		PartialM3u8Enabled:     getEnvBool("PARTIAL_M3U8_ENABLED", true),
+		PartialM3u8MinSegments: getEnvInt("PARTIAL_M3U8_MIN_SEGMENTS", 3),
+		CachedPreloadSegments:  getEnvInt("CACHED_PRELOAD_SEGMENTS", 3),
+		Mp4TeeCache:            getEnvBool("MP4_TEE_CACHE", true),
+		Mp4TeeKeepOnDisconnect: getEnvBool("MP4_TEE_KEEP_ON_DISCONNECT", true),
+		SegmentMissUpstream:    getEnvBool("SEGMENT_MISS_UPSTREAM", true),
+		SegmentMissStore:       getEnvBool("SEGMENT_MISS_STORE", false),
+
+		PreserveSegmentExt:     getEnvBool("PRESERVE_SEGMENT_EXT", true),
+		HlsSegmentFailureLimit: getEnvInt("HLS_SEGMENT_FAILURE_LIMIT", 5),
+
+		DownloadWriteBufferKB: getEnvInt("DOWNLOAD_WRITE_BUFFER_KB", 1024),
+		DownloadFsync:         getEnvBool("DOWNLOAD_FSYNC", true),
+		// 缓存下载并发上限
+		MaxConcurrentDownloads: getEnvInt("MAX_CONCURRENT_DOWNLOADS", 3),
+
+		MaxCacheDuration: getEnvInt("MAX_CACHE_DURATION", 0),
+		MaxCacheSegments: getEnvInt("MAX_CACHE_SEGMENTS", 0),
+		MaxCacheSizeMB:   getEnvInt("MAX_CACHE_SIZE_MB", 0),
+
+		CompressMetadata: getEnvBool("CACHE_COMPRESS_METADATA", false),
+
+		MaintenanceMode:       getEnvBool("MAINTENANCE_MODE", false),
+		MaintenanceMessage:    getEnv("MAINTENANCE_MESSAGE", ""),
+		MaintenanceRetryAfter: getEnvInt("MAINTENANCE_RETRY_AFTER", 300),
+	}
+
+	// 纯代理模式下视频、封面图、列表和详情缓存都依赖 VIDEO_CACHE_ENABLED，统一关闭
+	if Settings.PureProxy {
+		Settings.VideoCacheEnabled = false
 	}
 }
 
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupValue(key); ok {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupValue(key); ok {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -109,10 +403,24 @@ func getEnvInt(key string, defaultValue int) int {
 }
 
 func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupValue(key); ok {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
 	}
 	return defaultValue
 }
+
+func getEnvList(key string, defaultValue []string) []string {
+	value, ok := lookupValue(key)
+	if !ok {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
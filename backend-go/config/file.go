@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues CONFIG_FILE 中读取的配置，键为对应的环境变量名（大写）
+var fileValues map[string]interface{}
+
+// loadConfigFile 读取 JSON 或 YAML 配置文件（按扩展名区分），环境变量优先于文件中的值
+func loadConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	default:
+		err = json.Unmarshal(content, &raw)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+
+	fileValues = make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		fileValues[strings.ToUpper(key)] = value
+	}
+	return nil
+}
+
+// lookupValue 依次从环境变量和配置文件中查找配置，统一转换为字符串
+// 配置文件中的数组按逗号拼接，与环境变量中的列表格式一致
+func lookupValue(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+
+	value, ok := fileValues[key]
+	if !ok || value == nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), len(items) > 0
+	}
+	return "", false
+}
+
+// getEnvMap 读取键值对配置，环境变量为JSON对象字符串，配置文件中为对象
+// 读取到的键覆盖默认值中的同名键，其余默认值保留
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	result := make(map[string]string, len(defaultValue))
+	for k, v := range defaultValue {
+		result[k] = v
+	}
+
+	if value := os.Getenv(key); value != "" {
+		var fromEnv map[string]string
+		if err := json.Unmarshal([]byte(value), &fromEnv); err == nil {
+			for k, v := range fromEnv {
+				result[k] = v
+			}
+		}
+		return result
+	}
+
+	if fromFile, ok := fileValues[key].(map[string]interface{}); ok {
+		for k, v := range fromFile {
+			result[k] = fmt.Sprint(v)
+		}
+	}
+	return result
+}
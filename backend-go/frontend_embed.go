@@ -0,0 +1,24 @@
+//go:build embedfrontend
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+)
+
+// 构建前需要把前端构建产物复制到 backend-go/frontend/dist：
+//
+//	cp -r ../frontend/dist ./frontend/dist && go build -tags embedfrontend .
+//
+//go:embed all:frontend/dist
+var frontendFiles embed.FS
+
+func init() {
+	dist, err := fs.Sub(frontendFiles, "frontend/dist")
+	if err != nil {
+		log.Fatalf("读取嵌入的前端文件失败: %v", err)
+	}
+	embeddedFrontend = dist
+}
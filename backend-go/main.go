@@ -5,21 +5,43 @@ import (
 	"backend-go/models"
 	"backend-go/routers"
 	"backend-go/services"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "检测选择器匹配情况后退出")
+	listURL := flag.String("list-url", "", "dry-run 使用的列表页地址（默认为配置的列表页）")
+	detailURL := flag.String("detail-url", "", "dry-run 使用的详情页地址")
+	replay := flag.String("replay", "", "对保存的页面HTML运行提取逻辑并输出结果后退出")
+	replayURL := flag.String("replay-url", "", "replay 页面的原始地址（默认取自文件开头的注释）")
+	flag.Parse()
+
 	// 加载配置
 	config.Load()
 	cfg := config.Settings
 
+	if *dryRun {
+		runSelectorDryRun(*listURL, *detailURL)
+		return
+	}
+	if *replay != "" {
+		runFixtureReplay(*replay, *replayURL)
+		return
+	}
+
 	// 设置Gin模式
 	if !cfg.Debug {
 		gin.SetMode(gin.ReleaseMode)
@@ -27,82 +49,92 @@ func main() {
 
 	// 创建Gin引擎
 	r := gin.Default()
+	// 只有来自可信反向代理的请求才按 X-Forwarded-For 取客户端地址
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES 配置无效: %v", err)
+	}
 
 	// 配置CORS
-	r.Use(cors.New(cors.Config{
-		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Admin-Token"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges"},
-		AllowCredentials: true,
-	}))
+	r.Use(cors.New(corsConfig(cfg.CorsAllowedOrigins)))
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+		maintenance := services.GetMaintenance().Status()
+		status := "healthy"
+		if maintenance.Enabled {
+			status = "maintenance"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":        status,
+			"active_mirror": services.TargetBaseURL(),
+			"mirrors":       services.GetMirrorService().All(),
+			"maintenance":   maintenance,
+		})
 	})
 
 	// API路由组
 	api := r.Group("/api")
+	// 限制请求体大小（导入缓存的tar上传除外）
+	api.Use(routers.MaxBodyBytes(int64(cfg.MaxBodyBytes), "/api/admin/cache/import"))
+	api.Use(routers.ValidatePathParams())
+	// 视频流和缓存导出使用单独的写超时，避免长视频被 HTTP_WRITE_TIMEOUT 中断
+	api.Use(routers.StreamWriteDeadline(time.Duration(cfg.StreamWriteTimeout)*time.Second, "/api/stream/", "/api/admin/cache/export/"))
 	{
 		// 认证路由
 		api.POST("/auth/verify", verifyPassword)
+		api.GET("/status", getServiceStatus)
 
 		// 注册其他路由
 		routers.RegisterVideosRoutes(api)
 		routers.RegisterStreamRoutes(api)
 		routers.RegisterCacheRoutes(api)
+		routers.RegisterTagRoutes(api)
+		routers.RegisterAdminRoutes(api)
 	}
 
 	// 静态文件服务（前端）
-	frontendDist := "./frontend/dist"
-	// 兼容本地开发环境
-	if _, err := os.Stat(frontendDist); os.IsNotExist(err) {
-		frontendDist = "../frontend/dist"
-	}
-	if _, err := os.Stat(frontendDist); err == nil {
-		// 静态资源目录
-		assetsDir := filepath.Join(frontendDist, "assets")
-		if _, err := os.Stat(assetsDir); err == nil {
-			r.Static("/assets", assetsDir)
-		}
-
-		// 根路径返回index.html
-		r.GET("/", func(c *gin.Context) {
-			c.File(filepath.Join(frontendDist, "index.html"))
-		})
-
-		// SPA支持：其他非API路由返回index.html
-		r.NoRoute(func(c *gin.Context) {
-			// 如果是API请求，返回404
-			if len(c.Request.URL.Path) > 4 && c.Request.URL.Path[:4] == "/api" {
-				c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "接口不存在"})
-				return
-			}
-			c.File(filepath.Join(frontendDist, "index.html"))
-		})
+	if dist := frontendFS(); dist != nil {
+		routers.RegisterFrontendRoutes(r, dist)
 	}
 
 	// 初始化服务
 	log.Println("正在初始化Playwright...")
 	scraperService := services.GetScraperService()
 	if err := scraperService.Initialize(); err != nil {
-		log.Printf("警告: Playwright初始化失败: %v", err)
+		if cfg.RequireBrowserOnStart {
+			log.Fatalf("Playwright初始化失败，已启用 REQUIRE_BROWSER_ON_START，停止启动: %v", err)
+		}
+		log.Printf("警告: Playwright初始化失败，需要抓取的请求将返回 503 直到浏览器可用: %v", err)
+		scraperService.StartInitRetry(cfg.BrowserInitRetryInterval)
 	} else {
 		log.Println("Playwright初始化完成")
 	}
+	scraperService.StartCookieRefresh(cfg.CookieRefreshInterval)
+	scraperService.StartIdleShutdown(cfg.BrowserIdleTimeout)
 
-	// 初始化缓存数据库并同步现有缓存
-	log.Println("正在初始化缓存数据库...")
+	// 初始化缓存数据库并同步现有缓存；纯代理模式不读写缓存目录和数据库
 	cacheDB := services.GetCacheDBService()
 	cacheService := services.GetVideoCacheService()
-	if err := cacheDB.SyncFromFileSystem(cacheService); err != nil {
-		log.Printf("警告: 缓存数据同步失败: %v", err)
+	if cfg.PureProxy {
+		log.Println("纯代理模式：不缓存视频、封面图、列表和详情，不使用缓存数据库")
+	} else {
+		log.Println("正在初始化缓存数据库...")
+		if err := cacheDB.SyncFromFileSystem(cacheService); err != nil {
+			log.Printf("警告: 缓存数据同步失败: %v", err)
+		}
+		cacheDB.StartPeriodicReconcile(cacheService, cfg.CacheReconcileInterval)
+		cacheService.StartMp4TempSweep(cfg.Mp4TempSweepInterval, cfg.Mp4TempMaxAge)
+		cacheService.StartPartialM3u8Sweep(cfg.Mp4TempSweepInterval, cfg.HlsPartialMaxAge)
+		cacheService.StartStaleDetailSweep(cfg.DetailStaleWindow)
+
+		// 后台预热常用视频
+		routers.StartPreload()
 	}
 
 	// 优雅关闭
 	defer func() {
 		log.Println("正在关闭服务...")
+		services.GetScheduler().Stop()
 		scraperService.Close()
 		services.GetProxyService().Close()
 		cacheService.Close()
@@ -112,17 +144,112 @@ func main() {
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           r.Handler(),
+		ReadHeaderTimeout: time.Duration(cfg.HTTPReadHeaderTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.HTTPIdleTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.HTTPWriteTimeout) * time.Second,
+	}
 	log.Printf("服务器启动在 %s", addr)
-	if err := r.Run(addr); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
 }
 
+// embeddedFrontend 编译进二进制的前端文件，使用 embedfrontend 标签构建时设置（见 frontend_embed.go）
+var embeddedFrontend fs.FS
+
+// frontendFS 前端构建产物：优先使用嵌入的文件，否则读取 ./frontend/dist，本地开发时读取 ../frontend/dist；都不存在时返回nil
+func frontendFS() fs.FS {
+	if embeddedFrontend != nil {
+		log.Println("使用嵌入的前端文件")
+		return embeddedFrontend
+	}
+
+	frontendDist := "./frontend/dist"
+	// 兼容本地开发环境
+	if _, err := os.Stat(frontendDist); os.IsNotExist(err) {
+		frontendDist = "../frontend/dist"
+	}
+	if _, err := os.Stat(frontendDist); err != nil {
+		return nil
+	}
+	return os.DirFS(frontendDist)
+}
+
+// corsConfig 按 CORS_ALLOWED_ORIGINS 生成跨域配置
+// 配置了来源列表时只回显列表中的 Origin 并允许携带凭据；"*" 允许所有来源但不允许凭据；未配置时保持允许所有来源
+func corsConfig(origins []string) cors.Config {
+	corsCfg := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Admin-Token"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges"},
+		AllowCredentials: true,
+	}
+
+	switch {
+	case len(origins) == 0:
+		corsCfg.AllowAllOrigins = true
+	case slices.Contains(origins, "*"):
+		corsCfg.AllowAllOrigins = true
+		corsCfg.AllowCredentials = false
+	default:
+		corsCfg.AllowOrigins = origins
+	}
+	return corsCfg
+}
+
+// runFixtureReplay 对保存的页面HTML运行列表或详情提取逻辑并输出JSON，文件名以 list_ 开头时按列表页处理
+func runFixtureReplay(path, pageURL string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("读取页面文件失败: %v", err)
+	}
+	if pageURL == "" {
+		pageURL = services.FixtureURL(string(content))
+	}
+
+	scraperService := services.GetScraperService()
+	defer scraperService.Close()
+
+	var result interface{}
+	if strings.HasPrefix(filepath.Base(path), "list_") {
+		result, err = scraperService.ExtractListFromHTML(string(content), pageURL, "")
+	} else {
+		result, err = scraperService.ExtractDetailFromHTML(string(content), pageURL)
+	}
+	if err != nil {
+		log.Fatalf("提取失败: %v", err)
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(data))
+}
+
+// runSelectorDryRun 检测选择器并输出JSON报告
+func runSelectorDryRun(listURL, detailURL string) {
+	scraperService := services.GetScraperService()
+	defer scraperService.Close()
+
+	report, err := scraperService.DryRunSelectors(listURL, detailURL)
+	if err != nil {
+		log.Fatalf("选择器检测失败: %v", err)
+	}
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+}
+
+// getServiceStatus 当前能否实时抓取，前端据此显示实时或仅缓存模式
+func getServiceStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, services.GetScraperService().Availability())
+}
+
 // verifyPassword 验证访问密码
 func verifyPassword(c *gin.Context) {
 	var req models.PasswordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "请求格式错误"})
+	if !routers.BindJSON(c, &req) {
 		return
 	}
 
@@ -1,21 +1,52 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // VideoItem 视频列表项
 type VideoItem struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	Thumbnail string `json:"thumbnail,omitempty"`
-	URL       string `json:"url"`
-	Duration  string `json:"duration,omitempty"`
+	ID              string `json:"id"`
+	Title           string `json:"title"`
+	Thumbnail       string `json:"thumbnail,omitempty"`
+	URL             string `json:"url"`
+	Duration        string `json:"duration,omitempty"`
+	DurationSeconds int    `json:"duration_seconds"`
 }
 
-// VideoDetail 视频详情
+// VideoDetail 视频详情，抓取后保存到 detail.json
+// format 为抓取时判断的上游流格式（hls 或 mp4）
 type VideoDetail struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Thumbnail   string `json:"thumbnail,omitempty"`
-	M3u8URL     string `json:"m3u8_url,omitempty"`
-	OriginalURL string `json:"original_url"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Thumbnail   string     `json:"thumbnail,omitempty"`
+	M3u8URL     string     `json:"m3u8_url,omitempty"`
+	Mp4URL      string     `json:"mp4_url,omitempty"`
+	OriginalURL string     `json:"original_url"`
+	Duration    int        `json:"duration,omitempty"`
+	Resolution  string     `json:"resolution,omitempty"`
+	StreamURL   string     `json:"stream_url,omitempty"`
+	Subtitles   []Subtitle `json:"subtitles,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Format      string     `json:"format,omitempty"`
+}
+
+// VideoDetailResponse 视频详情接口的响应，缓存状态只在响应时计算，不写入 detail.json
+// format 为代理返回的流格式（已缓存时以缓存类型为准）；已缓存时 cache_type 为缓存类型（m3u8 或 mp4）
+type VideoDetailResponse struct {
+	VideoDetail
+	Format    string `json:"format,omitempty"`
+	Cached    bool   `json:"cached"`
+	CacheType string `json:"cache_type,omitempty"`
+}
+
+// Subtitle 字幕轨道
+type Subtitle struct {
+	Lang     string `json:"lang"`
+	Label    string `json:"label,omitempty"`
+	URL      string `json:"url"`
+	ProxyURL string `json:"proxy_url,omitempty"`
 }
 
 // VideoListResponse 视频列表响应
@@ -26,24 +57,62 @@ type VideoListResponse struct {
 	TotalPages int         `json:"total_pages"`
 }
 
+// TagCount 标签及带有该标签的已缓存视频数量
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagListResponse 标签列表响应
+type TagListResponse struct {
+	Tags  []TagCount `json:"tags"`
+	Total int        `json:"total"`
+}
+
 // StreamInfo 流信息
 type StreamInfo struct {
 	VideoID  string `json:"video_id"`
 	M3u8URL  string `json:"m3u8_url"`
 	ProxyURL string `json:"proxy_url"`
+	Format   string `json:"format"`
+	Cached   bool   `json:"cached"`
 }
 
 // CacheInfo 缓存信息
 type CacheInfo struct {
-	Viewkey string `json:"viewkey"`
-	Type    string `json:"type"`
-	Size    int64  `json:"size"`
+	Viewkey    string `json:"viewkey"`
+	Type       string `json:"type"`
+	Size       int64  `json:"size"`
+	Duration   int    `json:"duration,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// CachedRecord 缓存数据库中的完整记录，用于批量重新抓取详情等管理工具
+type CachedRecord struct {
+	Viewkey     string `json:"viewkey"`
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	Size        int64  `json:"size"`
+	Thumbnail   string `json:"thumbnail"`
+	OriginalURL string `json:"original_url"`
+	Duration    int    `json:"duration"`
+	Resolution  string `json:"resolution"`
+	CachedAt    string `json:"cached_at"`
+}
+
+// CachedRecordListResponse 缓存记录列表响应
+type CachedRecordListResponse struct {
+	Records  []CachedRecord `json:"records"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
 }
 
 // CacheListResponse 缓存列表响应
 type CacheListResponse struct {
 	Enabled     bool        `json:"enabled"`
 	CacheDir    string      `json:"cache_dir"`
+	Namespace   string      `json:"namespace"`
 	TotalSize   int64       `json:"total_size"`
 	TotalSizeMB float64     `json:"total_size_mb"`
 	Videos      []CacheInfo `json:"videos"`
@@ -53,12 +122,306 @@ type CacheListResponse struct {
 	TotalPages  int         `json:"total_pages"`
 }
 
+// CacheRecomputeResponse 缓存大小重新计算结果
+type CacheRecomputeResponse struct {
+	TotalSize   int64   `json:"total_size"`
+	TotalSizeMB float64 `json:"total_size_mb"`
+	Count       int     `json:"count"`
+	Added       int     `json:"added"`
+	Updated     int     `json:"updated"`
+	Removed     int     `json:"removed"`
+}
+
+// TempSweepResponse 清理遗留临时文件的结果
+type TempSweepResponse struct {
+	Removed     int     `json:"removed"`
+	RemovedDirs int     `json:"removed_dirs"`
+	FreedBytes  int64   `json:"freed_bytes"`
+	FreedMB     float64 `json:"freed_mb"`
+}
+
+// CacheIntegrityResponse 缓存完整性校验结果
+type CacheIntegrityResponse struct {
+	Viewkey  string   `json:"viewkey"`
+	Type     string   `json:"type"`
+	Complete bool     `json:"complete"`
+	Total    int      `json:"total"`
+	Missing  []string `json:"missing"`
+	Repaired bool     `json:"repaired,omitempty"`
+}
+
+// PrecacheBudgetInfo 预缓存每日预算使用情况，预算为 0 表示不限制
+type PrecacheBudgetInfo struct {
+	Enabled        bool   `json:"enabled"`
+	MaxVideos      int    `json:"max_videos"`
+	BudgetBytes    int64  `json:"budget_bytes"`
+	UsedBytes      int64  `json:"used_bytes"`
+	RemainingBytes int64  `json:"remaining_bytes"`
+	Started        int    `json:"started"`
+	Paused         bool   `json:"paused"`
+	ResetAt        string `json:"reset_at"`
+}
+
+// PrecacheSettingsRequest 修改预缓存设置请求，省略的字段保持不变
+type PrecacheSettingsRequest struct {
+	AutoPrecache       *bool `json:"auto_precache"`
+	PrecacheConcurrent *int  `json:"precache_concurrent"`
+}
+
+// PrecacheSettingsResponse 当前预缓存设置
+type PrecacheSettingsResponse struct {
+	AutoPrecache       bool `json:"auto_precache"`
+	PrecacheConcurrent int  `json:"precache_concurrent"`
+	Active             int  `json:"active"`
+	Overridden         bool `json:"overridden"`
+}
+
+// CacheStatsResponse 缓存统计响应
+type CacheStatsResponse struct {
+	TotalSize   int64              `json:"total_size"`
+	TotalSizeMB float64            `json:"total_size_mb"`
+	Count       int                `json:"count"`
+	Precache    PrecacheBudgetInfo `json:"precache"`
+}
+
+// DownloadInfo 进行中的下载任务
+// M3U8 的 downloaded/total 为分片数，MP4 为字节数；speed 单位为字节/秒，eta 为预计剩余秒数（-1 表示未知）
+// status 为 queued 时在等待下载槽位；priority 为 user、precache 或 bulk
+type DownloadInfo struct {
+	Viewkey    string  `json:"viewkey"`
+	Type       string  `json:"type,omitempty"`
+	Status     string  `json:"status"`
+	Downloaded int64   `json:"downloaded"`
+	Total      int64   `json:"total"`
+	Bytes      int64   `json:"bytes"`
+	Speed      float64 `json:"speed"`
+	ETA        int     `json:"eta"`
+	StartedAt  string  `json:"started_at,omitempty"`
+	Priority   string  `json:"priority,omitempty"`
+}
+
+// DownloadProgress 下载进度
+// M3U8 的 downloaded/total 为分片数，MP4 为字节数，bytes 为已下载的字节数
+type DownloadProgress struct {
+	Type         string    `json:"type,omitempty"`
+	Status       string    `json:"status"`
+	Total        int64     `json:"total"`
+	Downloaded   int64     `json:"downloaded"`
+	Bytes        int64     `json:"bytes"`
+	StartedAt    time.Time `json:"started_at,omitzero"`
+	Error        string    `json:"error,omitempty"`
+	FallbackFrom string    `json:"fallback_from,omitempty"`
+}
+
 // CacheStatusResponse 缓存状态响应
 type CacheStatusResponse struct {
-	Viewkey       string                 `json:"viewkey"`
-	IsCached      bool                   `json:"is_cached"`
-	IsDownloading bool                   `json:"is_downloading"`
-	Progress      map[string]interface{} `json:"progress,omitempty"`
+	Viewkey       string            `json:"viewkey"`
+	IsCached      bool              `json:"is_cached"`
+	IsDownloading bool              `json:"is_downloading"`
+	Progress      *DownloadProgress `json:"progress,omitempty"`
+}
+
+// VideoCheckResponse 视频预检响应
+type VideoCheckResponse struct {
+	VideoID     string `json:"video_id"`
+	Found       bool   `json:"found"`
+	URL         string `json:"url,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// CacheProgressItem 列表页中单个视频的缓存进度
+// status 为 cached、downloading、queued（等待预缓存）或 none；percent 为 0-100
+type CacheProgressItem struct {
+	Viewkey    string  `json:"viewkey"`
+	Status     string  `json:"status"`
+	Type       string  `json:"type,omitempty"`
+	Downloaded int64   `json:"downloaded,omitempty"`
+	Total      int64   `json:"total,omitempty"`
+	Percent    float64 `json:"percent"`
+	ETA        int     `json:"eta,omitempty"`
+}
+
+// CacheProgressResponse 列表页缓存进度响应
+type CacheProgressResponse struct {
+	Page        int                 `json:"page"`
+	Category    string              `json:"category,omitempty"`
+	Total       int                 `json:"total"`
+	Cached      int                 `json:"cached"`
+	Downloading int                 `json:"downloading"`
+	Videos      []CacheProgressItem `json:"videos"`
+}
+
+// CacheCoverageResponse 列表页缓存覆盖率响应
+type CacheCoverageResponse struct {
+	Page     int      `json:"page"`
+	Category string   `json:"category,omitempty"`
+	Total    int      `json:"total"`
+	Cached   int      `json:"cached"`
+	Uncached []string `json:"uncached"`
+}
+
+// ListPrefetchResponse 预取下一页列表响应
+// Status: queued 已开始后台抓取, pending 已在抓取中, cached 已有有效缓存, skipped 超出页码范围或未启用缓存
+type ListPrefetchResponse struct {
+	Page   int    `json:"page"`
+	Status string `json:"status"`
+}
+
+// SelectorResult 单个选择器的匹配结果
+type SelectorResult struct {
+	Selector string   `json:"selector"`
+	Count    int      `json:"count"`
+	Samples  []string `json:"samples,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// SelectorReport 选择器检测报告
+type SelectorReport struct {
+	ListURL   string                    `json:"list_url"`
+	DetailURL string                    `json:"detail_url,omitempty"`
+	List      map[string]SelectorResult `json:"list"`
+	Detail    map[string]SelectorResult `json:"detail,omitempty"`
+}
+
+// CircuitBreakerStatus 抓取熔断器状态
+// state 为 closed（正常）、open（熔断中）或 half_open（试探恢复）
+type CircuitBreakerStatus struct {
+	Enabled      bool   `json:"enabled"`
+	State        string `json:"state"`
+	Failures     int    `json:"failures"`
+	Threshold    int    `json:"threshold"`
+	LastError    string `json:"last_error,omitempty"`
+	LastFailure  string `json:"last_failure,omitempty"`
+	OpenUntil    string `json:"open_until,omitempty"`
+	RetryAfter   int    `json:"retry_after,omitempty"`
+	TotalTripped int    `json:"total_tripped"`
+}
+
+// ScraperStatusResponse 抓取服务状态
+type ScraperStatusResponse struct {
+	BrowserReady bool                 `json:"browser_ready"`
+	ActiveMirror string               `json:"active_mirror"`
+	Breaker      CircuitBreakerStatus `json:"breaker"`
+}
+
+// ScrapeAvailability 当前能否实时抓取
+type ScrapeAvailability struct {
+	ScrapeAvailable   bool   `json:"scrape_available"`
+	BrowserMode       string `json:"browser_mode"`
+	BrowserReady      bool   `json:"browser_ready"`
+	BrowserError      string `json:"browser_error,omitempty"`
+	CircuitState      string `json:"circuit_state"`
+	LastScrapeOKAt    string `json:"last_scrape_ok_at,omitempty"`
+	CloudflareBlocked bool   `json:"cloudflare_blocked"`
+	Maintenance       bool   `json:"maintenance"`
+}
+
+// MaintenanceRequest 切换维护模式请求，省略的字段保持不变
+type MaintenanceRequest struct {
+	Enabled *bool   `json:"enabled"`
+	Message *string `json:"message"`
+}
+
+// MaintenanceStatus 维护模式状态
+type MaintenanceStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message,omitempty"`
+	Since      string `json:"since,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// CookieProfile 一个cookies配置
+type CookieProfile struct {
+	Name      string `json:"name"`
+	Cookies   int    `json:"cookies"`
+	UpdatedAt string `json:"updated_at"`
+	Active    bool   `json:"active"`
+}
+
+// CookieProfileListResponse cookies配置列表
+type CookieProfileListResponse struct {
+	Active   string          `json:"active"`
+	Profiles []CookieProfile `json:"profiles"`
+}
+
+// CookieProfileRequest 创建或覆盖cookies配置请求，cookies 格式与 cookies.json 相同
+type CookieProfileRequest struct {
+	Cookies json.RawMessage `json:"cookies" binding:"required"`
+}
+
+// JobStatus 后台定时任务状态
+type JobStatus struct {
+	Name         string `json:"name"`
+	Interval     int    `json:"interval"`
+	Running      bool   `json:"running"`
+	Runs         int    `json:"runs"`
+	Skipped      int    `json:"skipped"`
+	LastRun      string `json:"last_run,omitempty"`
+	LastDuration int64  `json:"last_duration_ms"`
+	LastError    string `json:"last_error,omitempty"`
+	NextRun      string `json:"next_run,omitempty"`
+}
+
+// CacheTypeTotal 一种缓存类型（m3u8/mp4）的视频数和大小
+type CacheTypeTotal struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// RecentError 最近发生的错误，source 为 scrape、download 或 job
+type RecentError struct {
+	Source  string `json:"source"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message"`
+	Time    string `json:"time"`
+}
+
+// DashboardDownloads 进行中的下载任务及汇总
+type DashboardDownloads struct {
+	Active int            `json:"active"`
+	Queued int            `json:"queued"`
+	Speed  float64        `json:"speed"`
+	Items  []DownloadInfo `json:"items"`
+}
+
+// DashboardCache 数据库中维护的缓存汇总
+type DashboardCache struct {
+	Enabled   bool             `json:"enabled"`
+	Count     int              `json:"count"`
+	TotalSize int64            `json:"total_size"`
+	ByType    []CacheTypeTotal `json:"by_type"`
+}
+
+// DashboardResponse 管理面板汇总数据
+type DashboardResponse struct {
+	GeneratedAt  string               `json:"generated_at"`
+	Downloads    DashboardDownloads   `json:"downloads"`
+	Cache        DashboardCache       `json:"cache"`
+	Scraper      ScrapeAvailability   `json:"scraper"`
+	ActiveMirror string               `json:"active_mirror"`
+	Breaker      CircuitBreakerStatus `json:"breaker"`
+	Metrics      CacheMetrics         `json:"metrics"`
+	RecentErrors []RecentError        `json:"recent_errors"`
+}
+
+// CacheMetrics 启动以来的缓存命中和抓取计数
+type CacheMetrics struct {
+	StartedAt         string `json:"started_at"`
+	UptimeSeconds     int64  `json:"uptime_seconds"`
+	ListCacheHits     int64  `json:"list_cache_hits"`
+	ListCacheMisses   int64  `json:"list_cache_misses"`
+	DetailCacheHits   int64  `json:"detail_cache_hits"`
+	DetailCacheMisses int64  `json:"detail_cache_misses"`
+	SegmentRequests   int64  `json:"segment_proxy_requests"`
+	Mp4CacheHits      int64  `json:"mp4_cache_hits"`
+	ScrapeSuccesses   int64  `json:"scrape_successes"`
+	ScrapeFailures    int64  `json:"scrape_failures"`
+	CloudflareBlocks  int64  `json:"cloudflare_blocks"`
 }
 
 // PasswordRequest 密码验证请求
@@ -0,0 +1,449 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes 注册管理相关路由
+func RegisterAdminRoutes(r *gin.RouterGroup) {
+	admin := r.Group("/admin")
+	{
+		admin.GET("/selectors", dryRunSelectors)
+		admin.GET("/cache/export/:viewkey", exportCachedVideo)
+		admin.POST("/cache/import", importCachedVideo)
+		admin.GET("/cache/records", listCachedRecords)
+		admin.POST("/cache/recompute", recomputeCacheSize)
+		admin.POST("/cache/sweep-temp", sweepTempFiles)
+		admin.GET("/cache/metrics", getCacheMetrics)
+		admin.GET("/cache/verify/:viewkey", verifyCachedVideo)
+		admin.POST("/cache/repair/:viewkey", repairCachedVideo)
+		admin.GET("/precache", getPrecacheSettings)
+		admin.PUT("/precache", updatePrecacheSettings)
+		admin.GET("/scraper/status", getScraperStatus)
+		admin.POST("/scraper/restart", restartScraper)
+		admin.GET("/jobs", listJobs)
+		admin.GET("/dashboard", getDashboard)
+		admin.GET("/maintenance", getMaintenance)
+		admin.PUT("/maintenance", updateMaintenance)
+		admin.GET("/cookie-profiles", listCookieProfiles)
+		admin.PUT("/cookie-profiles/:name", saveCookieProfile)
+		admin.POST("/cookie-profiles/:name/select", selectCookieProfile)
+	}
+}
+
+// dryRunSelectors 检测选择器在列表页和详情页的匹配情况（需要管理员权限）
+func dryRunSelectors(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	scraperService := services.GetScraperService()
+	report, err := scraperService.DryRunSelectors(c.Query("list_url"), c.Query("detail_url"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "选择器检测失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// exportCachedVideo 将已缓存视频导出为tar（需要管理员权限）
+// 支持 Range/If-Range，下载工具可以多连接分段下载和断点续传
+func exportCachedVideo(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	viewkey := c.Param("viewkey")
+	cacheService := services.GetVideoCacheService()
+	archive, err := cacheService.OpenExport(viewkey)
+	if err != nil {
+		if errors.Is(err, services.ErrVideoNotCached) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "缓存不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "导出失败: " + err.Error()})
+		return
+	}
+	defer archive.Close()
+
+	// 文件名优先使用视频标题
+	filename := viewkey + ".tar"
+	if detail, err := cacheService.GetCachedDetail(viewkey); err == nil && detail.Title != "" {
+		filename = sanitizeFilename(detail.Title+" "+viewkey, ".tar")
+	}
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("ETag", archive.ETag())
+	setContentDisposition(c, "attachment", filename)
+
+	// ServeContent 处理 Range（含多段）、If-Range 和 416，返回 206/Content-Range/Accept-Ranges
+	http.ServeContent(c.Writer, c.Request, filename, archive.ModTime(), archive)
+}
+
+// importCachedVideo 从tar导入视频缓存（需要管理员权限）
+// 支持直接上传tar请求体，或 multipart 表单的 file 字段
+func importCachedVideo(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+	if config.Settings.PureProxy {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Detail: "纯代理模式下不支持导入缓存"})
+		return
+	}
+
+	var reader io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "缺少file字段"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "读取上传文件失败"})
+			return
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	viewkey, err := services.GetVideoCacheService().ImportVideo(reader)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrVideoDownloading) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Detail: "导入失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已导入视频缓存: " + viewkey, "viewkey": viewkey})
+}
+
+// getPrecacheSettings 获取当前的预缓存开关和并发数（需要管理员权限）
+func getPrecacheSettings(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetPrecacheControl().Settings())
+}
+
+// updatePrecacheSettings 运行时修改预缓存开关和并发数，无需重启（需要管理员权限）
+func updatePrecacheSettings(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	var req models.PrecacheSettingsRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+	if req.PrecacheConcurrent != nil && (*req.PrecacheConcurrent < 1 || *req.PrecacheConcurrent > 32) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "并发数需在1-32之间"})
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetPrecacheControl().Update(req))
+}
+
+// getScraperStatus 获取浏览器和抓取熔断器状态（需要管理员权限）
+func getScraperStatus(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetScraperService().Status())
+}
+
+// restartScraper 重启浏览器会话（需要管理员权限）
+func restartScraper(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	if err := services.GetScraperService().Restart(10 * time.Second); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrScraperBusy) {
+			status = http.StatusConflict
+		} else if errors.Is(err, services.ErrBrowserUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, models.ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "浏览器会话已重启"})
+}
+
+// listJobs 列出后台定时任务的上次运行、下次运行和错误（需要管理员权限）
+func listJobs(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetScheduler().Jobs())
+}
+
+// getMaintenance 获取维护模式状态（需要管理员权限）
+func getMaintenance(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetMaintenance().Status())
+}
+
+// updateMaintenance 运行时切换维护模式（需要管理员权限）
+func updateMaintenance(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	var req models.MaintenanceRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetMaintenance().Update(req))
+}
+
+// listCookieProfiles 列出cookies配置（需要管理员权限）
+func listCookieProfiles(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetScraperService().ListCookieProfiles())
+}
+
+// saveCookieProfile 创建或覆盖cookies配置（需要管理员权限）
+func saveCookieProfile(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	name := c.Param("name")
+	if !services.ValidCookieProfile(name) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: services.ErrInvalidCookieProfile.Error()})
+		return
+	}
+	var req models.CookieProfileRequest
+	if !BindJSON(c, &req) {
+		return
+	}
+
+	scraperService := services.GetScraperService()
+	if _, err := scraperService.SaveCookieProfile(name, req.Cookies); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, scraperService.ListCookieProfiles())
+}
+
+// selectCookieProfile 切换正在使用的cookies配置（需要管理员权限）
+func selectCookieProfile(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	scraperService := services.GetScraperService()
+	err := scraperService.SelectCookieProfile(c.Param("name"))
+	if errors.Is(err, services.ErrInvalidCookieProfile) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrCookieProfileNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, scraperService.ListCookieProfiles())
+}
+
+// getDashboard 汇总下载进度、缓存统计、抓取状态和最近的错误，供管理面板一次获取（需要管理员权限）
+// 只读取内存中的状态和数据库维护的汇总，不遍历缓存目录，也不访问站点
+func getDashboard(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	scraperService := services.GetScraperService()
+	status := scraperService.Status()
+
+	downloads := models.DashboardDownloads{Items: services.GetVideoCacheService().ListDownloads()}
+	for _, d := range downloads.Items {
+		if d.Status == "queued" {
+			downloads.Queued++
+			continue
+		}
+		downloads.Active++
+		downloads.Speed += d.Speed
+	}
+
+	cacheDB := services.GetCacheDBService()
+	cache := models.DashboardCache{
+		Enabled:   config.Settings.VideoCacheEnabled,
+		TotalSize: cacheDB.GetTotalSize(),
+		ByType:    []models.CacheTypeTotal{},
+	}
+	if byType, err := cacheDB.GetTotalsByType(); err == nil {
+		cache.ByType = byType
+		for _, total := range byType {
+			cache.Count += total.Count
+		}
+	}
+
+	c.JSON(http.StatusOK, models.DashboardResponse{
+		GeneratedAt:  time.Now().Format(time.RFC3339),
+		Downloads:    downloads,
+		Cache:        cache,
+		Scraper:      scraperService.Availability(),
+		ActiveMirror: status.ActiveMirror,
+		Breaker:      status.Breaker,
+		Metrics:      services.GetMetrics().Snapshot(),
+		RecentErrors: services.RecentErrors(),
+	})
+}
+
+// getCacheMetrics 获取启动以来的缓存命中和抓取计数（需要管理员权限）
+func getCacheMetrics(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetMetrics().Snapshot())
+}
+
+// listCachedRecords 分页列出缓存视频的完整记录，missing_title=true 时只返回缺少标题的记录（需要管理员权限）
+func listCachedRecords(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	page := 1
+	pageSize := 100
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.Atoi(p); err == nil && v > 0 {
+			page = v
+		}
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		if v, err := strconv.Atoi(ps); err == nil && v > 0 && v <= 500 {
+			pageSize = v
+		}
+	}
+
+	records, total, err := services.GetCacheDBService().ListCachedRecords(page, pageSize, c.Query("missing_title") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "查询缓存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, models.CachedRecordListResponse{
+		Records:  records,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// recomputeCacheSize 立即按磁盘重新计算缓存大小并校正数据库（需要管理员权限）
+func recomputeCacheSize(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	result, err := services.GetCacheDBService().Reconcile(services.GetVideoCacheService())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "重新计算失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// sweepTempFiles 立即清理遗留的MP4临时文件和过期的未完成M3U8缓存目录（需要管理员权限）
+func sweepTempFiles(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	maxAge := config.Settings.Mp4TempMaxAge
+	if v := c.Query("max_age"); v != "" {
+		age, err := strconv.Atoi(v)
+		if err != nil || age < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的 max_age"})
+			return
+		}
+		maxAge = age
+	}
+
+	cacheService := services.GetVideoCacheService()
+	result, err := cacheService.SweepMp4Temp(time.Duration(maxAge) * time.Second)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "清理临时文件失败: " + err.Error()})
+		return
+	}
+	if partialAge := config.Settings.HlsPartialMaxAge; partialAge > 0 {
+		partial, err := cacheService.SweepPartialM3u8(time.Duration(partialAge) * time.Second)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "清理未完成的M3U8缓存失败: " + err.Error()})
+			return
+		}
+		result.RemovedDirs = partial.RemovedDirs
+		result.FreedBytes += partial.FreedBytes
+		result.FreedMB = float64(result.FreedBytes) / (1024 * 1024)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// verifyCachedVideo 校验视频缓存是否完整，返回缺失的分片（需要管理员权限）
+func verifyCachedVideo(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	result, err := services.GetVideoCacheService().CheckIntegrity(c.Param("viewkey"))
+	if err != nil {
+		writeIntegrityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// repairCachedVideo 校验视频缓存，不完整时标记为待重新下载（需要管理员权限）
+func repairCachedVideo(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	result, err := services.GetVideoCacheService().RepairCache(c.Param("viewkey"))
+	if err != nil {
+		writeIntegrityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// writeIntegrityError 将缓存校验错误转换为响应
+func writeIntegrityError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrVideoNotCached):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrVideoDownloading):
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.ErrorResponse{Detail: "缓存校验失败: " + err.Error()})
+}
@@ -0,0 +1,194 @@
+package routers
+
+import (
+	"archive/tar"
+	"backend-go/config"
+	"backend-go/services"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupExport 在缓存目录写入一个已缓存的MP4视频，返回导出接口的路由
+func setupExport(t *testing.T, viewkey string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	saved := *config.Settings
+	t.Cleanup(func() { *config.Settings = saved })
+	config.Settings.AdminPassword = "secret"
+
+	dir := services.CacheNamespaceDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	video := bytes.Repeat([]byte("0123456789abcdef"), 400)
+	files := map[string][]byte{
+		viewkey + ".mp4":         video,
+		viewkey + ".detail.json": []byte(`{"id":"` + viewkey + `","title":"导出测试"}`),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(path) })
+	}
+
+	r := gin.New()
+	r.GET("/export/:viewkey", exportCachedVideo)
+	return r
+}
+
+func doExport(r *gin.Engine, viewkey string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/export/"+viewkey, nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExportOverlappingRanges(t *testing.T) {
+	const viewkey = "exportrange1"
+	r := setupExport(t, viewkey)
+
+	full := doExport(r, viewkey, nil)
+	if full.Code != http.StatusOK {
+		t.Fatalf("完整下载状态码 = %d", full.Code)
+	}
+	if full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("缺少 Accept-Ranges: %v", full.Header())
+	}
+	whole := full.Body.Bytes()
+	size := len(whole)
+
+	// 导出的内容是有效的tar，包含视频和详情
+	names := map[string]int64{}
+	tr := tar.NewReader(bytes.NewReader(whole))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("读取tar失败: %v", err)
+		}
+		names[header.Name] = header.Size
+	}
+	if names[viewkey+".mp4"] != 6400 || names[viewkey+".detail.json"] == 0 {
+		t.Fatalf("tar内容不正确: %v", names)
+	}
+
+	// 多个连接并发请求相互重叠的分段，拼接后与完整下载一致
+	ranges := [][2]int{{0, 1999}, {1500, 4999}, {4096, 6999}, {6500, size - 1}}
+	chunks := make([][]byte, len(ranges))
+	var wg sync.WaitGroup
+	for i, rng := range ranges {
+		wg.Add(1)
+		go func(i int, start, end int) {
+			defer wg.Done()
+			w := doExport(r, viewkey, map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, end)})
+			if w.Code != http.StatusPartialContent {
+				t.Errorf("分段 %d-%d 状态码 = %d", start, end, w.Code)
+				return
+			}
+			if got, want := w.Header().Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", start, end, size); got != want {
+				t.Errorf("Content-Range = %q, want %q", got, want)
+			}
+			chunks[i] = w.Body.Bytes()
+		}(i, rng[0], rng[1])
+	}
+	wg.Wait()
+
+	for i, rng := range ranges {
+		if !bytes.Equal(chunks[i], whole[rng[0]:rng[1]+1]) {
+			t.Fatalf("分段 %d-%d 内容与完整下载不一致", rng[0], rng[1])
+		}
+	}
+	var assembled []byte
+	for i, rng := range ranges {
+		start := rng[0]
+		if len(assembled) > start {
+			chunks[i] = chunks[i][len(assembled)-start:]
+		}
+		assembled = append(assembled, chunks[i]...)
+	}
+	if !bytes.Equal(assembled, whole) {
+		t.Fatal("拼接的分段与完整下载不一致")
+	}
+}
+
+func TestExportMultiRange(t *testing.T) {
+	const viewkey = "exportrange2"
+	r := setupExport(t, viewkey)
+	whole := doExport(r, viewkey, nil).Body.Bytes()
+
+	w := doExport(r, viewkey, map[string]string{"Range": "bytes=0-99,50-149,1000-1023"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("多段请求状态码 = %d", w.Code)
+	}
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+
+	want := [][2]int{{0, 99}, {50, 149}, {1000, 1023}}
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if i != len(want) {
+				t.Fatalf("分段数 = %d, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		start, end := want[i][0], want[i][1]
+		if got := part.Header.Get("Content-Range"); !strings.HasPrefix(got, fmt.Sprintf("bytes %d-%d/", start, end)) {
+			t.Fatalf("第 %d 段 Content-Range = %q", i, got)
+		}
+		if !bytes.Equal(body, whole[start:end+1]) {
+			t.Fatalf("第 %d 段内容不一致", i)
+		}
+	}
+}
+
+func TestExportIfRangeAndUnsatisfiable(t *testing.T) {
+	const viewkey = "exportrange3"
+	r := setupExport(t, viewkey)
+	full := doExport(r, viewkey, nil)
+	etag := full.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("缺少 ETag")
+	}
+
+	// If-Range 与当前 ETag 一致时续传，不一致时返回完整内容
+	if w := doExport(r, viewkey, map[string]string{"Range": "bytes=100-", "If-Range": etag}); w.Code != http.StatusPartialContent {
+		t.Fatalf("If-Range 匹配时状态码 = %d", w.Code)
+	}
+	if w := doExport(r, viewkey, map[string]string{"Range": "bytes=100-", "If-Range": `"stale"`}); w.Code != http.StatusOK || w.Body.Len() != full.Body.Len() {
+		t.Fatalf("If-Range 不匹配时状态码 = %d, 长度 = %d", w.Code, w.Body.Len())
+	}
+
+	w := doExport(r, viewkey, map[string]string{"Range": fmt.Sprintf("bytes=%d-", full.Body.Len()+10)})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("超出范围的请求状态码 = %d", w.Code)
+	}
+}
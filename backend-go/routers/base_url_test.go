@@ -0,0 +1,63 @@
+package routers
+
+import (
+	"backend-go/config"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestBaseURLTrustsForwardedHeadersOnlyFromProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.TrustedProxies = []string{"10.0.0.0/8", "127.0.0.1"}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		host       string
+		want       string
+	}{
+		{"trusted cidr", "10.1.2.3:4000", "https", "video.example.com", "https://video.example.com"},
+		{"trusted ip", "127.0.0.1:4000", "HTTPS", "", "https://backend:8000"},
+		{"untrusted", "203.0.113.9:4000", "https", "evil.example.com", "http://backend:8000"},
+		{"bad scheme", "10.1.2.3:4000", "javascript", "video.example.com", "http://video.example.com"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "http://backend:8000/api/stream/abc", nil)
+			c.Request.RemoteAddr = tc.remoteAddr
+			if tc.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			if tc.host != "" {
+				c.Request.Header.Set("X-Forwarded-Host", tc.host)
+			}
+			if got := requestBaseURL(c); got != tc.want {
+				t.Fatalf("requestBaseURL = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProxyBaseURLDefaultsToConfiguredAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "http://backend:8000/api/stream/abc", nil)
+
+	config.Settings.ProxyBaseURL = "http://localhost:8000/"
+	if got := proxyBaseURL(c); got != "http://localhost:8000" {
+		t.Fatalf("proxyBaseURL = %q", got)
+	}
+	config.Settings.ProxyBaseURL = proxyBaseURLAuto
+	if got := proxyBaseURL(c); got != "http://backend:8000" {
+		t.Fatalf("auto proxyBaseURL = %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"backend-go/config"
 	"backend-go/models"
 	"backend-go/services"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -15,6 +16,9 @@ func RegisterCacheRoutes(r *gin.RouterGroup) {
 	cache := r.Group("/cache")
 	{
 		cache.GET("", listCachedVideos)
+		cache.GET("/stats", getCacheStats)
+		cache.GET("/downloading", listDownloads)
+		cache.GET("/progress", getCacheProgress)
 		cache.GET("/:viewkey", getCacheStatus)
 		cache.DELETE("/:viewkey", deleteCachedVideo)
 		cache.DELETE("", clearAllCache)
@@ -64,7 +68,8 @@ func listCachedVideos(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.CacheListResponse{
 		Enabled:     config.Settings.VideoCacheEnabled,
-		CacheDir:    config.Settings.VideoCacheDir,
+		CacheDir:    services.CacheNamespaceDir(),
+		Namespace:   services.CacheNamespace(),
 		TotalSize:   totalSize,
 		TotalSizeMB: float64(totalSize) / (1024 * 1024),
 		Videos:      videos,
@@ -75,6 +80,29 @@ func listCachedVideos(c *gin.Context) {
 	})
 }
 
+// getCacheStats 获取缓存统计和预缓存预算使用情况
+func getCacheStats(c *gin.Context) {
+	cacheDB := services.GetCacheDBService()
+	totalSize := cacheDB.GetTotalSize()
+
+	c.JSON(http.StatusOK, models.CacheStatsResponse{
+		TotalSize:   totalSize,
+		TotalSizeMB: float64(totalSize) / (1024 * 1024),
+		Count:       cacheDB.GetTotalCount(),
+		Precache:    services.GetPrecacheBudget().Stats(),
+	})
+}
+
+// listDownloads 列出所有进行中的下载任务（需要管理员权限）
+func listDownloads(c *gin.Context) {
+	if !verifyAdmin(c) {
+		return
+	}
+
+	downloads := services.GetVideoCacheService().ListDownloads()
+	c.JSON(http.StatusOK, gin.H{"downloads": downloads, "total": len(downloads)})
+}
+
 // getCacheStatus 获取指定视频的缓存状态
 func getCacheStatus(c *gin.Context) {
 	viewkey := c.Param("viewkey")
@@ -82,14 +110,90 @@ func getCacheStatus(c *gin.Context) {
 
 	isCached := cacheService.IsCached(viewkey)
 	isDownloading := cacheService.IsDownloading(viewkey)
-	progress := cacheService.GetDownloadProgress(viewkey)
 
-	c.JSON(http.StatusOK, models.CacheStatusResponse{
+	response := models.CacheStatusResponse{
 		Viewkey:       viewkey,
 		IsCached:      isCached,
 		IsDownloading: isDownloading,
-		Progress:      progress,
-	})
+	}
+	if progress, ok := cacheService.GetDownloadProgress(viewkey); ok {
+		response.Progress = &progress
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getCacheProgress 一次返回列表页中所有视频的缓存状态和下载进度
+// 只读取已缓存的列表、下载进度和数据库，不触发抓取；非默认分类读取内存中按页保存的分类列表缓存
+func getCacheProgress(c *gin.Context) {
+	page := 1
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.Atoi(p); err == nil && v > 0 {
+			page = v
+		}
+	}
+
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+
+	videos, ok := cachedListVideos(page, category)
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "该页列表未缓存"})
+		return
+	}
+
+	cacheService := services.GetVideoCacheService()
+	cacheDB := services.GetCacheDBService()
+	response := models.CacheProgressResponse{
+		Page:     page,
+		Category: category,
+		Total:    len(videos),
+		Videos:   make([]models.CacheProgressItem, 0, len(videos)),
+	}
+	for _, video := range videos {
+		item := models.CacheProgressItem{Viewkey: video.ID, Status: "none"}
+		if info, downloading := cacheService.GetDownloadInfo(video.ID); downloading && info.Status == "queued" {
+			// 等待下载槽位
+			item.Status = "queued"
+		} else if downloading {
+			item.Status = "downloading"
+			item.Type = info.Type
+			item.Downloaded = info.Downloaded
+			item.Total = info.Total
+			if info.ETA > 0 {
+				item.ETA = info.ETA
+			}
+			if info.Total > 0 {
+				item.Percent = math.Round(float64(info.Downloaded)*1000/float64(info.Total)) / 10
+			}
+			response.Downloading++
+		} else if cacheDB.IsCached(video.ID) {
+			item.Status = "cached"
+			item.Percent = 100
+			response.Cached++
+		} else if isPrecacheQueued(video.ID) {
+			item.Status = "queued"
+		}
+		response.Videos = append(response.Videos, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// cachedListVideos 获取已缓存的列表页视频，不触发抓取
+func cachedListVideos(page int, category string) ([]models.VideoItem, bool) {
+	if _, isDefault := listPathForCategory(category); !isDefault {
+		entry, ok := getCategoryListCache(category, "", page)
+		return entry.Videos, ok
+	}
+
+	cached, err := services.GetVideoCacheService().GetCachedList(page, 0)
+	if err != nil || cached == nil {
+		return nil, false
+	}
+	return parseVideosFromCache(cached), true
 }
 
 // deleteCachedVideo 删除指定视频的缓存（需要管理员权限）
@@ -0,0 +1,95 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCacheProgressReadsCategoryPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoListCacheTTL = 300
+	defer clearCategoryListCache()
+
+	saveCategoryListCache("progresscat", "", 3, &services.VideoListResult{
+		Videos:     []models.VideoItem{{ID: "catvideo1"}, {ID: "catvideo2"}},
+		TotalPages: 5,
+	})
+
+	r := gin.New()
+	r.GET("/progress", getCacheProgress)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress?page=3&category=progresscat", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.CacheProgressResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Page != 3 || resp.Category != "progresscat" || resp.Total != 2 || resp.Videos[0].Viewkey != "catvideo1" {
+		t.Fatalf("响应不正确: %+v", resp)
+	}
+
+	// 其他页和其他分类没有缓存
+	for _, query := range []string{"page=2&category=progresscat", "page=3&category=othercat"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress?"+query, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: 状态码 = %d, want 404", query, w.Code)
+		}
+	}
+
+	// 删除该页后不再返回
+	if deleteCategoryListCache("progresscat", 3) != 1 {
+		t.Fatal("删除分类列表缓存失败")
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress?page=3&category=progresscat", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("删除后状态码 = %d, want 404", w.Code)
+	}
+}
+
+func TestListCoverageHonoursCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoListCacheTTL = 300
+	defer clearCategoryListCache()
+
+	saveCategoryListCache("coveragecat", "", 1, &services.VideoListResult{
+		Videos: []models.VideoItem{{ID: "coverage1"}, {ID: "coverage2"}, {ID: "coverage3"}},
+	})
+
+	r := gin.New()
+	r.GET("/coverage", getListCoverage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/coverage?page=1&category=coveragecat", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.CacheCoverageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Category != "coveragecat" || resp.Total != 3 || resp.Cached != 0 || len(resp.Uncached) != 3 {
+		t.Fatalf("响应不正确: %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/coverage?page=1&category=bad-cat!", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("无效分类状态码 = %d, want 400", w.Code)
+	}
+}
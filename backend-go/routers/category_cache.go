@@ -0,0 +1,85 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"sync"
+	"time"
+)
+
+// categoryListCache 非默认分类或指定了布局配置（?profile=）的列表缓存，按分类、布局配置和页码保存在内存中
+// 默认分类自动选择布局配置时使用列表文件缓存
+var categoryListCache = struct {
+	sync.Mutex
+	data map[categoryPageKey]categoryListEntry
+}{data: make(map[categoryPageKey]categoryListEntry)}
+
+// categoryPageKey 分类列表缓存的键
+type categoryPageKey struct {
+	Category string
+	// Profile 请求指定的布局配置，空为自动选择
+	Profile string
+	Page    int
+}
+
+// categoryListEntry 分类列表缓存项，过期后仍保留，用于抓取失败时兜底
+type categoryListEntry struct {
+	Videos     []models.VideoItem
+	TotalPages int
+	ExpiresAt  time.Time
+}
+
+// getCategoryListCache 获取分类某一页按指定布局配置提取的缓存（可能已过期）
+func getCategoryListCache(category, profile string, page int) (categoryListEntry, bool) {
+	categoryListCache.Lock()
+	defer categoryListCache.Unlock()
+	entry, ok := categoryListCache.data[categoryPageKey{category, profile, page}]
+	return entry, ok
+}
+
+// saveCategoryListCache 按 VIDEO_LIST_CACHE_TTL 缓存分类某一页的抓取结果，TTL 为0或没有视频时不缓存
+// 保存时顺带清理过期超过一个 TTL 的缓存项，避免浏览过的分类页一直占用内存
+func saveCategoryListCache(category, profile string, page int, result *services.VideoListResult) {
+	ttl := time.Duration(config.Settings.VideoListCacheTTL) * time.Second
+	if ttl <= 0 || result == nil || len(result.Videos) == 0 {
+		return
+	}
+
+	now := time.Now()
+	categoryListCache.Lock()
+	defer categoryListCache.Unlock()
+	for key, entry := range categoryListCache.data {
+		if now.Sub(entry.ExpiresAt) > ttl {
+			delete(categoryListCache.data, key)
+		}
+	}
+	categoryListCache.data[categoryPageKey{category, profile, page}] = categoryListEntry{
+		Videos:     result.Videos,
+		TotalPages: result.TotalPages,
+		ExpiresAt:  now.Add(ttl),
+	}
+}
+
+// deleteCategoryListCache 删除分类某一页所有布局配置的缓存，返回删除的缓存项数
+func deleteCategoryListCache(category string, page int) int {
+	categoryListCache.Lock()
+	defer categoryListCache.Unlock()
+	removed := 0
+	for key := range categoryListCache.data {
+		if key.Category == category && key.Page == page {
+			delete(categoryListCache.data, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// clearCategoryListCache 删除所有分类的列表缓存，返回删除的数量
+func clearCategoryListCache() int {
+	categoryListCache.Lock()
+	defer categoryListCache.Unlock()
+	removed := len(categoryListCache.data)
+	categoryListCache.data = make(map[categoryPageKey]categoryListEntry)
+	return removed
+}
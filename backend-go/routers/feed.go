@@ -0,0 +1,177 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var categoryPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// rssFeed RSS 2.0 文档
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel RSS 频道
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssItem RSS 条目
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Description string        `xml:"description,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+// rssGUID 条目唯一标识
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// rssEnclosure 条目附件（封面图）
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+// getVideoFeed 以 RSS 2.0 格式返回视频列表第一页
+// category 为空或与 VIDEO_LIST_PATH 中的分类相同时复用列表缓存，其他分类按列表缓存时间缓存在内存中
+func getVideoFeed(c *gin.Context) {
+	if rejectCookieProfile(c) {
+		return
+	}
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+	profile := c.Query("profile")
+	if !services.ValidListProfile(profile) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "未知的布局配置"})
+		return
+	}
+
+	listPath, isDefault := listPathForCategory(category)
+	var videos []models.VideoItem
+	if isDefault {
+		response, _, err := loadVideoList(1, "", profile, false)
+		if writeScrapeError(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取视频列表失败: " + err.Error()})
+			return
+		}
+		videos = response.Videos
+	} else {
+		var err error
+		videos, err = loadCategoryList(category, listPath, profile)
+		if writeScrapeError(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取视频列表失败: " + err.Error()})
+			return
+		}
+	}
+
+	base := proxyBaseURL(c)
+	title := "NOProxy"
+	if category != "" {
+		title += " - " + category
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          base + "/",
+			Description:   "视频列表订阅",
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, video := range videos {
+		item := rssItem{
+			Title: video.Title,
+			Link:  fmt.Sprintf("%s/play/%s", base, url.PathEscape(video.ID)),
+			GUID:  rssGUID{Value: video.ID},
+		}
+		if video.Duration != "" {
+			item.Description = "时长: " + video.Duration
+		}
+		// 订阅阅读器不带会话 cookie，封面图签名不绑定会话
+		if thumbnail := thumbnailProxyPath(video.ID, video.Thumbnail, ""); thumbnail != "" {
+			item.Enclosure = &rssEnclosure{
+				URL:  base + thumbnail,
+				Type: "image/jpeg",
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "生成订阅失败"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// listPathForCategory 将 VIDEO_LIST_PATH 中的 category 参数替换为指定分类
+// 分类为空或与配置相同时返回配置的路径和true
+func listPathForCategory(category string) (string, bool) {
+	listPath := config.Settings.VideoListPath
+	u, err := url.Parse(listPath)
+	if err != nil || category == "" {
+		return listPath, true
+	}
+
+	query := u.Query()
+	if query.Get("category") == category {
+		return listPath, true
+	}
+	query.Set("category", category)
+	u.RawQuery = query.Encode()
+	return u.String(), false
+}
+
+// loadCategoryList 获取非默认分类的第一页视频，结果按 VIDEO_LIST_CACHE_TTL 缓存
+func loadCategoryList(category, listPath, profile string) ([]models.VideoItem, error) {
+	entry, ok := getCategoryListCache(category, profile, 1)
+	if ok && time.Now().Before(entry.ExpiresAt) {
+		return entry.Videos, nil
+	}
+
+	result, err := services.GetScraperService().GetVideoListFromPath(1, profile, listPath)
+	if err != nil {
+		// 抓取失败时使用过期缓存兜底
+		if ok {
+			return entry.Videos, nil
+		}
+		return nil, err
+	}
+
+	saveCategoryListCache(category, profile, 1, result)
+	return result.Videos, nil
+}
@@ -0,0 +1,85 @@
+package routers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFilenameBytes 文件名（含扩展名）的最大字节数，常见文件系统限制为255字节
+const maxFilenameBytes = 180
+
+// sanitizeFilename 将视频标题转换为安全的文件名
+// 替换路径分隔符、Windows 保留字符和控制字符，去掉首尾的点和空格（避免 ".." 等），
+// 按UTF-8字符边界截断长度，保留中文、emoji 等可读字符，并补上扩展名 ext（如 ".mp4"）
+func sanitizeFilename(name, ext string) string {
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError:
+			continue
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			r = '_'
+		case unicode.IsControl(r) || unicode.IsSpace(r):
+			if lastSpace {
+				continue
+			}
+			r = ' '
+		}
+		lastSpace = r == ' '
+		b.WriteRune(r)
+	}
+
+	result := strings.Trim(b.String(), " .")
+	if ext != "" && strings.HasSuffix(strings.ToLower(result), strings.ToLower(ext)) {
+		result = strings.TrimRight(result[:len(result)-len(ext)], " .")
+	}
+
+	// 按字节截断，不切断多字节字符
+	limit := maxFilenameBytes - len(ext)
+	if len(result) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(result[cut]) {
+			cut--
+		}
+		result = strings.TrimRight(result[:cut], " .")
+	}
+
+	if result == "" {
+		result = "video"
+	}
+	return result + ext
+}
+
+// setContentDisposition 设置 Content-Disposition 头，disposition 为 attachment 或 inline
+// filename 提供ASCII兜底名称，filename* 按 RFC 5987 携带UTF-8原名
+func setContentDisposition(c *gin.Context, disposition, filename string) {
+	fallback := make([]rune, 0, len(filename))
+	for _, r := range filename {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' || unicode.IsControl(r) {
+			r = '_'
+		}
+		fallback = append(fallback, r)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`,
+		disposition, string(fallback), encodeRFC5987(filename)))
+}
+
+// encodeRFC5987 按 RFC 5987 的 attr-char 规则百分号编码
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch < utf8.RuneSelf && (unicode.IsLetter(rune(ch)) || unicode.IsDigit(rune(ch)) || strings.IndexByte("!#$&+-.^_`|~", ch) >= 0) {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package routers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		ext   string
+		want  string
+	}{
+		{"路径分隔符", `a/b\c`, ".mp4", "a_b_c.mp4"},
+		{"上级目录", "../../etc/passwd", ".mp4", "_.._etc_passwd.mp4"},
+		{"只有点", "..", ".mp4", "video.mp4"},
+		{"保留字符", `标题:"好"?<>|*`, ".tar", "标题__好______.tar"},
+		{"控制字符和连续空白", "a\tb\n\n  c\x00", ".mp4", "a b c.mp4"},
+		{"中文", "测试视频 第1集", ".mp4", "测试视频 第1集.mp4"},
+		{"emoji", "🎬 电影之夜", ".mp4", "🎬 电影之夜.mp4"},
+		{"已有扩展名", "clip.MP4", ".mp4", "clip.mp4"},
+		{"空标题", "   ", ".tar", "video.tar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFilename(tt.title, tt.ext); got != tt.want {
+				t.Fatalf("sanitizeFilename(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncatesLongTitles(t *testing.T) {
+	for _, title := range []string{
+		strings.Repeat("中", 200),
+		strings.Repeat("a", 500),
+		strings.Repeat("🎬", 100),
+	} {
+		got := sanitizeFilename(title, ".mp4")
+		if len(got) > maxFilenameBytes {
+			t.Fatalf("文件名长度 %d 超过 %d", len(got), maxFilenameBytes)
+		}
+		if !utf8.ValidString(got) {
+			t.Fatalf("截断切断了多字节字符: %q", got)
+		}
+		if !strings.HasSuffix(got, ".mp4") {
+			t.Fatalf("缺少扩展名: %q", got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package routers
+
+import (
+	"backend-go/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetImageRejectsUnsafeHosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+	defer upstream.Close()
+
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ThumbnailHostCheck = true
+	config.Settings.ThumbnailFallback = false
+
+	cases := []struct {
+		name         string
+		allowedHosts []string
+		imageURL     string
+	}{
+		{"internal ip", nil, upstream.URL + "/a.jpg"},
+		{"metadata ip", nil, "http://169.254.169.254/latest/meta-data"},
+		{"localhost", nil, "http://localhost/a.jpg"},
+		{"disallowed host", []string{"example.com"}, "http://evil.invalid/a.jpg"},
+		{"non-http scheme", nil, "file:///etc/passwd"},
+	}
+
+	r := gin.New()
+	r.GET("/image/:video_id", getImage)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Settings.ProxyAllowedHosts = tc.allowedHosts
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/image/abc123?url="+url.QueryEscape(tc.imageURL), nil))
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("上游被请求了 %d 次", hits.Load())
+	}
+}
@@ -0,0 +1,94 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"sync"
+	"time"
+)
+
+const (
+	// 浏览会话在该时间内没有请求时丢弃其记录
+	listDedupeSessionTTL = 30 * time.Minute
+	// 同时记录的浏览会话上限
+	listDedupeMaxSessions = 1000
+)
+
+// listDedupeSession 一个浏览会话已返回过的视频，按返回顺序保留最近 LIST_DEDUPE_WINDOW 个
+type listDedupeSession struct {
+	order    []string
+	pages    map[string]int
+	lastUsed time.Time
+}
+
+// 各浏览会话（session 参数 + 分类 + 布局配置）已返回过的视频
+var listDedupeSessions = struct {
+	sync.Mutex
+	data map[string]*listDedupeSession
+}{data: make(map[string]*listDedupeSession)}
+
+// dedupeListPage 去掉同一浏览会话中已在其他页返回过的视频，保持原有顺序
+// 同一页重复请求返回相同的结果；未启用 LIST_DEDUPE_WINDOW 或没有 session 参数时原样返回
+// 不同分类的页码各自独立，同一会话浏览多个分类时分别去重
+func dedupeListPage(session, category, profile string, page int, videos []models.VideoItem) []models.VideoItem {
+	window := config.Settings.ListDedupeWindow
+	if window <= 0 || session == "" {
+		return videos
+	}
+	key := category + "|" + profile + "|" + session
+
+	listDedupeSessions.Lock()
+	defer listDedupeSessions.Unlock()
+
+	entry, ok := listDedupeSessions.data[key]
+	if !ok {
+		pruneListDedupeSessions()
+		entry = &listDedupeSession{pages: make(map[string]int)}
+		listDedupeSessions.data[key] = entry
+	}
+	entry.lastUsed = time.Now()
+
+	result := make([]models.VideoItem, 0, len(videos))
+	for _, video := range videos {
+		if servedPage, seen := entry.pages[video.ID]; seen {
+			if servedPage != page {
+				continue
+			}
+		} else {
+			entry.pages[video.ID] = page
+			entry.order = append(entry.order, video.ID)
+		}
+		result = append(result, video)
+	}
+
+	// 超出窗口时遗忘最早返回的视频
+	if excess := len(entry.order) - window; excess > 0 {
+		for _, id := range entry.order[:excess] {
+			delete(entry.pages, id)
+		}
+		entry.order = append([]string(nil), entry.order[excess:]...)
+	}
+	return result
+}
+
+// pruneListDedupeSessions 删除过期的会话，仍达到上限时删除最久未使用的会话（调用方持有锁）
+func pruneListDedupeSessions() {
+	if len(listDedupeSessions.data) < listDedupeMaxSessions {
+		return
+	}
+
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range listDedupeSessions.data {
+		if time.Since(entry.lastUsed) > listDedupeSessionTTL {
+			delete(listDedupeSessions.data, key)
+			continue
+		}
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, entry.lastUsed
+		}
+	}
+	if len(listDedupeSessions.data) >= listDedupeMaxSessions {
+		delete(listDedupeSessions.data, oldestKey)
+	}
+}
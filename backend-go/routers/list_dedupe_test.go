@@ -0,0 +1,26 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"testing"
+)
+
+func TestDedupeListPageSeparatesCategories(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ListDedupeWindow = 100
+
+	videos := []models.VideoItem{{ID: "dedupe1"}, {ID: "dedupe2"}}
+	if got := dedupeListPage("sess-cat", "", "", 1, videos); len(got) != 2 {
+		t.Fatalf("默认分类第1页 = %d 个视频", len(got))
+	}
+	// 其他分类的第2页出现同样的视频时不应被当作已返回过
+	if got := dedupeListPage("sess-cat", "hot", "", 2, videos); len(got) != 2 {
+		t.Fatalf("其他分类第2页 = %d 个视频, want 2", len(got))
+	}
+	// 同一分类的其他页仍然去重
+	if got := dedupeListPage("sess-cat", "", "", 2, videos); len(got) != 0 {
+		t.Fatalf("默认分类第2页 = %d 个视频, want 0", len(got))
+	}
+}
@@ -0,0 +1,96 @@
+package routers
+
+import (
+	"backend-go/models"
+	"backend-go/services"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodyBytes 限制请求体大小，超出时返回413
+// GET/HEAD/OPTIONS 请求和 exempt 中的路由（如大文件上传）不受限制
+func MaxBodyBytes(limit int64, exempt ...string) gin.HandlerFunc {
+	exemptSet := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptSet[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if limit <= 0 || exemptSet[c.FullPath()] {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		// 声明了长度的请求直接拒绝，分块传输的请求在读取时限制
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{Detail: "请求体过大"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// StreamWriteDeadline 为路由以 prefixes 开头的请求（视频流、文件导出等长时间响应）重新设置写超时，
+// 替代服务器的 HTTP_WRITE_TIMEOUT；timeout 为0时不限制
+func StreamWriteDeadline(timeout time.Duration, prefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(path, prefix) {
+				continue
+			}
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+				log.Printf("设置写超时失败: %v", err)
+			}
+			break
+		}
+		c.Next()
+	}
+}
+
+// ValidatePathParams 校验路由中的 viewkey、video_id 和 segment_name 参数，不合法时返回400
+// 这些参数会用于拼接缓存文件路径，需拒绝 "../" 等路径穿越
+func ValidatePathParams() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range []string{"viewkey", "video_id"} {
+			if value, ok := c.Params.Get(name); ok && !services.ValidViewkey(value) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的视频ID"})
+				return
+			}
+		}
+		if value, ok := c.Params.Get("segment_name"); ok && !services.ValidSegmentName(value) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分片名"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// BindJSON 解析JSON请求体，失败时写入错误响应并返回false
+func BindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{Detail: "请求体过大"})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "请求格式错误"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/services"
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 浏览器初始化失败时的重试间隔和次数
+	preloadInitRetryInterval = 30 * time.Second
+	preloadInitRetries       = 10
+	// 检查下载是否完成的间隔
+	preloadPollInterval = 2 * time.Second
+)
+
+// preloadViewkeys 合并 PRELOAD_VIEWKEYS 和 PRELOAD_FILE 中的视频，去重并保持顺序
+// 文件每行一个 viewkey，忽略空行和 # 开头的注释；不合法的 viewkey 记录日志后跳过，不会用于缓存路径
+func preloadViewkeys() []string {
+	cfg := config.Settings
+	viewkeys := append([]string(nil), cfg.PreloadViewkeys...)
+
+	if cfg.PreloadFile != "" {
+		file, err := os.Open(cfg.PreloadFile)
+		if err != nil {
+			log.Printf("[预热] 读取预热列表失败: %v", err)
+		} else {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line != "" && !strings.HasPrefix(line, "#") {
+					viewkeys = append(viewkeys, line)
+				}
+			}
+			file.Close()
+		}
+	}
+
+	seen := make(map[string]bool, len(viewkeys))
+	result := make([]string, 0, len(viewkeys))
+	for _, viewkey := range viewkeys {
+		viewkey = strings.TrimSpace(viewkey)
+		if viewkey == "" || seen[viewkey] {
+			continue
+		}
+		if !services.ValidViewkey(viewkey) {
+			log.Printf("[预热] 跳过无效的 viewkey: %q", viewkey)
+			continue
+		}
+		seen[viewkey] = true
+		result = append(result, viewkey)
+	}
+	return result
+}
+
+// StartPreload 启动时在后台预缓存 PRELOAD_VIEWKEYS / PRELOAD_FILE 中的视频
+// 等待浏览器可用后按 PRECACHE_CONCURRENT 并发下载，跳过已缓存的视频
+func StartPreload() {
+	viewkeys := preloadViewkeys()
+	if len(viewkeys) == 0 {
+		return
+	}
+	go preloadVideos(viewkeys)
+}
+
+// preloadVideos 依次预缓存视频，每个并发槽位等到下载结束才处理下一个
+func preloadVideos(viewkeys []string) {
+	cacheService := services.GetVideoCacheService()
+
+	pending := make([]string, 0, len(viewkeys))
+	for _, viewkey := range viewkeys {
+		if !cacheService.IsCached(viewkey) {
+			pending = append(pending, viewkey)
+		}
+	}
+	log.Printf("[预热] 预热列表共 %d 个视频，已缓存 %d 个，待缓存 %d 个", len(viewkeys), len(viewkeys)-len(pending), len(pending))
+	if len(pending) == 0 {
+		log.Println("[预热] 预热列表已全部缓存")
+		return
+	}
+
+	if !waitScraperReady() {
+		log.Println("[预热] 浏览器初始化失败，放弃预热")
+		return
+	}
+
+	control := services.GetPrecacheControl()
+	var done int32
+	var wg sync.WaitGroup
+	for _, viewkey := range pending {
+		wg.Add(1)
+		go func(viewkey string) {
+			defer wg.Done()
+			control.Acquire()
+			defer control.Release()
+
+			precacheVideo(viewkey, services.PriorityPrecache)
+			for cacheService.IsDownloading(viewkey) {
+				time.Sleep(preloadPollInterval)
+			}
+
+			status := "完成"
+			if !cacheService.IsCached(viewkey) {
+				status = "失败"
+			}
+			log.Printf("[预热] %s %s (%d/%d)", viewkey, status, atomic.AddInt32(&done, 1), len(pending))
+		}(viewkey)
+	}
+	wg.Wait()
+
+	cached := 0
+	for _, viewkey := range viewkeys {
+		if cacheService.IsCached(viewkey) {
+			cached++
+		}
+	}
+	log.Printf("[预热] 预热结束: %d/%d 个视频已缓存", cached, len(viewkeys))
+}
+
+// waitScraperReady 等待浏览器可用，初始化失败时定期重试
+func waitScraperReady() bool {
+	scraperService := services.GetScraperService()
+	for attempt := 0; attempt < preloadInitRetries; attempt++ {
+		err := scraperService.Initialize()
+		if err == nil {
+			return true
+		}
+		log.Printf("[预热] 等待浏览器初始化: %v", err)
+		time.Sleep(preloadInitRetryInterval)
+	}
+	return false
+}
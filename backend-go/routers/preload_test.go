@@ -0,0 +1,26 @@
+package routers
+
+import (
+	"backend-go/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPreloadViewkeysSkipsInvalid(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+
+	file := filepath.Join(t.TempDir(), "preload.txt")
+	if err := os.WriteFile(file, []byte("# 注释\nfile123\n../../etc\n\nabc123\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Settings.PreloadViewkeys = []string{"abc123", "a/b", " env456 "}
+	config.Settings.PreloadFile = file
+
+	want := []string{"abc123", "env456", "file123"}
+	if got := preloadViewkeys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("preloadViewkeys = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errRangeNotSatisfiable 请求的范围超出内容大小
+var errRangeNotSatisfiable = errors.New("请求范围无效")
+
+// byteRange 请求的字节范围，end 包含在内
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// length 范围的字节数
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// contentRange Content-Range 响应头的值
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// parseRange 解析 Range 请求头，支持 start-end、start- 和 -suffix，多段范围只取第一段
+// 没有 Range 或格式无法识别时返回 false（按完整内容返回），范围超出内容大小时返回 errRangeNotSatisfiable
+func parseRange(header string, size int64) (byteRange, bool, error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found {
+		return byteRange{}, false, nil
+	}
+	spec, _, _ = strings.Cut(spec, ",")
+	startPart, endPart, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	if startPart == "" {
+		// 最后 N 个字节
+		suffix, err := strconv.ParseInt(endPart, 10, 64)
+		if err != nil || suffix < 0 {
+			return byteRange{}, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return byteRange{}, false, errRangeNotSatisfiable
+		}
+		return byteRange{start: max(size-suffix, 0), end: size - 1}, true, nil
+	}
+
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+	end := size - 1
+	if endPart != "" {
+		if end, err = strconv.ParseInt(endPart, 10, 64); err != nil || end < start {
+			return byteRange{}, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return byteRange{}, false, errRangeNotSatisfiable
+	}
+	return byteRange{start: start, end: end}, true, nil
+}
+
+// writeRangeNotSatisfiable 返回 416，Content-Range 中带上完整大小
+func writeRangeNotSatisfiable(c *gin.Context, size int64) {
+	c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+	c.Status(http.StatusRequestedRangeNotSatisfiable)
+}
@@ -0,0 +1,46 @@
+package routers
+
+import (
+	"backend-go/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWriteScrapeError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		err     error
+		handled bool
+	}{
+		{"熔断", services.ErrCircuitOpen, true},
+		{"繁忙", fmt.Errorf("抓取列表: %w", services.ErrScraperBusy), true},
+		{"维护", services.ErrMaintenance, true},
+		{"浏览器不可用", fmt.Errorf("初始化: %w", services.ErrBrowserUnavailable), true},
+		{"其他错误", errors.New("导航失败"), false},
+		{"无错误", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if got := writeScrapeError(c, tt.err); got != tt.handled {
+				t.Fatalf("writeScrapeError = %v, want %v", got, tt.handled)
+			}
+			if got := scrapeUnavailable(tt.err); got != tt.handled {
+				t.Fatalf("scrapeUnavailable = %v, want %v", got, tt.handled)
+			}
+			if tt.handled && w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("状态码 = %d, want 503", w.Code)
+			}
+			if !tt.handled && c.Writer.Written() {
+				t.Fatal("未处理的错误不应写入响应")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package routers
+
+import (
+	"backend-go/config"
+	"context"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// segmentSlotWait 分片请求等待并发名额的最长时间
+const segmentSlotWait = 30 * time.Second
+
+// segmentSession 一个播放会话的分片并发名额，users 为持有或等待名额的请求数
+type segmentSession struct {
+	slots chan struct{}
+	users int
+}
+
+// 各播放会话（客户端IP + 分片所在的上游目录）正在进行的分片请求
+var segmentSessions = struct {
+	sync.Mutex
+	data map[string]*segmentSession
+}{data: make(map[string]*segmentSession)}
+
+// segmentClientIP 分片限流使用的客户端地址：只有来自 TRUSTED_PROXIES 的请求才采用转发头中的地址，
+// 其他客户端伪造 X-Forwarded-For 无法绕过限流
+func segmentClientIP(c *gin.Context) string {
+	if fromTrustedProxy(c) {
+		return c.ClientIP()
+	}
+	return c.RemoteIP()
+}
+
+// segmentSessionKey 播放会话的键：同一客户端播放同一视频的分片位于同一上游目录
+func segmentSessionKey(clientIP, segmentURL string) string {
+	scope := segmentURL
+	if u, err := url.Parse(segmentURL); err == nil {
+		scope = u.Host + path.Dir(u.Path)
+	}
+	return clientIP + "|" + scope
+}
+
+// acquireSegmentSlot 等待播放会话的分片并发名额（SEGMENT_SESSION_CONCURRENCY），成功后调用方需调用 release
+// 请求被取消或等待超过 segmentSlotWait 时返回false
+func acquireSegmentSlot(ctx context.Context, key string) (release func(), ok bool) {
+	limit := config.Settings.SegmentSessionConcurrency
+	if limit <= 0 {
+		return func() {}, true
+	}
+
+	segmentSessions.Lock()
+	session, exists := segmentSessions.data[key]
+	if !exists {
+		session = &segmentSession{slots: make(chan struct{}, limit)}
+		segmentSessions.data[key] = session
+	}
+	session.users++
+	segmentSessions.Unlock()
+
+	// 没有请求使用的会话随即删除
+	leave := func() {
+		segmentSessions.Lock()
+		session.users--
+		if session.users == 0 {
+			delete(segmentSessions.data, key)
+		}
+		segmentSessions.Unlock()
+	}
+
+	timer := time.NewTimer(segmentSlotWait)
+	defer timer.Stop()
+	select {
+	case session.slots <- struct{}{}:
+		return func() {
+			<-session.slots
+			leave()
+		}, true
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	leave()
+	return nil, false
+}
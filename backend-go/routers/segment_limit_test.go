@@ -0,0 +1,98 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/services"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSegmentClientIPIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.TrustedProxies = []string{"10.0.0.1"}
+
+	cases := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"203.0.113.9:4000", "203.0.113.9"},
+		{"10.0.0.1:4000", "198.51.100.7"},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/stream/segment/x", nil)
+		c.Request.RemoteAddr = tc.remoteAddr
+		c.Request.Header.Set("X-Forwarded-For", "198.51.100.7")
+		if got := segmentClientIP(c); got != tc.want {
+			t.Fatalf("segmentClientIP(%s) = %q, want %q", tc.remoteAddr, got, tc.want)
+		}
+	}
+}
+
+func TestCachedSegmentSkipsSessionSlot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.URLSigningSecret = "test-secret"
+	config.Settings.SignedURLBindSession = false
+	config.Settings.CacheEnabled = true
+	config.Settings.CacheTTL = 60
+	config.Settings.SegmentCacheMaxMB = 10
+	config.Settings.SegmentPrefetchCount = 0
+	config.Settings.SegmentSessionConcurrency = 1
+	config.Settings.ProxyAllowedHosts = []string{"127.0.0.1"}
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Write([]byte("segment"))
+	}))
+	defer upstream.Close()
+	segmentURL := upstream.URL + "/hls/cachedslot/0.ts"
+
+	r := gin.New()
+	RegisterStreamRoutes(r.Group("/api"))
+	target := services.SignPath("/api/stream/segment/"+base64.URLEncoding.EncodeToString([]byte(segmentURL)), "")
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "192.0.2.1:5000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusOK || w.Body.String() != "segment" {
+		t.Fatalf("首次请求 status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	// 占住该播放会话唯一的名额，命中内存缓存的请求不应等待
+	release, ok := acquireSegmentSlot(context.Background(), segmentSessionKey("192.0.2.1", segmentURL))
+	if !ok {
+		t.Fatal("获取名额失败")
+	}
+	defer release()
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- get() }()
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK || w.Body.String() != "segment" {
+			t.Fatalf("缓存命中 status = %d, body = %q", w.Code, w.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("缓存命中的请求在等待并发名额")
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("上游请求次数 = %d, want 1", n)
+	}
+}
@@ -0,0 +1,203 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// 已压缩的静态文件，按修改时间和大小校验
+	gzipCache = struct {
+		sync.Mutex
+		data map[string]gzipEntry
+	}{data: make(map[string]gzipEntry)}
+
+	// 适合gzip压缩的文本类静态资源
+	compressibleExts = map[string]bool{
+		".html": true, ".js": true, ".mjs": true, ".css": true,
+		".json": true, ".svg": true, ".txt": true, ".map": true,
+	}
+)
+
+// gzipEntry 压缩后的静态文件，ETag 由原文件内容哈希得到
+type gzipEntry struct {
+	ModTime time.Time
+	Size    int64
+	Data    []byte
+	ETag    string
+}
+
+// RegisterFrontendRoutes 注册前端静态资源和SPA路由，dist 为前端构建产物（磁盘目录或嵌入的文件）
+// /assets 下的文件名带内容哈希，长期缓存；index.html 每次重新验证
+func RegisterFrontendRoutes(r *gin.Engine, dist fs.FS) {
+	indexPath := "index.html"
+
+	if info, err := fs.Stat(dist, "assets"); err == nil && info.IsDir() {
+		serveAsset := func(c *gin.Context) {
+			name := path.Join("assets", path.Clean("/"+c.Param("filepath")))
+			serveStaticFile(c, dist, name, "public, max-age=31536000, immutable")
+		}
+		r.GET("/assets/*filepath", serveAsset)
+		r.HEAD("/assets/*filepath", serveAsset)
+	}
+
+	// 根路径返回index.html
+	r.GET("/", func(c *gin.Context) {
+		serveStaticFile(c, dist, indexPath, "no-cache")
+	})
+
+	// SPA支持：其他非API路由返回index.html
+	r.NoRoute(func(c *gin.Context) {
+		// 如果是API请求，返回404
+		if isAPIPath(c.Request.URL.Path) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "接口不存在"})
+			return
+		}
+		serveStaticFile(c, dist, indexPath, "no-cache")
+	})
+}
+
+// isAPIPath 判断是否为 /api 或 /api/ 下的路径（/apix 等前端路由不算）
+func isAPIPath(urlPath string) bool {
+	return urlPath == "/api" || strings.HasPrefix(urlPath, "/api/")
+}
+
+// serveStaticFile 返回静态文件，客户端支持时对文本类文件使用gzip压缩
+func serveStaticFile(c *gin.Context, dist fs.FS, name, cacheControl string) {
+	info, err := fs.Stat(dist, name)
+	if err != nil || info.IsDir() {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", cacheControl)
+
+	ext := strings.ToLower(path.Ext(name))
+	if !config.Settings.StaticGzip || !compressibleExts[ext] {
+		serveFile(c, dist, name, info)
+		return
+	}
+
+	c.Header("Vary", "Accept-Encoding")
+	if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		serveFile(c, dist, name, info)
+		return
+	}
+
+	entry, err := gzipFile(dist, name, info)
+	if err != nil {
+		serveFile(c, dist, name, info)
+		return
+	}
+
+	// 嵌入的文件没有修改时间，只能靠 ETag 做条件请求
+	c.Header("ETag", entry.ETag)
+	modTime := info.ModTime()
+	if !modTime.IsZero() {
+		c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request, entry.ETag, modTime) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Encoding", "gzip")
+	c.Data(http.StatusOK, contentType, entry.Data)
+}
+
+// notModified 按 If-None-Match（优先）或 If-Modified-Since 判断客户端缓存是否仍然有效
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if modTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.Truncate(time.Second).After(since)
+}
+
+// serveFile 原样返回静态文件，支持 Range 和条件请求（嵌入的文件没有修改时间，不返回 Last-Modified）
+func serveFile(c *gin.Context, dist fs.FS, name string, info fs.FileInfo) {
+	f, err := dist.Open(name)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), content)
+}
+
+// gzipFile 获取文件的gzip压缩内容，文件未变化时复用已压缩的结果（嵌入的文件修改时间为零，但运行期间不会变化）
+func gzipFile(dist fs.FS, name string, info fs.FileInfo) (gzipEntry, error) {
+	gzipCache.Lock()
+	entry, ok := gzipCache.data[name]
+	gzipCache.Unlock()
+	if ok && entry.ModTime.Equal(info.ModTime()) && entry.Size == info.Size() {
+		return entry, nil
+	}
+
+	content, err := fs.ReadFile(dist, name)
+	if err != nil {
+		return gzipEntry{}, err
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return gzipEntry{}, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return gzipEntry{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return gzipEntry{}, err
+	}
+
+	// 压缩后的内容与原文件是不同的表示，ETag 加上 -gzip 后缀区分
+	sum := sha256.Sum256(content)
+	entry = gzipEntry{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Data:    buf.Bytes(),
+		ETag:    `"` + hex.EncodeToString(sum[:16]) + `-gzip"`,
+	}
+	gzipCache.Lock()
+	gzipCache.data[name] = entry
+	gzipCache.Unlock()
+	return entry, nil
+}
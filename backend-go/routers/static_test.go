@@ -0,0 +1,105 @@
+package routers
+
+import (
+	"backend-go/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsAPIPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/api", true},
+		{"/api/", true},
+		{"/api/videos", true},
+		{"/apifoo", false},
+		{"/apix/videos", false},
+		{"/watch/123", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := isAPIPath(tt.path); got != tt.want {
+			t.Errorf("isAPIPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNoRouteBranching(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterFrontendRoutes(r, fstest.MapFS{
+		"index.html": {Data: []byte("<html>spa</html>")},
+	})
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/api", http.StatusNotFound, "接口不存在"},
+		{"/api/", http.StatusNotFound, "接口不存在"},
+		{"/api/unknown", http.StatusNotFound, "接口不存在"},
+		{"/apifoo", http.StatusOK, "spa"},
+		{"/watch/123", http.StatusOK, "spa"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: %d %q, want %d containing %q", tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+}
+
+func TestGzipStaticFileETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.StaticGzip = true
+
+	r := gin.New()
+	// MapFS 未设置 ModTime，与嵌入的文件一样修改时间为零
+	RegisterFrontendRoutes(r, fstest.MapFS{
+		"index.html":       {Data: []byte("<html>spa</html>")},
+		"assets/app-1.js":  {Data: []byte("console.log(1)")},
+		"assets/app-2.css": {Data: []byte("body{}")},
+	})
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/assets/app-1.js", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || etag == "" {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("修改时间为零时不应返回 Last-Modified: %q", w.Header().Get("Last-Modified"))
+	}
+
+	w = get("/assets/app-1.js", etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatalf("条件请求 status = %d, body = %d bytes", w.Code, w.Body.Len())
+	}
+	if w = get("/assets/app-1.js", "W/"+etag); w.Code != http.StatusNotModified {
+		t.Fatalf("弱校验 status = %d", w.Code)
+	}
+	if w = get("/assets/app-2.css", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("其他文件 status = %d, etag = %q", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"backend-go/models"
 	"backend-go/services"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,37 +25,210 @@ var (
 	// 缓存视频URL
 	videoURLCache = struct {
 		sync.RWMutex
-		data map[string]struct {
-			URL    string
-			Detail *models.VideoDetail
-		}
-	}{data: make(map[string]struct {
-		URL    string
-		Detail *models.VideoDetail
-	})}
+		data map[string]videoURLEntry
+	}{data: make(map[string]videoURLEntry)}
+
+	// 缓存direct接口重写后的m3u8
+	directStreamCache = struct {
+		sync.RWMutex
+		data map[string]directStreamEntry
+	}{data: make(map[string]directStreamEntry)}
 )
 
+// videoURLEntry 视频URL缓存项，同时记录探测到的视频格式
+// ExpiresAt 为零值时不过期
+type videoURLEntry struct {
+	URL       string
+	Detail    *models.VideoDetail
+	IsMp4     bool
+	ExpiresAt time.Time
+}
+
+// videoURLExpiryMargin 签名URL到期前提前失效的时间，避免播放中途过期
+const videoURLExpiryMargin = 30 * time.Second
+
+// directStreamEntry direct接口缓存项
+type directStreamEntry struct {
+	Content   string
+	ExpiresAt time.Time
+}
+
 // RegisterStreamRoutes 注册流媒体相关路由
 func RegisterStreamRoutes(r *gin.RouterGroup) {
 	stream := r.Group("/stream")
 	{
 		stream.GET("/:video_id", getStream)
+		stream.GET("/:video_id/info", getStreamInfo)
 		stream.GET("/segment/*encoded_url", getSegment)
 		stream.GET("/cached-segment/:viewkey/:segment_name", getCachedSegment)
+		stream.GET("/subtitle/*encoded_url", getSubtitle)
+		stream.GET("/cached-subtitle/:viewkey/:index", getCachedSubtitle)
 		stream.GET("/direct", getDirectStream)
 		stream.DELETE("/cache", clearStreamCache)
 		stream.GET("/image/:video_id", getImage)
 	}
 }
 
+// videoURLExpiry 计算视频URL缓存的过期时间
+// 能从签名参数中解析出过期时间时提前 videoURLExpiryMargin 失效，否则使用 VIDEO_URL_CACHE_TTL（0 为不过期）
+func videoURLExpiry(videoURL string) time.Time {
+	if expiry, ok := services.URLExpiry(videoURL); ok {
+		return expiry.Add(-videoURLExpiryMargin)
+	}
+	if ttl := config.Settings.VideoURLCacheTTL; ttl > 0 {
+		return time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	return time.Time{}
+}
+
+// proxyBaseURLAuto PROXY_BASE_URL 取该值时根据请求推导对外地址
+const proxyBaseURLAuto = "auto"
+
+// proxyBaseURL 获取代理服务对外地址，配置为 auto 时根据请求推导
+func proxyBaseURL(c *gin.Context) string {
+	if base := config.Settings.ProxyBaseURL; base != "" && base != proxyBaseURLAuto {
+		return strings.TrimRight(base, "/")
+	}
+	return requestBaseURL(c)
+}
+
+// cachedPlaylistBaseURL 已缓存播放列表中分片地址使用的代理地址
+// 启用 CACHED_PLAYLIST_BASE_FROM_REQUEST 时忽略 PROXY_BASE_URL，指向客户端实际访问的地址
+func cachedPlaylistBaseURL(c *gin.Context) string {
+	if config.Settings.CachedPlaylistBaseFromRequest {
+		return requestBaseURL(c)
+	}
+	return proxyBaseURL(c)
+}
+
+// requestBaseURL 根据请求推导客户端访问的地址（scheme + host）
+// X-Forwarded-Proto / X-Forwarded-Host 只在请求来自 TRUSTED_PROXIES 时采信，scheme 只接受 http 和 https
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.Request.Host
+
+	if fromTrustedProxy(c) {
+		if proto := strings.ToLower(firstHeaderValue(c.GetHeader("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := firstHeaderValue(c.GetHeader("X-Forwarded-Host")); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+	// 裸IPv6地址需要加方括号
+	if strings.Count(host, ":") > 1 && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+
+	return scheme + "://" + host
+}
+
+// fromTrustedProxy 请求的直接来源是否为 TRUSTED_PROXIES 中的反向代理
+func fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range config.Settings.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstHeaderValue 获取逗号分隔的请求头中的第一个值
+func firstHeaderValue(value string) string {
+	if idx := strings.Index(value, ","); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
+
+// signingSessionCookie 签名会话 cookie 名称
+const signingSessionCookie = "noproxy_sid"
+
+// signingSessionMaxAge 签名会话 cookie 有效期（秒）
+const signingSessionMaxAge = 365 * 24 * 60 * 60
+
+// signingSession 获取签发链接时绑定的会话，客户端没有会话 cookie 时签发一个；未启用会话绑定时返回空
+func signingSession(c *gin.Context) string {
+	if !services.SessionBindingEnabled() {
+		return ""
+	}
+	if session, ok := c.Get(signingSessionCookie); ok {
+		return session.(string)
+	}
+	session := requestSigningSession(c)
+	if session == "" {
+		session = services.NewSigningSession()
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(signingSessionCookie, session, signingSessionMaxAge, "/", "", c.Request.TLS != nil, true)
+	}
+	c.Set(signingSessionCookie, session)
+	return session
+}
+
+// requestSigningSession 读取请求携带的会话 cookie，格式不对时视为没有
+func requestSigningSession(c *gin.Context) string {
+	session, err := c.Cookie(signingSessionCookie)
+	if err != nil || !services.ValidSigningSession(session) {
+		return ""
+	}
+	return session
+}
+
+// signedResource 还原签名时的路径和查询参数（去掉 exp、sig），url 等参数被改动后签名不再匹配
+func signedResource(u *url.URL) string {
+	var kept []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		if part == "" || strings.HasPrefix(part, "exp=") || strings.HasPrefix(part, "sig=") {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	if len(kept) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + strings.Join(kept, "&")
+}
+
+// verifySignature 校验请求URL签名、过期时间和会话，失败时返回403
+// 不绑定会话签发的链接（如订阅中的封面图）对任何请求都有效
+func verifySignature(c *gin.Context) bool {
+	resource := signedResource(c.Request.URL)
+	exp, sig := c.Query("exp"), c.Query("sig")
+	ok := services.VerifySignedPath(resource, exp, sig, "")
+	if !ok && services.SessionBindingEnabled() {
+		if session := requestSigningSession(c); session != "" {
+			ok = services.VerifySignedPath(resource, exp, sig, session)
+		}
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Detail: "链接签名无效或已过期"})
+		return false
+	}
+	return true
+}
+
 // getStream 获取视频流代理
 func getStream(c *gin.Context) {
+	if rejectCookieProfile(c) || !verifySignature(c) {
+		return
+	}
+
 	videoID := c.Param("video_id")
 	log.Printf("=== 收到流请求: video_id=%s ===", videoID)
 
 	cfg := config.Settings
 	cacheService := services.GetVideoCacheService()
-	scraperService := services.GetScraperService()
 	proxyService := services.GetProxyService()
 
 	// 检查本地缓存
@@ -62,6 +239,7 @@ func getStream(c *gin.Context) {
 		mp4Path := cacheService.GetCachedMp4Path(videoID)
 		if mp4Path != "" {
 			log.Printf("[Cache] 返回缓存的MP4: %s", mp4Path)
+			services.GetMetrics().Mp4CacheHit()
 			serveCachedMp4(c, mp4Path)
 			return
 		}
@@ -69,94 +247,207 @@ func getStream(c *gin.Context) {
 		// 返回缓存的M3U8
 		m3u8Content, err := cacheService.GetCachedM3u8(videoID)
 		if err == nil && m3u8Content != "" {
-			rewrittenM3u8 := cacheService.RewriteCachedM3u8(m3u8Content, videoID, cfg.ProxyBaseURL)
-			c.Header("Access-Control-Allow-Origin", "*")
+			rewrittenM3u8 := cacheService.RewriteCachedM3u8(m3u8Content, videoID, cachedPlaylistBaseURL(c), signingSession(c))
+			setPreloadLinks(c, rewrittenM3u8, cfg.CachedPreloadSegments)
 			c.Header("Cache-Control", "no-cache")
 			c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(rewrittenM3u8))
 			return
 		}
 	}
 
+	// 下载进行中：返回已就绪分片组成的直播列表，完成后自动切换为完整列表
+	if cfg.VideoCacheEnabled && cfg.PartialM3u8Enabled && cacheService.IsDownloading(videoID) {
+		if partial, ok := cacheService.GetPartialM3u8(videoID, cfg.PartialM3u8MinSegments); ok {
+			log.Printf("[Cache] 返回下载中的部分播放列表: %s", videoID)
+			rewrittenM3u8 := cacheService.RewriteCachedM3u8(partial, videoID, cachedPlaylistBaseURL(c), signingSession(c))
+			c.Header("Cache-Control", "no-cache")
+			c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(rewrittenM3u8))
+			return
+		}
+	}
+
+	videoURL, detail, isMp4, ok := resolveVideoURL(c, videoID)
+	if !ok {
+		return
+	}
+
+	if isMp4 {
+		log.Println("检测到MP4格式，使用流式代理")
+		var tee mp4TeeFunc
+		if cfg.VideoCacheEnabled && detail != nil {
+			if cfg.Mp4TeeCache && rangeFromStart(c.GetHeader("Range")) {
+				// 边播边缓存，上游没有返回完整文件时改为后台下载
+				tee = func(resp *http.Response) *services.Mp4Tee {
+					if total, ok := fullMp4Response(resp); ok {
+						if t := cacheService.BeginMp4Tee(videoID, detail, total); t != nil {
+							return t
+						}
+					}
+					go cacheService.StartMp4CacheDownload(videoID, videoURL, detail, services.PriorityUser)
+					return nil
+				}
+			} else {
+				// 启动后台缓存下载
+				go cacheService.StartMp4CacheDownload(videoID, videoURL, detail, services.PriorityUser)
+			}
+		}
+		proxyMp4Stream(c, videoURL, tee)
+	} else {
+		log.Println("检测到M3U8格式，重写并代理")
+		m3u8Content, err := proxyService.FetchM3u8(videoURL, proxyBaseURL(c), signingSession(c))
+		if err != nil {
+			log.Printf("M3U8处理失败: %v，尝试作为MP4代理", err)
+			proxyMp4Stream(c, videoURL, nil)
+			return
+		}
+
+		// 启动后台缓存下载
+		if cfg.VideoCacheEnabled && detail != nil {
+			go func() {
+				client := proxyService.GetClient()
+				resp, err := client.Get(videoURL)
+				if err == nil {
+					defer resp.Body.Close()
+					body, _ := io.ReadAll(resp.Body)
+					cacheService.StartCacheDownload(videoID, videoURL, string(body), detail, services.PriorityUser)
+				}
+			}()
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(m3u8Content))
+	}
+}
+
+// getStreamInfo 获取视频流信息（上游地址、代理地址和格式），不代理视频内容
+// 原生播放器等客户端可以据此选择直连上游或通过代理播放
+func getStreamInfo(c *gin.Context) {
+	if rejectCookieProfile(c) {
+		return
+	}
+	videoID := c.Param("video_id")
+	cacheService := services.GetVideoCacheService()
+
+	info := models.StreamInfo{
+		VideoID:  videoID,
+		ProxyURL: proxyBaseURL(c) + services.SignPath("/api/stream/"+videoID, signingSession(c)),
+	}
+
+	// 已缓存的视频由代理返回本地文件，上游地址取自保存的详情，可能已失效
+	if config.Settings.VideoCacheEnabled && cacheService.IsCached(videoID) {
+		info.Cached = true
+		info.Format = services.StreamFormat(cacheService.GetCachedMp4Path(videoID) != "")
+		if detail, err := cacheService.GetCachedDetail(videoID); err == nil && detail != nil {
+			info.M3u8URL = detail.M3u8URL
+		}
+		c.JSON(http.StatusOK, info)
+		return
+	}
+
+	videoURL, _, isMp4, ok := resolveVideoURL(c, videoID)
+	if !ok {
+		return
+	}
+	info.M3u8URL = videoURL
+	info.Format = services.StreamFormat(isMp4)
+	c.JSON(http.StatusOK, info)
+}
+
+// resolveVideoURL 获取视频的上游地址和详情，优先使用未过期的URL缓存，否则抓取详情页
+// 失败时已写入错误响应，返回 ok=false
+func resolveVideoURL(c *gin.Context, videoID string) (videoURL string, detail *models.VideoDetail, isMp4 bool, ok bool) {
+	// 维护模式下不代理上游，只有已缓存的视频可以播放
+	if services.GetMaintenance().Enabled() {
+		writeMaintenance(c)
+		return "", nil, false, false
+	}
+
 	cacheKey := "video_" + videoID
-	var videoURL string
-	var detail *models.VideoDetail
+	scraperService := services.GetScraperService()
 
 	// 检查URL缓存
-	videoURLCache.RLock()
+	videoURLCache.Lock()
 	if cached, ok := videoURLCache.data[cacheKey]; ok {
-		videoURL = cached.URL
-		detail = cached.Detail
-		log.Printf("使用缓存的URL: %s", videoURL)
+		if !cached.ExpiresAt.IsZero() && time.Now().After(cached.ExpiresAt) {
+			// 签名已过期，重新获取
+			delete(videoURLCache.data, cacheKey)
+			log.Printf("缓存的URL已过期: %s", cached.URL)
+		} else {
+			videoURL = cached.URL
+			detail = cached.Detail
+			isMp4 = cached.IsMp4
+			log.Printf("使用缓存的URL: %s", videoURL)
+		}
 	}
-	videoURLCache.RUnlock()
+	videoURLCache.Unlock()
 
 	if videoURL == "" {
 		// 构建视频页URL
-		pageURL := fmt.Sprintf("%s/view_video.php?viewkey=%s", cfg.TargetBaseURL, videoID)
+		pageURL := fmt.Sprintf("%s/view_video.php?viewkey=%s", services.TargetBaseURL(), videoID)
 		log.Printf("获取视频详情: %s", pageURL)
 
 		// 使用新标签页获取，避免与主页面冲突
 		var err error
 		detail, err = scraperService.GetVideoDetailInNewTab(pageURL)
 
+		if writeScrapeError(c, err) {
+			return "", nil, false, false
+		}
 		if err != nil {
 			log.Printf("错误: 获取视频详情失败: %v", err)
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "无法获取视频流: " + err.Error()})
-			return
+			return "", nil, false, false
 		}
 
 		if detail == nil || detail.M3u8URL == "" {
 			log.Println("错误: 无法获取视频流URL (detail为空或无URL)")
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "无法获取视频流"})
-			return
+			return "", nil, false, false
 		}
 
 		videoURL = detail.M3u8URL
+		// 判断是MP4还是M3U8，抓取详情时已探测过则直接使用
+		if detail.Format != "" {
+			isMp4 = detail.Format == "mp4"
+		} else {
+			isMp4 = services.GetProxyService().DetectIsMp4(videoURL)
+		}
 		videoURLCache.Lock()
-		videoURLCache.data[cacheKey] = struct {
-			URL    string
-			Detail *models.VideoDetail
-		}{videoURL, detail}
+		videoURLCache.data[cacheKey] = videoURLEntry{URL: videoURL, Detail: detail, IsMp4: isMp4, ExpiresAt: videoURLExpiry(videoURL)}
 		videoURLCache.Unlock()
 		log.Printf("获取到视频URL: %s", videoURL)
 	}
+	return videoURL, detail, isMp4, true
+}
 
-	// 判断是MP4还是M3U8
-	isMp4 := strings.Contains(strings.ToLower(videoURL), ".mp4") ||
-		!strings.Contains(strings.ToLower(videoURL), ".m3u8")
+// setPreloadLinks 为播放列表中的初始化分片和前 count 个分片添加 Link: rel=preload 头，加快首帧加载
+func setPreloadLinks(c *gin.Context, playlist string, count int) {
+	if count <= 0 {
+		return
+	}
 
-	if isMp4 {
-		log.Println("检测到MP4格式，使用流式代理")
-		// 启动后台缓存下载
-		if cfg.VideoCacheEnabled && detail != nil {
-			go cacheService.StartMp4CacheDownload(videoID, videoURL, detail)
+	var links []string
+	segments := 0
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXT-X-MAP") {
+			if matches := services.MapURIRe.FindStringSubmatch(line); matches != nil {
+				links = append(links, fmt.Sprintf("<%s>; rel=preload; as=fetch; crossorigin", matches[1]))
+			}
+			continue
 		}
-		proxyMp4Stream(c, videoURL)
-	} else {
-		log.Println("检测到M3U8格式，重写并代理")
-		m3u8Content, err := proxyService.FetchM3u8(videoURL, cfg.ProxyBaseURL)
-		if err != nil {
-			log.Printf("M3U8处理失败: %v，尝试作为MP4代理", err)
-			proxyMp4Stream(c, videoURL)
-			return
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
-
-		// 启动后台缓存下载
-		if cfg.VideoCacheEnabled && detail != nil {
-			go func() {
-				client := proxyService.GetClient()
-				resp, err := client.Get(videoURL)
-				if err == nil {
-					defer resp.Body.Close()
-					body, _ := io.ReadAll(resp.Body)
-					cacheService.StartCacheDownload(videoID, videoURL, string(body), detail)
-				}
-			}()
+		links = append(links, fmt.Sprintf("<%s>; rel=preload; as=fetch; crossorigin", line))
+		segments++
+		if segments >= count {
+			break
 		}
+	}
 
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Cache-Control", "no-cache")
-		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(m3u8Content))
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
 	}
 }
 
@@ -172,44 +463,42 @@ func serveCachedMp4(c *gin.Context, mp4Path string) {
 	fileInfo, _ := file.Stat()
 	fileSize := fileInfo.Size()
 
-	rangeHeader := c.GetHeader("Range")
-
-	if rangeHeader != "" {
-		// 解析Range头
-		rangeHeader = strings.Replace(rangeHeader, "bytes=", "", 1)
-		parts := strings.Split(rangeHeader, "-")
-
-		start, _ := strconv.ParseInt(parts[0], 10, 64)
-		end := fileSize - 1
-		if len(parts) > 1 && parts[1] != "" {
-			end, _ = strconv.ParseInt(parts[1], 10, 64)
-		}
-
-		contentLength := end - start + 1
+	rng, partial, err := parseRange(c.GetHeader("Range"), fileSize)
+	if err != nil {
+		writeRangeNotSatisfiable(c, fileSize)
+		return
+	}
 
+	if partial {
 		c.Header("Content-Type", "video/mp4")
-		c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
-		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
+		c.Header("Content-Length", strconv.FormatInt(rng.length(), 10))
+		c.Header("Content-Range", rng.contentRange(fileSize))
 		c.Header("Accept-Ranges", "bytes")
-		c.Header("Access-Control-Allow-Origin", "*")
 		c.Status(http.StatusPartialContent)
 
-		file.Seek(start, 0)
-		io.CopyN(c.Writer, file, contentLength)
+		file.Seek(rng.start, 0)
+		io.CopyN(c.Writer, file, rng.length())
 	} else {
 		c.Header("Content-Type", "video/mp4")
 		c.Header("Content-Length", strconv.FormatInt(fileSize, 10))
 		c.Header("Accept-Ranges", "bytes")
-		c.Header("Access-Control-Allow-Origin", "*")
 		io.Copy(c.Writer, file)
 	}
 }
 
 // proxyMp4Stream 代理MP4视频流
-func proxyMp4Stream(c *gin.Context, url string) {
+// tee 不为空时在收到上游响应后调用，返回值非空则同时将响应写入缓存
+func proxyMp4Stream(c *gin.Context, url string, tee mp4TeeFunc) {
 	log.Printf("=== 代理MP4流: %s ===", url)
 
-	cfg := config.Settings
+	release, ok := acquireStreamSlot()
+	if !ok {
+		log.Printf("流式代理并发已达上限 (%d)，拒绝请求", config.Settings.MaxConcurrentStreams)
+		writeTooManyStreams(c)
+		return
+	}
+	defer release()
+
 	client := &http.Client{}
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -219,7 +508,8 @@ func proxyMp4Stream(c *gin.Context, url string) {
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", cfg.TargetBaseURL)
+	services.SetAcceptLanguage(req)
+	req.Header.Set("Referer", services.TargetBaseURL())
 	req.Header.Set("Accept", "*/*")
 	req.Header.Set("Accept-Encoding", "identity")
 
@@ -247,7 +537,6 @@ func proxyMp4Stream(c *gin.Context, url string) {
 
 	log.Printf("上游响应: status=%d, content-type=%s, length=%s", resp.StatusCode, contentType, contentLength)
 
-	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Accept-Ranges", "bytes")
 	c.Header("Content-Type", contentType)
 	c.Header("Cache-Control", "public, max-age=3600")
@@ -261,30 +550,107 @@ func proxyMp4Stream(c *gin.Context, url string) {
 
 	c.Status(resp.StatusCode)
 
-	// 流式传输
-	buf := make([]byte, 512*1024)
+	var cacheWriter *services.Mp4Tee
+	if tee != nil {
+		cacheWriter = tee(resp)
+	}
+
+	// 流式传输：按字节数或时间间隔定期刷新，小响应无需中途刷新
+	cfg := config.Settings
+	pooled := services.GetTransferBuffer()
+	defer services.PutTransferBuffer(pooled)
+	buf := *pooled
+	bufSize := len(buf)
+	flushBytes := int64(cfg.StreamFlushKB) * 1024
+	flushInterval := time.Duration(cfg.StreamFlushIntervalMs) * time.Millisecond
+	smallResponse := resp.ContentLength >= 0 && resp.ContentLength <= int64(bufSize)
+
+	var unflushed int64
+	lastFlush := time.Now()
+	var readErr error
+	clientGone := false
 	for {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
-			c.Writer.Write(buf[:n])
-			c.Writer.Flush()
+			if cacheWriter != nil {
+				cacheWriter.Write(buf[:n])
+			}
+			if !clientGone {
+				if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+					clientGone = true
+					// 客户端断开后按配置继续读完上游完成缓存，否则结束
+					if cacheWriter == nil || !cfg.Mp4TeeKeepOnDisconnect {
+						readErr = errClientGone
+						break
+					}
+					log.Println("客户端已断开，继续下载剩余部分写入缓存")
+				} else {
+					unflushed += int64(n)
+					if !smallResponse && (unflushed >= flushBytes || time.Since(lastFlush) >= flushInterval) {
+						c.Writer.Flush()
+						unflushed = 0
+						lastFlush = time.Now()
+					}
+				}
+			}
 		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			readErr = err
 			break
 		}
 	}
+	if unflushed > 0 && !clientGone {
+		c.Writer.Flush()
+	}
+	if cacheWriter != nil {
+		cacheWriter.Finish(readErr)
+	}
+}
+
+// mp4TeeFunc 根据上游响应决定是否边播边缓存
+type mp4TeeFunc func(resp *http.Response) *services.Mp4Tee
+
+// errClientGone 客户端在传输过程中断开
+var errClientGone = errors.New("客户端已断开")
+
+// rangeFromStart 请求是否从文件开头读取（无 Range 或 bytes=0-）
+func rangeFromStart(rangeHeader string) bool {
+	rangeHeader = strings.ReplaceAll(rangeHeader, " ", "")
+	return rangeHeader == "" || rangeHeader == "bytes=0-"
+}
+
+// fullMp4Response 上游响应是否包含完整文件，返回文件大小（未知时为0）
+func fullMp4Response(resp *http.Response) (int64, bool) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if resp.ContentLength > 0 {
+			return resp.ContentLength, true
+		}
+		return 0, true
+	case http.StatusPartialContent:
+		var start, end, total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+			return 0, false
+		}
+		return total, start == 0 && end == total-1
+	}
+	return 0, false
 }
 
 // getSegment 代理获取ts分片或其他资源
 func getSegment(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+	services.GetMetrics().SegmentRequest()
+
 	encodedURL := c.Param("encoded_url")
 	// 去掉开头的斜杠
 	encodedURL = strings.TrimPrefix(encodedURL, "/")
 
-	cfg := config.Settings
 	proxyService := services.GetProxyService()
 
 	// 解码原始URL
@@ -295,25 +661,40 @@ func getSegment(c *gin.Context) {
 	}
 	originalURL := string(decoded)
 
+	if !proxyService.IsAllowedHost(originalURL) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Detail: "不允许代理该地址"})
+		return
+	}
+
 	// 判断是m3u8还是其他资源
 	if strings.Contains(originalURL, ".m3u8") {
-		content, err := proxyService.FetchM3u8(originalURL, cfg.ProxyBaseURL)
+		content, err := proxyService.FetchM3u8(originalURL, proxyBaseURL(c), signingSession(c))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取资源失败"})
 			return
 		}
 
-		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Cache-Control", "no-cache")
 		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(content))
 	} else {
-		content, contentType, err := proxyService.FetchSegment(originalURL)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取资源失败"})
-			return
+		// 内存缓存命中时直接返回，不占用播放会话的并发名额
+		content, contentType, cached := proxyService.CachedSegment(originalURL)
+		if !cached {
+			// 限制同一播放会话同时向上游请求的分片数
+			release, ok := acquireSegmentSlot(c.Request.Context(), segmentSessionKey(segmentClientIP(c), originalURL))
+			if !ok {
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: "分片请求过多，请稍后重试"})
+				return
+			}
+			content, contentType, err = proxyService.FetchSegment(originalURL)
+			release()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取资源失败"})
+				return
+			}
 		}
 
-		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Cache-Control", "max-age=3600")
 		c.Data(http.StatusOK, contentType, content)
 	}
@@ -321,24 +702,106 @@ func getSegment(c *gin.Context) {
 
 // getCachedSegment 获取本地缓存的分片
 func getCachedSegment(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+
 	viewkey := c.Param("viewkey")
 	segmentName := c.Param("segment_name")
 
 	cacheService := services.GetVideoCacheService()
 
 	content, err := cacheService.GetCachedSegment(viewkey, segmentName)
+	if err != nil && config.Settings.SegmentMissUpstream && cacheService.IsDownloading(viewkey) {
+		// 边下边播时请求了尚未下载的分片（如向后拖动），直接从上游获取
+		content, err = cacheService.FetchMissingSegment(viewkey, segmentName)
+		if err == nil {
+			services.GetMetrics().SegmentRequest()
+		} else if !errors.Is(err, services.ErrVideoNotCached) {
+			log.Printf("[Cache] 从上游获取分片失败 %s/%s: %v", viewkey, segmentName, err)
+		}
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "缓存分片不存在"})
 		return
 	}
 
-	c.Header("Access-Control-Allow-Origin", "*")
+	size := int64(len(content))
+	rng, partial, err := parseRange(c.GetHeader("Range"), size)
+	if err != nil {
+		writeRangeNotSatisfiable(c, size)
+		return
+	}
+
 	c.Header("Cache-Control", "max-age=86400")
-	c.Data(http.StatusOK, "video/MP2T", content)
+	c.Header("Accept-Ranges", "bytes")
+	if partial {
+		c.Header("Content-Range", rng.contentRange(size))
+		c.Data(http.StatusPartialContent, services.SegmentContentType(segmentName), content[rng.start:rng.end+1])
+		return
+	}
+	c.Data(http.StatusOK, services.SegmentContentType(segmentName), content)
+}
+
+// getSubtitle 代理字幕文件
+func getSubtitle(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+
+	encodedURL := strings.TrimPrefix(c.Param("encoded_url"), "/")
+	decoded, err := base64.URLEncoding.DecodeString(encodedURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的编码URL"})
+		return
+	}
+	originalURL := string(decoded)
+
+	proxyService := services.GetProxyService()
+	if !proxyService.IsAllowedHost(originalURL) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Detail: "不允许代理该地址"})
+		return
+	}
+
+	content, _, err := proxyService.FetchSegment(originalURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取字幕失败"})
+		return
+	}
+
+	c.Header("Cache-Control", "max-age=3600")
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", content)
+}
+
+// getCachedSubtitle 获取本地缓存的字幕
+func getCachedSubtitle(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的字幕序号"})
+		return
+	}
+
+	subPath := services.GetVideoCacheService().GetCachedSubtitlePath(c.Param("viewkey"), index)
+	if subPath == "" {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "缓存字幕不存在"})
+		return
+	}
+
+	c.Header("Cache-Control", "max-age=86400")
+	c.Header("Content-Type", "text/vtt; charset=utf-8")
+	c.File(subPath)
 }
 
 // getDirectStream 直接获取m3u8内容
 func getDirectStream(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+
 	url := c.Query("url")
 	if url == "" {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "缺少url参数"})
@@ -348,31 +811,86 @@ func getDirectStream(c *gin.Context) {
 	cfg := config.Settings
 	proxyService := services.GetProxyService()
 
-	m3u8Content, err := proxyService.FetchM3u8(url, cfg.ProxyBaseURL)
+	if !proxyService.IsAllowedHost(url) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Detail: "不允许代理该地址"})
+		return
+	}
+
+	// 检查短期缓存（重写结果依赖代理地址和签名会话，一并作为键）
+	proxyBase := proxyBaseURL(c)
+	session := signingSession(c)
+	cacheKey := proxyBase + "|" + session + "|" + url
+	if cfg.DirectStreamCacheTTL > 0 {
+		directStreamCache.RLock()
+		entry, ok := directStreamCache.data[cacheKey]
+		directStreamCache.RUnlock()
+		if ok && time.Now().Before(entry.ExpiresAt) {
+			c.Header("Cache-Control", "no-cache")
+			c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(entry.Content))
+			return
+		}
+	}
+
+	m3u8Content, err := proxyService.FetchM3u8(url, proxyBase, session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取视频流失败"})
 		return
 	}
 
-	c.Header("Access-Control-Allow-Origin", "*")
+	if cfg.DirectStreamCacheTTL > 0 {
+		storeDirectStream(cacheKey, m3u8Content, time.Duration(cfg.DirectStreamCacheTTL)*time.Second)
+	}
+
 	c.Header("Cache-Control", "no-cache")
 	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(m3u8Content))
 }
 
+// directStreamCacheMaxEntries direct接口重写结果的缓存条数上限（键包含签名会话，客户端多时条数会增长）
+const directStreamCacheMaxEntries = 256
+
+// storeDirectStream 缓存direct接口重写后的m3u8，同时清理过期项；达到条数上限时淘汰最早过期的一项
+func storeDirectStream(key, content string, ttl time.Duration) {
+	now := time.Now()
+	directStreamCache.Lock()
+	defer directStreamCache.Unlock()
+
+	for k, e := range directStreamCache.data {
+		if now.After(e.ExpiresAt) {
+			delete(directStreamCache.data, k)
+		}
+	}
+	if _, exists := directStreamCache.data[key]; !exists && len(directStreamCache.data) >= directStreamCacheMaxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for k, e := range directStreamCache.data {
+			if oldestKey == "" || e.ExpiresAt.Before(oldest) {
+				oldestKey, oldest = k, e.ExpiresAt
+			}
+		}
+		delete(directStreamCache.data, oldestKey)
+	}
+	directStreamCache.data[key] = directStreamEntry{Content: content, ExpiresAt: now.Add(ttl)}
+}
+
 // clearStreamCache 清除URL缓存
 func clearStreamCache(c *gin.Context) {
 	videoURLCache.Lock()
-	videoURLCache.data = make(map[string]struct {
-		URL    string
-		Detail *models.VideoDetail
-	})
+	videoURLCache.data = make(map[string]videoURLEntry)
 	videoURLCache.Unlock()
 
+	directStreamCache.Lock()
+	directStreamCache.data = make(map[string]directStreamEntry)
+	directStreamCache.Unlock()
+
 	c.JSON(http.StatusOK, gin.H{"message": "流缓存已清除"})
 }
 
 // getImage 获取视频封面图代理
 func getImage(c *gin.Context) {
+	if !verifySignature(c) {
+		return
+	}
+
 	videoID := c.Param("video_id")
 	url := c.Query("url")
 
@@ -383,7 +901,6 @@ func getImage(c *gin.Context) {
 	if cfg.VideoCacheEnabled {
 		thumbPath := cacheService.GetCachedThumbnailPath(videoID)
 		if thumbPath != "" {
-			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Cache-Control", "public, max-age=86400")
 			c.File(thumbPath)
 			return
@@ -396,41 +913,43 @@ func getImage(c *gin.Context) {
 		return
 	}
 
-	// 代理远程图片
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取图片失败"})
-		return
+	// 与分片代理使用同一白名单，并拒绝内网地址，避免被用来请求任意地址
+	if cfg.ThumbnailHostCheck {
+		proxyService := services.GetProxyService()
+		if !proxyService.IsAllowedHost(url) || !proxyService.IsPublicHost(url) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Detail: "不允许代理该地址"})
+			return
+		}
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", cfg.TargetBaseURL)
-
-	resp, err := client.Do(req)
+	// 代理远程图片（同一地址的并发请求合并并短暂缓存在内存，启用缓存时同时写入本地）
+	content, contentType, err := cacheService.FetchThumbnail(videoID, url)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "获取图片失败"})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(resp.StatusCode, models.ErrorResponse{Detail: "获取图片失败"})
+		unavailable := errors.Is(err, services.ErrThumbnailUnavailable)
+		if cfg.ThumbnailFallback {
+			writeThumbnailPlaceholder(c, unavailable)
+			return
+		}
+		if unavailable {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "封面图不可用"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{Detail: "获取图片失败"})
 		return
 	}
 
-	content, _ := io.ReadAll(resp.Body)
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "image/jpeg"
-	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, contentType, content)
+}
 
-	// 后台缓存图片
-	if cfg.VideoCacheEnabled {
-		go cacheService.DownloadThumbnail(videoID, url)
+// writeThumbnailPlaceholder 返回占位图，确认不可用的封面图允许浏览器缓存，暂时失败的不缓存以便稍后重试
+func writeThumbnailPlaceholder(c *gin.Context, unavailable bool) {
+	content, contentType := services.ThumbnailPlaceholder()
+	if unavailable {
+		c.Header("Cache-Control", "public, max-age=3600")
+	} else {
+		c.Header("Cache-Control", "no-store")
 	}
-
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Thumbnail-Placeholder", "1")
 	c.Data(http.StatusOK, contentType, content)
 }
@@ -0,0 +1,76 @@
+package routers
+
+import (
+	"backend-go/config"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// discardResponseWriter 丢弃响应内容并统计刷新次数，避免基准测试被录制响应的内存拷贝干扰
+type discardResponseWriter struct {
+	header  http.Header
+	written int64
+	flushes int
+}
+
+func (w *discardResponseWriter) Header() http.Header { return w.header }
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	return len(p), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+func (w *discardResponseWriter) Flush() { w.flushes++ }
+
+// BenchmarkProxyMp4Stream 比较不同 STREAM_BUFFER_KB 下代理本地上游MP4的吞吐
+// go test ./routers -run '^$' -bench ProxyMp4Stream -benchmem
+func BenchmarkProxyMp4Stream(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	const videoSize = 64 << 20
+	video := bytes.Repeat([]byte{0x42}, videoSize)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", strconv.Itoa(len(video)))
+		w.Write(video)
+	}))
+	defer upstream.Close()
+
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.MaxConcurrentStreams = 0
+
+	// 每次代理都会打印日志，基准测试中不输出
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, kb := range []int{32, 128, 256, 512, 1024} {
+		b.Run(fmt.Sprintf("buffer=%dKB", kb), func(b *testing.B) {
+			config.Settings.StreamBufferKB = kb
+			b.SetBytes(videoSize)
+			b.ReportAllocs()
+			var flushes int
+			for i := 0; i < b.N; i++ {
+				w := &discardResponseWriter{header: make(http.Header)}
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodGet, "/api/stream/test", nil)
+				proxyMp4Stream(c, upstream.URL+"/video.mp4", nil)
+				if w.written != videoSize {
+					b.Fatalf("写出 %d 字节, want %d", w.written, videoSize)
+				}
+				flushes += w.flushes
+			}
+			b.ReportMetric(float64(flushes)/float64(b.N), "flushes/op")
+		})
+	}
+}
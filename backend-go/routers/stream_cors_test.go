@@ -0,0 +1,47 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCachedMp4UsesConfiguredCORS 流式响应不应覆盖 CORS 中间件按白名单回显的 Origin
+func TestCachedMp4UsesConfiguredCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const origin = "https://player.example.com"
+	r := gin.New()
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{origin},
+		AllowMethods:     []string{"GET"},
+		AllowCredentials: true,
+	}))
+	r.GET("/video", func(c *gin.Context) { serveCachedMp4(c, path) })
+
+	for _, rangeHeader := range []string{"", "bytes=2-5", "bytes=100-"} {
+		req := httptest.NewRequest(http.MethodGet, "/video", nil)
+		req.Header.Set("Origin", origin)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("Range %q: Access-Control-Allow-Origin = %q, want %q", rangeHeader, got, origin)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Range %q: Access-Control-Allow-Credentials = %q", rangeHeader, got)
+		}
+	}
+}
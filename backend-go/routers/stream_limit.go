@@ -0,0 +1,33 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activeStreams 正在进行的MP4流式代理响应数
+var activeStreams atomic.Int64
+
+// acquireStreamSlot 占用一个流式代理名额（MAX_CONCURRENT_STREAMS），成功后调用方需调用 release
+// 已达到上限时立即返回false，不排队等待
+func acquireStreamSlot() (release func(), ok bool) {
+	limit := int64(config.Settings.MaxConcurrentStreams)
+	if limit <= 0 {
+		return func() {}, true
+	}
+	if activeStreams.Add(1) > limit {
+		activeStreams.Add(-1)
+		return nil, false
+	}
+	return func() { activeStreams.Add(-1) }, true
+}
+
+// writeTooManyStreams 流式代理并发达到上限时返回 503
+func writeTooManyStreams(c *gin.Context) {
+	c.Header("Retry-After", "5")
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: "同时播放的视频过多，请稍后重试"})
+}
@@ -0,0 +1,136 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImageSignatureCoversURLAndSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.URLSigningSecret = "test-secret"
+	config.Settings.SignedURLTTL = 60
+	config.Settings.SignedURLBindSession = true
+	config.Settings.ThumbnailHostCheck = true
+	config.Settings.ThumbnailFallback = false
+	config.Settings.ProxyAllowedHosts = []string{"img.example.com"}
+
+	r := gin.New()
+	r.GET("/api/stream/image/:video_id", getImage)
+
+	session := services.NewSigningSession()
+	other := services.NewSigningSession()
+	// 签名通过后因白名单被拒绝，不会真正请求上游
+	signed := services.SignPath("/api/stream/image/abc?url="+url.QueryEscape("http://evil.invalid/a.jpg"), session)
+
+	cases := []struct {
+		name    string
+		target  string
+		session string
+		want    string
+	}{
+		{"valid", signed, session, "不允许代理该地址"},
+		{"unsigned", "/api/stream/image/abc?url=" + url.QueryEscape("http://evil.invalid/a.jpg"), session, "链接签名无效或已过期"},
+		{"tampered url", strings.Replace(signed, "evil.invalid", "other.invalid", 1), session, "链接签名无效或已过期"},
+		{"other session", signed, other, "链接签名无效或已过期"},
+		{"no session", signed, "", "链接签名无效或已过期"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.session != "" {
+				req.AddCookie(&http.Cookie{Name: signingSessionCookie, Value: tc.session})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var body models.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusForbidden || body.Detail != tc.want {
+				t.Fatalf("status = %d, detail = %q, want 403 %q", w.Code, body.Detail, tc.want)
+			}
+		})
+	}
+
+	// 不绑定会话签发的链接（订阅封面）任何请求都能使用
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", services.SignPath("/api/stream/image/abc", ""), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("无会话签名 status = %d, want 404: %s", w.Code, w.Body.String())
+	}
+
+	// 过期链接
+	config.Settings.SignedURLTTL = -1
+	expired := services.SignPath("/api/stream/image/abc", "")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", expired, nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("过期链接 status = %d, want 403", w.Code)
+	}
+}
+
+func TestDirectStreamRequiresSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.URLSigningSecret = "test-secret"
+
+	r := gin.New()
+	r.GET("/api/stream/direct", getDirectStream)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/stream/direct?url="+url.QueryEscape("http://127.0.0.1/a.m3u8"), nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestSigningSessionIssuesCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.URLSigningSecret = "test-secret"
+	config.Settings.SignedURLBindSession = true
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/videos/abc", nil)
+	session := signingSession(c)
+	if !services.ValidSigningSession(session) || signingSession(c) != session {
+		t.Fatalf("session = %q", session)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != signingSessionCookie || cookies[0].Value != session || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+}
+
+func TestDirectStreamCacheBounded(t *testing.T) {
+	defer func() {
+		directStreamCache.Lock()
+		directStreamCache.data = make(map[string]directStreamEntry)
+		directStreamCache.Unlock()
+	}()
+
+	for i := 0; i < directStreamCacheMaxEntries+10; i++ {
+		storeDirectStream(fmt.Sprintf("key-%d", i), "#EXTM3U", time.Duration(i+1)*time.Minute)
+	}
+	directStreamCache.RLock()
+	defer directStreamCache.RUnlock()
+	if n := len(directStreamCache.data); n != directStreamCacheMaxEntries {
+		t.Fatalf("缓存条数 = %d, want %d", n, directStreamCacheMaxEntries)
+	}
+	if _, ok := directStreamCache.data["key-0"]; ok {
+		t.Fatal("最早过期的项应被淘汰")
+	}
+}
@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"backend-go/models"
+	"backend-go/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterTagRoutes 注册标签路由
+func RegisterTagRoutes(r *gin.RouterGroup) {
+	r.GET("/tags", listTags)
+}
+
+// listTags 列出已缓存视频的标签及各标签的视频数量
+func listTags(c *gin.Context) {
+	tags, err := services.GetCacheDBService().ListTags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "查询标签失败"})
+		return
+	}
+	c.JSON(http.StatusOK, models.TagListResponse{Tags: tags, Total: len(tags)})
+}
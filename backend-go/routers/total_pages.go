@@ -0,0 +1,94 @@
+package routers
+
+import (
+	"backend-go/config"
+	"sync"
+	"time"
+)
+
+// totalPagesEntry 一个分类已知的总页数
+type totalPagesEntry struct {
+	value     int
+	updatedAt time.Time
+}
+
+// 各分类已知的总页数，默认分类的键为空字符串
+var totalPagesCache = struct {
+	sync.RWMutex
+	data map[string]totalPagesEntry
+}{data: make(map[string]totalPagesEntry)}
+
+// totalPagesKey 分类在总页数缓存中的键，默认分类（含与 VIDEO_LIST_PATH 相同的分类）统一为空字符串
+func totalPagesKey(category string) string {
+	if _, isDefault := listPathForCategory(category); isDefault {
+		return ""
+	}
+	return category
+}
+
+// getTotalPages 获取分类已知的总页数，未知或超过 TOTAL_PAGES_CACHE_TTL 时返回1
+func getTotalPages(category string) int {
+	totalPagesCache.RLock()
+	entry, ok := totalPagesCache.data[totalPagesKey(category)]
+	totalPagesCache.RUnlock()
+
+	if !ok || totalPagesExpired(entry) {
+		return 1
+	}
+	return entry.value
+}
+
+// setTotalPages 记录分类的总页数，只记录大于1的值（抓取失败或只有一页时不覆盖已知值）
+// 超出 TOTAL_PAGES_CACHE_SIZE 时淘汰过期的和最久未更新的分类
+func setTotalPages(category string, totalPages int) {
+	if totalPages <= 1 {
+		return
+	}
+	key := totalPagesKey(category)
+
+	totalPagesCache.Lock()
+	defer totalPagesCache.Unlock()
+
+	if _, ok := totalPagesCache.data[key]; !ok {
+		pruneTotalPages()
+	}
+	totalPagesCache.data[key] = totalPagesEntry{value: totalPages, updatedAt: time.Now()}
+}
+
+// resetTotalPages 清空所有分类的总页数
+func resetTotalPages() {
+	totalPagesCache.Lock()
+	totalPagesCache.data = make(map[string]totalPagesEntry)
+	totalPagesCache.Unlock()
+}
+
+// totalPagesExpired 总页数是否已超过 TOTAL_PAGES_CACHE_TTL，0 为不过期
+func totalPagesExpired(entry totalPagesEntry) bool {
+	ttl := time.Duration(config.Settings.TotalPagesCacheTTL) * time.Second
+	return ttl > 0 && time.Since(entry.updatedAt) > ttl
+}
+
+// pruneTotalPages 为新分类腾出位置：先删除过期的记录，仍达到上限时删除最久未更新的分类（调用方持有写锁）
+func pruneTotalPages() {
+	limit := config.Settings.TotalPagesCacheSize
+	if limit <= 0 || len(totalPagesCache.data) < limit {
+		return
+	}
+
+	for key, entry := range totalPagesCache.data {
+		if totalPagesExpired(entry) {
+			delete(totalPagesCache.data, key)
+		}
+	}
+
+	for len(totalPagesCache.data) >= limit {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range totalPagesCache.data {
+			if oldest.IsZero() || entry.updatedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.updatedAt
+			}
+		}
+		delete(totalPagesCache.data, oldestKey)
+	}
+}
@@ -4,25 +4,48 @@ import (
 	"backend-go/config"
 	"backend-go/models"
 	"backend-go/services"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	totalPagesCache = struct {
-		sync.RWMutex
-		value int
-	}{value: 1}
+	// errNoVideoData 既未抓取到视频也没有缓存
+	errNoVideoData = errors.New("暂无视频数据")
 
 	precacheQueue = struct {
 		sync.RWMutex
 		set map[string]bool
 	}{set: make(map[string]bool)}
+
+	// 正在后台刷新详情的视频
+	detailRefreshing = struct {
+		sync.Mutex
+		set map[string]bool
+	}{set: make(map[string]bool)}
+
+	// 正在后台预取的列表页，按分类、布局配置和页码区分
+	listPrefetching = struct {
+		sync.Mutex
+		set map[categoryPageKey]bool
+	}{set: make(map[categoryPageKey]bool)}
+
+	// 各分类、布局配置下每页上次强制刷新的时间
+	listRefreshTimes = struct {
+		sync.Mutex
+		data map[categoryPageKey]time.Time
+	}{data: make(map[categoryPageKey]time.Time)}
 )
 
 // RegisterVideosRoutes 注册视频相关路由
@@ -30,13 +53,20 @@ func RegisterVideosRoutes(r *gin.RouterGroup) {
 	videos := r.Group("/videos")
 	{
 		videos.GET("", getVideoList)
+		videos.GET("/coverage", getListCoverage)
+		videos.GET("/feed", getVideoFeed)
+		videos.POST("/prefetch", prefetchVideoList)
 		videos.GET("/:video_id", getVideoDetail)
+		videos.GET("/:video_id/check", checkVideo)
 		videos.DELETE("/cache", clearVideoCache)
 	}
 }
 
 // getVideoList 获取视频列表
 func getVideoList(c *gin.Context) {
+	if rejectCookieProfile(c) {
+		return
+	}
 	page := 1
 	if p := c.Query("page"); p != "" {
 		if v, err := strconv.Atoi(p); err == nil && v > 0 {
@@ -44,39 +74,128 @@ func getVideoList(c *gin.Context) {
 		}
 	}
 
+	// 带 tag 时从已缓存的视频中按标签筛选，不抓取
+	if tag := strings.TrimSpace(c.Query("tag")); tag != "" {
+		listVideosByTag(c, tag, page)
+		return
+	}
+
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+	profile := c.Query("profile")
+	if !services.ValidListProfile(profile) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "未知的布局配置"})
+		return
+	}
+
+	// 超出该分类总页数或 LIST_MAX_PAGE 的页码不抓取
+	if maxPage := maxListPage(category); maxPage > 0 && page > maxPage {
+		if config.Settings.ListPageOverflow == "reject" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: fmt.Sprintf("页码超出范围，共%d页", maxPage)})
+			return
+		}
+		page = maxPage
+	}
+
+	// refresh=true 时跳过缓存直接抓取（同一页按 LIST_REFRESH_INTERVAL 限频）
+	refresh := c.Query("refresh") == "true" && allowListRefresh(category, profile, page)
+
+	response, maxAge, err := loadVideoList(page, category, profile, refresh)
+	if err != nil {
+		if errors.Is(err, errNoVideoData) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: err.Error()})
+			return
+		}
+		if writeScrapeError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Detail: "获取视频列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 带 session 时去掉本次浏览中已在其他页返回过的视频，结果与浏览历史有关，不允许客户端缓存
+	if session := c.Query("session"); session != "" && config.Settings.ListDedupeWindow > 0 {
+		deduped := *response
+		deduped.Videos = dedupeListPage(session, category, profile, page, response.Videos)
+		writeListResponse(c, deduped, 0)
+		return
+	}
+
+	writeListResponse(c, *response, maxAge)
+}
+
+// listVideosByTag 分页返回带有指定标签的已缓存视频，每页数量与缓存列表相同
+func listVideosByTag(c *gin.Context, tag string, page int) {
+	pageSize := config.Settings.CachePageSize
+	videos, total, err := services.GetCacheDBService().ListVideosByTag(tag, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "查询缓存失败"})
+		return
+	}
+
+	totalPages := 1
+	if total > 0 {
+		totalPages = (total + pageSize - 1) / pageSize
+	}
+	writeListResponse(c, models.VideoListResponse{
+		Videos:     videos,
+		Total:      total,
+		Page:       page,
+		TotalPages: totalPages,
+	}, 0)
+}
+
+// loadVideoList 获取视频列表：优先有效期内的缓存，其次实时抓取，失败时使用过期缓存兜底
+// 非默认分类不使用列表文件缓存，使用内存中的分类列表缓存；返回列表和客户端可缓存的秒数
+func loadVideoList(page int, category, profile string, refresh bool) (*models.VideoListResponse, int, error) {
 	cfg := config.Settings
 	cacheService := services.GetVideoCacheService()
 	scraperService := services.GetScraperService()
 
+	// 指定了布局配置时提取结果可能不同，与非默认分类一样按布局配置单独缓存，不使用列表文件缓存
+	if listPath, isDefault := listPathForCategory(category); !isDefault || profile != "" {
+		return loadCategoryPage(page, category, listPath, profile, refresh)
+	}
+
 	// 优先使用有效期内的缓存
-	if cfg.VideoCacheEnabled {
+	if cfg.VideoCacheEnabled && !refresh {
 		freshCache, err := cacheService.GetCachedList(page, cfg.VideoListCacheTTL)
 		if err == nil && freshCache != nil {
 			videos := parseVideosFromCache(freshCache)
 			total := getIntFromMap(freshCache, "total", len(videos))
 			totalPages := getIntFromMap(freshCache, "total_pages", 1)
 
-			if totalPages > 1 {
-				totalPagesCache.Lock()
-				totalPagesCache.value = totalPages
-				totalPagesCache.Unlock()
-			}
+			setTotalPages("", totalPages)
 
-			c.JSON(http.StatusOK, models.VideoListResponse{
+			services.GetMetrics().ListCacheHit()
+
+			// 客户端缓存时间取缓存剩余有效期
+			maxAge := cfg.VideoListCacheTTL
+			if modTime, err := cacheService.GetListCacheModTime(page); err == nil {
+				maxAge -= int(time.Since(modTime).Seconds())
+			}
+			return &models.VideoListResponse{
 				Videos:     videos,
 				Total:      total,
 				Page:       page,
 				TotalPages: totalPages,
-			})
-			return
+			}, maxAge, nil
 		}
 	}
 
-	// 缓存过期或不存在，尝试从网站获取
+	// 缓存过期或不存在，尝试从网站获取；未启用列表缓存时不计入缓存未命中
+	if cfg.VideoCacheEnabled {
+		services.GetMetrics().ListCacheMiss()
+	}
 	var result *services.VideoListResult
 	var fetchError error
 
-	result, fetchError = scraperService.GetVideoList(page)
+	result, fetchError = scraperService.GetVideoList(page, profile)
 
 	if fetchError != nil {
 		log.Printf("获取视频列表失败: %v", fetchError)
@@ -84,15 +203,9 @@ func getVideoList(c *gin.Context) {
 
 	// 获取成功且有数据
 	if result != nil && len(result.Videos) > 0 {
-		if result.TotalPages > 1 {
-			totalPagesCache.Lock()
-			totalPagesCache.value = result.TotalPages
-			totalPagesCache.Unlock()
-		}
+		setTotalPages("", result.TotalPages)
 
-		totalPagesCache.RLock()
-		tp := totalPagesCache.value
-		totalPagesCache.RUnlock()
+		tp := getTotalPages("")
 
 		response := models.VideoListResponse{
 			Videos:     result.Videos,
@@ -126,13 +239,16 @@ func getVideoList(c *gin.Context) {
 			go downloadThumbnails(result.Videos)
 
 			// 后台异步预缓存视频
-			if cfg.AutoPrecache {
+			if services.GetPrecacheControl().Enabled() {
 				go precacheVideos(result.Videos)
 			}
 		}
 
-		c.JSON(http.StatusOK, response)
-		return
+		maxAge := 0
+		if cfg.VideoCacheEnabled {
+			maxAge = cfg.VideoListCacheTTL
+		}
+		return &response, maxAge, nil
 	}
 
 	// 获取失败或无数据，尝试使用过期的缓存作为兜底
@@ -143,33 +259,265 @@ func getVideoList(c *gin.Context) {
 			total := getIntFromMap(fileCached, "total", len(videos))
 			totalPages := getIntFromMap(fileCached, "total_pages", 1)
 
-			if totalPages > 1 {
-				totalPagesCache.Lock()
-				totalPagesCache.value = totalPages
-				totalPagesCache.Unlock()
-			}
+			setTotalPages("", totalPages)
 
 			log.Printf("[Cache] 使用过期缓存兜底: 第%d页, %d个视频", page, len(videos))
-			c.JSON(http.StatusOK, models.VideoListResponse{
+			return &models.VideoListResponse{
 				Videos:     videos,
 				Total:      total,
 				Page:       page,
 				TotalPages: totalPages,
-			})
-			return
+			}, 0, nil
 		}
 	}
 
 	// 既无法获取也无缓存
 	if fetchError != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Detail: "获取视频列表失败: " + fetchError.Error(),
-		})
+		return nil, 0, fetchError
+	}
+	return nil, 0, errNoVideoData
+}
+
+// loadCategoryPage 获取非默认分类或指定了布局配置的一页视频：优先内存中有效期内的分类列表缓存，其次实时抓取并保存，
+// 抓取失败时使用过期缓存兜底；记录该分类的总页数，返回列表和客户端可缓存的秒数
+// VIDEO_LIST_CACHE_TTL 为0时不缓存，每次抓取只计入抓取次数，不计入列表缓存未命中
+func loadCategoryPage(page int, category, listPath, profile string, refresh bool) (*models.VideoListResponse, int, error) {
+	ttl := config.Settings.VideoListCacheTTL
+	entry, cached := getCategoryListCache(category, profile, page)
+	if cached && !refresh {
+		if remaining := int(time.Until(entry.ExpiresAt).Seconds()); remaining > 0 {
+			services.GetMetrics().ListCacheHit()
+			setTotalPages(category, entry.TotalPages)
+			return categoryListResponse(entry.Videos, page, category), remaining, nil
+		}
+	}
+	if ttl > 0 {
+		services.GetMetrics().ListCacheMiss()
+	}
+
+	result, err := services.GetScraperService().GetVideoListFromPath(page, profile, listPath)
+	if err != nil || result == nil || len(result.Videos) == 0 {
+		if cached {
+			log.Printf("[Cache] 使用过期缓存兜底: 分类%s 第%d页, %d个视频", category, page, len(entry.Videos))
+			return categoryListResponse(entry.Videos, page, category), 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, errNoVideoData
+	}
+
+	setTotalPages(category, result.TotalPages)
+	saveCategoryListCache(category, profile, page, result)
+	if config.Settings.VideoCacheEnabled {
+		go downloadThumbnails(result.Videos)
+		if services.GetPrecacheControl().Enabled() {
+			go precacheVideos(result.Videos)
+		}
+	}
+
+	return categoryListResponse(result.Videos, page, category), ttl, nil
+}
+
+// categoryListResponse 生成分类列表的响应，总页数取该分类已记录的值
+func categoryListResponse(videos []models.VideoItem, page int, category string) *models.VideoListResponse {
+	return &models.VideoListResponse{
+		Videos:     videos,
+		Total:      len(videos),
+		Page:       page,
+		TotalPages: getTotalPages(category),
+	}
+}
+
+// prefetchVideoList 客户端正在浏览第N页时，在后台抓取并缓存第N+1页，立即返回
+// 同一页同时只预取一次；熔断期间返回 503，抓取本身仍受列表锁限制
+func prefetchVideoList(c *gin.Context) {
+	if rejectCookieProfile(c) {
+		return
+	}
+	page := 1
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.Atoi(p); err == nil && v > 0 {
+			page = v
+		}
+	}
+	next := page + 1
+	cfg := config.Settings
+
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+	profile := c.Query("profile")
+	if !services.ValidListProfile(profile) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "未知的布局配置"})
+		return
+	}
+
+	if maxPage := maxListPage(category); !cfg.VideoCacheEnabled || services.GetMaintenance().Enabled() || (maxPage > 0 && next > maxPage) {
+		c.JSON(http.StatusOK, models.ListPrefetchResponse{Page: next, Status: "skipped"})
+		return
+	}
+	if listPageCached(category, profile, next) {
+		c.JSON(http.StatusOK, models.ListPrefetchResponse{Page: next, Status: "cached"})
+		return
+	}
+	if services.GetScraperService().BreakerRetryAfter() > 0 {
+		writeCircuitOpen(c)
+		return
+	}
+
+	key := categoryPageKey{category, profile, next}
+	listPrefetching.Lock()
+	if listPrefetching.set[key] {
+		listPrefetching.Unlock()
+		c.JSON(http.StatusOK, models.ListPrefetchResponse{Page: next, Status: "pending"})
+		return
+	}
+	listPrefetching.set[key] = true
+	listPrefetching.Unlock()
+
+	go func() {
+		defer func() {
+			listPrefetching.Lock()
+			delete(listPrefetching.set, key)
+			listPrefetching.Unlock()
+		}()
+		if _, _, err := loadVideoList(next, category, profile, false); err != nil {
+			log.Printf("[预取] 第%d页预取失败: %v", next, err)
+			return
+		}
+		log.Printf("[预取] 第%d页预取完成", next)
+	}()
+
+	c.JSON(http.StatusAccepted, models.ListPrefetchResponse{Page: next, Status: "queued"})
+}
+
+// listPageCached 列表页是否有有效期内的缓存，与 loadVideoList 使用同样的分类、布局配置缓存
+func listPageCached(category, profile string, page int) bool {
+	if _, isDefault := listPathForCategory(category); !isDefault || profile != "" {
+		entry, ok := getCategoryListCache(category, profile, page)
+		return ok && time.Now().Before(entry.ExpiresAt)
+	}
+	cached, err := services.GetVideoCacheService().GetCachedList(page, config.Settings.VideoListCacheTTL)
+	return err == nil && cached != nil
+}
+
+// maxListPage 允许请求的最大页码：分类已知的总页数和 LIST_MAX_PAGE 中较小者，0 表示不限制
+// 总页数只在抓取或缓存得到大于1的值后才视为已知
+func maxListPage(category string) int {
+	maxPage := config.Settings.ListMaxPage
+
+	total := getTotalPages(category)
+
+	if total > 1 && (maxPage <= 0 || total < maxPage) {
+		maxPage = total
+	}
+	return maxPage
+}
+
+// allowListRefresh 检查分类、布局配置下的该页是否允许强制刷新，允许时记录本次刷新时间
+// 同时清理已超过限频间隔的记录
+func allowListRefresh(category, profile string, page int) bool {
+	interval := time.Duration(config.Settings.ListRefreshInterval) * time.Second
+	key := categoryPageKey{category, profile, page}
+
+	listRefreshTimes.Lock()
+	defer listRefreshTimes.Unlock()
+
+	if last, ok := listRefreshTimes.data[key]; ok && time.Since(last) < interval {
+		log.Printf("第%d页刷新过于频繁，使用缓存", page)
+		return false
+	}
+	for k, last := range listRefreshTimes.data {
+		if time.Since(last) >= interval {
+			delete(listRefreshTimes.data, k)
+		}
+	}
+	listRefreshTimes.data[key] = time.Now()
+	return true
+}
+
+// listClientMaxAge 列表响应允许浏览器直接复用的最长秒数，之后凭 ETag 重新验证，避免刷新后仍看到旧列表
+const listClientMaxAge = 5
+
+// writeListResponse 返回视频列表，带ETag并处理 If-None-Match 条件请求
+// maxAge 为列表缓存的剩余秒数，客户端最多缓存 listClientMaxAge 秒，<=0 时要求客户端每次重新验证
+func writeListResponse(c *gin.Context, response models.VideoListResponse, maxAge int) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "序列化列表失败"})
+		return
+	}
+
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	c.Header("ETag", etag)
+	if maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", min(maxAge, listClientMaxAge)))
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	c.JSON(http.StatusNotFound, models.ErrorResponse{
-		Detail: "暂无视频数据",
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches 检查 If-None-Match 是否包含指定ETag（忽略弱校验前缀）
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// getListCoverage 获取列表页的视频缓存覆盖情况，只读取已缓存的列表（非默认分类读取内存中的分类列表缓存），不触发抓取
+func getListCoverage(c *gin.Context) {
+	page := 1
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.Atoi(p); err == nil && v > 0 {
+			page = v
+		}
+	}
+
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+
+	videos, ok := cachedListVideos(page, category)
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: "该页列表未缓存"})
+		return
+	}
+
+	cacheDB := services.GetCacheDBService()
+	uncached := make([]string, 0)
+	for _, v := range videos {
+		if !cacheDB.IsCached(v.ID) {
+			uncached = append(uncached, v.ID)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.CacheCoverageResponse{
+		Page:     page,
+		Category: category,
+		Total:    len(videos),
+		Cached:   len(videos) - len(uncached),
+		Uncached: uncached,
 	})
 }
 
@@ -178,21 +526,68 @@ func getVideoDetail(c *gin.Context) {
 	videoID := c.Param("video_id")
 	cacheService := services.GetVideoCacheService()
 	scraperService := services.GetScraperService()
-	cfg := config.Settings
+
+	// 指定了cookies配置时直接用该配置抓取，不使用也不更新详情缓存
+	if profile := c.Query("cookie_profile"); profile != "" {
+		getVideoDetailWithCookieProfile(c, videoID, profile)
+		return
+	}
 
 	// 如果视频文件已缓存，优先使用持久化的详情缓存
+	// 保存的详情无法播放（旧版或不完整的缓存缺少视频地址）时重新抓取并更新详情缓存
+	rescrape := false
 	if cacheService.IsCached(videoID) {
 		cachedDetail, err := cacheService.GetCachedDetail(videoID)
 		if err == nil && cachedDetail != nil {
-			c.JSON(http.StatusOK, cachedDetail)
-			return
+			if detailPlayable(videoID, cachedDetail) {
+				services.GetMetrics().DetailCacheHit()
+				c.JSON(http.StatusOK, withStreamURL(videoID, cachedDetail, signingSession(c)))
+				return
+			}
+			rescrape = true
+		}
+	}
+
+	// 视频未缓存时，在 DETAIL_STALE_WINDOW 内先返回上次保存的详情并在后台刷新（fresh=true 跳过）
+	// 保存的视频地址已过期时不能播放，直接重新抓取
+	staleWindow := time.Duration(config.Settings.DetailStaleWindow) * time.Second
+	if !config.Settings.VideoCacheEnabled {
+		staleWindow = 0
+	}
+	if !rescrape && staleWindow > 0 && c.Query("fresh") != "true" {
+		if modTime, err := cacheService.GetCachedDetailModTime(videoID); err == nil && time.Since(modTime) < staleWindow {
+			if cachedDetail, err := cacheService.GetCachedDetail(videoID); err == nil && cachedDetail != nil && !playlistExpired(cachedDetail) {
+				if detailPlayable(videoID, cachedDetail) {
+					services.GetMetrics().DetailCacheHit()
+					go refreshVideoDetail(videoID)
+					c.JSON(http.StatusOK, withStreamURL(videoID, cachedDetail, signingSession(c)))
+					return
+				}
+				rescrape = true
+			}
 		}
 	}
+	if rescrape {
+		log.Printf("[详情] %s 保存的详情缺少视频地址，重新抓取", videoID)
+	}
 
 	// 视频未缓存，每次都重新获取详情（使用新标签页避免冲突）
-	videoURL := cfg.TargetBaseURL + "/view_video.php?viewkey=" + videoID
+	services.GetMetrics().DetailCacheMiss()
+	videoURL := services.TargetBaseURL() + "/view_video.php?viewkey=" + videoID
 	detail, err := scraperService.GetVideoDetailInNewTab(videoURL)
 
+	if scrapeUnavailable(err) {
+		// 熔断、繁忙、维护或浏览器不可用时使用上次保存的详情兜底（去掉已过期的视频地址）
+		if cachedDetail, cacheErr := cacheService.GetCachedDetail(videoID); cacheErr == nil && cachedDetail != nil {
+			if playlistExpired(cachedDetail) {
+				cachedDetail.M3u8URL = ""
+			}
+			c.JSON(http.StatusOK, withStreamURL(videoID, cachedDetail, signingSession(c)))
+			return
+		}
+		writeScrapeError(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Detail: "获取视频详情失败: " + err.Error(),
@@ -207,16 +602,287 @@ func getVideoDetail(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, detail)
+	if services.CacheWritesEnabled() && (staleWindow > 0 || rescrape) {
+		cacheService.SaveDetail(videoID, detail)
+	}
+
+	c.JSON(http.StatusOK, withStreamURL(videoID, detail, signingSession(c)))
+}
+
+// playlistExpired 保存的视频地址带签名过期时间且已过期（或即将过期）
+func playlistExpired(detail *models.VideoDetail) bool {
+	expiry, ok := services.URLExpiry(detail.M3u8URL)
+	return ok && time.Now().After(expiry.Add(-videoURLExpiryMargin))
+}
+
+// detailPlayable 保存的详情能否用于播放：有视频地址，或视频文件已缓存（由代理返回本地文件）
+func detailPlayable(videoID string, detail *models.VideoDetail) bool {
+	if detail.M3u8URL != "" {
+		return true
+	}
+	return config.Settings.VideoCacheEnabled && services.GetVideoCacheService().IsCached(videoID)
+}
+
+// getVideoDetailWithCookieProfile 使用指定的cookies配置抓取视频详情
+func getVideoDetailWithCookieProfile(c *gin.Context, videoID, profile string) {
+	if !services.ValidCookieProfile(profile) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: services.ErrInvalidCookieProfile.Error()})
+		return
+	}
+
+	services.GetMetrics().DetailCacheMiss()
+	videoURL := services.TargetBaseURL() + "/view_video.php?viewkey=" + videoID
+	detail, err := services.GetScraperService().GetVideoDetailWithCookieProfile(videoURL, profile)
+	switch {
+	case errors.Is(err, services.ErrCookieProfileNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Detail: err.Error()})
+		return
+	case writeScrapeError(c, err):
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Detail: "获取视频详情失败: " + err.Error(),
+		})
+		return
+	}
+
+	if detail == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "视频不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, withStreamURL(videoID, detail, signingSession(c)))
+}
+
+// rejectCookieProfile 列表、预取、检测和流地址解析不支持按请求切换cookies配置，带 cookie_profile 时返回 400
+// 这些抓取共用浏览器的默认上下文，始终使用当前选择的配置；只有视频详情接口支持 cookie_profile
+func rejectCookieProfile(c *gin.Context) bool {
+	if c.Query("cookie_profile") == "" {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "该接口不支持 cookie_profile，只有视频详情接口支持"})
+	return true
+}
+
+// scrapeUnavailable 错误是否表示暂时无法抓取（熔断、繁忙、维护模式或浏览器不可用）
+func scrapeUnavailable(err error) bool {
+	return errors.Is(err, services.ErrCircuitOpen) || errors.Is(err, services.ErrScraperBusy) ||
+		errors.Is(err, services.ErrMaintenance) || errors.Is(err, services.ErrBrowserUnavailable)
+}
+
+// writeScrapeError 暂时无法抓取时写入对应的 503 响应并返回true，其他错误不处理，返回false
+func writeScrapeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrCircuitOpen):
+		writeCircuitOpen(c)
+	case errors.Is(err, services.ErrScraperBusy):
+		writeScraperBusy(c)
+	case errors.Is(err, services.ErrMaintenance):
+		writeMaintenance(c)
+	case errors.Is(err, services.ErrBrowserUnavailable):
+		writeBrowserUnavailable(c)
+	default:
+		return false
+	}
+	return true
+}
+
+// writeCircuitOpen 抓取熔断时返回 503，Retry-After 为熔断剩余时间
+func writeCircuitOpen(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(services.GetScraperService().BreakerRetryAfter()))
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: services.ErrCircuitOpen.Error()})
+}
+
+// writeMaintenance 维护模式下需要访问站点的请求返回 503 和维护提示
+func writeMaintenance(c *gin.Context) {
+	status := services.GetMaintenance().Status()
+	if status.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(status.RetryAfter))
+	}
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: status.Message})
+}
+
+// writeScraperBusy 抓取繁忙时返回 503，稍后重试
+func writeScraperBusy(c *gin.Context) {
+	c.Header("Retry-After", "5")
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: services.ErrScraperBusy.Error()})
+}
+
+// writeBrowserUnavailable 浏览器启动失败时返回 503，后台重试启用时 Retry-After 为重试间隔
+func writeBrowserUnavailable(c *gin.Context) {
+	if interval := config.Settings.BrowserInitRetryInterval; interval > 0 {
+		c.Header("Retry-After", strconv.Itoa(interval))
+	}
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{Detail: services.ErrBrowserUnavailable.Error()})
+}
+
+// refreshVideoDetail 后台重新获取视频详情并保存，同一视频同时只刷新一次
+func refreshVideoDetail(videoID string) {
+	detailRefreshing.Lock()
+	if detailRefreshing.set[videoID] {
+		detailRefreshing.Unlock()
+		return
+	}
+	detailRefreshing.set[videoID] = true
+	detailRefreshing.Unlock()
+
+	defer func() {
+		detailRefreshing.Lock()
+		delete(detailRefreshing.set, videoID)
+		detailRefreshing.Unlock()
+	}()
+
+	videoURL := services.TargetBaseURL() + "/view_video.php?viewkey=" + videoID
+	detail, err := services.GetScraperService().GetVideoDetailInNewTab(videoURL)
+	if err != nil || detail == nil {
+		log.Printf("[详情] 后台刷新 %s 失败: %v", videoID, err)
+		return
+	}
+	services.GetVideoCacheService().SaveDetail(videoID, detail)
+}
+
+// withStreamURL 返回附带（签名）流地址、封面图和字幕代理地址及缓存状态的详情副本，签名绑定 session
+func withStreamURL(videoID string, detail *models.VideoDetail, session string) models.VideoDetailResponse {
+	result := models.VideoDetailResponse{VideoDetail: *detail, Format: detail.Format}
+	result.StreamURL = services.SignPath("/api/stream/"+videoID, session)
+	result.Thumbnail = thumbnailProxyPath(videoID, detail.Thumbnail, session)
+
+	// 已缓存时代理返回本地文件，格式以缓存类型为准；旧版保存的详情没有格式时按URL判断
+	cacheService := services.GetVideoCacheService()
+	result.Cached = config.Settings.VideoCacheEnabled && cacheService.IsCached(videoID)
+	if result.Cached {
+		isMp4 := cacheService.GetCachedMp4Path(videoID) != ""
+		result.Format = services.StreamFormat(isMp4)
+		result.CacheType = "m3u8"
+		if isMp4 {
+			result.CacheType = "mp4"
+		}
+	} else if result.Format == "" && result.M3u8URL != "" {
+		result.Format = services.StreamFormat(services.IsMp4URL(result.M3u8URL))
+	}
+
+	// 已缓存的字幕走本地文件，否则代理上游地址
+	result.Subtitles = make([]models.Subtitle, len(detail.Subtitles))
+	for i, sub := range detail.Subtitles {
+		if cacheService.GetCachedSubtitlePath(videoID, i) != "" {
+			sub.ProxyURL = services.SignPath(fmt.Sprintf("/api/stream/cached-subtitle/%s/%d", videoID, i), session)
+		} else {
+			sub.ProxyURL = services.SubtitleProxyPath(sub.URL, session)
+		}
+		result.Subtitles[i] = sub
+	}
+	return result
+}
+
+// thumbnailProxyPath 获取（签名）封面图代理地址，封面已缓存时走本地文件，否则附带原始地址
+func thumbnailProxyPath(videoID, thumbnail, session string) string {
+	path := "/api/stream/image/" + url.PathEscape(videoID)
+	if config.Settings.VideoCacheEnabled && services.GetVideoCacheService().GetCachedThumbnailPath(videoID) != "" {
+		return services.SignPath(path, session)
+	}
+	if thumbnail == "" {
+		return ""
+	}
+	return services.SignPath(path+"?url="+url.QueryEscape(thumbnail), session)
+}
+
+// checkVideo 预检视频能否解析出播放地址（不下载、不修改缓存）
+func checkVideo(c *gin.Context) {
+	if rejectCookieProfile(c) {
+		return
+	}
+	videoID := c.Param("video_id")
+	scraperService := services.GetScraperService()
+	proxyService := services.GetProxyService()
+
+	videoURL := services.TargetBaseURL() + "/view_video.php?viewkey=" + videoID
+	detail, err := scraperService.GetVideoDetailInNewTab(videoURL)
+	if err != nil {
+		c.JSON(http.StatusOK, models.VideoCheckResponse{VideoID: videoID, Error: err.Error()})
+		return
+	}
+	if detail == nil || detail.M3u8URL == "" {
+		c.JSON(http.StatusOK, models.VideoCheckResponse{VideoID: videoID})
+		return
+	}
+
+	result := models.VideoCheckResponse{
+		VideoID: videoID,
+		Found:   true,
+		URL:     detail.M3u8URL,
+		Type:    "m3u8",
+	}
+	if proxyService.DetectIsMp4(detail.M3u8URL) {
+		result.Type = "mp4"
+	}
+
+	status, contentType, size, err := proxyService.HeadInfo(detail.M3u8URL)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Status = status
+		result.ContentType = contentType
+		if size > 0 {
+			result.Size = size
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
-// clearVideoCache 清除缓存
+// clearVideoCache 清除列表缓存（需要管理员权限）
+// 指定 page 时只清除该页，否则清除所有页的列表缓存文件、分类列表缓存和已知总页数；不影响已缓存的视频
 func clearVideoCache(c *gin.Context) {
-	totalPagesCache.Lock()
-	totalPagesCache.value = 1
-	totalPagesCache.Unlock()
+	if !verifyAdmin(c) {
+		return
+	}
+
+	category := c.Query("category")
+	if category != "" && !categoryPattern.MatchString(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的分类"})
+		return
+	}
+	_, isDefault := listPathForCategory(category)
+	cacheService := services.GetVideoCacheService()
 
-	c.JSON(http.StatusOK, gin.H{"message": "缓存已清除"})
+	// 指定页码时只清除该页
+	if p := c.Query("page"); p != "" {
+		page, err := strconv.Atoi(p)
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: "无效的页码"})
+			return
+		}
+
+		// 非默认分类和指定了布局配置的列表缓存在内存中
+		removed := deleteCategoryListCache(category, page)
+		if isDefault {
+			deleted, err := cacheService.DeleteListCache(page)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "删除列表缓存失败: " + err.Error()})
+				return
+			}
+			if deleted {
+				removed++
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("第%d页列表缓存已清除", page), "removed": removed})
+		return
+	}
+
+	// 未指定页码时清除所有列表缓存和已知总页数
+	removed, err := cacheService.ClearListCaches()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Detail: "清除列表缓存失败: " + err.Error()})
+		return
+	}
+
+	removed += clearCategoryListCache()
+
+	resetTotalPages()
+
+	c.JSON(http.StatusOK, gin.H{"message": "缓存已清除", "removed": removed})
 }
 
 // 辅助函数
@@ -233,6 +899,9 @@ func parseVideosFromCache(data map[string]interface{}) []models.VideoItem {
 					URL:       getStringFromMap(vm, "url"),
 					Duration:  getStringFromMap(vm, "duration"),
 				}
+				video.DurationSeconds = services.ParseDuration(video.Duration)
+				// 重启后从列表缓存恢复允许代理的封面图主机
+				services.RememberUpstreamHosts(video.Thumbnail)
 				videos = append(videos, video)
 			}
 		}
@@ -271,29 +940,55 @@ func downloadThumbnails(videos []models.VideoItem) {
 	}
 }
 
+// isPrecacheQueued 视频是否在等待预缓存
+func isPrecacheQueued(videoID string) bool {
+	precacheQueue.RLock()
+	defer precacheQueue.RUnlock()
+	return precacheQueue.set[videoID]
+}
+
 func precacheVideos(videos []models.VideoItem) {
 	cfg := config.Settings
-	log.Printf("[预缓存] 开始预缓存 %d 个视频, 并发数: %d", len(videos), cfg.PrecacheConcurrent)
-	sem := make(chan struct{}, cfg.PrecacheConcurrent)
+	cacheService := services.GetVideoCacheService()
+
+	// 每次最多预缓存 PRECACHE_MAX_VIDEOS 个未缓存的视频
+	if cfg.PrecacheMaxVideos > 0 {
+		var pending []models.VideoItem
+		for _, video := range videos {
+			if len(pending) >= cfg.PrecacheMaxVideos {
+				break
+			}
+			if !cacheService.IsCached(video.ID) && !cacheService.IsDownloading(video.ID) {
+				pending = append(pending, video)
+			}
+		}
+		videos = pending
+	}
+
+	// 并发数和开关可在运行时调整，每个任务开始前读取最新值
+	control := services.GetPrecacheControl()
+	log.Printf("[预缓存] 开始预缓存 %d 个视频, 并发数: %d", len(videos), control.Concurrent())
 
 	var wg sync.WaitGroup
 	for _, video := range videos {
 		wg.Add(1)
 		go func(v models.VideoItem) {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			precacheVideo(v.ID)
+			control.Acquire()
+			defer control.Release()
+			if !control.Enabled() {
+				return
+			}
+			precacheVideo(v.ID, services.PriorityBulk)
 		}(video)
 	}
 	wg.Wait()
 }
 
-func precacheVideo(videoID string) {
+func precacheVideo(videoID string, priority services.DownloadPriority) {
 	cacheService := services.GetVideoCacheService()
 	scraperService := services.GetScraperService()
 	proxyService := services.GetProxyService()
-	cfg := config.Settings
 
 	if cacheService.IsCached(videoID) {
 		return
@@ -301,6 +996,10 @@ func precacheVideo(videoID string) {
 	if cacheService.IsDownloading(videoID) {
 		return
 	}
+	// 已因超出可缓存上限跳过的视频不再抓取
+	if cacheService.IsTooLarge(videoID) {
+		return
+	}
 
 	precacheQueue.RLock()
 	if precacheQueue.set[videoID] {
@@ -319,7 +1018,20 @@ func precacheVideo(videoID string) {
 		precacheQueue.Unlock()
 	}()
 
-	videoURL := cfg.TargetBaseURL + "/view_video.php?viewkey=" + videoID
+	// 当天预算已用完时暂停预缓存，次日恢复
+	budget := services.GetPrecacheBudget()
+	if !budget.Reserve(videoID) {
+		log.Printf("[预缓存] 跳过 %s: 今日预缓存流量预算已用完", videoID)
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			budget.Release(videoID)
+		}
+	}()
+
+	videoURL := services.TargetBaseURL() + "/view_video.php?viewkey=" + videoID
 	detail, err := scraperService.GetVideoDetailInNewTab(videoURL)
 
 	if err != nil || detail == nil || detail.M3u8URL == "" {
@@ -333,10 +1045,14 @@ func precacheVideo(videoID string) {
 	}
 
 	videoSrc := detail.M3u8URL
-	isMp4 := containsIgnoreCase(videoSrc, ".mp4") || !containsIgnoreCase(videoSrc, ".m3u8")
 
+	// 抓取详情时已探测过格式则直接使用
+	isMp4 := detail.Format == "mp4"
+	if detail.Format == "" {
+		isMp4 = proxyService.DetectIsMp4(videoSrc)
+	}
 	if isMp4 {
-		cacheService.StartMp4CacheDownload(videoID, videoSrc, detail)
+		cacheService.StartMp4CacheDownload(videoID, videoSrc, detail, priority)
 	} else {
 		// 获取m3u8内容
 		client := proxyService.GetClient()
@@ -350,12 +1066,10 @@ func precacheVideo(videoID string) {
 		n, _ := resp.Body.Read(body)
 		originalM3u8 := string(body[:n])
 
-		cacheService.StartCacheDownload(videoID, videoSrc, originalM3u8, detail)
+		cacheService.StartCacheDownload(videoID, videoSrc, originalM3u8, detail, priority)
 	}
 
+	started = true
+	budget.Record(videoID)
 	log.Printf("[预缓存] 已启动: %s", videoID)
 }
-
-func containsIgnoreCase(s, substr string) bool {
-	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
-}
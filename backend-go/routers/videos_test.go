@@ -0,0 +1,262 @@
+package routers
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"backend-go/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadCategoryPageUsesCache(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoListCacheTTL = 300
+	defer clearCategoryListCache()
+
+	saveCategoryListCache("cachedcat", "", 2, &services.VideoListResult{
+		Videos:     []models.VideoItem{{ID: "catcached1"}},
+		TotalPages: 4,
+	})
+
+	// 有效期内的缓存直接返回，不抓取网站
+	resp, maxAge, err := loadCategoryPage(2, "cachedcat", "/v.php?category=cachedcat", "", false)
+	if err != nil {
+		t.Fatalf("读取分类缓存失败: %v", err)
+	}
+	if len(resp.Videos) != 1 || resp.Videos[0].ID != "catcached1" || resp.Page != 2 {
+		t.Fatalf("响应不正确: %+v", resp)
+	}
+	if maxAge <= 0 || maxAge > 300 {
+		t.Fatalf("maxAge = %d", maxAge)
+	}
+	if got := getTotalPages("cachedcat"); got != 4 {
+		t.Fatalf("总页数 = %d, want 4", got)
+	}
+}
+
+func TestLoadVideoListKeysCacheByProfile(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoCacheEnabled = true
+	config.Settings.VideoListCacheTTL = 300
+	defer clearCategoryListCache()
+
+	cacheService := services.GetVideoCacheService()
+	if err := cacheService.SaveListCache(1, map[string]interface{}{
+		"videos":      []map[string]interface{}{{"id": "autoitem"}},
+		"total":       1,
+		"page":        1,
+		"total_pages": 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer cacheService.DeleteListCache(1)
+	saveCategoryListCache("", "grid", 1, &services.VideoListResult{
+		Videos:     []models.VideoItem{{ID: "griditem"}},
+		TotalPages: 1,
+	})
+
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"", "autoitem"},
+		{"grid", "griditem"},
+	}
+	for _, tt := range tests {
+		resp, _, err := loadVideoList(1, "", tt.profile, false)
+		if err != nil {
+			t.Fatalf("profile=%q: %v", tt.profile, err)
+		}
+		if len(resp.Videos) != 1 || resp.Videos[0].ID != tt.want {
+			t.Errorf("profile=%q 返回 %+v, want %s", tt.profile, resp.Videos, tt.want)
+		}
+	}
+}
+
+func TestWriteListResponseLimitsClientCaching(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		maxAge int
+		want   string
+	}{
+		{12 * 60 * 60, "private, max-age=5"},
+		{3, "private, max-age=3"},
+		{0, "private, no-cache"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/videos", nil)
+		writeListResponse(c, models.VideoListResponse{Page: 1}, tc.maxAge)
+		if got := w.Header().Get("Cache-Control"); got != tc.want {
+			t.Fatalf("maxAge=%d: Cache-Control = %q, want %q", tc.maxAge, got, tc.want)
+		}
+		etag := w.Header().Get("ETag")
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/videos", nil)
+		c.Request.Header.Set("If-None-Match", etag)
+		writeListResponse(c, models.VideoListResponse{Page: 1}, tc.maxAge)
+		c.Writer.WriteHeaderNow()
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("If-None-Match 命中 status = %d, want 304", w.Code)
+		}
+	}
+}
+
+func TestAllowListRefreshKeyedByCategoryAndProfile(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ListRefreshInterval = 60
+	defer func() {
+		listRefreshTimes.Lock()
+		listRefreshTimes.data = make(map[categoryPageKey]time.Time)
+		listRefreshTimes.Unlock()
+	}()
+
+	if !allowListRefresh("", "", 1) {
+		t.Fatal("首次刷新应允许")
+	}
+	if allowListRefresh("", "", 1) {
+		t.Fatal("间隔内重复刷新同一页应拒绝")
+	}
+	if !allowListRefresh("hot", "", 1) || !allowListRefresh("", "mobile", 1) {
+		t.Fatal("其他分类或布局配置的同一页应允许刷新")
+	}
+
+	// 超过间隔的记录在下次刷新时清理
+	listRefreshTimes.Lock()
+	for k := range listRefreshTimes.data {
+		listRefreshTimes.data[k] = time.Now().Add(-2 * time.Minute)
+	}
+	listRefreshTimes.Unlock()
+	if !allowListRefresh("", "", 2) {
+		t.Fatal("其他页应允许刷新")
+	}
+	listRefreshTimes.Lock()
+	n := len(listRefreshTimes.data)
+	listRefreshTimes.Unlock()
+	if n != 1 {
+		t.Fatalf("过期记录未清理, 剩余 %d 条", n)
+	}
+}
+
+func TestPrefetchVideoListUsesCategoryProfileCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoCacheEnabled = true
+	config.Settings.VideoListCacheTTL = 300
+	config.Settings.ListMaxPage = 0
+	defer clearCategoryListCache()
+
+	saveCategoryListCache("", "mobile", 3, &services.VideoListResult{
+		Videos:     []models.VideoItem{{ID: "prefetched1"}},
+		TotalPages: 10,
+	})
+
+	r := gin.New()
+	r.POST("/api/videos/prefetch", prefetchVideoList)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/videos/prefetch?page=2&profile=mobile", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"cached"`) {
+		t.Fatalf("指定布局配置的缓存页应返回 cached: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/videos/prefetch?page=2&profile=nosuch", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("未知布局配置 status = %d, want 400", w.Code)
+	}
+}
+
+func TestPlaylistExpired(t *testing.T) {
+	past := time.Now().Add(-time.Minute).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+	cases := []struct {
+		url  string
+		want bool
+	}{
+		{"https://cdn.example.com/v.m3u8?e=" + strconv.FormatInt(past, 10), true},
+		{"https://cdn.example.com/v.m3u8?e=" + strconv.FormatInt(future, 10), false},
+		{"https://cdn.example.com/v.m3u8", false},
+	}
+	for _, tc := range cases {
+		if got := playlistExpired(&models.VideoDetail{M3u8URL: tc.url}); got != tc.want {
+			t.Fatalf("playlistExpired(%q) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestDetailResponseKeepsCacheStateOutOfSavedDetail(t *testing.T) {
+	detail := &models.VideoDetail{ID: "respfields", M3u8URL: "https://cdn.example.com/v.mp4", Format: "mp4"}
+	body, err := json.Marshal(withStreamURL("respfields", detail, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp map[string]any
+	json.Unmarshal(body, &resp)
+	if resp["cached"] != false || resp["format"] != "mp4" || resp["id"] != "respfields" {
+		t.Fatalf("response = %s", body)
+	}
+
+	saved, err := json.Marshal(detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), `"cached"`) || strings.Contains(string(saved), `"cache_type"`) {
+		t.Fatalf("保存的详情不应包含缓存状态: %s", saved)
+	}
+}
+
+func TestCookieProfileRejectedOutsideDetail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api")
+	RegisterVideosRoutes(api)
+	RegisterStreamRoutes(api)
+
+	for _, target := range []string{
+		"/api/videos?page=1&cookie_profile=alt",
+		"/api/videos/feed?cookie_profile=alt",
+		"/api/videos/abc/check?cookie_profile=alt",
+		"/api/stream/abc/info?cookie_profile=alt",
+		"/api/stream/abc?cookie_profile=alt",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "cookie_profile") {
+			t.Fatalf("%s: status = %d, body = %s", target, w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/videos/prefetch?cookie_profile=alt", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("prefetch: status = %d", w.Code)
+	}
+}
+
+func TestUnknownListProfileRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterVideosRoutes(r.Group("/api"))
+
+	for _, target := range []string{"/api/videos?page=1&profile=nosuch", "/api/videos/feed?profile=nosuch"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "未知的布局配置") {
+			t.Fatalf("%s: status = %d, body = %s", target, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"backend-go/config"
+	"log"
+	"time"
+)
+
+// idleCheckInterval 检查浏览器是否空闲的间隔
+const idleCheckInterval = 30 * time.Second
+
+// beginScrape 标记抓取开始，抓取期间不会因空闲关闭浏览器
+func (s *ScraperService) beginScrape() {
+	s.mu.Lock()
+	s.activeScrapes++
+	s.lastScrapeTime = time.Now()
+	s.mu.Unlock()
+}
+
+// endScrape 标记抓取结束，从此刻开始计算空闲时间
+func (s *ScraperService) endScrape() {
+	s.mu.Lock()
+	s.activeScrapes--
+	s.lastScrapeTime = time.Now()
+	s.mu.Unlock()
+}
+
+// StartIdleShutdown 浏览器连续 timeout 分钟没有抓取时关闭，下次抓取时重新初始化，timeout<=0时不启动
+func (s *ScraperService) StartIdleShutdown(timeout int) {
+	if timeout <= 0 {
+		return
+	}
+	GetScheduler().Register("browser_idle", idleCheckInterval, func() error {
+		s.closeIfIdle(time.Duration(timeout) * time.Minute)
+		return nil
+	})
+}
+
+// closeIfIdle 浏览器空闲超过 timeout 时关闭
+// 持有 listMu 和 mu 期间检查并关闭，新的抓取要么在关闭前开始（跳过本次关闭），要么在关闭后重新初始化浏览器
+func (s *ScraperService) closeIfIdle(timeout time.Duration) {
+	// cookies刷新等占用列表页面时跳过
+	if !s.listMu.TryLock() {
+		return
+	}
+	defer s.listMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.browser == nil || s.activeScrapes > 0 {
+		return
+	}
+	idle := time.Since(s.lastScrapeTime)
+	if idle < timeout {
+		return
+	}
+
+	if config.Settings.BrowserMode == "cdp" {
+		// 外部Chrome由用户管理：只关闭自己创建的列表页面并断开连接
+		if s.listPage != nil {
+			s.listPage.Close()
+		}
+		s.resetBrowserLocked()
+		log.Printf("[Scraper] 浏览器空闲 %d 分钟，已断开与Chrome的连接", int(idle.Minutes()))
+	} else {
+		s.closeLocked()
+		log.Printf("[Scraper] 浏览器空闲 %d 分钟，已关闭浏览器", int(idle.Minutes()))
+	}
+	// 列表页面已关闭，下次抓取需要重新导航
+	s.currentPageNum = 0
+}
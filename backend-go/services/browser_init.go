@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrBrowserUnavailable 浏览器启动或连接失败，暂时无法抓取
+var ErrBrowserUnavailable = errors.New("浏览器不可用，请稍后重试")
+
+// initializeInternal 内部初始化方法（不加锁），失败时返回包装了 ErrBrowserUnavailable 的错误并记录原因
+func (s *ScraperService) initializeInternal() error {
+	if s.browser != nil {
+		return nil
+	}
+	if err := s.launchBrowserLocked(); err != nil {
+		s.initError.Store(err.Error())
+		return fmt.Errorf("%w: %v", ErrBrowserUnavailable, err)
+	}
+	s.initError.Store("")
+	s.initialized.Store(true)
+	return nil
+}
+
+// InitError 最近一次浏览器初始化失败的原因，成功后为空
+func (s *ScraperService) InitError() string {
+	msg, _ := s.initError.Load().(string)
+	return msg
+}
+
+// StartInitRetry 启动时浏览器初始化失败后，每隔 interval 秒在后台重试，成功一次后不再重试
+// （之后因空闲关闭的浏览器由下次抓取重新启动），interval<=0 时不启动
+func (s *ScraperService) StartInitRetry(interval int) {
+	if interval <= 0 || s.initialized.Load() {
+		return
+	}
+	GetScheduler().Register("browser_init", time.Duration(interval)*time.Second, func() error {
+		if s.initialized.Load() {
+			return nil
+		}
+		if err := s.Initialize(); err != nil {
+			return err
+		}
+		log.Println("浏览器初始化重试成功")
+		return nil
+	})
+}
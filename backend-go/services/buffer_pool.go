@@ -0,0 +1,44 @@
+package services
+
+import (
+	"backend-go/config"
+	"sync"
+)
+
+// defaultTransferBufferSize STREAM_BUFFER_KB 未配置或无效时的读取缓冲区大小
+const defaultTransferBufferSize = 512 * 1024
+
+// transferBuffers MP4 流式代理和缓存下载共用的读取缓冲区，避免每个传输单独分配
+var transferBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, TransferBufferSize())
+		return &buf
+	},
+}
+
+// TransferBufferSize 读取缓冲区大小（STREAM_BUFFER_KB）
+func TransferBufferSize() int {
+	if size := config.Settings.StreamBufferKB * 1024; size > 0 {
+		return size
+	}
+	return defaultTransferBufferSize
+}
+
+// GetTransferBuffer 从共享池取出读取缓冲区，用完后调用 PutTransferBuffer 归还
+// 池中大小与当前配置不符的缓冲区（配置在运行中被修改）直接丢弃，重新分配
+func GetTransferBuffer() *[]byte {
+	buf := transferBuffers.Get().(*[]byte)
+	if size := TransferBufferSize(); len(*buf) != size {
+		fresh := make([]byte, size)
+		return &fresh
+	}
+	return buf
+}
+
+// PutTransferBuffer 归还读取缓冲区，大小与当前配置不符的缓冲区直接丢弃
+func PutTransferBuffer(buf *[]byte) {
+	if buf == nil || len(*buf) != TransferBufferSize() {
+		return
+	}
+	transferBuffers.Put(buf)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// byteRangeFragment 地址片段中记录字节范围的前缀，片段不会发送给上游
+const byteRangeFragment = "#byterange="
+
+var (
+	// mapByteRangeRe 匹配 #EXT-X-MAP 中的 BYTERANGE 属性
+	mapByteRangeRe = regexp.MustCompile(`,?BYTERANGE="([^"]+)"`)
+)
+
+// parseHLSByteRange 解析 "长度[@偏移]" 格式的字节范围，省略偏移时使用 nextOffset
+func parseHLSByteRange(value string, nextOffset int64) (int64, int64, bool) {
+	lengthPart, offsetPart, hasOffset := strings.Cut(strings.TrimSpace(value), "@")
+	length, err := strconv.ParseInt(lengthPart, 10, 64)
+	if err != nil || length <= 0 {
+		return 0, 0, false
+	}
+	offset := nextOffset
+	if hasOffset {
+		offset, err = strconv.ParseInt(offsetPart, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	return offset, length, true
+}
+
+// withByteRange 在地址后附加字节范围片段
+func withByteRange(rawURL string, offset, length int64) string {
+	return fmt.Sprintf("%s%s%d-%d", rawURL, byteRangeFragment, offset, offset+length-1)
+}
+
+// splitByteRange 拆分地址中的字节范围片段，返回上游地址和 Range 请求头（无范围时为空）
+func splitByteRange(rawURL string) (string, string) {
+	idx := strings.LastIndex(rawURL, byteRangeFragment)
+	if idx < 0 {
+		return rawURL, ""
+	}
+	return rawURL[:idx], "bytes=" + rawURL[idx+len(byteRangeFragment):]
+}
+
+// readRangeBody 读取按范围请求的响应
+// 上游忽略 Range 返回完整文件时，从中截取所需的部分
+func readRangeBody(resp *http.Response, rangeHeader string) ([]byte, error) {
+	if rangeHeader == "" || resp.StatusCode == http.StatusPartialContent {
+		return io.ReadAll(resp.Body)
+	}
+
+	var start, end int64
+	if _, err := fmt.Sscanf(strings.TrimPrefix(rangeHeader, "bytes="), "%d-%d", &start, &end); err != nil {
+		return nil, fmt.Errorf("无效的字节范围: %s", rangeHeader)
+	}
+	if _, err := io.CopyN(io.Discard, resp.Body, start); err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != end-start+1 {
+		return nil, fmt.Errorf("分片数据不完整: %s", rangeHeader)
+	}
+	return content, nil
+}
+
+// byteRangeTracker 按顺序跟踪m3u8中的 #EXT-X-BYTERANGE 标签
+// 未指定偏移的范围紧接同一资源上一个范围之后
+type byteRangeTracker struct {
+	pending  string
+	nextByte map[string]int64
+}
+
+// newByteRangeTracker 创建字节范围跟踪器
+func newByteRangeTracker() *byteRangeTracker {
+	return &byteRangeTracker{nextByte: make(map[string]int64)}
+}
+
+// consumeTag 记录 #EXT-X-BYTERANGE 标签，是该标签时返回true（标签本身不再输出）
+func (t *byteRangeTracker) consumeTag(line string) bool {
+	if !strings.HasPrefix(line, "#EXT-X-BYTERANGE:") {
+		return false
+	}
+	t.pending = strings.TrimPrefix(line, "#EXT-X-BYTERANGE:")
+	return true
+}
+
+// apply 将待处理的字节范围应用到分片地址
+func (t *byteRangeTracker) apply(absoluteURL string) string {
+	if t.pending == "" {
+		return absoluteURL
+	}
+	value := t.pending
+	t.pending = ""
+
+	offset, length, ok := parseHLSByteRange(value, t.nextByte[absoluteURL])
+	if !ok {
+		return absoluteURL
+	}
+	t.nextByte[absoluteURL] = offset + length
+	return withByteRange(absoluteURL, offset, length)
+}
+
+// mapByteRange 去掉 #EXT-X-MAP 中的 BYTERANGE 属性，返回新标签和需附加到初始化分片地址上的范围函数
+func mapByteRange(line string) (string, func(string) string) {
+	matches := mapByteRangeRe.FindStringSubmatch(line)
+	if matches == nil {
+		return line, func(u string) string { return u }
+	}
+	line = strings.Replace(line, matches[0], "", 1)
+	line = strings.Replace(line, "#EXT-X-MAP:,", "#EXT-X-MAP:", 1)
+
+	offset, length, ok := parseHLSByteRange(matches[1], 0)
+	if !ok {
+		return line, func(u string) string { return u }
+	}
+	return line, func(u string) string { return withByteRange(u, offset, length) }
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrVideoNotCached 视频未缓存
+	ErrVideoNotCached = errors.New("视频未缓存")
+	// ErrVideoDownloading 视频正在下载
+	ErrVideoDownloading = errors.New("视频正在下载中")
+
+	archiveFilePattern  = regexp.MustCompile(`^([A-Za-z0-9]+)(\.mp4|\.detail\.json|\.jpg|\.sub\d+\.vtt)$`)
+	archiveEntryPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// ExportVideo 将指定视频的缓存文件（视频、详情、封面图）打包为tar写入w
+func (v *VideoCacheService) ExportVideo(viewkey string, w io.Writer) error {
+	archive, err := v.OpenExport(viewkey)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	_, err = io.Copy(w, archive)
+	return err
+}
+
+// ImportVideo 从tar恢复单个视频的缓存文件和数据库记录，返回视频的viewkey
+func (v *VideoCacheService) ImportVideo(r io.Reader) (string, error) {
+	if err := os.MkdirAll(v.cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	// 先解压到缓存目录旁的临时目录（同一文件系统，可直接重命名），校验通过后再移入缓存目录，
+	// 同步和校正缓存时不会扫描到解压了一半的文件
+	staging, err := os.MkdirTemp(filepath.Dir(v.cacheDir), ".import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+
+	var viewkey string
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("读取压缩包失败: %v", err)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return "", fmt.Errorf("不支持的文件类型: %s", header.Name)
+		}
+
+		vk, rel, ok := parseArchiveName(header.Name)
+		if !ok {
+			return "", fmt.Errorf("非法文件路径: %s", header.Name)
+		}
+		if viewkey == "" {
+			viewkey = vk
+		} else if vk != viewkey {
+			return "", fmt.Errorf("压缩包包含多个视频")
+		}
+
+		dst := filepath.Join(staging, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", err
+		}
+		file, err := os.Create(dst)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("解压文件失败 %s: %v", header.Name, err)
+		}
+
+		top := strings.SplitN(rel, "/", 2)[0]
+		if !containsString(names, top) {
+			names = append(names, top)
+		}
+	}
+
+	if viewkey == "" {
+		return "", fmt.Errorf("压缩包为空")
+	}
+
+	// 校验视频文件完整性
+	_, mp4Err := os.Stat(filepath.Join(staging, viewkey+".mp4"))
+	_, m3u8Err := os.Stat(filepath.Join(staging, viewkey, "video.m3u8"))
+	_, completeErr := os.Stat(filepath.Join(staging, viewkey, ".complete"))
+	if mp4Err != nil && (m3u8Err != nil || completeErr != nil) {
+		return "", fmt.Errorf("压缩包缺少完整的视频文件")
+	}
+
+	if v.IsDownloading(viewkey) {
+		return "", ErrVideoDownloading
+	}
+
+	// 替换已有缓存
+	v.DeleteCachedVideo(viewkey)
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(staging, name), filepath.Join(v.cacheDir, name)); err != nil {
+			return "", fmt.Errorf("移动文件失败 %s: %v", name, err)
+		}
+	}
+
+	// 写入数据库
+	cacheType := "m3u8"
+	size := v.getDirSize(v.getVideoCacheDir(viewkey))
+	if mp4Err == nil {
+		cacheType = "mp4"
+		if info, err := os.Stat(v.getMp4CachePath(viewkey)); err == nil {
+			size = info.Size()
+		}
+	}
+	var title, thumbnail, originalURL, resolution string
+	var duration int
+	if detail, err := v.GetCachedDetail(viewkey); err == nil && detail != nil {
+		title = detail.Title
+		thumbnail = detail.Thumbnail
+		originalURL = detail.OriginalURL
+		duration = detail.Duration
+		resolution = detail.Resolution
+	}
+	GetCacheDBService().AddCachedVideo(viewkey, title, cacheType, size, thumbnail, originalURL, duration, resolution)
+
+	log.Printf("[Cache] 已导入视频: %s (%s)", viewkey, cacheType)
+	return viewkey, nil
+}
+
+// parseArchiveName 校验压缩包内的文件路径，返回所属viewkey和相对路径
+func parseArchiveName(name string) (string, string, bool) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if strings.HasPrefix(clean, "/") || strings.Contains(clean, "..") {
+		return "", "", false
+	}
+
+	parts := strings.Split(clean, "/")
+	switch len(parts) {
+	case 1:
+		// {viewkey}.mp4 / {viewkey}.detail.json / {viewkey}.jpg / {viewkey}.subN.vtt
+		matches := archiveFilePattern.FindStringSubmatch(parts[0])
+		if matches == nil {
+			return "", "", false
+		}
+		return matches[1], clean, true
+	case 2:
+		// {viewkey}/{文件}
+		if !ValidViewkey(parts[0]) || !archiveEntryPattern.MatchString(parts[1]) {
+			return "", "", false
+		}
+		return parts[0], clean, true
+	}
+	return "", "", false
+}
+
+// containsString 检查切片是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stagingProbeReader 读取压缩包期间检查缓存目录，确认解压中的文件不出现在缓存目录里
+type stagingProbeReader struct {
+	r        io.Reader
+	cacheDir string
+	leaked   []string
+}
+
+func (p *stagingProbeReader) Read(b []byte) (int, error) {
+	if entries, err := os.ReadDir(p.cacheDir); err == nil {
+		for _, entry := range entries {
+			p.leaked = append(p.leaked, entry.Name())
+		}
+	}
+	return p.r.Read(b)
+}
+
+func TestImportVideoStagesOutsideCacheDir(t *testing.T) {
+	v := NewVideoCacheService()
+	v.cacheDir = filepath.Join(t.TempDir(), "namespace")
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{"importvk.mp4", strings.Repeat("v", 64*1024)},
+		{"importvk.detail.json", `{"id":"importvk","title":"导入测试"}`},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次读取都很小，解压过程中多次检查缓存目录
+	probe := &stagingProbeReader{r: io.LimitReader(&buf, int64(buf.Len())), cacheDir: v.cacheDir}
+	viewkey, err := v.ImportVideo(&smallReader{probe})
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if viewkey != "importvk" {
+		t.Fatalf("viewkey = %q", viewkey)
+	}
+	if len(probe.leaked) > 0 {
+		t.Fatalf("解压期间缓存目录中出现了文件: %v", probe.leaked)
+	}
+	if info, err := os.Stat(v.getMp4CachePath(viewkey)); err != nil || info.Size() != 64*1024 {
+		t.Fatalf("导入的视频文件不正确: %v", err)
+	}
+
+	// 临时目录已清理
+	siblings, _ := os.ReadDir(filepath.Dir(v.cacheDir))
+	for _, entry := range siblings {
+		if strings.HasPrefix(entry.Name(), ".import-") {
+			t.Fatalf("临时目录未清理: %s", entry.Name())
+		}
+	}
+}
+
+// smallReader 每次最多读取 4KB
+type smallReader struct {
+	r io.Reader
+}
+
+func (s *smallReader) Read(b []byte) (int, error) {
+	if len(b) > 4096 {
+		b = b[:4096]
+	}
+	return s.r.Read(b)
+}
@@ -4,6 +4,7 @@ import (
 	"backend-go/config"
 	"backend-go/models"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,38 +16,51 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// errCorruptDB 数据库完整性检查未通过
+var errCorruptDB = errors.New("数据库完整性检查未通过")
+
 // CacheDBService 缓存数据库服务
 type CacheDBService struct {
 	db       *sql.DB
 	dbPath   string
 	cacheDir string
+	site     string // 当前缓存命名空间，记录按命名空间区分
 	mu       sync.RWMutex
+	// 缓存总大小，随增删记录更新，定期按磁盘重新计算
+	totalSize int64
 }
 
 // NewCacheDBService 创建缓存数据库服务实例
 func NewCacheDBService() *CacheDBService {
-	cacheDir := "cache/videos"
+	rootDir := cacheRootDir()
+	cacheDir := CacheNamespaceDir()
 	dbPath := ""
 	if config.Settings != nil {
-		cacheDir = config.Settings.VideoCacheDir
 		dbPath = config.Settings.CacheDBPath
 	}
 
 	// 转换为绝对路径
-	if !filepath.IsAbs(cacheDir) {
-		if abs, err := filepath.Abs(cacheDir); err == nil {
-			cacheDir = abs
+	for _, dir := range []*string{&rootDir, &cacheDir} {
+		if !filepath.IsAbs(*dir) {
+			if abs, err := filepath.Abs(*dir); err == nil {
+				*dir = abs
+			}
 		}
 	}
 
+	// 纯代理模式不创建目录，也不打开数据库
+	pureProxy := config.Settings != nil && config.Settings.PureProxy
+
 	// 确保缓存目录存在
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		log.Printf("[CacheDB] 创建缓存目录失败: %v", err)
+	if !pureProxy {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			log.Printf("[CacheDB] 创建缓存目录失败: %v", err)
+		}
 	}
 
-	// 如果未配置数据库路径，默认放在缓存目录下
+	// 如果未配置数据库路径，默认放在缓存根目录下，各命名空间共用
 	if dbPath == "" {
-		dbPath = filepath.Join(cacheDir, "cache.db")
+		dbPath = filepath.Join(rootDir, "cache.db")
 	} else {
 		// 转换为绝对路径
 		if !filepath.IsAbs(dbPath) {
@@ -61,15 +75,18 @@ func NewCacheDBService() *CacheDBService {
 	}
 
 	// 确保数据库文件所在目录存在
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		log.Printf("[CacheDB] 创建数据库目录失败: %v", err)
+	if !pureProxy {
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			log.Printf("[CacheDB] 创建数据库目录失败: %v", err)
+		}
 	}
 
-	log.Printf("[CacheDB] 数据库路径: %s", dbPath)
+	log.Printf("[CacheDB] 数据库路径: %s，命名空间: %s", dbPath, CacheNamespace())
 
 	return &CacheDBService{
 		dbPath:   dbPath,
 		cacheDir: cacheDir,
+		site:     CacheNamespace(),
 	}
 }
 
@@ -78,50 +95,241 @@ func (s *CacheDBService) Initialize() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	db, err := s.openDB()
+	if err == nil {
+		if err = checkDBIntegrity(db); err != nil {
+			db.Close()
+		}
+	}
+
+	// 数据库损坏（如写入时断电）时移到一旁并重建，缓存记录随后从文件系统重新同步
+	if err != nil {
+		if !isCorruptDBError(err) {
+			return err
+		}
+
+		log.Printf("[CacheDB] 数据库已损坏: %v", err)
+		backupPath, moveErr := s.moveCorruptDB()
+		if moveErr != nil {
+			return fmt.Errorf("移除损坏的数据库失败: %w", moveErr)
+		}
+		log.Printf("[CacheDB] 已将损坏的数据库移至 %s，重新创建数据库，缓存记录将从文件系统重新同步", backupPath)
+
+		if db, err = s.openDB(); err != nil {
+			return err
+		}
+	}
+
+	s.db = db
+
+	// 创建表
+	if err := s.createTables(); err != nil {
+		return err
+	}
+	s.totalSize = s.sumSizeLocked()
+
+	log.Printf("[CacheDB] 数据库初始化完成: %s", s.dbPath)
+	return nil
+}
+
+// openDB 打开数据库并测试连接
+func (s *CacheDBService) openDB() (*sql.DB, error) {
 	// 使用 file: 前缀和参数确保正确创建数据库
 	dsn := "file:" + s.dbPath + "?_pragma=busy_timeout(5000)"
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 测试连接
 	if err := db.Ping(); err != nil {
 		db.Close()
-		return fmt.Errorf("数据库连接测试失败: %w", err)
+		return nil, fmt.Errorf("数据库连接测试失败: %w", err)
 	}
+	return db, nil
+}
 
-	s.db = db
+// checkDBIntegrity 执行 PRAGMA integrity_check，结果不是 ok 时返回错误
+func checkDBIntegrity(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("数据库完整性检查失败: %w", err)
+	}
+	defer rows.Close()
 
-	// 创建表
-	if err := s.createTables(); err != nil {
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return err
 	}
 
-	log.Printf("[CacheDB] 数据库初始化完成: %s", s.dbPath)
+	if len(problems) > 0 {
+		if len(problems) > 5 {
+			problems = problems[:5]
+		}
+		return fmt.Errorf("%w: %s", errCorruptDB, strings.Join(problems, "; "))
+	}
 	return nil
 }
 
+// isCorruptDBError 判断错误是否表示数据库文件损坏
+func isCorruptDBError(err error) bool {
+	if errors.Is(err, errCorruptDB) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "malformed") || strings.Contains(msg, "not a database")
+}
+
+// moveCorruptDB 将损坏的数据库文件（含 -wal/-shm）重命名为 .corrupt-时间戳，返回备份路径
+func (s *CacheDBService) moveCorruptDB() (string, error) {
+	backupPath := fmt.Sprintf("%s.corrupt-%s", s.dbPath, time.Now().Format("20060102150405"))
+	if err := os.Rename(s.dbPath, backupPath); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(s.dbPath + suffix); err == nil {
+			os.Rename(s.dbPath+suffix, backupPath+suffix)
+		}
+	}
+	return backupPath, nil
+}
+
 // createTables 创建数据库表
 func (s *CacheDBService) createTables() error {
 	schema := `
-	CREATE TABLE IF NOT EXISTS cached_videos (
-		viewkey TEXT PRIMARY KEY,
+	CREATE TABLE IF NOT EXISTS cached_videos (` + cachedVideosColumns + `);
+	CREATE TABLE IF NOT EXISTS video_tags (
+		site TEXT NOT NULL DEFAULT '',
+		viewkey TEXT NOT NULL,
+		tag TEXT NOT NULL COLLATE NOCASE,
+		PRIMARY KEY (site, viewkey, tag)
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	if err := s.migrateColumns(map[string]string{
+		"duration":   "INTEGER NOT NULL DEFAULT 0",
+		"resolution": "TEXT NOT NULL DEFAULT ''",
+	}); err != nil {
+		return err
+	}
+	if err := s.migrateSite(); err != nil {
+		return err
+	}
+
+	indexes := `
+	CREATE INDEX IF NOT EXISTS idx_cached_at ON cached_videos(site, cached_at);
+	CREATE INDEX IF NOT EXISTS idx_size ON cached_videos(size);
+	CREATE INDEX IF NOT EXISTS idx_title ON cached_videos(title);
+	CREATE INDEX IF NOT EXISTS idx_tag ON video_tags(site, tag);
+	`
+	_, err := s.db.Exec(indexes)
+	return err
+}
+
+// cachedVideosColumns cached_videos 表结构，同一 viewkey 在不同命名空间中各自独立
+const cachedVideosColumns = `
+		site TEXT NOT NULL DEFAULT '',
+		viewkey TEXT NOT NULL,
 		title TEXT,
 		type TEXT NOT NULL,
 		size INTEGER NOT NULL DEFAULT 0,
 		thumbnail TEXT,
 		original_url TEXT,
-		cached_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_cached_at ON cached_videos(cached_at);
-	CREATE INDEX IF NOT EXISTS idx_size ON cached_videos(size);
-	CREATE INDEX IF NOT EXISTS idx_title ON cached_videos(title);
+		duration INTEGER NOT NULL DEFAULT 0,
+		resolution TEXT NOT NULL DEFAULT '',
+		cached_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (site, viewkey)
 	`
 
-	_, err := s.db.Exec(schema)
-	return err
+// tableColumns 获取 cached_videos 已有的列
+func (s *CacheDBService) tableColumns() (map[string]bool, error) {
+	rows, err := s.db.Query("PRAGMA table_info(cached_videos)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err == nil {
+			existing[name] = true
+		}
+	}
+	return existing, rows.Err()
+}
+
+// migrateSite 旧版数据库没有命名空间列（主键只有 viewkey），重建表并将已有记录归入当前命名空间
+func (s *CacheDBService) migrateSite() error {
+	existing, err := s.tableColumns()
+	if err != nil {
+		return err
+	}
+	if existing["site"] {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns := "viewkey, title, type, size, thumbnail, original_url, duration, resolution, cached_at"
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DROP TABLE IF EXISTS cached_videos_new", nil},
+		{"CREATE TABLE cached_videos_new (" + cachedVideosColumns + ")", nil},
+		{"INSERT INTO cached_videos_new (site, " + columns + ") SELECT ?, " + columns + " FROM cached_videos", []interface{}{s.site}},
+		{"DROP TABLE cached_videos", nil},
+		{"ALTER TABLE cached_videos_new RENAME TO cached_videos", nil},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return fmt.Errorf("迁移命名空间失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("迁移命名空间失败: %w", err)
+	}
+	log.Printf("[CacheDB] 已将现有缓存记录迁入命名空间: %s", s.site)
+	return nil
+}
+
+// migrateColumns 为旧版本数据库补充缺失的列
+func (s *CacheDBService) migrateColumns(columns map[string]string) error {
+	existing, err := s.tableColumns()
+	if err != nil {
+		return err
+	}
+
+	for name, definition := range columns {
+		if existing[name] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE cached_videos ADD COLUMN %s %s", name, definition)); err != nil {
+			return fmt.Errorf("添加列 %s 失败: %w", name, err)
+		}
+		log.Printf("[CacheDB] 已添加列: %s", name)
+	}
+	return nil
 }
 
 // Close 关闭数据库连接
@@ -141,7 +349,7 @@ func (s *CacheDBService) isReady() bool {
 }
 
 // AddCachedVideo 添加缓存视频记录
-func (s *CacheDBService) AddCachedVideo(viewkey, title, cacheType string, size int64, thumbnail, originalURL string) error {
+func (s *CacheDBService) AddCachedVideo(viewkey, title, cacheType string, size int64, thumbnail, originalURL string, duration int, resolution string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -149,15 +357,19 @@ func (s *CacheDBService) AddCachedVideo(viewkey, title, cacheType string, size i
 		return fmt.Errorf("数据库未初始化")
 	}
 
+	oldSize := s.videoSizeLocked(viewkey)
+
 	query := `
-	INSERT OR REPLACE INTO cached_videos (viewkey, title, type, size, thumbnail, original_url, cached_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT OR REPLACE INTO cached_videos (site, viewkey, title, type, size, thumbnail, original_url, duration, resolution, cached_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := s.db.Exec(query, viewkey, title, cacheType, size, thumbnail, originalURL, time.Now())
+	_, err := s.db.Exec(query, s.site, viewkey, title, cacheType, size, thumbnail, originalURL, duration, resolution, time.Now())
 	if err != nil {
 		log.Printf("[CacheDB] 添加缓存记录失败 %s: %v", viewkey, err)
+		return err
 	}
-	return err
+	s.totalSize += size - oldSize
+	return nil
 }
 
 // UpdateVideoSize 更新视频大小
@@ -169,8 +381,15 @@ func (s *CacheDBService) UpdateVideoSize(viewkey string, size int64) error {
 		return fmt.Errorf("数据库未初始化")
 	}
 
-	_, err := s.db.Exec("UPDATE cached_videos SET size = ? WHERE viewkey = ?", size, viewkey)
-	return err
+	oldSize := s.videoSizeLocked(viewkey)
+	result, err := s.db.Exec("UPDATE cached_videos SET size = ? WHERE site = ? AND viewkey = ?", size, s.site, viewkey)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		s.totalSize += size - oldSize
+	}
+	return nil
 }
 
 // DeleteCachedVideo 删除缓存记录
@@ -182,11 +401,16 @@ func (s *CacheDBService) DeleteCachedVideo(viewkey string) error {
 		return fmt.Errorf("数据库未初始化")
 	}
 
-	_, err := s.db.Exec("DELETE FROM cached_videos WHERE viewkey = ?", viewkey)
-	return err
+	oldSize := s.videoSizeLocked(viewkey)
+	if _, err := s.db.Exec("DELETE FROM cached_videos WHERE site = ? AND viewkey = ?", s.site, viewkey); err != nil {
+		return err
+	}
+	s.db.Exec("DELETE FROM video_tags WHERE site = ? AND viewkey = ?", s.site, viewkey)
+	s.totalSize -= oldSize
+	return nil
 }
 
-// ClearAll 清空所有缓存记录
+// ClearAll 清空当前命名空间的所有缓存记录
 func (s *CacheDBService) ClearAll() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -195,8 +419,29 @@ func (s *CacheDBService) ClearAll() error {
 		return fmt.Errorf("数据库未初始化")
 	}
 
-	_, err := s.db.Exec("DELETE FROM cached_videos")
-	return err
+	if _, err := s.db.Exec("DELETE FROM cached_videos WHERE site = ?", s.site); err != nil {
+		return err
+	}
+	s.db.Exec("DELETE FROM video_tags WHERE site = ?", s.site)
+	s.totalSize = 0
+	return nil
+}
+
+// videoSizeLocked 查询单个视频记录的大小，不存在时为0（调用方需持有 mu）
+func (s *CacheDBService) videoSizeLocked(viewkey string) int64 {
+	var size int64
+	s.db.QueryRow("SELECT size FROM cached_videos WHERE site = ? AND viewkey = ?", s.site, viewkey).Scan(&size)
+	return size
+}
+
+// sumSizeLocked 从数据库汇总缓存大小（调用方需持有 mu）
+func (s *CacheDBService) sumSizeLocked() int64 {
+	var total sql.NullInt64
+	s.db.QueryRow("SELECT SUM(size) FROM cached_videos WHERE site = ?", s.site).Scan(&total)
+	if total.Valid {
+		return total.Int64
+	}
+	return 0
 }
 
 // GetCachedVideo 获取单个缓存视频信息
@@ -210,9 +455,9 @@ func (s *CacheDBService) GetCachedVideo(viewkey string) (*models.CacheInfo, erro
 
 	var info models.CacheInfo
 	err := s.db.QueryRow(
-		"SELECT viewkey, type, size FROM cached_videos WHERE viewkey = ?",
-		viewkey,
-	).Scan(&info.Viewkey, &info.Type, &info.Size)
+		"SELECT viewkey, type, size, duration, resolution FROM cached_videos WHERE site = ? AND viewkey = ?",
+		s.site, viewkey,
+	).Scan(&info.Viewkey, &info.Type, &info.Size, &info.Duration, &info.Resolution)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -234,15 +479,15 @@ func (s *CacheDBService) ListCachedVideos(page, pageSize int) ([]models.CacheInf
 
 	// 获取总数
 	var total int
-	if err := s.db.QueryRow("SELECT COUNT(*) FROM cached_videos").Scan(&total); err != nil {
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM cached_videos WHERE site = ?", s.site).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	// 分页查询
 	offset := (page - 1) * pageSize
 	rows, err := s.db.Query(
-		"SELECT viewkey, type, size FROM cached_videos ORDER BY cached_at DESC LIMIT ? OFFSET ?",
-		pageSize, offset,
+		"SELECT viewkey, type, size, duration, resolution FROM cached_videos WHERE site = ? ORDER BY cached_at DESC LIMIT ? OFFSET ?",
+		s.site, pageSize, offset,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -252,7 +497,7 @@ func (s *CacheDBService) ListCachedVideos(page, pageSize int) ([]models.CacheInf
 	var videos []models.CacheInfo
 	for rows.Next() {
 		var info models.CacheInfo
-		if err := rows.Scan(&info.Viewkey, &info.Type, &info.Size); err != nil {
+		if err := rows.Scan(&info.Viewkey, &info.Type, &info.Size, &info.Duration, &info.Resolution); err != nil {
 			continue
 		}
 		videos = append(videos, info)
@@ -261,21 +506,194 @@ func (s *CacheDBService) ListCachedVideos(page, pageSize int) ([]models.CacheInf
 	return videos, total, nil
 }
 
-// GetTotalSize 获取缓存总大小
+// ListCachedRecords 分页查询缓存视频的完整记录（含标题、封面、原始地址和缓存时间），按缓存时间倒序
+// missingTitle 为true时只返回标题为空或为默认值 "Video" 的记录
+func (s *CacheDBService) ListCachedRecords(page, pageSize int, missingTitle bool) ([]models.CachedRecord, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return nil, 0, fmt.Errorf("数据库未初始化")
+	}
+
+	where := " FROM cached_videos WHERE site = ?"
+	if missingTitle {
+		where += " AND (title IS NULL OR TRIM(title) = '' OR title = 'Video')"
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*)"+where, s.site).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	rows, err := s.db.Query(
+		"SELECT viewkey, COALESCE(title, ''), type, size, COALESCE(thumbnail, ''), COALESCE(original_url, ''), duration, resolution, cached_at"+where+" ORDER BY cached_at DESC LIMIT ? OFFSET ?",
+		s.site, pageSize, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	records := []models.CachedRecord{}
+	for rows.Next() {
+		var record models.CachedRecord
+		var cachedAt sql.NullTime
+		if err := rows.Scan(&record.Viewkey, &record.Title, &record.Type, &record.Size, &record.Thumbnail,
+			&record.OriginalURL, &record.Duration, &record.Resolution, &cachedAt); err != nil {
+			continue
+		}
+		if cachedAt.Valid {
+			record.CachedAt = cachedAt.Time.Format(time.RFC3339)
+		}
+		records = append(records, record)
+	}
+	return records, total, nil
+}
+
+// SetVideoTags 替换视频的标签记录
+func (s *CacheDBService) SetVideoTags(viewkey string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM video_tags WHERE site = ? AND viewkey = ?", s.site, viewkey); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO video_tags (site, viewkey, tag) VALUES (?, ?, ?)", s.site, viewkey, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteVideoTags 删除视频的标签记录
+func (s *CacheDBService) DeleteVideoTags(viewkey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	_, err := s.db.Exec("DELETE FROM video_tags WHERE site = ? AND viewkey = ?", s.site, viewkey)
+	return err
+}
+
+// ListTags 统计已缓存视频的标签，按视频数量从多到少排列
+func (s *CacheDBService) ListTags() ([]models.TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+
+	rows, err := s.db.Query(`
+	SELECT t.tag, COUNT(*) AS count FROM video_tags t
+	JOIN cached_videos v ON v.site = t.site AND v.viewkey = t.viewkey
+	WHERE t.site = ?
+	GROUP BY t.tag
+	ORDER BY count DESC, t.tag
+	`, s.site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// ListVideosByTag 分页查询带有指定标签的已缓存视频（标签不区分大小写）
+func (s *CacheDBService) ListVideosByTag(tag string, page, pageSize int) ([]models.VideoItem, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return nil, 0, fmt.Errorf("数据库未初始化")
+	}
+
+	const from = `
+	FROM cached_videos v
+	JOIN video_tags t ON t.site = v.site AND t.viewkey = v.viewkey
+	WHERE v.site = ? AND t.tag = ?
+	`
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*)"+from, s.site, tag).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	rows, err := s.db.Query(
+		"SELECT v.viewkey, COALESCE(v.title, ''), COALESCE(v.thumbnail, ''), COALESCE(v.original_url, ''), v.duration"+from+"ORDER BY v.cached_at DESC LIMIT ? OFFSET ?",
+		s.site, tag, pageSize, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	videos := []models.VideoItem{}
+	for rows.Next() {
+		var video models.VideoItem
+		if err := rows.Scan(&video.ID, &video.Title, &video.Thumbnail, &video.URL, &video.DurationSeconds); err != nil {
+			continue
+		}
+		videos = append(videos, video)
+	}
+	return videos, total, nil
+}
+
+// GetTotalSize 获取缓存总大小（读取维护中的累计值，不查询数据库和磁盘）
 func (s *CacheDBService) GetTotalSize() int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.totalSize
+}
+
+// GetTotalsByType 按缓存类型汇总数据库中的视频数和大小，按类型名排序
+func (s *CacheDBService) GetTotalsByType() ([]models.CacheTypeTotal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	if s.db == nil {
-		return 0
+		return nil, fmt.Errorf("数据库未初始化")
 	}
 
-	var total sql.NullInt64
-	s.db.QueryRow("SELECT SUM(size) FROM cached_videos").Scan(&total)
-	if total.Valid {
-		return total.Int64
+	rows, err := s.db.Query("SELECT type, COUNT(*), COALESCE(SUM(size), 0) FROM cached_videos WHERE site = ? GROUP BY type ORDER BY type", s.site)
+	if err != nil {
+		return nil, err
 	}
-	return 0
+	defer rows.Close()
+
+	totals := []models.CacheTypeTotal{}
+	for rows.Next() {
+		var total models.CacheTypeTotal
+		if err := rows.Scan(&total.Type, &total.Count, &total.Size); err != nil {
+			continue
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
 }
 
 // GetTotalCount 获取缓存总数
@@ -288,7 +706,7 @@ func (s *CacheDBService) GetTotalCount() int {
 	}
 
 	var count int
-	s.db.QueryRow("SELECT COUNT(*) FROM cached_videos").Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM cached_videos WHERE site = ?", s.site).Scan(&count)
 	return count
 }
 
@@ -302,16 +720,22 @@ func (s *CacheDBService) IsCached(viewkey string) bool {
 	}
 
 	var count int
-	s.db.QueryRow("SELECT COUNT(*) FROM cached_videos WHERE viewkey = ?", viewkey).Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM cached_videos WHERE site = ? AND viewkey = ?", s.site, viewkey).Scan(&count)
 	return count > 0
 }
 
 // SyncFromFileSystem 从文件系统同步缓存数据到数据库
 func (s *CacheDBService) SyncFromFileSystem(cacheService *VideoCacheService) error {
+	_, err := s.syncFromFileSystem(cacheService)
+	return err
+}
+
+// syncFromFileSystem 将磁盘上有但数据库中没有的缓存写入数据库，返回新增数量
+func (s *CacheDBService) syncFromFileSystem(cacheService *VideoCacheService) (int, error) {
 	// 检查数据库是否已初始化
 	if s.db == nil {
 		log.Println("[CacheDB] 数据库未初始化，跳过同步")
-		return nil
+		return 0, nil
 	}
 
 	log.Println("[CacheDB] 开始从文件系统同步缓存数据...")
@@ -319,9 +743,9 @@ func (s *CacheDBService) SyncFromFileSystem(cacheService *VideoCacheService) err
 	entries, err := os.ReadDir(s.cacheDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return 0, nil
 		}
-		return err
+		return 0, err
 	}
 
 	syncCount := 0
@@ -361,20 +785,109 @@ func (s *CacheDBService) SyncFromFileSystem(cacheService *VideoCacheService) err
 		}
 
 		// 尝试获取详情
-		var title, thumbnail, originalURL string
+		var title, thumbnail, originalURL, resolution string
+		var duration int
+		var tags []string
 		if detail, err := cacheService.GetCachedDetail(viewkey); err == nil && detail != nil {
 			title = detail.Title
 			thumbnail = detail.Thumbnail
 			originalURL = detail.OriginalURL
+			duration = detail.Duration
+			resolution = detail.Resolution
+			tags = detail.Tags
 		}
 
-		if err := s.AddCachedVideo(viewkey, title, cacheType, size, thumbnail, originalURL); err == nil {
+		if err := s.AddCachedVideo(viewkey, title, cacheType, size, thumbnail, originalURL, duration, resolution); err == nil {
 			syncCount++
+			if len(tags) > 0 {
+				s.SetVideoTags(viewkey, tags)
+			}
 		}
 	}
 
 	log.Printf("[CacheDB] 同步完成，新增 %d 条记录", syncCount)
-	return nil
+	return syncCount, nil
+}
+
+// Reconcile 按磁盘重新计算缓存大小并校正数据库：
+// 补录磁盘上的新缓存、更新大小变化的记录、删除文件已不存在的记录
+func (s *CacheDBService) Reconcile(cacheService *VideoCacheService) (*models.CacheRecomputeResponse, error) {
+	if !s.isReady() {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+
+	added, err := s.syncFromFileSystem(cacheService)
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取全部记录后释放锁再访问磁盘
+	s.mu.RLock()
+	rows, err := s.db.Query("SELECT viewkey, type, size FROM cached_videos WHERE site = ?", s.site)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	var records []models.CacheInfo
+	for rows.Next() {
+		var info models.CacheInfo
+		if err := rows.Scan(&info.Viewkey, &info.Type, &info.Size); err == nil {
+			records = append(records, info)
+		}
+	}
+	rows.Close()
+	s.mu.RUnlock()
+
+	result := &models.CacheRecomputeResponse{Added: added}
+	for _, record := range records {
+		var actual int64
+		var exists bool
+		if record.Type == "mp4" {
+			if info, err := os.Stat(filepath.Join(s.cacheDir, record.Viewkey+".mp4")); err == nil {
+				actual, exists = info.Size(), true
+			}
+		} else {
+			dir := filepath.Join(s.cacheDir, record.Viewkey)
+			if _, err := os.Stat(filepath.Join(dir, ".complete")); err == nil {
+				actual, exists = getDirSize(dir), true
+			}
+		}
+
+		if !exists {
+			if s.DeleteCachedVideo(record.Viewkey) == nil {
+				result.Removed++
+			}
+			continue
+		}
+		if actual != record.Size && s.UpdateVideoSize(record.Viewkey, actual) == nil {
+			result.Updated++
+		}
+	}
+
+	// 以数据库汇总值校正累计大小
+	s.mu.Lock()
+	s.totalSize = s.sumSizeLocked()
+	result.TotalSize = s.totalSize
+	s.mu.Unlock()
+
+	result.TotalSizeMB = float64(result.TotalSize) / (1024 * 1024)
+	result.Count = s.GetTotalCount()
+
+	log.Printf("[CacheDB] 缓存校正完成: 新增 %d, 更新 %d, 删除 %d, 总大小 %.1fMB",
+		result.Added, result.Updated, result.Removed, result.TotalSizeMB)
+	return result, nil
+}
+
+// StartPeriodicReconcile 按间隔（秒）定期校正缓存大小并清理过期的列表缓存，间隔<=0时不启动
+func (s *CacheDBService) StartPeriodicReconcile(cacheService *VideoCacheService, interval int) {
+	GetScheduler().Register("cache_reconcile", time.Duration(interval)*time.Second, func() error {
+		_, err := s.Reconcile(cacheService)
+		cacheService.pruneListCache()
+		if err != nil {
+			return fmt.Errorf("定期校正失败: %w", err)
+		}
+		return nil
+	})
 }
 
 // isVideoFile 判断是否是视频相关文件
@@ -403,6 +916,10 @@ var cacheDBOnce sync.Once
 func GetCacheDBService() *CacheDBService {
 	cacheDBOnce.Do(func() {
 		cacheDBService = NewCacheDBService()
+		if config.Settings != nil && config.Settings.PureProxy {
+			log.Println("[CacheDB] 纯代理模式，不使用缓存数据库")
+			return
+		}
 		if err := cacheDBService.Initialize(); err != nil {
 			log.Printf("[CacheDB] 初始化失败: %v", err)
 		}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"backend-go/models"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckIntegrity 校验视频缓存的完整性
+// M3U8 缓存会解析 video.m3u8，按分片清单检查引用的每个分片（含 #EXT-X-MAP 初始化分片）是否存在且非空
+func (v *VideoCacheService) CheckIntegrity(viewkey string) (*models.CacheIntegrityResponse, error) {
+	if !v.IsCached(viewkey) {
+		return nil, ErrVideoNotCached
+	}
+
+	result := &models.CacheIntegrityResponse{Viewkey: viewkey, Missing: []string{}}
+
+	// MP4 缓存只有单个文件
+	mp4Path := v.getMp4CachePath(viewkey)
+	if info, err := os.Stat(mp4Path); err == nil {
+		result.Type = "mp4"
+		result.Total = 1
+		if info.Size() == 0 {
+			result.Missing = append(result.Missing, filepath.Base(mp4Path))
+		}
+		result.Complete = len(result.Missing) == 0
+		return result, nil
+	}
+
+	result.Type = "m3u8"
+	content, err := v.GetCachedM3u8(viewkey)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir := v.getVideoCacheDir(viewkey)
+	checkFile := func(name string) {
+		result.Total++
+		// 文件名不应包含路径，防止越出缓存目录
+		if name != filepath.Base(name) {
+			result.Missing = append(result.Missing, name)
+			return
+		}
+		if info, err := os.Stat(filepath.Join(cacheDir, name)); err != nil || info.Size() == 0 {
+			result.Missing = append(result.Missing, name)
+		}
+	}
+
+	namer := newSegmentNamer(v.segmentEntries(viewkey))
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXT-X-MAP") {
+			if matches := MapURIRe.FindStringSubmatch(line); matches != nil {
+				checkFile(namer.initName(matches[1]))
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		checkFile(namer.mediaName(line))
+	}
+
+	result.Complete = len(result.Missing) == 0
+	return result, nil
+}
+
+// RepairCache 校验缓存完整性，不完整时移除完成标记和数据库记录，下次播放时重新下载
+func (v *VideoCacheService) RepairCache(viewkey string) (*models.CacheIntegrityResponse, error) {
+	if v.IsDownloading(viewkey) {
+		return nil, ErrVideoDownloading
+	}
+
+	result, err := v.CheckIntegrity(viewkey)
+	if err != nil || result.Complete {
+		return result, err
+	}
+
+	if result.Type == "mp4" {
+		os.Remove(v.getMp4CachePath(viewkey))
+	} else {
+		if err := os.Remove(filepath.Join(v.getVideoCacheDir(viewkey), ".complete")); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	GetCacheDBService().DeleteCachedVideo(viewkey)
+
+	log.Printf("[Cache] %s: 缓存不完整（缺失 %d/%d 个文件），已标记为待重新下载", viewkey, len(result.Missing), result.Total)
+	result.Repaired = true
+	return result, nil
+}
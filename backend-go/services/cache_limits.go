@@ -0,0 +1,72 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// statusTooLarge 视频超出可缓存上限时的下载状态
+const statusTooLarge = "too_large"
+
+// playlistDuration 累计播放列表中 #EXTINF 的时长（秒）
+func playlistDuration(content string) float64 {
+	var total float64
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#EXTINF:") {
+			continue
+		}
+		value := strings.TrimPrefix(line, "#EXTINF:")
+		if idx := strings.Index(value, ","); idx >= 0 {
+			value = value[:idx]
+		}
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && seconds > 0 {
+			total += seconds
+		}
+	}
+	return total
+}
+
+// m3u8OverLimit 检查 M3U8 视频是否超出 MAX_CACHE_DURATION / MAX_CACHE_SEGMENTS，超出时返回原因
+func m3u8OverLimit(content string, segments int) string {
+	cfg := config.Settings
+	if limit := cfg.MaxCacheSegments; limit > 0 && segments > limit {
+		return fmt.Sprintf("分片数 %d 超过上限 %d", segments, limit)
+	}
+	if limit := cfg.MaxCacheDuration; limit > 0 {
+		if duration := playlistDuration(content); duration > float64(limit) {
+			return fmt.Sprintf("时长 %d 秒超过上限 %d 秒", int(math.Ceil(duration)), limit)
+		}
+	}
+	return ""
+}
+
+// mp4OverLimit 检查 MP4 大小是否超出 MAX_CACHE_SIZE_MB，超出时返回原因
+func mp4OverLimit(size int64) string {
+	limit := int64(config.Settings.MaxCacheSizeMB) * 1024 * 1024
+	if limit > 0 && size > limit {
+		return fmt.Sprintf("大小 %.1f MB 超过上限 %d MB", float64(size)/(1024*1024), config.Settings.MaxCacheSizeMB)
+	}
+	return ""
+}
+
+// setTooLarge 记录视频超出可缓存上限，不再缓存
+func (v *VideoCacheService) setTooLarge(viewkey, cacheType, reason string) {
+	v.setProgress(viewkey, models.DownloadProgress{
+		Type:   cacheType,
+		Status: statusTooLarge,
+		Error:  reason,
+	})
+	log.Printf("[Cache] 跳过缓存 %s: %s", viewkey, reason)
+}
+
+// IsTooLarge 视频是否已因超出可缓存上限被跳过（记录保存在内存中，重启后重新判断）
+func (v *VideoCacheService) IsTooLarge(viewkey string) bool {
+	progress, ok := v.GetDownloadProgress(viewkey)
+	return ok && progress.Status == statusTooLarge
+}
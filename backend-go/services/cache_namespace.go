@@ -0,0 +1,130 @@
+package services
+
+import (
+	"backend-go/config"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// namespaceMarker 缓存根目录下的迁移标记，存在时不再迁移旧版平铺的缓存文件
+const namespaceMarker = ".namespaced"
+
+var (
+	// namespaceUnsafe 命名空间中不允许出现的字符
+	namespaceUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+	// legacyCacheFile 旧版直接存放在缓存根目录下的文件（见 getMp4CachePath 等）
+	legacyCacheFile = regexp.MustCompile(`^([A-Za-z0-9]+\.(mp4|mp4\.tmp|jpg|jpg\..+\.part|detail\.json|sub\d+\.vtt)|list_page_\d+\.json)$`)
+
+	namespaceOnce sync.Once
+)
+
+// CacheNamespace 当前缓存命名空间
+// 配置了 CACHE_NAMESPACE 时使用配置值，否则取 TARGET_BASE_URL 的域名（去掉 www.）
+func CacheNamespace() string {
+	if config.Settings == nil {
+		return siteKey("https://91porn.com")
+	}
+	if ns := sanitizeNamespace(config.Settings.CacheNamespace); ns != "" {
+		return ns
+	}
+	return siteKey(config.Settings.TargetBaseURL)
+}
+
+// siteKey 从站点地址得到命名空间，如 https://www.example.com:8080 -> example.com_8080
+func siteKey(baseURL string) string {
+	host := ""
+	if parsed, err := url.Parse(strings.TrimSpace(baseURL)); err == nil {
+		host = strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	}
+	if ns := sanitizeNamespace(host); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+// sanitizeNamespace 将命名空间限制为可安全用作目录名的字符，结果可能为空
+func sanitizeNamespace(value string) string {
+	value = namespaceUnsafe.ReplaceAllString(strings.ToLower(strings.TrimSpace(value)), "_")
+	return strings.Trim(value, ".")
+}
+
+// cacheRootDir 缓存根目录（VIDEO_CACHE_DIR）
+func cacheRootDir() string {
+	if config.Settings == nil {
+		return "cache/videos"
+	}
+	return config.Settings.VideoCacheDir
+}
+
+// CacheNamespaceDir 当前命名空间的缓存目录
+// 首次调用时将旧版直接存放在缓存根目录下的缓存迁入当前命名空间
+func CacheNamespaceDir() string {
+	root := cacheRootDir()
+	namespace := CacheNamespace()
+	namespaceOnce.Do(func() {
+		if config.Settings != nil && config.Settings.PureProxy {
+			return
+		}
+		migrateFlatCache(root, namespace)
+	})
+	return filepath.Join(root, namespace)
+}
+
+// migrateFlatCache 将缓存根目录下的视频目录、MP4、封面、详情、字幕和列表缓存移入命名空间目录
+// 只在根目录没有迁移标记时执行一次，数据库等其他文件保持不动
+func migrateFlatCache(root, namespace string) {
+	markerPath := filepath.Join(root, namespaceMarker)
+	if _, err := os.Stat(markerPath); err == nil {
+		return
+	}
+
+	dir := filepath.Join(root, namespace)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[缓存] 创建命名空间目录失败: %v", err)
+		return
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		log.Printf("[缓存] 读取缓存目录失败: %v", err)
+		return
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == namespace {
+			continue
+		}
+		if entry.IsDir() {
+			if !ValidViewkey(name) {
+				continue
+			}
+		} else if !legacyCacheFile.MatchString(name) {
+			continue
+		}
+
+		target := filepath.Join(dir, name)
+		if _, err := os.Stat(target); err == nil {
+			log.Printf("[缓存] 命名空间中已存在 %s，跳过迁移", name)
+			continue
+		}
+		if err := os.Rename(filepath.Join(root, name), target); err != nil {
+			log.Printf("[缓存] 迁移 %s 失败: %v", name, err)
+			continue
+		}
+		moved++
+	}
+
+	if err := os.WriteFile(markerPath, []byte(namespace+"\n"), 0644); err != nil {
+		log.Printf("[缓存] 写入迁移标记失败: %v", err)
+	}
+	if moved > 0 {
+		log.Printf("[缓存] 已将 %d 个旧版缓存文件迁入命名空间 %s", moved, namespace)
+	}
+}
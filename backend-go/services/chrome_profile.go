@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// profileLockName 用户数据目录中的实例锁文件
+const profileLockName = "noproxy.lock"
+
+// acquireProfileLock 为Chrome用户数据目录加锁，保证同一目录只被一个实例使用
+// 返回释放锁的函数；锁文件记录进程号，持有进程已退出的残留锁会被清理
+func acquireProfileLock(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建用户数据目录失败: %v", err)
+	}
+
+	lockPath := filepath.Join(dir, profileLockName)
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("创建锁文件失败: %v", err)
+		}
+
+		content, _ := os.ReadFile(lockPath)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		if pid == os.Getpid() {
+			// 本进程重启浏览器时复用已有的锁
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if pid > 0 && processAlive(pid) {
+			return nil, fmt.Errorf("用户数据目录 %s 正在被进程 %d 使用", dir, pid)
+		}
+
+		log.Printf("清理残留的用户数据目录锁 (进程 %d 已退出)", pid)
+		os.Remove(lockPath)
+	}
+	return nil, fmt.Errorf("无法获取用户数据目录锁: %s", dir)
+}
+
+// clearStaleChromeSingleton 清理Chrome异常退出后残留的 Singleton 锁
+// Chrome 的 SingletonLock 是指向 "主机名-进程号" 的符号链接，进程仍存活时视为目录被占用
+func clearStaleChromeSingleton(dir string) error {
+	target, err := os.Readlink(filepath.Join(dir, "SingletonLock"))
+	if err != nil {
+		return nil
+	}
+
+	if idx := strings.LastIndex(target, "-"); idx >= 0 {
+		if pid, err := strconv.Atoi(target[idx+1:]); err == nil && processAlive(pid) {
+			return fmt.Errorf("用户数据目录 %s 正在被Chrome进程 %d 使用", dir, pid)
+		}
+	}
+
+	log.Println("清理残留的Chrome Singleton锁")
+	for _, name := range []string{"SingletonLock", "SingletonSocket", "SingletonCookie"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+	return nil
+}
+
+// processAlive 检查进程是否存在
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// 无权限发送信号说明进程存在但属于其他用户
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// isProfileInUseError 判断Chrome启动失败是否由用户数据目录被占用导致
+func isProfileInUseError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "profile") && strings.Contains(msg, "in use") ||
+		strings.Contains(msg, "singletonlock") ||
+		strings.Contains(msg, "processsingleton")
+}
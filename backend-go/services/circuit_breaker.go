@@ -0,0 +1,174 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen 站点连续抓取失败，熔断期间不再访问
+var ErrCircuitOpen = errors.New("目标站点暂时不可用，请稍后重试")
+
+// CircuitBreaker 抓取熔断器
+// 窗口期内连续失败达到阈值后熔断，冷却结束后放行一个试探请求，成功则恢复，失败则重新熔断
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	state       string
+	failures    int
+	lastFailure time.Time
+	lastError   string
+	openUntil   time.Time
+	probing     bool
+	tripped     int
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{state: breakerClosed}
+}
+
+// enabled 是否启用熔断（SCRAPER_BREAKER_THRESHOLD 大于0）
+func (b *CircuitBreaker) enabled() bool {
+	return config.Settings.BreakerThreshold > 0
+}
+
+// Allow 判断是否可以发起抓取，熔断中返回 ErrCircuitOpen
+// 冷却结束后只放行一个试探请求，试探完成前其他请求仍被拒绝
+func (b *CircuitBreaker) Allow() error {
+	if !b.enabled() {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		log.Println("[熔断] 冷却结束，放行试探请求")
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success 记录一次成功的抓取，熔断器恢复正常
+func (b *CircuitBreaker) Success() {
+	if !b.enabled() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		log.Println("[熔断] 试探成功，恢复抓取")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure 记录一次失败的抓取，达到阈值或试探失败时熔断
+func (b *CircuitBreaker) Failure(err error) {
+	if !b.enabled() {
+		return
+	}
+
+	cfg := config.Settings
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	// 距上次失败超过窗口期时重新计数
+	if window := time.Duration(cfg.BreakerWindow) * time.Second; window > 0 && now.Sub(b.lastFailure) > window {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if b.state == breakerHalfOpen || b.failures >= cfg.BreakerThreshold {
+		b.state = breakerOpen
+		b.probing = false
+		b.openUntil = now.Add(time.Duration(cfg.BreakerCooldown) * time.Second)
+		b.tripped++
+		log.Printf("[熔断] 连续失败%d次，暂停抓取%d秒: %s", b.failures, cfg.BreakerCooldown, b.lastError)
+	}
+}
+
+// RetryAfter 熔断剩余秒数，未熔断时返回0
+func (b *CircuitBreaker) RetryAfter() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerOpen {
+		return 0
+	}
+	remaining := int(time.Until(b.openUntil).Seconds()) + 1
+	if remaining < 1 {
+		remaining = 1
+	}
+	return remaining
+}
+
+// Status 获取熔断器状态
+func (b *CircuitBreaker) Status() models.CircuitBreakerStatus {
+	retryAfter := b.RetryAfter()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := models.CircuitBreakerStatus{
+		Enabled:      b.enabled(),
+		State:        b.state,
+		Failures:     b.failures,
+		Threshold:    config.Settings.BreakerThreshold,
+		LastError:    b.lastError,
+		RetryAfter:   retryAfter,
+		TotalTripped: b.tripped,
+	}
+	if !b.lastFailure.IsZero() {
+		status.LastFailure = b.lastFailure.Format(time.RFC3339)
+	}
+	if b.state == breakerOpen {
+		status.OpenUntil = b.openUntil.Format(time.RFC3339)
+	}
+	return status
+}
+
+// record 按抓取结果更新熔断器，繁忙、熔断本身和浏览器不可用不计为失败
+func (b *CircuitBreaker) record(err error) {
+	switch {
+	case err == nil:
+		b.Success()
+	case errors.Is(err, ErrScraperBusy), errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrBrowserUnavailable),
+		errors.Is(err, ErrCookieProfileNotFound), errors.Is(err, ErrInvalidCookieProfile):
+		// 未实际访问站点；试探请求未完成时释放试探名额
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+	default:
+		b.Failure(err)
+	}
+}
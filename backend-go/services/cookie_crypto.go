@@ -0,0 +1,105 @@
+package services
+
+import (
+	"backend-go/config"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// cookieKeyIterations 由 COOKIE_SECRET 派生密钥的 PBKDF2 迭代次数
+	cookieKeyIterations = 100000
+	cookieSaltSize      = 16
+)
+
+// encryptedCookies 加密后的cookies文件内容
+type encryptedCookies struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// cookieSecret 当前配置的cookies加密密钥，为空时以明文保存
+func cookieSecret() string {
+	if config.Settings == nil {
+		return ""
+	}
+	return config.Settings.CookieSecret
+}
+
+// isEncryptedCookies 文件内容是否为加密格式（明文是JSON数组，加密后是JSON对象）
+func isEncryptedCookies(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// cookieCipher 由密钥和盐派生 AES-256-GCM
+func cookieCipher(secret string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, secret, salt, cookieKeyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptCookies 加密cookies文件内容，每次使用新的盐和随机数
+func encryptCookies(plaintext []byte, secret string) ([]byte, error) {
+	salt := make([]byte, cookieSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := cookieCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(encryptedCookies{
+		Version: 1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+}
+
+// decryptCookies 解密cookies文件内容，密钥错误或文件被篡改时返回错误
+func decryptCookies(data []byte, secret string) ([]byte, error) {
+	if secret == "" {
+		return nil, errors.New("cookies文件已加密，但未配置 COOKIE_SECRET")
+	}
+
+	var envelope encryptedCookies
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version != 1 {
+		return nil, fmt.Errorf("不支持的cookies文件版本: %d", envelope.Version)
+	}
+
+	gcm, err := cookieCipher(secret, envelope.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("cookies文件格式错误")
+	}
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Data, nil)
+	if err != nil {
+		return nil, errors.New("cookies文件解密失败，COOKIE_SECRET 不正确或文件已损坏")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DefaultCookieProfile 默认cookies配置名，对应 cookies.json
+const DefaultCookieProfile = "default"
+
+var (
+	// ErrInvalidCookieProfile cookies配置名不合法
+	ErrInvalidCookieProfile = errors.New("无效的cookies配置名")
+	// ErrCookieProfileNotFound cookies配置不存在
+	ErrCookieProfileNotFound = errors.New("cookies配置不存在")
+)
+
+// cookieProfileNameRe cookies配置名只允许字母、数字、下划线和短横线，避免拼接文件名时越出目录
+var cookieProfileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidCookieProfile 检查cookies配置名是否合法
+func ValidCookieProfile(name string) bool {
+	return cookieProfileNameRe.MatchString(name)
+}
+
+// cookieProfilePath cookies配置对应的文件：默认配置为 cookies.json，其余为同目录下的 cookies_<名称>.json
+func cookieProfilePath(name string) string {
+	if name == "" || name == DefaultCookieProfile {
+		return cookiesFile
+	}
+	return filepath.Join(filepath.Dir(cookiesFile), "cookies_"+name+".json")
+}
+
+// checkCookieProfile 检查cookies配置名是否合法，非默认配置还要求配置文件已存在
+func checkCookieProfile(name string) error {
+	if !ValidCookieProfile(name) {
+		return ErrInvalidCookieProfile
+	}
+	if name != DefaultCookieProfile {
+		if _, err := os.Stat(cookieProfilePath(name)); err != nil {
+			return ErrCookieProfileNotFound
+		}
+	}
+	return nil
+}
+
+// isSiteCookie 是否为目标站点的cookie，只有这些cookie会保存到配置文件
+func isSiteCookie(domain string) bool {
+	return strings.Contains(domain, "91porn")
+}
+
+// ActiveCookieProfile 当前使用的cookies配置名
+func (s *ScraperService) ActiveCookieProfile() string {
+	if name, ok := s.cookieProfile.Load().(string); ok {
+		return name
+	}
+	if name := config.Settings.CookieProfile; name != "" && ValidCookieProfile(name) {
+		return name
+	}
+	return DefaultCookieProfile
+}
+
+// ListCookieProfiles 列出已保存的cookies配置，默认配置始终在最前
+func (s *ScraperService) ListCookieProfiles() models.CookieProfileListResponse {
+	active := s.ActiveCookieProfile()
+	names := []string{DefaultCookieProfile}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(cookiesFile), "cookies_*.json"))
+	var others []string
+	for _, match := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "cookies_"), ".json")
+		if ValidCookieProfile(name) && name != DefaultCookieProfile {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	resp := models.CookieProfileListResponse{Active: active, Profiles: []models.CookieProfile{}}
+	for _, name := range names {
+		path := cookieProfilePath(name)
+		info, err := os.Stat(path)
+		if err != nil && name != active {
+			continue
+		}
+		profile := models.CookieProfile{Name: name, Active: name == active}
+		if err == nil {
+			profile.Cookies = len(loadCookiesFile(path))
+			profile.UpdatedAt = info.ModTime().Format(time.RFC3339)
+		}
+		resp.Profiles = append(resp.Profiles, profile)
+	}
+	return resp
+}
+
+// SaveCookieProfile 创建或覆盖cookies配置，cookies 为 cookies.json 格式的JSON数组
+// 覆盖的是当前使用的配置且浏览器正在运行时，立即替换浏览器中的站点cookie
+func (s *ScraperService) SaveCookieProfile(name string, data []byte) (int, error) {
+	if !ValidCookieProfile(name) {
+		return 0, ErrInvalidCookieProfile
+	}
+	var cookies []*proto.NetworkCookieParam
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return 0, fmt.Errorf("cookies格式错误: %v", err)
+	}
+	content, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeCookiesFile(cookieProfilePath(name), content); err != nil {
+		return 0, fmt.Errorf("保存cookies配置失败: %v", err)
+	}
+	log.Printf("已保存cookies配置 %s (%d 个cookies)", name, len(cookies))
+
+	if name == s.ActiveCookieProfile() {
+		s.applyCookieProfile(cookies)
+	}
+	return len(cookies), nil
+}
+
+// SelectCookieProfile 切换当前使用的cookies配置，之后自动保存的cookies写入该配置
+// 浏览器正在运行时立即用该配置替换浏览器中的站点cookie；只在内存中生效，重启后恢复为 COOKIE_PROFILE
+func (s *ScraperService) SelectCookieProfile(name string) error {
+	if err := checkCookieProfile(name); err != nil {
+		return err
+	}
+	path := cookieProfilePath(name)
+
+	s.cookieProfile.Store(name)
+	log.Printf("已切换到cookies配置 %s", name)
+	s.applyCookieProfile(loadCookiesFile(path))
+	return nil
+}
+
+// applyCookieProfile 浏览器正在运行时删除其中的站点cookie并设置为给定的cookies
+func (s *ScraperService) applyCookieProfile(cookies []*proto.NetworkCookieParam) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.browser == nil || s.page == nil {
+		return
+	}
+
+	existing, err := s.browser.GetCookies()
+	if err != nil {
+		log.Printf("读取浏览器cookies失败: %v", err)
+		return
+	}
+	for _, c := range existing {
+		if !isSiteCookie(c.Domain) {
+			continue
+		}
+		proto.NetworkDeleteCookies{Name: c.Name, Domain: c.Domain, Path: c.Path}.Call(s.page)
+	}
+	if len(cookies) == 0 {
+		return
+	}
+	if err := s.browser.SetCookies(cookies); err != nil {
+		log.Printf("设置浏览器cookies失败: %v", err)
+	}
+}
+
+// openCookieProfileTab 打开使用指定cookies配置的标签页，返回的 closeTab 关闭标签页
+// 未指定或指定的是当前配置时使用普通标签页；否则在独立的无痕上下文中打开，不影响主浏览器的cookie，
+// 关闭前把刷新后的站点cookie写回该配置
+func (s *ScraperService) openCookieProfileTab(name string) (*rod.Page, func(), error) {
+	if name == "" || name == s.ActiveCookieProfile() {
+		page, err := s.openTab()
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, func() { page.Close() }, nil
+	}
+
+	if err := checkCookieProfile(name); err != nil {
+		return nil, nil, err
+	}
+	path := cookieProfilePath(name)
+
+	s.mu.Lock()
+	if s.browser == nil {
+		if err := s.initializeInternal(); err != nil {
+			s.mu.Unlock()
+			return nil, nil, err
+		}
+	}
+	browser := s.browser
+	s.mu.Unlock()
+
+	incognito, err := browser.Incognito()
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建无痕上下文失败: %v", err)
+	}
+	cookies := append(localeBrowserCookies(), loadCookiesFile(path)...)
+	if len(cookies) > 0 {
+		if err := incognito.SetCookies(cookies); err != nil {
+			incognito.Close()
+			return nil, nil, fmt.Errorf("设置cookies失败: %v", err)
+		}
+	}
+	page, err := incognito.Page(proto.TargetCreateTarget{URL: ""})
+	if err != nil {
+		incognito.Close()
+		return nil, nil, fmt.Errorf("创建新标签页失败: %v", err)
+	}
+	log.Printf("使用cookies配置 %s 打开标签页", name)
+
+	closeTab := func() {
+		saveContextCookies(incognito, path)
+		page.Close()
+		incognito.Close()
+	}
+	return page, closeTab, nil
+}
+
+// saveContextCookies 把浏览器上下文中的站点cookie保存到文件
+func saveContextCookies(browser *rod.Browser, path string) {
+	cookies, err := browser.GetCookies()
+	if err != nil {
+		return
+	}
+	var filtered []*proto.NetworkCookie
+	for _, c := range cookies {
+		if isSiteCookie(c.Domain) {
+			filtered = append(filtered, c)
+		}
+	}
+	if len(filtered) == 0 {
+		return
+	}
+	data, err := json.MarshalIndent(filtered, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := writeCookiesFile(path, data); err != nil {
+		log.Printf("保存cookies失败: %v", err)
+	}
+}
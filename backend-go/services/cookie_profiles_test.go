@@ -0,0 +1,47 @@
+package services
+
+import (
+	"backend-go/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetVideoDetailWithCookieProfileKeepsProbe(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.BreakerThreshold = 1
+	config.Settings.BreakerCooldown = 1
+
+	s := &ScraperService{breaker: NewCircuitBreaker()}
+	s.breaker.Failure(errors.New("抓取失败"))
+	s.breaker.mu.Lock()
+	s.breaker.openUntil = time.Now().Add(-time.Second)
+	s.breaker.mu.Unlock()
+
+	for _, name := range []string{"../bad", "missing"} {
+		if _, err := s.GetVideoDetailWithCookieProfile("https://example.com/view_video.php?viewkey=abc", name); err == nil {
+			t.Fatalf("配置 %q 应返回错误", name)
+		}
+	}
+	// 配置错误不应占用冷却结束后的试探名额
+	if err := s.breaker.Allow(); err != nil {
+		t.Fatalf("试探请求被拒绝: %v", err)
+	}
+}
+
+func TestCircuitBreakerRecordReleasesProbeOnProfileError(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.BreakerThreshold = 1
+
+	b := NewCircuitBreaker()
+	b.state = breakerHalfOpen
+	if err := b.Allow(); err != nil {
+		t.Fatalf("试探请求被拒绝: %v", err)
+	}
+	b.record(ErrCookieProfileNotFound)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("配置不存在后试探名额未释放: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"backend-go/config"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// StartCookieRefresh 按间隔（秒）定期访问站点首页以刷新 cf_clearance 等cookies，间隔<=0时不启动
+func (s *ScraperService) StartCookieRefresh(interval int) {
+	GetScheduler().Register("cookie_refresh", time.Duration(interval)*time.Second, s.refreshCookies)
+}
+
+// refreshCookies 在浏览器空闲时访问首页并保存cookies
+// 浏览器未初始化、列表抓取进行中、共用主页面的详情抓取进行中或处于维护模式时跳过本次刷新，不会主动启动浏览器
+func (s *ScraperService) refreshCookies() error {
+	if GetMaintenance().Enabled() {
+		return nil
+	}
+	if !s.listMu.TryLock() {
+		log.Println("[Scraper] 列表抓取进行中，跳过本次cookies刷新")
+		return nil
+	}
+	defer s.listMu.Unlock()
+
+	// 未启用独立页面时列表页面就是主页面，与列表抓取一样持有 pageMu，不打断正在进行的详情抓取
+	if !config.Settings.ListDedicatedPage {
+		if !s.pageMu.TryLock() {
+			log.Println("[Scraper] 详情抓取进行中，跳过本次cookies刷新")
+			return nil
+		}
+		defer s.pageMu.Unlock()
+	}
+
+	s.mu.Lock()
+	healthy := s.browser != nil
+	s.mu.Unlock()
+	if !healthy {
+		return nil
+	}
+
+	page, err := s.acquireListPage()
+	if err != nil {
+		return fmt.Errorf("cookies刷新失败: %v", err)
+	}
+
+	homeURL := strings.TrimRight(GetMirrorService().Active(), "/") + "/"
+	if err := page.Timeout(60 * time.Second).Navigate(homeURL); err != nil {
+		return fmt.Errorf("cookies刷新失败: 访问首页出错: %v", err)
+	}
+	// 列表页面已离开原来的页码
+	s.currentPageNum = 0
+
+	if err := page.Timeout(60 * time.Second).WaitLoad(); err != nil {
+		log.Printf("[Scraper] 等待首页加载失败: %v", err)
+	}
+
+	info, err := page.Info()
+	if err != nil {
+		return fmt.Errorf("cookies刷新失败: 获取页面信息出错: %v", err)
+	}
+	if isChallengeTitle(info.Title) {
+		s.markChallenge()
+		return fmt.Errorf("cookies刷新时遇到验证页面，请在设置中更新cookies")
+	}
+
+	s.saveBrowserCookies(page)
+	log.Println("[Scraper] 已通过访问首页刷新cookies")
+	return nil
+}
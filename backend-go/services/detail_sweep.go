@@ -0,0 +1,65 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// detailFileSuffix 未缓存视频的详情文件后缀（已缓存的 M3U8 视频详情保存在缓存目录中）
+const detailFileSuffix = ".detail.json"
+
+// staleDetailSweepMinInterval 清理未缓存视频详情的最短间隔
+const staleDetailSweepMinInterval = 10 * time.Minute
+
+// SweepStaleDetails 删除视频未缓存、且超过 maxAge 未更新的详情文件及其标签记录，返回删除的文件数
+// 这些详情只用于 DETAIL_STALE_WINDOW 内快速返回，过期后不再使用
+func (v *VideoCacheService) SweepStaleDetails(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(v.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, detailFileSuffix) {
+			continue
+		}
+		viewkey := strings.TrimSuffix(name, detailFileSuffix)
+		if !ValidViewkey(viewkey) || v.IsCached(viewkey) || v.IsDownloading(viewkey) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(v.cacheDir, name)); err != nil {
+			log.Printf("[Cache] 删除过期详情失败 %s: %v", name, err)
+			continue
+		}
+		GetCacheDBService().DeleteVideoTags(viewkey)
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("[Cache] 清理了 %d 个未缓存视频的过期详情", removed)
+	}
+	return removed, nil
+}
+
+// StartStaleDetailSweep 按 DETAIL_STALE_WINDOW（秒）定期清理未缓存视频的过期详情，窗口为0时不清理
+func (v *VideoCacheService) StartStaleDetailSweep(window int) {
+	if window <= 0 {
+		return
+	}
+	maxAge := time.Duration(window) * time.Second
+	GetScheduler().Register("stale_detail_sweep", max(maxAge, staleDetailSweepMinInterval), func() error {
+		_, err := v.SweepStaleDetails(maxAge)
+		return err
+	})
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepStaleDetails(t *testing.T) {
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+
+	for _, viewkey := range []string{"staleold", "stalenew"} {
+		if err := v.SaveDetail(viewkey, &models.VideoDetail{ID: viewkey, Tags: []string{"tag"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(v.cacheDir, "staleold"+detailFileSuffix), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := v.SweepStaleDetails(time.Hour)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed = %d, err = %v, want 1", removed, err)
+	}
+	if _, err := v.GetCachedDetail("staleold"); err == nil {
+		t.Fatal("过期详情应已删除")
+	}
+	if _, err := v.GetCachedDetail("stalenew"); err != nil {
+		t.Fatalf("未过期的详情应保留: %v", err)
+	}
+}
+
+func TestSaveDetailSkipsTagsForUncachedVideos(t *testing.T) {
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+	db := GetCacheDBService()
+
+	if err := v.SaveDetail("tagsuncached", &models.VideoDetail{Tags: []string{"uncachedtag"}}); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM video_tags WHERE viewkey = ?", "tagsuncached").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("未缓存视频不应记录标签, got %d", count)
+	}
+}
+
+func TestCacheWritesSkippedInPureProxy(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+
+	for _, tc := range []struct {
+		name       string
+		pureProxy  bool
+		cacheVideo bool
+	}{
+		{"pure proxy", true, true},
+		{"cache disabled", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Settings.PureProxy = tc.pureProxy
+			config.Settings.VideoCacheEnabled = tc.cacheVideo
+
+			v.SaveDetail("nowrite", &models.VideoDetail{ID: "nowrite"})
+			v.SaveListCache(1, map[string]interface{}{"videos": []interface{}{}})
+			v.saveThumbnail("nowrite", []byte("jpg"))
+
+			entries, err := os.ReadDir(v.cacheDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Fatalf("不应写入缓存文件, got %d entries", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDownloadProgressConcurrentReads 下载协程更新进度的同时读取进度，配合 go test -race 检查数据竞争
+func TestDownloadProgressConcurrentReads(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoCacheEnabled = true
+	config.Settings.FFprobeEnabled = false
+	config.Settings.StreamBufferKB = 1
+
+	const segmentCount = 8
+	chunk := strings.Repeat("x", 1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/video.mp4" {
+			// 分块发送，下载协程多次更新进度
+			flusher := w.(http.Flusher)
+			for i := 0; i < 20; i++ {
+				fmt.Fprint(w, chunk)
+				flusher.Flush()
+				time.Sleep(time.Millisecond)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+		fmt.Fprint(w, chunk)
+	}))
+	defer server.Close()
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:4\n")
+	for i := 0; i < segmentCount; i++ {
+		fmt.Fprintf(&playlist, "#EXTINF:4,\nseg%d.ts\n", i)
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+	v.StartMp4CacheDownload("progressmp4", server.URL+"/video.mp4", nil, PriorityUser)
+	v.StartCacheDownload("progressm3u8", server.URL+"/index.m3u8", playlist.String(), nil, PriorityUser)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, viewkey := range []string{"progressmp4", "progressm3u8"} {
+					if progress, ok := v.GetDownloadProgress(viewkey); ok && progress.Downloaded > progress.Total && progress.Total > 0 {
+						t.Errorf("%s 进度超出总量: %+v", viewkey, progress)
+					}
+					v.GetDownloadInfo(viewkey)
+				}
+				v.ListDownloads()
+				v.GetPartialM3u8("progressm3u8", 1)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, viewkey := range []string{"progressmp4", "progressm3u8"} {
+		for {
+			progress, _ := v.GetDownloadProgress(viewkey)
+			if progress.Status == "complete" {
+				break
+			}
+			if progress.Status == "error" {
+				t.Fatalf("%s 下载失败: %s", viewkey, progress.Error)
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s 下载超时: %+v", viewkey, progress)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	close(done)
+	wg.Wait()
+	// 等待下载协程释放队列槽位后再恢复配置
+	for _, viewkey := range []string{"progressmp4", "progressm3u8"} {
+		for {
+			if _, _, ok := v.downloadQueue.state(viewkey); !ok {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	mp4, _ := v.GetDownloadProgress("progressmp4")
+	if mp4.Downloaded != int64(20*len(chunk)) {
+		t.Errorf("MP4 已下载 = %d, want %d", mp4.Downloaded, 20*len(chunk))
+	}
+	m3u8, _ := v.GetDownloadProgress("progressm3u8")
+	if m3u8.Downloaded != segmentCount || m3u8.Total != segmentCount {
+		t.Errorf("M3U8 进度 = %d/%d, want %d/%d", m3u8.Downloaded, m3u8.Total, segmentCount, segmentCount)
+	}
+}
+
+// TestM3u8FallbackToMp4KeepsTask 分片连续失败改为缓存MP4时，任务保持在下载中并立即标记回退，MP4 完成后才删除已下载的分片
+func TestM3u8FallbackToMp4KeepsTask(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.VideoCacheEnabled = true
+	config.Settings.FFprobeEnabled = false
+	config.Settings.HlsSegmentFailureLimit = 1
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/seg0.ts":
+			fmt.Fprint(w, "segment0")
+		case "/video.mp4":
+			<-release
+			fmt.Fprint(w, "mp4data")
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+	const viewkey = "fallbackm3u8"
+	v.StartCacheDownload(viewkey, server.URL+"/index.m3u8", playlist, &models.VideoDetail{Mp4URL: server.URL + "/video.mp4"}, PriorityUser)
+
+	waitProgress := func(done func(models.DownloadProgress) bool) models.DownloadProgress {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			progress, _ := v.GetDownloadProgress(viewkey)
+			if done(progress) {
+				return progress
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("等待超时: %+v", progress)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	progress := waitProgress(func(p models.DownloadProgress) bool { return p.Type == "mp4" })
+	if progress.FallbackFrom != "m3u8" || progress.Status != "downloading" {
+		t.Fatalf("回退开始时的进度 = %+v", progress)
+	}
+	if !v.IsDownloading(viewkey) {
+		t.Fatal("回退下载MP4期间任务应仍在下载中")
+	}
+	if !segmentStored(filepath.Join(v.getVideoCacheDir(viewkey), localSegmentName(0, server.URL+"/seg0.ts"))) {
+		t.Fatal("MP4 完成前应保留已下载的分片")
+	}
+
+	release <- struct{}{}
+	waitProgress(func(p models.DownloadProgress) bool { return p.Status == "complete" })
+	for v.IsDownloading(viewkey) {
+		time.Sleep(time.Millisecond)
+	}
+	for {
+		if _, _, ok := v.downloadQueue.state(viewkey); !ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v.GetCachedMp4Path(viewkey) == "" {
+		t.Fatal("MP4 应已缓存")
+	}
+	if _, err := os.Stat(v.getVideoCacheDir(viewkey)); !os.IsNotExist(err) {
+		t.Fatalf("MP4 完成后应删除分片目录: %v", err)
+	}
+}
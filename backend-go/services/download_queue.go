@@ -0,0 +1,154 @@
+package services
+
+import (
+	"backend-go/config"
+	"sync"
+)
+
+// DownloadPriority 缓存下载的优先级，数值越大越优先
+type DownloadPriority int
+
+const (
+	// PriorityBulk 浏览列表时的自动预缓存
+	PriorityBulk DownloadPriority = iota
+	// PriorityPrecache 按需预缓存（如启动预热）
+	PriorityPrecache
+	// PriorityUser 用户播放时触发的缓存
+	PriorityUser
+)
+
+// String 优先级名称，用于下载列表接口
+func (p DownloadPriority) String() string {
+	switch p {
+	case PriorityUser:
+		return "user"
+	case PriorityPrecache:
+		return "precache"
+	default:
+		return "bulk"
+	}
+}
+
+// queuedDownload 一个下载任务的排队状态
+type queuedDownload struct {
+	priority DownloadPriority
+	seq      uint64
+	waiting  bool
+	ready    chan struct{}
+}
+
+// downloadQueue 按优先级分配下载并发槽位（MAX_CONCURRENT_DOWNLOADS）
+// 槽位占满时按优先级排队，同一优先级先到先得；用户播放触发的下载不排队，直接开始
+type downloadQueue struct {
+	mu      sync.Mutex
+	running int
+	seq     uint64
+	tasks   map[string]*queuedDownload
+}
+
+// newDownloadQueue 创建下载队列
+func newDownloadQueue() *downloadQueue {
+	return &downloadQueue{tasks: make(map[string]*queuedDownload)}
+}
+
+// downloadLimit 下载并发上限，<=0 不限制
+func downloadLimit() int {
+	if config.Settings == nil {
+		return 0
+	}
+	return config.Settings.MaxConcurrentDownloads
+}
+
+// acquire 等待下载槽位，返回后调用方需在下载结束时调用 release
+func (q *downloadQueue) acquire(viewkey string, priority DownloadPriority) {
+	q.mu.Lock()
+	q.seq++
+	task := &queuedDownload{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	q.tasks[viewkey] = task
+
+	limit := downloadLimit()
+	if limit <= 0 || priority == PriorityUser || (q.running < limit && !q.hasWaitingLocked()) {
+		q.running++
+		q.mu.Unlock()
+		return
+	}
+	task.waiting = true
+	q.mu.Unlock()
+
+	<-task.ready
+}
+
+// release 释放下载槽位并按优先级启动排队中的下载
+func (q *downloadQueue) release(viewkey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.tasks, viewkey)
+	q.running--
+	q.dispatchLocked()
+}
+
+// promote 提高排队中或进行中下载的优先级，提升为用户优先级的排队任务立即开始
+func (q *downloadQueue) promote(viewkey string, priority DownloadPriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.tasks[viewkey]
+	if !ok || task.priority >= priority {
+		return
+	}
+	task.priority = priority
+	if task.waiting && priority == PriorityUser {
+		q.startLocked(task)
+	}
+}
+
+// state 返回下载任务的优先级以及是否仍在排队
+func (q *downloadQueue) state(viewkey string) (DownloadPriority, bool, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.tasks[viewkey]
+	if !ok {
+		return 0, false, false
+	}
+	return task.priority, task.waiting, true
+}
+
+// hasWaitingLocked 是否有排队中的下载（调用方需持有 mu）
+func (q *downloadQueue) hasWaitingLocked() bool {
+	for _, task := range q.tasks {
+		if task.waiting {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatchLocked 有空闲槽位时依次启动优先级最高、最早排队的下载（调用方需持有 mu）
+func (q *downloadQueue) dispatchLocked() {
+	limit := downloadLimit()
+	for limit <= 0 || q.running < limit {
+		var next *queuedDownload
+		for _, task := range q.tasks {
+			if !task.waiting {
+				continue
+			}
+			if next == nil || task.priority > next.priority ||
+				(task.priority == next.priority && task.seq < next.seq) {
+				next = task
+			}
+		}
+		if next == nil {
+			return
+		}
+		q.startLocked(next)
+	}
+}
+
+// startLocked 启动排队中的下载（调用方需持有 mu）
+func (q *downloadQueue) startLocked(task *queuedDownload) {
+	task.waiting = false
+	q.running++
+	close(task.ready)
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"backend-go/config"
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// downloadBufferSize 下载写入缓冲区大小
+func downloadBufferSize() int {
+	size := config.Settings.DownloadWriteBufferKB * 1024
+	if size < 4096 {
+		size = 4096
+	}
+	return size
+}
+
+// newDownloadWriter 为下载文件创建带缓冲的写入器
+func newDownloadWriter(file *os.File) *bufio.Writer {
+	return bufio.NewWriterSize(file, downloadBufferSize())
+}
+
+// syncFile 按 DOWNLOAD_FSYNC 配置将文件内容刷到磁盘
+func syncFile(file *os.File) error {
+	if !config.Settings.DownloadFsync {
+		return nil
+	}
+	return file.Sync()
+}
+
+// syncDir 按 DOWNLOAD_FSYNC 配置同步目录，保证重命名后的目录项落盘
+func syncDir(dir string) {
+	if !config.Settings.DownloadFsync {
+		return
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// writeFileDurable 先写临时文件并落盘，再重命名为最终文件，避免崩溃后留下内容不完整的文件
+func writeFileDurable(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
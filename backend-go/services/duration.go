@@ -0,0 +1,37 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// durationPattern 列表页时长文本，如 12:34 或 1:02:03（可能带有前后的其他文字）
+var durationPattern = regexp.MustCompile(`(\d+):(\d{1,2})(?::(\d{1,2}))?`)
+
+// ParseDuration 将列表页的时长文本解析为秒数，支持 mm:ss 和 hh:mm:ss，无法解析时返回0
+func ParseDuration(text string) int {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return 0
+	}
+
+	parts := []string{match[1], match[2]}
+	if match[3] != "" {
+		parts = append(parts, match[3])
+	}
+
+	seconds := 0
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		// 除第一段外，分和秒不能超过59
+		if i > 0 && value >= 60 {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds
+}
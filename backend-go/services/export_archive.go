@@ -0,0 +1,227 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarBlockSize tar 的块大小，文件内容按块补齐，结尾是两个空块
+const tarBlockSize = 512
+
+// exportPart 导出tar中的一段：内存中的头部/填充，或缓存文件的内容
+type exportPart struct {
+	offset int64
+	size   int64
+	data   []byte
+	path   string
+}
+
+// ExportArchive 视频缓存的导出tar，按文件列表预先计算布局，支持任意位置读取
+// 同一份缓存每次生成的字节完全一致，下载工具可以分段并发下载和断点续传
+type ExportArchive struct {
+	parts   []exportPart
+	size    int64
+	modTime time.Time
+	etag    string
+
+	pos      int64
+	file     *os.File
+	filePath string
+}
+
+// exportFiles 列出需要导出的缓存文件，返回本地路径和tar中的名称
+func (v *VideoCacheService) exportFiles(viewkey string) ([][2]string, error) {
+	var files [][2]string
+
+	// M3U8 缓存目录
+	cacheDir := v.getVideoCacheDir(viewkey)
+	if info, err := os.Stat(cacheDir); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".part") {
+				continue
+			}
+			files = append(files, [2]string{filepath.Join(cacheDir, entry.Name()), viewkey + "/" + entry.Name()})
+		}
+	}
+
+	// MP4、详情、封面图和字幕
+	names := []string{viewkey + ".mp4", viewkey + ".detail.json", viewkey + ".jpg"}
+	if subs, err := filepath.Glob(filepath.Join(v.cacheDir, viewkey+".sub*.vtt")); err == nil {
+		for _, sub := range subs {
+			names = append(names, filepath.Base(sub))
+		}
+	}
+	for _, name := range names {
+		filePath := filepath.Join(v.cacheDir, name)
+		if _, err := os.Stat(filePath); err != nil {
+			continue
+		}
+		files = append(files, [2]string{filePath, name})
+	}
+	return files, nil
+}
+
+// OpenExport 生成视频缓存的导出tar，使用完需要 Close
+func (v *VideoCacheService) OpenExport(viewkey string) (*ExportArchive, error) {
+	if !v.IsCached(viewkey) {
+		return nil, ErrVideoNotCached
+	}
+
+	files, err := v.exportFiles(viewkey)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &ExportArchive{}
+	hash := sha1.New()
+	for _, file := range files {
+		info, err := os.Stat(file[0])
+		if err != nil {
+			return nil, err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return nil, err
+		}
+		header.Name = file[1]
+
+		// 单独写出头部得到其字节，内容和填充按布局在读取时拼接
+		var buf bytes.Buffer
+		if err := tar.NewWriter(&buf).WriteHeader(header); err != nil {
+			return nil, err
+		}
+		hash.Write(buf.Bytes())
+
+		archive.add(exportPart{data: buf.Bytes()})
+		archive.add(exportPart{size: info.Size(), path: file[0]})
+		if padding := (tarBlockSize - info.Size()%tarBlockSize) % tarBlockSize; padding > 0 {
+			archive.add(exportPart{data: make([]byte, padding)})
+		}
+		if info.ModTime().After(archive.modTime) {
+			archive.modTime = info.ModTime()
+		}
+	}
+	archive.add(exportPart{data: make([]byte, 2*tarBlockSize)})
+	archive.etag = fmt.Sprintf(`"%x-%x"`, hash.Sum(nil)[:8], archive.size)
+	return archive, nil
+}
+
+// add 在末尾追加一段
+func (a *ExportArchive) add(part exportPart) {
+	if part.data != nil {
+		part.size = int64(len(part.data))
+	}
+	part.offset = a.size
+	a.parts = append(a.parts, part)
+	a.size += part.size
+}
+
+// Size tar 的总大小
+func (a *ExportArchive) Size() int64 {
+	return a.size
+}
+
+// ModTime 导出文件中最新的修改时间
+func (a *ExportArchive) ModTime() time.Time {
+	return a.modTime
+}
+
+// ETag 由各文件的名称、大小和修改时间计算，缓存文件变化后随之改变
+func (a *ExportArchive) ETag() string {
+	return a.etag
+}
+
+// Read 从当前位置读取
+func (a *ExportArchive) Read(p []byte) (int, error) {
+	if a.pos >= a.size {
+		return 0, io.EOF
+	}
+
+	idx := sort.Search(len(a.parts), func(i int) bool {
+		return a.parts[i].offset+a.parts[i].size > a.pos
+	})
+	part := a.parts[idx]
+	within := a.pos - part.offset
+	if remaining := part.size - within; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	var n int
+	if part.path == "" {
+		n = copy(p, part.data[within:])
+	} else {
+		if err := a.openFile(part.path); err != nil {
+			return 0, err
+		}
+		var err error
+		n, err = a.file.ReadAt(p, within)
+		if n < len(p) {
+			// 文件在导出过程中被修改或删除
+			if err == nil || errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			a.pos += int64(n)
+			return n, err
+		}
+	}
+	a.pos += int64(n)
+	return n, nil
+}
+
+// openFile 打开当前读取的缓存文件，同一时间只保持一个文件打开
+func (a *ExportArchive) openFile(path string) error {
+	if a.file != nil && a.filePath == path {
+		return nil
+	}
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	a.file, a.filePath = file, path
+	return nil
+}
+
+// Seek 移动读取位置
+func (a *ExportArchive) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += a.pos
+	case io.SeekEnd:
+		offset += a.size
+	default:
+		return 0, errors.New("无效的 whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("无效的读取位置")
+	}
+	a.pos = offset
+	return offset, nil
+}
+
+// Close 关闭打开的缓存文件
+func (a *ExportArchive) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
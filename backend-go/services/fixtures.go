@@ -0,0 +1,155 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+var (
+	// fixtureNameRe 录制文件名中允许的字符
+	fixtureNameRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+	// fixtureURLRe 录制文件开头记录的页面地址
+	fixtureURLRe = regexp.MustCompile(`^<!-- url: (\S+) -->`)
+	// headTagRe 页面的 <head> 标签，<base> 插入在其后
+	headTagRe = regexp.MustCompile(`(?i)<head[^>]*>`)
+)
+
+// recordFixture 配置了 SCRAPE_FIXTURE_DIR 时保存已加载页面的HTML，用于离线回放提取逻辑
+// 文件名为 <kind>_<viewkey 或页码>.html，同一页面覆盖保存；开头的注释记录页面地址
+func recordFixture(kind, pageURL string, page *rod.Page) {
+	dir := config.Settings.ScrapeFixtureDir
+	if dir == "" {
+		return
+	}
+
+	content, err := page.HTML()
+	if err != nil {
+		log.Printf("[Fixture] 读取页面HTML失败: %v", err)
+		return
+	}
+
+	key := "unknown"
+	if u, err := url.Parse(pageURL); err == nil {
+		query := u.Query()
+		if viewkey := query.Get("viewkey"); viewkey != "" {
+			key = viewkey
+		} else if pageNum := query.Get("page"); pageNum != "" {
+			key = query.Get("category") + "_" + pageNum
+		}
+	}
+	name := fmt.Sprintf("%s_%s.html", kind, fixtureNameRe.ReplaceAllString(key, ""))
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[Fixture] 创建目录失败: %v", err)
+		return
+	}
+	content = fmt.Sprintf("<!-- url: %s -->\n%s", pageURL, content)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		log.Printf("[Fixture] 保存失败: %v", err)
+		return
+	}
+	log.Printf("[Fixture] 已保存 %s", name)
+}
+
+// FixtureURL 读取录制文件开头记录的页面地址，没有记录时返回空字符串
+func FixtureURL(content string) string {
+	if matches := fixtureURLRe.FindStringSubmatch(content); len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// SetPageHTML 用给定的HTML替换页面内容，不访问网络
+// pageURL 非空且页面没有 <base> 时插入 <base>，使相对链接按原页面地址解析
+func SetPageHTML(page *rod.Page, content, pageURL string) error {
+	if pageURL != "" && !strings.Contains(strings.ToLower(content), "<base") {
+		base := fmt.Sprintf(`<base href="%s">`, html.EscapeString(pageURL))
+		if loc := headTagRe.FindStringIndex(content); loc != nil {
+			content = content[:loc[1]] + base + content[loc[1]:]
+		} else {
+			content = base + content
+		}
+	}
+	if err := page.SetDocumentContent(content); err != nil {
+		return fmt.Errorf("设置页面内容失败: %v", err)
+	}
+	return nil
+}
+
+// ExtractListFromHTML 对给定的列表页HTML运行列表提取逻辑（布局配置与在线抓取相同），用于回放录制的页面
+// 只需要浏览器，不访问网络，也不受熔断、维护模式影响
+func (s *ScraperService) ExtractListFromHTML(content, listURL, profileName string) (*VideoListResult, error) {
+	page, closeTab, err := s.openFixtureTab(content, listURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTab()
+
+	videos, err := s.extractListWithFallback(page, resolveListProfile(profileName, listURL))
+	if err != nil {
+		return nil, err
+	}
+	return &VideoListResult{
+		Videos:     videos,
+		TotalPages: s.getTotalPages(page),
+	}, nil
+}
+
+// ExtractDetailFromHTML 对给定的详情页HTML运行详情提取逻辑，未找到视频地址时返回nil
+// 不访问网络，Format 按地址判断，不探测上游
+func (s *ScraperService) ExtractDetailFromHTML(content, videoURL string) (*models.VideoDetail, error) {
+	page, closeTab, err := s.openFixtureTab(content, videoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTab()
+
+	detail := extractDetailFromPage(page, videoURL, "[Fixture] ")
+	if detail != nil {
+		detail.Format = StreamFormat(IsMp4URL(detail.M3u8URL))
+	}
+	return detail, nil
+}
+
+// fixtureTabTimeout 回放标签页的操作超时，避免页面异常时提取一直阻塞
+const fixtureTabTimeout = 30 * time.Second
+
+// openFixtureTab 打开空白标签页并载入给定的HTML，页面中的请求全部拦截，避免回放时访问网络
+func (s *ScraperService) openFixtureTab(content, pageURL string) (*rod.Page, func(), error) {
+	tab, err := s.openTab()
+	if err != nil {
+		return nil, nil, err
+	}
+	page := tab.Timeout(fixtureTabTimeout)
+
+	router := page.HijackRequests()
+	if err := router.Add("*", "", func(ctx *rod.Hijack) {
+		ctx.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+	}); err != nil {
+		tab.Close()
+		return nil, nil, fmt.Errorf("拦截页面请求失败: %v", err)
+	}
+	go router.Run()
+
+	closeTab := func() {
+		router.Stop()
+		tab.Close()
+	}
+	if err := SetPageHTML(page, content, pageURL); err != nil {
+		closeTab()
+		return nil, nil, err
+	}
+	return page, closeTab, nil
+}
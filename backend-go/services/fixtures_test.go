@@ -0,0 +1,186 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+const (
+	detailFixture = "testdata/detail_abc123.html"
+	listFixture   = "testdata/list_basic_1.html"
+)
+
+const (
+	fixtureVideoURL = "https://example.com/view_video.php?viewkey=abc123"
+	fixtureM3u8URL  = "https://cdn.example.com/hls/abc123/index.m3u8"
+	fixtureListURL  = "https://example.com/v.php?category=rf&viewtype=basic&page=1"
+)
+
+func readFixture(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestDetailFixtureMarkup(t *testing.T) {
+	content := readFixture(t, detailFixture)
+
+	if got := FixtureURL(content); got != fixtureVideoURL {
+		t.Fatalf("FixtureURL = %q, want %q", got, fixtureVideoURL)
+	}
+	src := decodeStrencodeSource(content)
+	if got := duplicateSlashRe.ReplaceAllString(src, ".com/"); got != fixtureM3u8URL {
+		t.Fatalf("解码的视频地址 = %q, want %q", got, fixtureM3u8URL)
+	}
+	// 混淆的地址经过URL编码，不应被页面内容的兜底匹配误认
+	if got := findMediaURL(content); got != "" {
+		t.Fatalf("findMediaURL = %q, want empty", got)
+	}
+}
+
+func TestFindMediaURL(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"mp4优先", `<a href="https://a.example.com/x.m3u8"></a><a href="https://b.example.com/y.mp4?t=1"></a>`, "https://b.example.com/y.mp4?t=1"},
+		{"m3u8", `var src = 'https://a.example.com/hls/index.m3u8';`, "https://a.example.com/hls/index.m3u8"},
+		{"无地址", `<p>no video</p>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findMediaURL(tt.html); got != tt.want {
+				t.Fatalf("findMediaURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractDetailFromHTML 在浏览器中回放录制的详情页，未安装Chrome时跳过
+func TestExtractDetailFromHTML(t *testing.T) {
+	bin, ok := launcher.LookPath()
+	if !ok {
+		t.Skip("未找到Chrome，跳过浏览器回放测试")
+	}
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.BrowserMode = "auto"
+	config.Settings.Headless = true
+	config.Settings.ChromePath = bin
+	config.Settings.ChromeUserDataDir = ""
+
+	s := NewScraperService()
+	defer s.Close()
+
+	detail, err := s.ExtractDetailFromHTML(readFixture(t, detailFixture), fixtureVideoURL)
+	if err != nil {
+		t.Fatalf("回放失败: %v", err)
+	}
+	if detail == nil {
+		t.Fatal("未提取到视频详情")
+	}
+	if detail.ID != "abc123" || detail.M3u8URL != fixtureM3u8URL {
+		t.Fatalf("ID/M3u8URL = %q/%q", detail.ID, detail.M3u8URL)
+	}
+	if detail.Title != "示例视频标题" {
+		t.Fatalf("Title = %q", detail.Title)
+	}
+	if detail.Thumbnail != "https://img.example.com/thumb/abc123.jpg" {
+		t.Fatalf("Thumbnail = %q", detail.Thumbnail)
+	}
+	if detail.Format != "hls" {
+		t.Fatalf("Format = %q", detail.Format)
+	}
+	// 只取播放器的字幕轨道，元数据轨道和页面上的其他 .vtt 链接不算
+	if len(detail.Subtitles) != 1 || detail.Subtitles[0].URL != "https://example.com/subs/abc123.zh.vtt" || detail.Subtitles[0].Lang != "zh" {
+		t.Fatalf("Subtitles = %+v", detail.Subtitles)
+	}
+}
+
+func TestListFixtureMarkup(t *testing.T) {
+	content := readFixture(t, listFixture)
+
+	if got := FixtureURL(content); got != fixtureListURL {
+		t.Fatalf("FixtureURL = %q, want %q", got, fixtureListURL)
+	}
+	// 未指定布局时按地址中的 viewtype=basic 选择
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ListExtractProfile = ""
+	if got := resolveListProfile("", fixtureListURL); got.Name != "basic" {
+		t.Fatalf("resolveListProfile = %q, want basic", got.Name)
+	}
+}
+
+// TestExtractListFromHTML 在浏览器中回放录制的列表页，未安装Chrome时跳过
+func TestExtractListFromHTML(t *testing.T) {
+	bin, ok := launcher.LookPath()
+	if !ok {
+		t.Skip("未找到Chrome，跳过浏览器回放测试")
+	}
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.BrowserMode = "auto"
+	config.Settings.Headless = true
+	config.Settings.ChromePath = bin
+	config.Settings.ChromeUserDataDir = ""
+	config.Settings.ListExtractProfile = ""
+
+	s := NewScraperService()
+	defer s.Close()
+
+	result, err := s.ExtractListFromHTML(readFixture(t, listFixture), fixtureListURL, "")
+	if err != nil {
+		t.Fatalf("回放失败: %v", err)
+	}
+	if result.TotalPages != 7 {
+		t.Fatalf("TotalPages = %d, want 7", result.TotalPages)
+	}
+	// 重复的视频和没有 viewkey 的链接被跳过
+	want := []models.VideoItem{
+		{ID: "abc123", Title: "第一个视频", Thumbnail: "https://img.example.com/thumb/abc123.jpg", Duration: "12:34", DurationSeconds: 754},
+		{ID: "def456", Title: "第二个视频", Thumbnail: "https://img.example.com/thumb/def456.jpg", Duration: "1:02:03", DurationSeconds: 3723},
+	}
+	if len(result.Videos) != len(want) {
+		t.Fatalf("Videos = %+v", result.Videos)
+	}
+	for i, w := range want {
+		got := result.Videos[i]
+		if got.ID != w.ID || got.Title != w.Title || got.Thumbnail != w.Thumbnail ||
+			got.Duration != w.Duration || got.DurationSeconds != w.DurationSeconds {
+			t.Fatalf("Videos[%d] = %+v, want %+v", i, got, w)
+		}
+		if !strings.HasPrefix(got.URL, "https://example.com/view_video.php?viewkey="+w.ID) {
+			t.Fatalf("Videos[%d].URL = %q", i, got.URL)
+		}
+	}
+}
+
+func TestDryRunCoversDetailSelectors(t *testing.T) {
+	// 选择器检查必须覆盖提取时使用的每个选择器
+	named := detailSelectors.named()
+	fields := reflect.ValueOf(detailSelectors)
+	if len(named) != fields.NumField() {
+		t.Fatalf("选择器检查有 %d 项，提取使用 %d 项", len(named), fields.NumField())
+	}
+	for i := 0; i < fields.NumField(); i++ {
+		sel := fields.Field(i).String()
+		found := false
+		for _, v := range named {
+			found = found || v == sel
+		}
+		if sel == "" || !found {
+			t.Errorf("选择器 %s = %q 未在选择器检查中", fields.Type().Field(i).Name, sel)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"backend-go/config"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// listCacheFile 列表缓存文件及其最后使用时间
+type listCacheFile struct {
+	page     int
+	path     string
+	lastUsed time.Time
+}
+
+// touchListCache 记录列表缓存的使用时间（不修改文件时间，文件时间用于判断列表是否过期）
+func (v *VideoCacheService) touchListCache(page int) {
+	v.mu.Lock()
+	v.listAccess[page] = time.Now()
+	v.mu.Unlock()
+}
+
+// pruneListCache 删除超过 LIST_CACHE_MAX_AGE 未使用的列表缓存，
+// 数量超过 LIST_CACHE_MAX_FILES 时再删除最久未使用的页，保留最近浏览的页
+// 启动后未使用过的页按文件修改时间计算
+func (v *VideoCacheService) pruneListCache() {
+	cfg := config.Settings
+	if cfg.ListCacheMaxFiles <= 0 && cfg.ListCacheMaxAge <= 0 {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(v.cacheDir, "list_page_*.json"))
+	if err != nil {
+		return
+	}
+
+	v.mu.RLock()
+	files := make([]listCacheFile, 0, len(paths))
+	for _, path := range paths {
+		var page int
+		if _, err := fmt.Sscanf(filepath.Base(path), "list_page_%d.json", &page); err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		lastUsed := info.ModTime()
+		if accessed := v.listAccess[page]; accessed.After(lastUsed) {
+			lastUsed = accessed
+		}
+		files = append(files, listCacheFile{page: page, path: path, lastUsed: lastUsed})
+	}
+	v.mu.RUnlock()
+
+	// 最近使用的在前
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].lastUsed.After(files[j].lastUsed)
+	})
+
+	maxAge := time.Duration(cfg.ListCacheMaxAge) * time.Second
+	removed := 0
+	for i, file := range files {
+		expired := maxAge > 0 && time.Since(file.lastUsed) > maxAge
+		overflow := cfg.ListCacheMaxFiles > 0 && i >= cfg.ListCacheMaxFiles
+		if !expired && !overflow {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		v.mu.Lock()
+		delete(v.listAccess, file.page)
+		v.mu.Unlock()
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("[Cache] 已清理 %d 个列表缓存，保留 %d 个", removed, len(files)-removed)
+	}
+}
+
+// DeleteListCache 删除指定页的列表缓存文件，返回是否删除了文件
+func (v *VideoCacheService) DeleteListCache(page int) (bool, error) {
+	v.mu.Lock()
+	delete(v.listAccess, page)
+	v.mu.Unlock()
+
+	if err := os.Remove(v.getListCachePath(page)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	log.Printf("[Cache] 已删除列表缓存: 第%d页", page)
+	return true, nil
+}
+
+// ClearListCaches 删除所有页的列表缓存文件，返回删除的数量
+func (v *VideoCacheService) ClearListCaches() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(v.cacheDir, "list_page_*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+
+	v.mu.Lock()
+	v.listAccess = make(map[int]time.Time)
+	v.mu.Unlock()
+
+	log.Printf("[Cache] 已清除 %d 个列表缓存", removed)
+	return removed, nil
+}
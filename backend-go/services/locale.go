@@ -0,0 +1,82 @@
+package services
+
+import (
+	"backend-go/config"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// siteLocale 获取语言cookie的名称和值，SITE_LOCALE 设为 off 或 none 时不设置
+func siteLocale() (string, string, bool) {
+	name := strings.TrimSpace(config.Settings.SiteLocaleCookie)
+	value := strings.TrimSpace(config.Settings.SiteLocale)
+	switch strings.ToLower(value) {
+	case "", "off", "none":
+		return "", "", false
+	}
+	if name == "" {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+// localeCookieHeader 获取HTTP请求使用的语言cookie，未启用时返回空字符串
+func localeCookieHeader() string {
+	name, value, ok := siteLocale()
+	if !ok {
+		return ""
+	}
+	return name + "=" + value
+}
+
+// localeBrowserCookies 获取浏览器中设置的语言cookie，主站和每个镜像各一条
+func localeBrowserCookies() []*proto.NetworkCookieParam {
+	name, value, ok := siteLocale()
+	if !ok {
+		return nil
+	}
+
+	var cookies []*proto.NetworkCookieParam
+	seen := make(map[string]bool)
+	for _, base := range GetMirrorService().All() {
+		parsed, err := url.Parse(base)
+		if err != nil || parsed.Hostname() == "" || seen[parsed.Hostname()] {
+			continue
+		}
+		seen[parsed.Hostname()] = true
+		cookies = append(cookies, &proto.NetworkCookieParam{
+			Name:   name,
+			Value:  value,
+			Domain: "." + strings.TrimPrefix(parsed.Hostname(), "www."),
+			Path:   "/",
+		})
+	}
+	return cookies
+}
+
+// AcceptLanguage 浏览器和HTTP请求使用的 Accept-Language（ACCEPT_LANGUAGE），为空时不设置
+func AcceptLanguage() string {
+	return strings.TrimSpace(config.Settings.AcceptLanguage)
+}
+
+// SetAcceptLanguage 为请求设置配置的 Accept-Language
+func SetAcceptLanguage(req *http.Request) {
+	if lang := AcceptLanguage(); lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+}
+
+// navigatorLanguages 由 Accept-Language 得到的 navigator.languages，去掉权重并按原顺序排列
+func navigatorLanguages() []string {
+	languages := make([]string, 0)
+	for _, item := range strings.Split(AcceptLanguage(), ",") {
+		tag, _, _ := strings.Cut(item, ";")
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" {
+			languages = append(languages, tag)
+		}
+	}
+	return languages
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"backend-go/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain 使用临时缓存目录和数据库加载配置，测试不读写仓库中的缓存
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "noproxy-services-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("VIDEO_CACHE_DIR", filepath.Join(dir, "videos"))
+	os.Setenv("CACHE_DB_PATH", filepath.Join(dir, "cache.db"))
+	config.Load()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
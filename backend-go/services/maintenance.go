@@ -0,0 +1,95 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrMaintenance 维护模式下不访问站点
+var ErrMaintenance = errors.New("服务维护中，暂时只提供已缓存的内容")
+
+// Maintenance 运行时可切换的维护模式
+// 开启后抓取服务不再访问站点（列表、详情、cookies刷新），路由使用缓存兜底或返回 503，已缓存的视频照常播放
+type Maintenance struct {
+	mu      sync.Mutex
+	enabled bool
+	message string
+	since   time.Time
+}
+
+// NewMaintenance 创建维护模式实例，初始状态取自 MAINTENANCE_MODE
+func NewMaintenance() *Maintenance {
+	m := &Maintenance{
+		enabled: config.Settings.MaintenanceMode,
+		message: config.Settings.MaintenanceMessage,
+	}
+	if m.enabled {
+		m.since = time.Now()
+	}
+	return m
+}
+
+// Enabled 是否处于维护模式
+func (m *Maintenance) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+// Status 获取维护模式状态
+func (m *Maintenance) Status() models.MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.statusLocked()
+}
+
+func (m *Maintenance) statusLocked() models.MaintenanceStatus {
+	status := models.MaintenanceStatus{Enabled: m.enabled}
+	if !m.enabled {
+		return status
+	}
+	status.Message = m.message
+	if status.Message == "" {
+		status.Message = ErrMaintenance.Error()
+	}
+	status.Since = m.since.Format(time.RFC3339)
+	status.RetryAfter = config.Settings.MaintenanceRetryAfter
+	return status
+}
+
+// Update 切换维护模式或修改提示信息，省略的字段保持不变（只在内存中生效）
+func (m *Maintenance) Update(req models.MaintenanceRequest) models.MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if req.Message != nil {
+		m.message = *req.Message
+	}
+	if req.Enabled != nil && *req.Enabled != m.enabled {
+		m.enabled = *req.Enabled
+		if m.enabled {
+			m.since = time.Now()
+			log.Println("[维护] 已进入维护模式，只提供已缓存的内容")
+		} else {
+			m.since = time.Time{}
+			log.Println("[维护] 已退出维护模式")
+		}
+	}
+	return m.statusLocked()
+}
+
+// 全局单例
+var maintenance *Maintenance
+var maintenanceOnce sync.Once
+
+// GetMaintenance 获取全局维护模式实例
+func GetMaintenance() *Maintenance {
+	maintenanceOnce.Do(func() {
+		maintenance = NewMaintenance()
+	})
+	return maintenance
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"backend-go/config"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// gzipMagic gzip 文件头
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// encodeMetadata 按 CACHE_COMPRESS_METADATA 压缩 video.m3u8、详情JSON等元数据，文件名保持不变
+func encodeMetadata(content []byte) ([]byte, error) {
+	if !config.Settings.CompressMetadata {
+		return content, nil
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readMetadata 读取元数据文件，按文件头识别 gzip 压缩，未压缩的文件原样返回
+// 开关 CACHE_COMPRESS_METADATA 前后写入的文件都能读取
+func readMetadata(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(content, gzipMagic) {
+		return content, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"backend-go/models"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics 启动以来的缓存命中和抓取计数，供没有监控系统的部署查看
+type Metrics struct {
+	startedAt time.Time
+
+	listCacheHits     atomic.Int64
+	listCacheMisses   atomic.Int64
+	detailCacheHits   atomic.Int64
+	detailCacheMisses atomic.Int64
+	segmentRequests   atomic.Int64
+	mp4CacheHits      atomic.Int64
+	scrapeSuccesses   atomic.Int64
+	scrapeFailures    atomic.Int64
+	cloudflareBlocks  atomic.Int64
+}
+
+// NewMetrics 创建计数器
+func NewMetrics() *Metrics {
+	return &Metrics{startedAt: time.Now()}
+}
+
+// ListCacheHit 列表命中有效期内的缓存
+func (m *Metrics) ListCacheHit() {
+	m.listCacheHits.Add(1)
+}
+
+// ListCacheMiss 列表缓存过期或不存在，需要实时抓取；不使用列表缓存的抓取不计入
+func (m *Metrics) ListCacheMiss() {
+	m.listCacheMisses.Add(1)
+}
+
+// DetailCacheHit 详情直接返回保存的结果
+func (m *Metrics) DetailCacheHit() {
+	m.detailCacheHits.Add(1)
+}
+
+// DetailCacheMiss 详情需要实时抓取
+func (m *Metrics) DetailCacheMiss() {
+	m.detailCacheMisses.Add(1)
+}
+
+// SegmentRequest 代理了一个分片请求
+func (m *Metrics) SegmentRequest() {
+	m.segmentRequests.Add(1)
+}
+
+// Mp4CacheHit 从本地缓存返回了MP4
+func (m *Metrics) Mp4CacheHit() {
+	m.mp4CacheHits.Add(1)
+}
+
+// recordScrape 按抓取结果计数，繁忙、熔断、维护和浏览器不可用时未实际访问站点，不计入
+func (m *Metrics) recordScrape(err error) {
+	switch {
+	case err == nil:
+		m.scrapeSuccesses.Add(1)
+	case errors.Is(err, ErrScraperBusy), errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrMaintenance), errors.Is(err, ErrBrowserUnavailable),
+		errors.Is(err, ErrCookieProfileNotFound), errors.Is(err, ErrInvalidCookieProfile):
+	default:
+		m.scrapeFailures.Add(1)
+		recordRecentError("scrape", "", err)
+	}
+}
+
+// cloudflareBlocked 抓取时遇到验证页面
+func (m *Metrics) cloudflareBlocked() {
+	m.cloudflareBlocks.Add(1)
+}
+
+// Snapshot 当前计数
+func (m *Metrics) Snapshot() models.CacheMetrics {
+	return models.CacheMetrics{
+		StartedAt:         m.startedAt.Format(time.RFC3339),
+		UptimeSeconds:     int64(time.Since(m.startedAt).Seconds()),
+		ListCacheHits:     m.listCacheHits.Load(),
+		ListCacheMisses:   m.listCacheMisses.Load(),
+		DetailCacheHits:   m.detailCacheHits.Load(),
+		DetailCacheMisses: m.detailCacheMisses.Load(),
+		SegmentRequests:   m.segmentRequests.Load(),
+		Mp4CacheHits:      m.mp4CacheHits.Load(),
+		ScrapeSuccesses:   m.scrapeSuccesses.Load(),
+		ScrapeFailures:    m.scrapeFailures.Load(),
+		CloudflareBlocks:  m.cloudflareBlocks.Load(),
+	}
+}
+
+// 全局单例
+var metrics *Metrics
+var metricsOnce sync.Once
+
+// GetMetrics 获取全局计数器实例
+func GetMetrics() *Metrics {
+	metricsOnce.Do(func() {
+		metrics = NewMetrics()
+	})
+	return metrics
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"backend-go/config"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MirrorService 目标网站镜像管理服务
+type MirrorService struct {
+	bases  []string
+	active int
+	mu     sync.RWMutex
+}
+
+// NewMirrorService 创建镜像管理服务实例
+func NewMirrorService() *MirrorService {
+	cfg := config.Settings
+	bases := []string{strings.TrimRight(cfg.TargetBaseURL, "/")}
+	for _, m := range cfg.TargetMirrors {
+		m = strings.TrimRight(m, "/")
+		if m != "" && m != bases[0] {
+			bases = append(bases, m)
+		}
+	}
+	return &MirrorService{bases: bases}
+}
+
+// Active 获取当前使用的镜像地址
+func (m *MirrorService) Active() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bases[m.active]
+}
+
+// All 获取所有镜像地址
+func (m *MirrorService) All() []string {
+	return m.bases
+}
+
+// Count 获取镜像数量
+func (m *MirrorService) Count() int {
+	return len(m.bases)
+}
+
+// Failover 切换到下一个镜像，返回新的镜像地址
+func (m *MirrorService) Failover(failed string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 其他请求已经切换过，直接使用当前镜像
+	if m.bases[m.active] != failed {
+		return m.bases[m.active]
+	}
+	m.active = (m.active + 1) % len(m.bases)
+	log.Printf("[Mirror] %s 不可用，切换到 %s", failed, m.bases[m.active])
+	return m.bases[m.active]
+}
+
+// IsMirrorHost 检查主机是否属于任一镜像
+func (m *MirrorService) IsMirrorHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, base := range m.bases {
+		if parsed, err := url.Parse(base); err == nil && strings.ToLower(parsed.Hostname()) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// RewriteToActive 将指向任一镜像的URL改写为当前镜像
+func (m *MirrorService) RewriteToActive(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !m.IsMirrorHost(parsed.Hostname()) {
+		return rawURL
+	}
+	active, err := url.Parse(m.Active())
+	if err != nil {
+		return rawURL
+	}
+	parsed.Scheme = active.Scheme
+	parsed.Host = active.Host
+	return parsed.String()
+}
+
+// mirrorBaseOf 获取URL的 scheme://host 部分
+func mirrorBaseOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// TargetBaseURL 获取当前可用的目标网站地址
+func TargetBaseURL() string {
+	return GetMirrorService().Active()
+}
+
+// 全局单例
+var mirrorService *MirrorService
+var mirrorOnce sync.Once
+
+// GetMirrorService 获取全局镜像管理服务实例
+func GetMirrorService() *MirrorService {
+	mirrorOnce.Do(func() {
+		mirrorService = NewMirrorService()
+	})
+	return mirrorService
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Mp4Tee 边播边缓存MP4：代理上游响应给客户端的同时写入缓存临时文件，上游只下载一次
+type Mp4Tee struct {
+	v          *VideoCacheService
+	viewkey    string
+	detail     *models.VideoDetail
+	total      int64
+	file       *os.File
+	writer     *bufio.Writer
+	tempPath   string
+	downloaded int64
+	err        error
+}
+
+// BeginMp4Tee 占用视频的下载任务并创建缓存临时文件，total 为上游文件大小（未知时<=0）
+// 未启用缓存、已缓存、超出 MAX_CACHE_SIZE_MB 或已有下载任务时返回nil
+func (v *VideoCacheService) BeginMp4Tee(viewkey string, detail *models.VideoDetail, total int64) *Mp4Tee {
+	if !config.Settings.VideoCacheEnabled || v.IsCached(viewkey) || mp4OverLimit(total) != "" {
+		return nil
+	}
+
+	v.mu.Lock()
+	if _, exists := v.downloadTasks[viewkey]; exists {
+		v.mu.Unlock()
+		return nil
+	}
+	v.downloadTasks[viewkey] = make(chan struct{})
+	v.mu.Unlock()
+
+	os.MkdirAll(v.cacheDir, 0755)
+	tempPath := v.getMp4TempPath(viewkey)
+	file, err := os.Create(tempPath)
+	if err != nil {
+		v.releaseDownloadTask(viewkey)
+		log.Printf("[Cache] 创建MP4缓存文件失败 %s: %v", viewkey, err)
+		return nil
+	}
+
+	v.setProgress(viewkey, models.DownloadProgress{
+		Type:      "mp4",
+		Status:    "downloading",
+		Total:     total,
+		StartedAt: time.Now(),
+	})
+	if detail != nil && detail.Thumbnail != "" {
+		go v.DownloadThumbnail(viewkey, detail.Thumbnail)
+	}
+
+	log.Printf("[Cache] 边播边缓存MP4: %s", viewkey)
+	return &Mp4Tee{
+		v:        v,
+		viewkey:  viewkey,
+		detail:   detail,
+		total:    total,
+		file:     file,
+		writer:   newDownloadWriter(file),
+		tempPath: tempPath,
+	}
+}
+
+// Write 写入一段上游数据，写入失败后不再写入，结束时放弃缓存
+func (t *Mp4Tee) Write(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.writer.Write(p)
+	if err != nil {
+		t.err = err
+		return n, err
+	}
+	t.downloaded += int64(n)
+
+	downloaded := t.downloaded
+	t.v.updateProgress(t.viewkey, func(progress *models.DownloadProgress) {
+		progress.Downloaded = downloaded
+		progress.Bytes = downloaded
+	})
+	return n, nil
+}
+
+// Finish 结束缓存：readErr 为空且数据完整时保存为缓存文件，否则删除临时文件
+func (t *Mp4Tee) Finish(readErr error) {
+	defer t.v.releaseDownloadTask(t.viewkey)
+	defer t.file.Close()
+
+	err := readErr
+	if err == nil {
+		err = t.err
+	}
+	if err == nil && t.total > 0 && t.downloaded != t.total {
+		err = fmt.Errorf("MP4数据不完整: %d/%d", t.downloaded, t.total)
+	}
+	if err != nil {
+		t.file.Close()
+		os.Remove(t.tempPath)
+		t.v.setDownloadError(t.viewkey, err)
+		return
+	}
+
+	t.v.completeMp4Download(t.viewkey, t.detail, t.file, t.writer, t.tempPath, t.downloaded)
+}
+
+// releaseDownloadTask 释放视频的下载任务
+func (v *VideoCacheService) releaseDownloadTask(viewkey string) {
+	v.mu.Lock()
+	delete(v.downloadTasks, viewkey)
+	v.mu.Unlock()
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"backend-go/config"
+	"log"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	// videoElementSelector 详情页播放器中的视频元素
+	videoElementSelector = ".video-container video, video"
+	// defaultPlayButtonSelector 详情页的播放按钮，可通过 SELECTORS 中的 play_button 覆盖
+	defaultPlayButtonSelector = ".vjs-big-play-button, .play-button, #player"
+)
+
+// videoSourceReady 视频元素是否已经有播放地址
+const videoSourceReady = `() => {
+	const v = document.querySelector('.video-container video') || document.querySelector('video');
+	return !!(v && (v.currentSrc || v.getAttribute('src') || v.querySelector('source[src]')));
+}`
+
+// playButtonSelector 点击播放使用的选择器，PLAY_BUTTON_CLICK 关闭或选择器为空时返回空字符串
+func playButtonSelector() string {
+	cfg := config.Settings
+	if !cfg.PlayButtonClick {
+		return ""
+	}
+	if sel, ok := cfg.Selectors["play_button"]; ok {
+		return sel
+	}
+	return defaultPlayButtonSelector
+}
+
+// preparePlayer 等待视频元素可见后点击播放，再等待视频地址就绪
+// VIDEO_ELEMENT_TIMEOUT 内视频元素没有出现时退回固定等待（3秒，点击播放后再等 PLAY_BUTTON_WAIT_MS）
+// 关闭 PLAY_BUTTON_CLICK 时不点击，也不做点击后的等待
+func preparePlayer(page *rod.Page, logPrefix string) {
+	playButton := playButtonSelector()
+	timeout := time.Duration(config.Settings.VideoElementTimeout) * time.Second
+	if timeout > 0 {
+		start := time.Now()
+		waitPage := page.Timeout(timeout)
+		defer waitPage.CancelTimeout()
+
+		if videoEl, err := waitPage.Element(videoElementSelector); err == nil && videoEl.WaitVisible() == nil {
+			// 播放按钮不存在时直接等待视频地址，不等到超时
+			if playButton != "" {
+				if has, playBtn, err := waitPage.Has(playButton); err == nil && has {
+					playBtn.Click(proto.InputMouseButtonLeft, 1)
+				}
+			}
+			if err := waitPage.Wait(rod.Eval(videoSourceReady)); err != nil {
+				log.Printf("%s等待视频地址超时，继续从页面提取", logPrefix)
+			}
+			log.Printf("%s视频元素就绪，用时 %v", logPrefix, time.Since(start).Round(time.Millisecond))
+			return
+		}
+		log.Printf("%s%v 内未等到视频元素，使用固定等待", logPrefix, timeout)
+	}
+
+	time.Sleep(3 * time.Second)
+	if playButton == "" {
+		return
+	}
+	// 没有播放按钮时不等待元素出现
+	if has, playBtn, err := page.Has(playButton); err == nil && has {
+		playBtn.Click(proto.InputMouseButtonLeft, 1)
+		time.Sleep(time.Duration(config.Settings.PlayButtonWaitMs) * time.Millisecond)
+	}
+}
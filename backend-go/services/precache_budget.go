@@ -0,0 +1,167 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"sync"
+	"time"
+)
+
+// defaultPrecacheEstimate 当天还没有完成的预缓存、下载进度也无法推算大小时，按此估算单个视频的大小
+const defaultPrecacheEstimate = 100 * 1024 * 1024
+
+// PrecacheBudget 预缓存每日流量预算
+// 已用流量按当天由预缓存启动的视频计算：已完成的按实际大小，进行中的按预计大小预留，失败的不计入
+type PrecacheBudget struct {
+	mu       sync.Mutex
+	day      string
+	viewkeys map[string]bool
+}
+
+// NewPrecacheBudget 创建预缓存预算实例
+func NewPrecacheBudget() *PrecacheBudget {
+	return &PrecacheBudget{viewkeys: make(map[string]bool)}
+}
+
+// budgetBytes 每日预算字节数，<=0 表示不限制
+func (b *PrecacheBudget) budgetBytes() int64 {
+	return int64(config.Settings.PrecacheDailyBudgetMB) * 1024 * 1024
+}
+
+// resetLocked 跨天时清空已用记录（调用方需持有 mu）
+func (b *PrecacheBudget) resetLocked(now time.Time) {
+	today := now.Format("2006-01-02")
+	if b.day != today {
+		b.day = today
+		b.viewkeys = make(map[string]bool)
+	}
+}
+
+// usedLocked 计算当天已用流量（调用方需持有 mu）
+// 已缓存的按数据库中的大小；抓取详情或下载中的按预计大小预留；既未缓存也不在下载的视为失败，不计入
+func (b *PrecacheBudget) usedLocked() int64 {
+	cacheDB := GetCacheDBService()
+	cacheService := GetVideoCacheService()
+
+	var used, completed int64
+	var completedCount int64
+	var pending []string
+	for viewkey, reserved := range b.viewkeys {
+		if info, err := cacheDB.GetCachedVideo(viewkey); err == nil && info != nil {
+			used += info.Size
+			completed += info.Size
+			completedCount++
+			continue
+		}
+		if reserved || cacheService.IsDownloading(viewkey) {
+			pending = append(pending, viewkey)
+		}
+	}
+
+	estimate := int64(defaultPrecacheEstimate)
+	if completedCount > 0 {
+		estimate = completed / completedCount
+	}
+	for _, viewkey := range pending {
+		progress, ok := cacheService.GetDownloadProgress(viewkey)
+		if !ok {
+			used += estimate
+			continue
+		}
+		used += expectedDownloadBytes(progress, estimate)
+	}
+	return used
+}
+
+// expectedDownloadBytes 按下载进度推算视频的总大小，无法推算时使用 estimate，结果不小于已下载的字节数
+// MP4 的 Total 即为字节数；M3U8 按已下载分片的平均大小乘以分片总数
+func expectedDownloadBytes(progress models.DownloadProgress, estimate int64) int64 {
+	expected := estimate
+	switch {
+	case progress.Type == "mp4" && progress.Total > 0:
+		expected = progress.Total
+	case progress.Type != "mp4" && progress.Downloaded > 0 && progress.Total > 0:
+		expected = progress.Bytes * progress.Total / progress.Downloaded
+	}
+	if progress.Bytes > expected {
+		expected = progress.Bytes
+	}
+	return expected
+}
+
+// Reserve 检查当天预算是否还有剩余，有剩余时为该视频预留预计大小
+// 预留在 Record 启动下载后转为按下载进度计算，未能启动下载时需调用 Release 释放
+func (b *PrecacheBudget) Reserve(viewkey string) bool {
+	budget := b.budgetBytes()
+	if budget <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetLocked(time.Now())
+	if b.usedLocked() >= budget {
+		return false
+	}
+	b.viewkeys[viewkey] = true
+	return true
+}
+
+// Release 释放未能启动下载的视频的预留
+func (b *PrecacheBudget) Release(viewkey string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.viewkeys[viewkey] {
+		delete(b.viewkeys, viewkey)
+	}
+}
+
+// Record 记录由预缓存启动的下载，之后按下载进度计算该视频的预计大小，下载失败后不再计入
+func (b *PrecacheBudget) Record(viewkey string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetLocked(time.Now())
+	b.viewkeys[viewkey] = false
+}
+
+// Stats 获取当天预算使用情况
+func (b *PrecacheBudget) Stats() models.PrecacheBudgetInfo {
+	now := time.Now()
+	budget := b.budgetBytes()
+
+	b.mu.Lock()
+	b.resetLocked(now)
+	used := b.usedLocked()
+	started := len(b.viewkeys)
+	b.mu.Unlock()
+
+	year, month, day := now.Date()
+	info := models.PrecacheBudgetInfo{
+		Enabled:     GetPrecacheControl().Enabled(),
+		MaxVideos:   config.Settings.PrecacheMaxVideos,
+		BudgetBytes: budget,
+		UsedBytes:   used,
+		Started:     started,
+		ResetAt:     time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Format(time.RFC3339),
+	}
+	if budget > 0 {
+		info.RemainingBytes = budget - used
+		if info.RemainingBytes < 0 {
+			info.RemainingBytes = 0
+		}
+		info.Paused = info.RemainingBytes == 0
+	}
+	return info
+}
+
+// 全局单例
+var precacheBudget *PrecacheBudget
+var precacheBudgetOnce sync.Once
+
+// GetPrecacheBudget 获取全局预缓存预算实例
+func GetPrecacheBudget() *PrecacheBudget {
+	precacheBudgetOnce.Do(func() {
+		precacheBudget = NewPrecacheBudget()
+	})
+	return precacheBudget
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"testing"
+)
+
+func TestPrecacheBudgetReservesInFlight(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.PrecacheDailyBudgetMB = 250
+
+	b := NewPrecacheBudget()
+	for _, viewkey := range []string{"budget_a", "budget_b", "budget_c"} {
+		if !b.Reserve(viewkey) {
+			t.Fatalf("%s 应在预算内", viewkey)
+		}
+	}
+	// 三个进行中的预缓存按默认估算共预留 300MB，超出 250MB 预算
+	if b.Reserve("budget_d") {
+		t.Fatal("进行中的预缓存应占用预算")
+	}
+
+	// 未能启动下载时释放预留
+	b.Release("budget_c")
+	if !b.Reserve("budget_d") {
+		t.Fatal("释放预留后应有剩余预算")
+	}
+
+	// 已启动但既未缓存也不在下载（下载失败）的视频不再计入
+	b.Record("budget_a")
+	b.Record("budget_b")
+	if used := b.Stats().UsedBytes; used != defaultPrecacheEstimate {
+		t.Fatalf("已用 = %d, want %d", used, defaultPrecacheEstimate)
+	}
+}
+
+func TestExpectedDownloadBytes(t *testing.T) {
+	const estimate = 1000
+	tests := []struct {
+		name     string
+		progress models.DownloadProgress
+		want     int64
+	}{
+		{"mp4总大小", models.DownloadProgress{Type: "mp4", Total: 5000, Bytes: 100}, 5000},
+		{"m3u8按分片推算", models.DownloadProgress{Type: "m3u8", Total: 10, Downloaded: 2, Bytes: 400}, 2000},
+		{"尚无进度", models.DownloadProgress{Type: "m3u8", Total: 10}, estimate},
+		{"不小于已下载", models.DownloadProgress{Type: "mp4", Bytes: 3000}, 3000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expectedDownloadBytes(tt.progress, estimate); got != tt.want {
+				t.Fatalf("expectedDownloadBytes = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
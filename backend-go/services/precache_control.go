@@ -0,0 +1,148 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// PrecacheControl 运行时可调整的预缓存开关和并发数
+// 未修改时使用配置中的 AUTO_PRECACHE / PRECACHE_CONCURRENT，修改后保存在内存中，
+// 配置了 PRECACHE_SETTINGS_FILE 时同时写入文件，重启后恢复；纯代理模式（PURE_PROXY）下不读写该文件
+type PrecacheControl struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	enabled    *bool
+	concurrent *int
+	active     int
+}
+
+// precacheOverrides 保存到文件中的覆盖值
+type precacheOverrides struct {
+	AutoPrecache       *bool `json:"auto_precache,omitempty"`
+	PrecacheConcurrent *int  `json:"precache_concurrent,omitempty"`
+}
+
+// NewPrecacheControl 创建预缓存控制实例，并读取已保存的覆盖值
+func NewPrecacheControl() *PrecacheControl {
+	p := &PrecacheControl{}
+	p.cond = sync.NewCond(&p.mu)
+
+	if path := config.Settings.PrecacheSettingsFile; path != "" && !config.Settings.PureProxy {
+		if content, err := os.ReadFile(path); err == nil {
+			var saved precacheOverrides
+			if err := json.Unmarshal(content, &saved); err != nil {
+				log.Printf("[预缓存] 读取运行时设置失败: %v", err)
+			} else {
+				p.enabled = saved.AutoPrecache
+				p.concurrent = saved.PrecacheConcurrent
+			}
+		}
+	}
+	return p
+}
+
+// Enabled 当前是否自动预缓存列表视频
+func (p *PrecacheControl) Enabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enabledLocked()
+}
+
+func (p *PrecacheControl) enabledLocked() bool {
+	if p.enabled != nil {
+		return *p.enabled
+	}
+	return config.Settings.AutoPrecache
+}
+
+// Concurrent 当前预缓存并发数
+func (p *PrecacheControl) Concurrent() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.concurrentLocked()
+}
+
+func (p *PrecacheControl) concurrentLocked() int {
+	n := config.Settings.PrecacheConcurrent
+	if p.concurrent != nil {
+		n = *p.concurrent
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Acquire 占用一个预缓存并发名额，已达到当前并发数时等待
+// 每次都读取最新的并发数，调小后正在进行的任务完成前不再启动新任务
+func (p *PrecacheControl) Acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.active >= p.concurrentLocked() {
+		p.cond.Wait()
+	}
+	p.active++
+}
+
+// Release 释放预缓存并发名额
+func (p *PrecacheControl) Release() {
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// Update 修改预缓存开关和并发数，nil 表示不修改
+func (p *PrecacheControl) Update(req models.PrecacheSettingsRequest) models.PrecacheSettingsResponse {
+	p.mu.Lock()
+	if req.AutoPrecache != nil {
+		enabled := *req.AutoPrecache
+		p.enabled = &enabled
+	}
+	if req.PrecacheConcurrent != nil {
+		concurrent := *req.PrecacheConcurrent
+		p.concurrent = &concurrent
+	}
+	saved := precacheOverrides{AutoPrecache: p.enabled, PrecacheConcurrent: p.concurrent}
+	p.mu.Unlock()
+
+	// 并发数调大时唤醒等待中的任务
+	p.cond.Broadcast()
+
+	if path := config.Settings.PrecacheSettingsFile; path != "" && !config.Settings.PureProxy {
+		if content, err := json.MarshalIndent(saved, "", "  "); err == nil {
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				log.Printf("[预缓存] 保存运行时设置失败: %v", err)
+			}
+		}
+	}
+	return p.Settings()
+}
+
+// Settings 获取当前的预缓存设置
+func (p *PrecacheControl) Settings() models.PrecacheSettingsResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return models.PrecacheSettingsResponse{
+		AutoPrecache:       p.enabledLocked(),
+		PrecacheConcurrent: p.concurrentLocked(),
+		Active:             p.active,
+		Overridden:         p.enabled != nil || p.concurrent != nil,
+	}
+}
+
+// 全局单例
+var precacheControl *PrecacheControl
+var precacheControlOnce sync.Once
+
+// GetPrecacheControl 获取全局预缓存控制实例
+func GetPrecacheControl() *PrecacheControl {
+	precacheControlOnce.Do(func() {
+		precacheControl = NewPrecacheControl()
+	})
+	return precacheControl
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrecacheControlPureProxySkipsSettingsFile(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+
+	path := filepath.Join(t.TempDir(), "precache_settings.json")
+	if err := os.WriteFile(path, []byte(`{"precache_concurrent": 7}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Settings.PrecacheSettingsFile = path
+	config.Settings.PureProxy = true
+	config.Settings.PrecacheConcurrent = 2
+
+	p := NewPrecacheControl()
+	if got := p.Concurrent(); got != 2 {
+		t.Fatalf("纯代理模式不应读取设置文件，并发数 = %d", got)
+	}
+
+	os.Remove(path)
+	enabled := false
+	p.Update(models.PrecacheSettingsRequest{AutoPrecache: &enabled})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("纯代理模式不应写入设置文件: %v", err)
+	}
+	if p.Enabled() {
+		t.Fatal("修改应在内存中生效")
+	}
+}
@@ -1,13 +1,14 @@
 package services
 
 import (
+	"backend-go/config"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +16,9 @@ import (
 
 // ProxyService M3U8代理服务
 type ProxyService struct {
-	client *http.Client
-	mu     sync.RWMutex
+	client   *http.Client
+	mu       sync.RWMutex
+	segments *segmentCache
 }
 
 // NewProxyService 创建代理服务实例
@@ -30,6 +32,7 @@ func NewProxyService() *ProxyService {
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
+		segments: newSegmentCache(),
 	}
 }
 
@@ -38,21 +41,23 @@ func (p *ProxyService) Close() {
 	p.client.CloseIdleConnections()
 }
 
-// FetchM3u8 获取并重写m3u8文件
-func (p *ProxyService) FetchM3u8(m3u8URL, proxyBaseURL string) (string, error) {
-	log.Printf("正在获取m3u8: %s", m3u8URL)
-
-	req, err := http.NewRequest("GET", m3u8URL, nil)
-	if err != nil {
-		return "", err
-	}
+// FetchM3u8 获取并重写m3u8文件，改写后的分片地址按 session 签名
+func (p *ProxyService) FetchM3u8(m3u8URL, proxyBaseURL, session string) (string, error) {
+	return p.fetchM3u8(m3u8URL, proxyBaseURL, session, 0)
+}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Cookie", "language=cn_CN")
+// fetchM3u8 获取并重写m3u8文件，depth 为已跟随的重定向次数
+func (p *ProxyService) fetchM3u8(m3u8URL, proxyBaseURL, session string, depth int) (string, error) {
+	log.Printf("正在获取m3u8: %s", m3u8URL)
 
-	resp, err := p.client.Do(req)
+	resp, m3u8URL, err := p.doWithMirrorFailover(m3u8URL, func(req *http.Request) {
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+		SetAcceptLanguage(req)
+		req.Header.Set("Accept", "*/*")
+		if cookie := localeCookieHeader(); cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+	})
 	if err != nil {
 		return "", err
 	}
@@ -77,22 +82,28 @@ func (p *ProxyService) FetchM3u8(m3u8URL, proxyBaseURL string) (string, error) {
 		if strings.HasPrefix(strings.TrimSpace(content), "http") {
 			redirectURL := strings.TrimSpace(strings.Split(content, "\n")[0])
 			log.Printf("检测到重定向URL: %s", redirectURL)
-			return p.FetchM3u8(redirectURL, proxyBaseURL)
+			if depth >= config.Settings.M3u8MaxRedirects {
+				return "", fmt.Errorf("m3u8重定向次数超过上限: %d", config.Settings.M3u8MaxRedirects)
+			}
+			return p.fetchM3u8(redirectURL, proxyBaseURL, session, depth+1)
 		}
 		return "", fmt.Errorf("内容不是m3u8格式，可能是MP4文件")
 	}
 
 	// 重写m3u8内容
-	result := p.rewriteM3u8(content, m3u8URL, proxyBaseURL)
+	result := p.rewriteM3u8(content, m3u8URL, proxyBaseURL, session)
 	log.Printf("m3u8重写后内容前500字符:\n%s", truncateString(result, 500))
 	return result, nil
 }
 
 // rewriteM3u8 重写m3u8文件中的URL
-func (p *ProxyService) rewriteM3u8(content, originalURL, proxyBaseURL string) string {
+func (p *ProxyService) rewriteM3u8(content, originalURL, proxyBaseURL, session string) string {
 	lines := strings.Split(content, "\n")
 	var newLines []string
+	var segmentURLs []string
 	baseURL := p.getBaseURL(originalURL)
+	// 字节范围分片改写为各自独立的代理地址，不再保留 BYTERANGE
+	ranges := newByteRangeTracker()
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -104,9 +115,16 @@ func (p *ProxyService) rewriteM3u8(content, originalURL, proxyBaseURL string) st
 
 		// 跳过注释行但保留
 		if strings.HasPrefix(line, "#") {
+			if ranges.consumeTag(line) {
+				continue
+			}
 			// 处理 #EXT-X-KEY 等包含URI的行
 			if strings.Contains(line, "URI=") {
-				line = p.rewriteURIInTag(line, baseURL, proxyBaseURL)
+				withRange := func(u string) string { return u }
+				if strings.HasPrefix(line, "#EXT-X-MAP") {
+					line, withRange = mapByteRange(line)
+				}
+				line = p.rewriteURIInTag(line, baseURL, proxyBaseURL, session, withRange)
 			}
 			newLines = append(newLines, line)
 			continue
@@ -121,19 +139,25 @@ func (p *ProxyService) rewriteM3u8(content, originalURL, proxyBaseURL string) st
 		} else {
 			absoluteURL = line
 		}
+		absoluteURL = ranges.apply(absoluteURL)
 
 		// 生成代理URL
-		proxyURL := p.createProxyURL(absoluteURL, proxyBaseURL)
+		proxyURL := p.createProxyURL(absoluteURL, proxyBaseURL, session)
 		newLines = append(newLines, proxyURL)
+		segmentURLs = append(segmentURLs, absoluteURL)
+	}
+
+	// 记录分片顺序，供播放时预取后续分片
+	if prefetchEnabled() {
+		p.segments.indexPlaylist(segmentURLs)
 	}
 
 	return strings.Join(newLines, "\n")
 }
 
-// rewriteURIInTag 重写标签中的URI
-func (p *ProxyService) rewriteURIInTag(line, baseURL, proxyBaseURL string) string {
-	re := regexp.MustCompile(`URI="([^"]+)"`)
-	matches := re.FindStringSubmatch(line)
+// rewriteURIInTag 重写标签中的URI，withRange 用于给初始化分片附加字节范围
+func (p *ProxyService) rewriteURIInTag(line, baseURL, proxyBaseURL, session string, withRange func(string) string) string {
+	matches := MapURIRe.FindStringSubmatch(line)
 	if len(matches) > 1 {
 		originalURI := matches[1]
 		var absoluteURI string
@@ -144,7 +168,7 @@ func (p *ProxyService) rewriteURIInTag(line, baseURL, proxyBaseURL string) strin
 		} else {
 			absoluteURI = originalURI
 		}
-		proxyURI := p.createProxyURL(absoluteURI, proxyBaseURL)
+		proxyURI := p.createProxyURL(withRange(absoluteURI), proxyBaseURL, session)
 		line = strings.Replace(line, fmt.Sprintf(`URI="%s"`, originalURI), fmt.Sprintf(`URI="%s"`, proxyURI), 1)
 	}
 	return line
@@ -163,33 +187,114 @@ func (p *ProxyService) getBaseURL(rawURL string) string {
 	return fmt.Sprintf("%s://%s%s", parsed.Scheme, parsed.Host, path)
 }
 
-// createProxyURL 创建代理URL
-func (p *ProxyService) createProxyURL(originalURL, proxyBaseURL string) string {
+// createProxyURL 创建代理URL，并记录播放列表中出现的上游主机
+func (p *ProxyService) createProxyURL(originalURL, proxyBaseURL, session string) string {
+	RememberUpstreamHosts(originalURL)
 	encoded := base64.URLEncoding.EncodeToString([]byte(originalURL))
-	return fmt.Sprintf("%s/api/stream/segment/%s", proxyBaseURL, encoded)
+	return proxyBaseURL + SignPath("/api/stream/segment/"+encoded, session)
+}
+
+// SubtitleProxyPath 生成字幕代理路径（启用签名时附带签名）
+func SubtitleProxyPath(subtitleURL, session string) string {
+	encoded := base64.URLEncoding.EncodeToString([]byte(subtitleURL))
+	return SignPath("/api/stream/subtitle/"+encoded, session)
 }
 
 // FetchSegment 获取ts分片或其他资源
+// 启用内存缓存时优先从缓存读取，并在后台预取播放列表中的后续分片；未启用时每次直接请求上游
 func (p *ProxyService) FetchSegment(segmentURL string) ([]byte, string, error) {
-	req, err := http.NewRequest("GET", segmentURL, nil)
+	cfg := config.Settings
+	if !segmentCacheEnabled() {
+		return p.fetchSegment(segmentURL)
+	}
+
+	ttl := time.Duration(cfg.CacheTTL) * time.Second
+	maxBytes := segmentCacheMaxBytes()
+	if prefetchEnabled() {
+		go p.prefetchSegments(segmentURL, cfg.SegmentPrefetchOffset, cfg.SegmentPrefetchCount, ttl, maxBytes)
+	}
+
+	if content, contentType, ok := p.segments.get(segmentURL); ok {
+		return content, contentType, nil
+	}
+
+	content, contentType, err := p.fetchSegment(segmentURL)
 	if err != nil {
 		return nil, "", err
 	}
+	p.segments.put(segmentURL, content, contentType, ttl, maxBytes)
+	return content, contentType, nil
+}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Accept", "*/*")
+// CachedSegment 从内存缓存读取分片，命中时同时触发后续分片的预取；未启用内存缓存或未命中时返回false
+// 调用方可以先用它处理命中的请求，只在需要请求上游时再调用 FetchSegment
+func (p *ProxyService) CachedSegment(segmentURL string) ([]byte, string, bool) {
+	if !segmentCacheEnabled() {
+		return nil, "", false
+	}
+	content, contentType, ok := p.segments.get(segmentURL)
+	if ok && prefetchEnabled() {
+		cfg := config.Settings
+		go p.prefetchSegments(segmentURL, cfg.SegmentPrefetchOffset, cfg.SegmentPrefetchCount,
+			time.Duration(cfg.CacheTTL)*time.Second, segmentCacheMaxBytes())
+	}
+	return content, contentType, ok
+}
 
-	resp, err := p.client.Do(req)
+// prefetchSegments 预取播放列表中指定分片之后（跳过 offset 个）的 count 个分片到内存缓存
+func (p *ProxyService) prefetchSegments(segmentURL string, offset, count int, ttl time.Duration, maxBytes int64) {
+	for _, next := range p.segments.nextURLs(segmentURL, offset, count) {
+		if !p.segments.beginFetch(next) {
+			continue
+		}
+		content, contentType, err := p.fetchSegment(next)
+		p.segments.endFetch(next)
+		if err != nil {
+			log.Printf("[Proxy] 预取分片失败: %v", err)
+			return
+		}
+		p.segments.put(next, content, contentType, ttl, maxBytes)
+	}
+}
+
+// segmentCacheEnabled 是否启用分片内存缓存：CACHE_ENABLED 开启，且 CACHE_TTL 和 SEGMENT_CACHE_MAX_MB 大于0
+func segmentCacheEnabled() bool {
+	cfg := config.Settings
+	return cfg.CacheEnabled && cfg.CacheTTL > 0 && cfg.SegmentCacheMaxMB > 0
+}
+
+// prefetchEnabled 是否启用分片预取（需要同时启用内存缓存，否则预取的分片无处保存）
+func prefetchEnabled() bool {
+	return segmentCacheEnabled() && config.Settings.SegmentPrefetchCount > 0
+}
+
+// segmentCacheMaxBytes 分片内存缓存的容量上限
+func segmentCacheMaxBytes() int64 {
+	return int64(config.Settings.SegmentCacheMaxMB) * 1024 * 1024
+}
+
+// fetchSegment 从上游获取分片
+// 地址带字节范围片段时只请求对应的字节
+func (p *ProxyService) fetchSegment(segmentURL string) ([]byte, string, error) {
+	segmentURL, rangeHeader := splitByteRange(segmentURL)
+	resp, _, err := p.doWithMirrorFailover(segmentURL, func(req *http.Request) {
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+		SetAcceptLanguage(req)
+		req.Header.Set("Accept", "*/*")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+	})
 	if err != nil {
 		return nil, "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		return nil, "", fmt.Errorf("获取分片失败: %d", resp.StatusCode)
 	}
 
-	content, err := io.ReadAll(resp.Body)
+	content, err := readRangeBody(resp, rangeHeader)
 	if err != nil {
 		return nil, "", err
 	}
@@ -202,6 +307,204 @@ func (p *ProxyService) FetchSegment(segmentURL string) ([]byte, string, error) {
 	return content, contentType, nil
 }
 
+// doWithMirrorFailover 发送GET请求，地址属于镜像站点时先改写为当前镜像，
+// 遇到连接失败、5xx 或验证拦截时依次切换到下一个镜像重试，返回响应和最终请求的地址
+func (p *ProxyService) doWithMirrorFailover(rawURL string, prepare func(*http.Request)) (*http.Response, string, error) {
+	mirrors := GetMirrorService()
+	target := mirrors.RewriteToActive(rawURL)
+	attempts := 1
+	if parsed, err := url.Parse(target); err == nil && mirrors.IsMirrorHost(parsed.Hostname()) {
+		attempts = mirrors.Count()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			return nil, target, err
+		}
+		prepare(req)
+
+		resp, err := p.client.Do(req)
+		if attempt >= attempts-1 || (err == nil && resp.StatusCode < 500 && !isChallengeResponse(resp)) {
+			return resp, target, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		log.Printf("[Mirror] 请求 %s 失败: %v，切换镜像重试", target, err)
+		mirrors.Failover(mirrorBaseOf(target))
+		target = mirrors.RewriteToActive(target)
+	}
+}
+
+// isChallengeResponse 判断响应是否为 Cloudflare 验证拦截页面
+func isChallengeResponse(resp *http.Response) bool {
+	return resp.Header.Get("Cf-Mitigated") == "challenge"
+}
+
+// HeadInfo 通过HEAD请求获取上游资源的状态码、类型和大小（大小未知时为-1）
+func (p *ProxyService) HeadInfo(resourceURL string) (int, string, int64, error) {
+	req, err := http.NewRequest("HEAD", resourceURL, nil)
+	if err != nil {
+		return 0, "", -1, err
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	SetAcceptLanguage(req)
+	req.Header.Set("Referer", TargetBaseURL())
+	req.Header.Set("Accept", "*/*")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, "", -1, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, resp.Header.Get("Content-Type"), resp.ContentLength, nil
+}
+
+// ProbeIsMp4 探测上游视频地址是否为MP4：先看HEAD返回的Content-Type，
+// 无法判断时读取开头少量数据检查是否以 #EXTM3U 开头
+func (p *ProxyService) ProbeIsMp4(resourceURL string) (bool, error) {
+	status, contentType, _, err := p.HeadInfo(resourceURL)
+	if err == nil && status < 400 {
+		if isMp4, ok := streamTypeFromContentType(contentType); ok {
+			return isMp4, nil
+		}
+	}
+
+	req, err := http.NewRequest("GET", resourceURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	SetAcceptLanguage(req)
+	req.Header.Set("Referer", TargetBaseURL())
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Range", "bytes=0-511")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if isMp4, ok := streamTypeFromContentType(resp.Header.Get("Content-Type")); ok {
+		return isMp4, nil
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if err != nil && len(head) == 0 {
+		return false, err
+	}
+	content := strings.TrimLeft(strings.TrimPrefix(string(head), "\uFEFF"), " \t\r\n")
+	if strings.HasPrefix(content, "#EXTM3U") {
+		return false, nil
+	}
+	// MP4 文件第4-8字节为 ftyp
+	if len(head) >= 8 && string(head[4:8]) == "ftyp" {
+		return true, nil
+	}
+	return false, fmt.Errorf("无法识别的视频格式: %s", resp.Header.Get("Content-Type"))
+}
+
+// streamTypeFromContentType 根据Content-Type判断是否为MP4，第二个返回值表示能否判断
+// MPEG-TS（video/mp2t）是HLS分片，按HLS处理
+func streamTypeFromContentType(contentType string) (bool, bool) {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "mpegurl"), strings.HasPrefix(contentType, "video/mp2t"):
+		return false, true
+	case strings.HasPrefix(contentType, "video/"):
+		return true, true
+	}
+	return false, false
+}
+
+// IsMp4URL 根据URL猜测是否为MP4（探测失败时的兜底判断）
+func IsMp4URL(videoURL string) bool {
+	lower := strings.ToLower(videoURL)
+	return strings.Contains(lower, ".mp4") || !strings.Contains(lower, ".m3u8")
+}
+
+// StreamFormat 视频流格式名称：mp4 或 hls
+func StreamFormat(isMp4 bool) string {
+	if isMp4 {
+		return "mp4"
+	}
+	return "hls"
+}
+
+// DetectIsMp4 判断视频地址是否为MP4，优先探测上游，失败时按URL猜测
+func (p *ProxyService) DetectIsMp4(videoURL string) bool {
+	isMp4, err := p.ProbeIsMp4(videoURL)
+	if err != nil {
+		log.Printf("[Proxy] 探测视频格式失败，按URL判断: %v", err)
+		return IsMp4URL(videoURL)
+	}
+	return isMp4
+}
+
+// IsAllowedHost 检查URL的主机是否在代理白名单中，目标网站（含镜像）始终允许
+// 未配置白名单时只允许从目标网站抓取到的CDN主机（见 RememberUpstreamHosts），不会成为任意地址的代理
+func (p *ProxyService) IsAllowedHost(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if GetMirrorService().IsMirrorHost(host) {
+		return true
+	}
+
+	allowed := config.Settings.ProxyAllowedHosts
+	if len(allowed) == 0 {
+		return isUpstreamHost(host)
+	}
+	for _, h := range allowed {
+		h = strings.ToLower(h)
+		// 支持子域名匹配
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublicHost 检查URL的主机是否为公网地址，IP或域名解析结果为内网、本机、链路本地等地址时返回false
+// 只用于提前拒绝请求，实际连接时由 newPublicOnlyClient 再次检查
+func (p *ProxyService) IsPublicHost(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil || len(ips) == 0 {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetClient 获取HTTP客户端
 func (p *ProxyService) GetClient() *http.Client {
 	return p.client
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"backend-go/config"
+	"backend-go/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchM3u8FollowsRedirectBody(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.M3u8MaxRedirects = 3
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/first.m3u8":
+			fmt.Fprintf(w, "%s/second.m3u8\n", server.URL)
+		case "/second.m3u8":
+			fmt.Fprintf(w, "%s/hls/index.m3u8\n", server.URL)
+		case "/hls/index.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXT-X-ENDLIST\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	content, err := GetProxyService().FetchM3u8(server.URL+"/first.m3u8", "/api/stream/segment", "")
+	if err != nil {
+		t.Fatalf("两次重定向应成功: %v", err)
+	}
+	if !strings.HasPrefix(content, "#EXTM3U") || !strings.Contains(content, "/api/stream/segment") {
+		t.Fatalf("重写后的播放列表不正确:\n%s", content)
+	}
+}
+
+func TestFetchM3u8StopsSelfRedirectLoop(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.M3u8MaxRedirects = 3
+
+	var hits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintf(w, "%s/loop.m3u8\n", server.URL)
+	}))
+	defer server.Close()
+
+	_, err := GetProxyService().FetchM3u8(server.URL+"/loop.m3u8", "/api/stream/segment", "")
+	if err == nil || !strings.Contains(err.Error(), "重定向次数超过上限") {
+		t.Fatalf("自循环重定向应返回超过上限的错误, got %v", err)
+	}
+	// 首次请求加上最多 M3U8_MAX_REDIRECTS 次重定向
+	if got := hits.Load(); got != 4 {
+		t.Fatalf("请求次数 = %d, want 4", got)
+	}
+}
+
+func TestFetchSegmentRespectsCacheEnabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheEnabled bool
+		wantSegHits  int32
+		wantPrefetch int32
+	}{
+		{"启用内存缓存", true, 1, 1},
+		{"关闭内存缓存", false, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := *config.Settings
+			defer func() { *config.Settings = saved }()
+			config.Settings.CacheEnabled = tt.cacheEnabled
+			config.Settings.CacheTTL = 300
+			config.Settings.SegmentCacheMaxMB = 8
+			config.Settings.SegmentPrefetchCount = 1
+			config.Settings.SegmentPrefetchOffset = 0
+
+			var segHits, prefetchHits atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/index.m3u8":
+					fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n")
+				case "/seg0.ts":
+					segHits.Add(1)
+					fmt.Fprint(w, "segment0")
+				case "/seg1.ts":
+					prefetchHits.Add(1)
+					fmt.Fprint(w, "segment1")
+				}
+			}))
+			defer server.Close()
+
+			p := NewProxyService()
+			if _, err := p.FetchM3u8(server.URL+"/index.m3u8", "/api/stream/segment", ""); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				content, _, err := p.FetchSegment(server.URL + "/seg0.ts")
+				if err != nil || string(content) != "segment0" {
+					t.Fatalf("获取分片失败: %q, %v", content, err)
+				}
+			}
+			if got := segHits.Load(); got != tt.wantSegHits {
+				t.Errorf("上游分片请求次数 = %d, want %d", got, tt.wantSegHits)
+			}
+
+			// 预取在后台进行，等待其完成
+			deadline := time.Now().Add(2 * time.Second)
+			for prefetchHits.Load() < tt.wantPrefetch && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if got := prefetchHits.Load(); got != tt.wantPrefetch {
+				t.Errorf("预取请求次数 = %d, want %d", got, tt.wantPrefetch)
+			}
+		})
+	}
+}
+
+func TestFetchM3u8FailsOverToNextMirror(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.CacheEnabled = false
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	var backupHits atomic.Int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits.Add(1)
+		switch r.URL.Path {
+		case "/hls/index.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXT-X-ENDLIST\n")
+		case "/hls/seg0.ts":
+			w.Write([]byte("segment"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backup.Close()
+
+	GetMirrorService()
+	savedMirrors := mirrorService
+	defer func() { mirrorService = savedMirrors }()
+	mirrorService = &MirrorService{bases: []string{down.URL, backup.URL}}
+
+	content, err := GetProxyService().FetchM3u8(down.URL+"/hls/index.m3u8", "/api/stream/segment", "")
+	if err != nil {
+		t.Fatalf("应切换到备用镜像: %v", err)
+	}
+	if !strings.Contains(content, "/api/stream/segment/") || mirrorService.Active() != backup.URL {
+		t.Fatalf("active = %s, 播放列表:\n%s", mirrorService.Active(), content)
+	}
+
+	// 分片地址仍指向故障镜像时改写到当前镜像；当前镜像再出错时切回另一个
+	mirrorService.Failover(backup.URL)
+	data, _, err := GetProxyService().FetchSegment(backup.URL + "/hls/seg0.ts")
+	if err != nil || string(data) != "segment" {
+		t.Fatalf("分片应从备用镜像获取: %q, %v", data, err)
+	}
+	if backupHits.Load() != 2 {
+		t.Fatalf("备用镜像请求次数 = %d, want 2", backupHits.Load())
+	}
+}
+
+func TestFetchThumbnailPermanentOnlyForMissing(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ThumbnailHostCheck = false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	v := NewVideoCacheService()
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusGone, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+	} {
+		_, _, err := v.fetchThumbnail("thumbstatus", fmt.Sprintf("%s/%d", server.URL, tc.status))
+		if err == nil || errors.Is(err, ErrThumbnailUnavailable) != tc.permanent {
+			t.Fatalf("status %d: err = %v, want permanent %v", tc.status, err, tc.permanent)
+		}
+	}
+}
+
+func TestIsAllowedHostDefaultsToScrapedHosts(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.ProxyAllowedHosts = nil
+	GetMirrorService()
+	savedMirrors := mirrorService
+	defer func() { mirrorService = savedMirrors }()
+	mirrorService = &MirrorService{bases: []string{"https://target.example.com"}}
+
+	p := NewProxyService()
+	if !p.IsAllowedHost("https://target.example.com/view_video.php") {
+		t.Fatal("目标网站应允许代理")
+	}
+	if p.IsAllowedHost("https://open-relay.invalid/a.m3u8") {
+		t.Fatal("未配置白名单时不应允许任意主机")
+	}
+
+	rememberDetailHosts(&models.VideoDetail{
+		M3u8URL:   "https://video-cdn.invalid/hls/index.m3u8",
+		Thumbnail: "https://img-cdn.invalid/a.jpg",
+	})
+	p.rewriteM3u8("#EXTM3U\n#EXTINF:10,\nhttps://seg-cdn.invalid/0.ts\n", "https://video-cdn.invalid/hls/index.m3u8", "", "")
+	for _, u := range []string{"https://video-cdn.invalid/x", "https://img-cdn.invalid/b.jpg", "https://seg-cdn.invalid/1.ts"} {
+		if !p.IsAllowedHost(u) {
+			t.Fatalf("抓取到的主机应允许代理: %s", u)
+		}
+	}
+
+	// 配置白名单后只按白名单判断
+	config.Settings.ProxyAllowedHosts = []string{"example.com"}
+	if p.IsAllowedHost("https://video-cdn.invalid/x") || !p.IsAllowedHost("https://cdn.example.com/x") {
+		t.Fatal("白名单判断不正确")
+	}
+}
+
+func TestStreamTypeFromContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		isMp4, ok   bool
+	}{
+		{"application/vnd.apple.mpegurl", false, true},
+		{"application/x-mpegURL; charset=utf-8", false, true},
+		{"video/MP2T", false, true},
+		{"video/mp4", true, true},
+		{"video/webm", true, true},
+		{"text/html", false, false},
+	}
+	for _, tc := range cases {
+		isMp4, ok := streamTypeFromContentType(tc.contentType)
+		if isMp4 != tc.isMp4 || ok != tc.ok {
+			t.Fatalf("streamTypeFromContentType(%q) = %v, %v, want %v, %v", tc.contentType, isMp4, ok, tc.isMp4, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errNonPublicAddress 连接的地址不是公网地址
+var errNonPublicAddress = errors.New("不允许连接内网地址")
+
+// isPublicIP IP是否为公网地址：内网、本机、链路本地、未指定等地址返回false
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+// dialAddressAllowed 建立连接前检查实际连接的地址（DNS解析之后的 IP:端口）
+var dialAddressAllowed = func(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && isPublicIP(ip)
+}
+
+// newPublicOnlyClient 只连接公网地址的HTTP客户端，用于代理外部传入的地址
+// 在建立连接时检查解析后的IP，重定向到的地址和DNS解析结果变化都无法绕过；每次重定向还会重新检查代理白名单
+func newPublicOnlyClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if !dialAddressAllowed(address) {
+				return fmt.Errorf("%w: %s", errNonPublicAddress, address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("重定向次数过多")
+			}
+			if !GetProxyService().IsAllowedHost(req.URL.String()) {
+				return fmt.Errorf("重定向到不允许代理的地址: %s", req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
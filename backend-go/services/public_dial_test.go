@@ -0,0 +1,103 @@
+package services
+
+import (
+	"backend-go/config"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.0.0.1":        false,
+		"172.16.5.4":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+	}
+	for addr, want := range cases {
+		if got := isPublicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestPublicOnlyClientRejectsLoopback(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	_, err := newPublicOnlyClient(0).Get(server.URL)
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("err = %v, want errNonPublicAddress", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("请求到达了内网地址")
+	}
+}
+
+// newRedirectPair 返回重定向到 target 的服务器，以及 target 被请求的次数
+func newRedirectPair(t *testing.T, location func(target *httptest.Server) string) (*httptest.Server, *httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(target.Close)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, location(target), http.StatusFound)
+	}))
+	t.Cleanup(origin.Close)
+	return origin, target, &hits
+}
+
+func TestPublicOnlyClientRejectsRedirectToInternal(t *testing.T) {
+	origin, target, hits := newRedirectPair(t, func(target *httptest.Server) string { return target.URL })
+
+	// 把 origin 视为公网地址，target 仍按实际的本机地址检查
+	originAddr := strings.TrimPrefix(origin.URL, "http://")
+	saved := dialAddressAllowed
+	dialAddressAllowed = func(address string) bool { return address == originAddr || saved(address) }
+	defer func() { dialAddressAllowed = saved }()
+
+	_, err := newPublicOnlyClient(0).Get(origin.URL)
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("err = %v, want errNonPublicAddress (target %s)", err, target.URL)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("重定向后请求到达了内网地址")
+	}
+}
+
+func TestPublicOnlyClientRejectsRedirectToDisallowedHost(t *testing.T) {
+	origin, _, hits := newRedirectPair(t, func(target *httptest.Server) string {
+		return strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	})
+
+	saved, savedHosts := dialAddressAllowed, config.Settings.ProxyAllowedHosts
+	dialAddressAllowed = func(string) bool { return true }
+	config.Settings.ProxyAllowedHosts = []string{"127.0.0.1"}
+	defer func() {
+		dialAddressAllowed = saved
+		config.Settings.ProxyAllowedHosts = savedHosts
+	}()
+
+	_, err := newPublicOnlyClient(0).Get(origin.URL)
+	if err == nil || !strings.Contains(err.Error(), "不允许代理") {
+		t.Fatalf("err = %v, want redirect rejected", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("重定向后请求到达了白名单外的地址")
+	}
+}
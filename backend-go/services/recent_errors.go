@@ -0,0 +1,48 @@
+package services
+
+import (
+	"backend-go/models"
+	"sync"
+	"time"
+)
+
+// recentErrorLimit 保留的最近错误条数
+const recentErrorLimit = 20
+
+// recentErrors 最近发生的抓取、下载和定时任务错误，超出上限时丢弃最早的
+var recentErrors = struct {
+	sync.Mutex
+	items []models.RecentError
+}{}
+
+// recordRecentError 记录一条错误，source 为 scrape、download 或 job，target 为相关的视频或任务名
+func recordRecentError(source, target string, err error) {
+	if err == nil {
+		return
+	}
+	item := models.RecentError{
+		Source:  source,
+		Target:  target,
+		Message: err.Error(),
+		Time:    time.Now().Format(time.RFC3339),
+	}
+
+	recentErrors.Lock()
+	recentErrors.items = append(recentErrors.items, item)
+	if len(recentErrors.items) > recentErrorLimit {
+		recentErrors.items = recentErrors.items[len(recentErrors.items)-recentErrorLimit:]
+	}
+	recentErrors.Unlock()
+}
+
+// RecentErrors 最近的错误，最新的在前
+func RecentErrors() []models.RecentError {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+
+	result := make([]models.RecentError, len(recentErrors.items))
+	for i, item := range recentErrors.items {
+		result[len(result)-1-i] = item
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"backend-go/models"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Scheduler 后台定时任务调度
+// 每个任务按固定间隔执行，上一次仍在运行时跳过本次，任务 panic 时记录为错误而不影响其他任务
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     []*scheduledJob
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// scheduledJob 定时任务及其运行记录（由 Scheduler.mu 保护）
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func() error
+
+	running      bool
+	runs         int
+	skipped      int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	nextRun      time.Time
+}
+
+// NewScheduler 创建调度器实例
+func NewScheduler() *Scheduler {
+	return &Scheduler{stopChan: make(chan struct{})}
+}
+
+// Register 注册定时任务，首次在一个间隔后执行；interval<=0 时不注册
+func (s *Scheduler) Register(name string, interval time.Duration, run func() error) {
+	if interval <= 0 {
+		return
+	}
+
+	job := &scheduledJob{
+		name:     name,
+		interval: interval,
+		run:      run,
+		nextRun:  time.Now().Add(interval),
+	}
+	s.mu.Lock()
+	s.jobs = append(s.jobs, job)
+	s.mu.Unlock()
+	log.Printf("[Scheduler] 已注册任务 %s，间隔 %s", name, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.trigger(job)
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// trigger 执行一次任务，上一次仍在运行时跳过
+func (s *Scheduler) trigger(job *scheduledJob) {
+	s.mu.Lock()
+	job.nextRun = time.Now().Add(job.interval)
+	if job.running {
+		job.skipped++
+		s.mu.Unlock()
+		log.Printf("[Scheduler] 任务 %s 上一次仍在运行，跳过本次", job.name)
+		return
+	}
+	job.running = true
+	s.mu.Unlock()
+
+	go func() {
+		start := time.Now()
+		err := runJob(job)
+
+		s.mu.Lock()
+		job.running = false
+		job.runs++
+		job.lastRun = start
+		job.lastDuration = time.Since(start)
+		job.lastError = ""
+		if err != nil {
+			job.lastError = err.Error()
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			log.Printf("[Scheduler] 任务 %s 执行失败: %v", job.name, err)
+			recordRecentError("job", job.name, err)
+		}
+	}()
+}
+
+// runJob 执行任务函数，panic 转换为错误
+func runJob(job *scheduledJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Scheduler] 任务 %s panic: %v\n%s", job.name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.run()
+}
+
+// Jobs 列出所有任务的运行状态，按注册顺序
+func (s *Scheduler) Jobs() []models.JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]models.JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := models.JobStatus{
+			Name:         job.name,
+			Interval:     int(job.interval.Seconds()),
+			Running:      job.running,
+			Runs:         job.runs,
+			Skipped:      job.skipped,
+			LastDuration: job.lastDuration.Milliseconds(),
+			LastError:    job.lastError,
+			NextRun:      job.nextRun.Format(time.RFC3339),
+		}
+		if !job.lastRun.IsZero() {
+			status.LastRun = job.lastRun.Format(time.RFC3339)
+		}
+		jobs = append(jobs, status)
+	}
+	return jobs
+}
+
+// Stop 停止调度，正在运行的任务不会被中断
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+}
+
+// 全局单例
+var scheduler *Scheduler
+var schedulerOnce sync.Once
+
+// GetScheduler 获取全局调度器实例
+func GetScheduler() *Scheduler {
+	schedulerOnce.Do(func() {
+		scheduler = NewScheduler()
+	})
+	return scheduler
+}
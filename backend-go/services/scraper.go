@@ -3,7 +3,9 @@ package services
 import (
 	"backend-go/config"
 	"backend-go/models"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -12,15 +14,22 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
 	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
 	"github.com/go-rod/rod/lib/proto"
 )
 
 var (
 	cookiesFile = "cookies.json"
+
+	// ErrScraperBusy 有抓取任务进行中
+	ErrScraperBusy = errors.New("有抓取任务正在进行，请稍后重试")
 )
 
 // VideoListResult 视频列表结果
@@ -29,20 +38,126 @@ type VideoListResult struct {
 	TotalPages int
 }
 
+// ListProfile 列表页布局提取配置
+type ListProfile struct {
+	Name      string `json:"name"`
+	Column    string `json:"column"`
+	Card      string `json:"card"`
+	Link      string `json:"link"`
+	Thumbnail string `json:"thumbnail"`
+	Title     string `json:"title"`
+	Duration  string `json:"duration"`
+}
+
+// listProfileOrder 布局配置的回退顺序
+var listProfileOrder = []string{"basic", "grid", "mobile"}
+
+// getListProfiles 获取所有布局配置
+func getListProfiles() map[string]ListProfile {
+	selectors := config.Settings.Selectors
+	return map[string]ListProfile{
+		// viewtype=basic 的 Bootstrap 栅格布局
+		"basic": {
+			Name:      "basic",
+			Column:    ".col-xs-12.col-sm-4.col-md-3.col-lg-3",
+			Card:      ".well.well-sm.videos-text-align",
+			Link:      `a[href*="viewkey"]`,
+			Thumbnail: ".thumb-overlay img, img.img-responsive",
+			Title:     ".video-title",
+			Duration:  ".duration",
+		},
+		// 其他 viewtype 的频道列表布局
+		"grid": {
+			Name:      "grid",
+			Column:    selectors["video_item"],
+			Link:      `a[href*="viewkey"]`,
+			Thumbnail: selectors["video_thumbnail"],
+			Title:     selectors["video_title"],
+			Duration:  selectors["video_duration"],
+		},
+		// 移动端布局
+		"mobile": {
+			Name:      "mobile",
+			Column:    ".video-list li, .videos-list .video-item",
+			Link:      `a[href*="viewkey"]`,
+			Thumbnail: "img",
+			Title:     ".title, .video-title",
+			Duration:  ".duration, .time",
+		},
+	}
+}
+
+// ValidListProfile 检查请求指定的布局配置名称，空表示自动选择
+func ValidListProfile(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := getListProfiles()[name]
+	return ok
+}
+
+// resolveListProfile 根据名称或列表URL中的viewtype选择布局配置
+func resolveListProfile(name, listURL string) ListProfile {
+	profiles := getListProfiles()
+
+	if name == "" {
+		name = config.Settings.ListExtractProfile
+	}
+	if profile, ok := profiles[name]; ok {
+		return profile
+	}
+
+	if parsed, err := url.Parse(listURL); err == nil {
+		if parsed.Query().Get("viewtype") == "basic" {
+			return profiles["basic"]
+		}
+		return profiles["grid"]
+	}
+	return profiles["basic"]
+}
+
 // ScraperService Rod 解析服务
+//
+// 并发模型：
+//   - mu 只保护 browser/page/listPage 字段，仅在获取或重建页面时短暂持有，不能在导航期间持有
+//   - 列表抓取使用独立的 listPage，由 listMu 串行化（同一页面不能并发导航），不阻塞详情获取
+//   - 主页面 page 的导航由 pageMu 串行化：GetVideoDetail 和关闭 LIST_DEDICATED_PAGE 时的列表抓取共用主页面
+//   - 详情获取和预缓存使用各自新建的标签页（openTab），互不阻塞
+//   - 抓取期间计入 activeScrapes（由 mu 保护），空闲关闭浏览器时跳过有抓取进行中的情况
 type ScraperService struct {
 	browser        *rod.Browser
 	page           *rod.Page
+	listPage       *rod.Page
 	mu             sync.Mutex
+	listMu         sync.Mutex
+	pageMu         sync.Mutex
 	currentPageNum int
-	pendingReqs    int
+	// 进行中的详情获取数，超过 MAX_PENDING_DETAIL_REQUESTS 时拒绝新的请求
+	pendingReqs atomic.Int32
+	// 释放Chrome用户数据目录锁（auto模式且配置了 CHROME_USER_DATA_DIR 时）
+	releaseProfile func()
+	// 连续抓取失败时熔断
+	breaker *CircuitBreaker
+	// 最近一次抓取的时间和进行中的抓取数，用于空闲时关闭浏览器
+	lastScrapeTime time.Time
+	activeScrapes  int
+	// 断开与外部Chrome的连接（CDP模式）
+	disconnect func()
+	// 最近一次成功抓取和最近一次遇到验证页面的时间（UnixNano）
+	lastScrapeOK  atomic.Int64
+	lastChallenge atomic.Int64
+	// 最近一次浏览器初始化失败的原因，成功后清空；是否至少初始化成功过一次
+	initError   atomic.Value
+	initialized atomic.Bool
+	// 当前使用的cookies配置名，未切换过时使用 COOKIE_PROFILE
+	cookieProfile atomic.Value
 }
 
 // NewScraperService 创建解析服务实例
 func NewScraperService() *ScraperService {
 	return &ScraperService{
 		currentPageNum: 0,
-		pendingReqs:    0,
+		breaker:        NewCircuitBreaker(),
 	}
 }
 
@@ -53,8 +168,8 @@ func (s *ScraperService) Initialize() error {
 	return s.initializeInternal()
 }
 
-// initializeInternal 内部初始化方法（不加锁）
-func (s *ScraperService) initializeInternal() error {
+// launchBrowserLocked 启动或连接浏览器（调用方需持有 mu）
+func (s *ScraperService) launchBrowserLocked() error {
 	if s.browser != nil {
 		return nil
 	}
@@ -65,13 +180,14 @@ func (s *ScraperService) initializeInternal() error {
 		// CDP模式：连接到已运行的Chrome
 		log.Printf("尝试连接到已运行的Chrome (%s)...", cfg.CdpURL)
 
-		browser := rod.New().ControlURL(cfg.CdpURL)
-		if err := browser.Connect(); err != nil {
+		browser, disconnect, err := connectCDP(cfg.CdpURL)
+		if err != nil {
 			log.Printf("连接Chrome失败: %v", err)
 			log.Println("请先运行: google-chrome --remote-debugging-port=9222")
 			return fmt.Errorf("CDP连接失败: %v", err)
 		}
 		s.browser = browser
+		s.disconnect = disconnect
 
 		// 获取已有的页面或创建新页面
 		pages, err := browser.Pages()
@@ -94,12 +210,39 @@ func (s *ScraperService) initializeInternal() error {
 		// Auto模式：自动启动浏览器
 		log.Printf("启动浏览器 (headless=%v)...", cfg.Headless)
 
-		l := launcher.New().
-			Headless(cfg.Headless).
-			Set("disable-features", "TranslateUI").
-			Set("disable-background-networking", "").
-			Set("disable-dev-shm-usage", "").
-			Set("no-sandbox", "")
+		l := launcher.New().Headless(cfg.Headless)
+
+		// 启动参数：默认值与 CHROME_FLAGS 合并
+		launchFlags, removed := parseChromeFlags(cfg.ChromeFlags)
+		for name, value := range launchFlags {
+			if value == "" {
+				l = l.Set(flags.Flag(name))
+			} else {
+				l = l.Set(flags.Flag(name), value)
+			}
+		}
+		for _, name := range removed {
+			l = l.Delete(flags.Flag(name))
+		}
+
+		if cfg.ChromePath != "" {
+			l = l.Bin(cfg.ChromePath)
+			log.Printf("使用Chrome: %s", cfg.ChromePath)
+		}
+		if cfg.ChromeUserDataDir != "" {
+			// 持久化的用户数据目录只允许一个实例使用
+			release, err := acquireProfileLock(cfg.ChromeUserDataDir)
+			if err != nil {
+				return err
+			}
+			if err := clearStaleChromeSingleton(cfg.ChromeUserDataDir); err != nil {
+				release()
+				return err
+			}
+			s.releaseProfile = release
+			l = l.UserDataDir(cfg.ChromeUserDataDir)
+			log.Printf("使用用户数据目录: %s", cfg.ChromeUserDataDir)
+		}
 
 		if cfg.BrowserProxy != "" {
 			l = l.Proxy(cfg.BrowserProxy)
@@ -108,20 +251,30 @@ func (s *ScraperService) initializeInternal() error {
 
 		controlURL, err := l.Launch()
 		if err != nil {
+			s.releaseProfileLock()
+			if isProfileInUseError(err) {
+				return fmt.Errorf("启动浏览器失败: 用户数据目录 %s 被其他Chrome实例占用，请关闭该实例或更换 CHROME_USER_DATA_DIR", cfg.ChromeUserDataDir)
+			}
 			return fmt.Errorf("启动浏览器失败: %v", err)
 		}
 
 		browser := rod.New().ControlURL(controlURL)
 		if err := browser.Connect(); err != nil {
+			// 已启动的Chrome不会再被使用，结束进程并释放用户数据目录，避免下次启动时目录被占用
+			l.Kill()
+			s.releaseProfileLock()
 			return fmt.Errorf("连接浏览器失败: %v", err)
 		}
-		s.browser = browser
 
 		// 创建页面
 		page, err := browser.Page(proto.TargetCreateTarget{URL: ""})
 		if err != nil {
+			browser.Close()
+			l.Kill()
+			s.releaseProfileLock()
 			return fmt.Errorf("创建页面失败: %v", err)
 		}
+		s.browser = browser
 		s.page = page
 
 		log.Println("浏览器启动成功!")
@@ -133,27 +286,114 @@ func (s *ScraperService) initializeInternal() error {
 	})
 
 	// 添加语言cookie
-	s.page.SetCookies([]*proto.NetworkCookieParam{{
-		Name:   "language",
-		Value:  "cn_CN",
-		Domain: ".91porn.com",
-		Path:   "/",
-	}})
+	if cookies := localeBrowserCookies(); len(cookies) > 0 {
+		s.page.SetCookies(cookies)
+	}
 
 	// 注入反检测脚本
 	s.injectStealth()
 
+	// 刚启动的浏览器从现在开始计算空闲时间
+	s.lastScrapeTime = time.Now()
+
 	return nil
 }
 
+// connectCDP 连接到已运行的Chrome，返回的 disconnect 只断开连接，不会关闭Chrome
+func connectCDP(controlURL string) (*rod.Browser, func(), error) {
+	ws := &cdp.WebSocket{}
+	if err := ws.Connect(context.Background(), controlURL, nil); err != nil {
+		return nil, nil, err
+	}
+	browser := rod.New().Client(cdp.New().Start(ws))
+	if err := browser.Connect(); err != nil {
+		ws.Close()
+		return nil, nil, err
+	}
+	return browser, func() { ws.Close() }, nil
+}
+
+// defaultChromeFlags 默认的Chrome启动参数
+var defaultChromeFlags = map[string]string{
+	"disable-features":              "TranslateUI",
+	"disable-background-networking": "",
+	"disable-dev-shm-usage":         "",
+	"no-sandbox":                    "",
+}
+
+// parseChromeFlags 将空白分隔的 key=value 启动参数合并到默认值上，
+// 参数值可以包含逗号（如 disable-features=A,B），含空白的值用引号包起来；以 "!" 开头的参数名表示移除该默认参数
+func parseChromeFlags(spec string) (map[string]string, []string) {
+	result := make(map[string]string, len(defaultChromeFlags))
+	for name, value := range defaultChromeFlags {
+		result[name] = value
+	}
+
+	var removed []string
+	for _, item := range splitChromeFlags(spec) {
+		item = strings.TrimLeft(item, "-")
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "!") {
+			name := strings.TrimLeft(item[1:], "-")
+			delete(result, name)
+			removed = append(removed, name)
+			continue
+		}
+		name, value, _ := strings.Cut(item, "=")
+		result[name] = value
+	}
+	return result, removed
+}
+
+// splitChromeFlags 按空白拆分启动参数，单引号或双引号内的空白不拆分，引号本身会被去掉
+func splitChromeFlags(spec string) []string {
+	var items []string
+	var current strings.Builder
+	var quote rune
+	inItem := false
+	for _, r := range spec {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inItem = true
+		case unicode.IsSpace(r):
+			if inItem {
+				items = append(items, current.String())
+				current.Reset()
+				inItem = false
+			}
+		default:
+			current.WriteRune(r)
+			inItem = true
+		}
+	}
+	if inItem {
+		items = append(items, current.String())
+	}
+	return items
+}
+
 // injectStealth 注入反检测脚本到主页面
 func (s *ScraperService) injectStealth() {
 	s.injectStealthToPage(s.page)
 }
 
 // injectStealthToPage 注入反检测脚本到指定页面
+// 同时为页面的请求设置 ACCEPT_LANGUAGE，navigator.languages 与之保持一致
 func (s *ScraperService) injectStealthToPage(page *rod.Page) {
-	script := `() => {
+	if lang := AcceptLanguage(); lang != "" {
+		page.SetExtraHeaders([]string{"Accept-Language", lang})
+	}
+
+	script := `(languages) => {
 		// 1. 隐藏 webdriver 标志
 		Object.defineProperty(navigator, 'webdriver', { get: () => undefined });
 		delete navigator.__proto__.webdriver;
@@ -210,8 +450,10 @@ func (s *ScraperService) injectStealthToPage(page *rod.Page) {
 		Object.defineProperty(navigator, 'mimeTypes', { get: makeMimeTypeArray });
 
 		// 4. 语言设置
-		Object.defineProperty(navigator, 'languages', { get: () => ['zh-CN', 'zh', 'en-US', 'en'] });
-		Object.defineProperty(navigator, 'language', { get: () => 'zh-CN' });
+		if (languages.length > 0) {
+			Object.defineProperty(navigator, 'languages', { get: () => languages });
+			Object.defineProperty(navigator, 'language', { get: () => languages[0] });
+		}
 
 		// 5. 硬件并发数（不要太假）
 		Object.defineProperty(navigator, 'hardwareConcurrency', { get: () => 8 });
@@ -374,14 +616,62 @@ func (s *ScraperService) injectStealthToPage(page *rod.Page) {
 
 		console.log('[Stealth] Anti-detection script injected');
 	}`
-	page.Eval(script)
+	page.Eval(script, navigatorLanguages())
 }
 
 // Close 关闭浏览器
 func (s *ScraperService) Close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+// Restart 关闭当前浏览器会话并重新初始化
+// 最多等待 wait 时长让进行中的列表抓取结束，超时返回 ErrScraperBusy；
+// 正在新标签页中获取的详情会因浏览器关闭而失败
+func (s *ScraperService) Restart(wait time.Duration) error {
+	if !s.lockList(wait) {
+		return ErrScraperBusy
+	}
+	defer s.listMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Println("[Scraper] 正在重启浏览器会话...")
+	s.closeLocked()
+	s.currentPageNum = 0
+
+	if err := s.initializeInternal(); err != nil {
+		return fmt.Errorf("重新初始化浏览器失败: %w", err)
+	}
+	log.Println("[Scraper] 浏览器会话已重启")
+	return nil
+}
 
+// lockList 在 wait 时长内尝试获取列表锁，wait<=0 时一直等待
+func (s *ScraperService) lockList(wait time.Duration) bool {
+	if wait <= 0 {
+		s.listMu.Lock()
+		return true
+	}
+
+	deadline := time.Now().Add(wait)
+	for !s.listMu.TryLock() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// closeLocked 关闭页面和浏览器（调用方需持有 mu）
+func (s *ScraperService) closeLocked() {
+	if s.listPage != nil {
+		s.listPage.Close()
+		s.listPage = nil
+	}
 	if s.page != nil {
 		s.page.Close()
 		s.page = nil
@@ -390,42 +680,111 @@ func (s *ScraperService) Close() {
 		s.browser.Close()
 		s.browser = nil
 	}
+	s.disconnectLocked()
+	s.releaseProfileLock()
+}
+
+// disconnectLocked 关闭与外部Chrome的连接（调用方需持有 mu）
+func (s *ScraperService) disconnectLocked() {
+	if s.disconnect != nil {
+		s.disconnect()
+		s.disconnect = nil
+	}
+}
+
+// releaseProfileLock 释放用户数据目录锁（调用方需持有 mu）
+func (s *ScraperService) releaseProfileLock() {
+	if s.releaseProfile != nil {
+		s.releaseProfile()
+		s.releaseProfile = nil
+	}
+}
+
+// resetBrowserLocked 连接断开后丢弃浏览器和页面引用（调用方需持有 mu）
+func (s *ScraperService) resetBrowserLocked() {
+	s.page = nil
+	s.listPage = nil
+	s.browser = nil
+	s.disconnectLocked()
 }
 
-// LoadCookies 从文件加载cookies
+// LoadCookies 从当前cookies配置的文件加载cookies
 func (s *ScraperService) LoadCookies() []*proto.NetworkCookieParam {
-	data, err := os.ReadFile(cookiesFile)
+	return loadCookiesFile(cookieProfilePath(s.ActiveCookieProfile()))
+}
+
+// loadCookiesFile 从文件加载cookies，文件已加密时使用 COOKIE_SECRET 解密
+// 配置了 COOKIE_SECRET 但文件仍是明文时，读取后加密保存
+func loadCookiesFile(path string) []*proto.NetworkCookieParam {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil
 	}
 
+	secret := cookieSecret()
+	encrypted := isEncryptedCookies(data)
+	if encrypted {
+		if data, err = decryptCookies(data, secret); err != nil {
+			log.Printf("读取cookies失败: %v", err)
+			return nil
+		}
+	}
+
 	var cookies []*proto.NetworkCookieParam
 	if err := json.Unmarshal(data, &cookies); err != nil {
 		return nil
 	}
+
+	if !encrypted && secret != "" {
+		if err := writeCookiesFile(path, data); err != nil {
+			log.Printf("加密cookies文件失败: %v", err)
+		} else {
+			log.Println("已将明文cookies文件加密保存")
+		}
+	}
 	return cookies
 }
 
-// SaveCookies 保存cookies到文件
+// SaveCookies 保存cookies到当前cookies配置的文件
 func (s *ScraperService) SaveCookies(cookies []*proto.NetworkCookie) {
 	data, err := json.MarshalIndent(cookies, "", "  ")
 	if err != nil {
 		return
 	}
-	os.WriteFile(cookiesFile, data, 0644)
+	if err := writeCookiesFile(cookieProfilePath(s.ActiveCookieProfile()), data); err != nil {
+		log.Printf("保存cookies失败: %v", err)
+	}
+}
+
+// writeCookiesFile 写入cookies文件，配置了 COOKIE_SECRET 时加密并只允许所有者读写
+func writeCookiesFile(path string, data []byte) error {
+	secret := cookieSecret()
+	if secret == "" {
+		return os.WriteFile(path, data, 0644)
+	}
+
+	encrypted, err := encryptCookies(data, secret)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		return err
+	}
+	// WriteFile 不修改已有文件的权限
+	return os.Chmod(path, 0600)
 }
 
 // saveBrowserCookies 保存当前浏览器的cookies
-func (s *ScraperService) saveBrowserCookies() {
-	if s.page != nil {
-		cookies, err := s.page.Cookies(nil)
+func (s *ScraperService) saveBrowserCookies(page *rod.Page) {
+	if page != nil {
+		cookies, err := page.Cookies(nil)
 		if err != nil {
 			return
 		}
 		// 只保存91porn相关的cookies
 		var filtered []*proto.NetworkCookie
 		for _, c := range cookies {
-			if strings.Contains(c.Domain, "91porn") {
+			if isSiteCookie(c.Domain) {
 				filtered = append(filtered, c)
 			}
 		}
@@ -436,6 +795,64 @@ func (s *ScraperService) saveBrowserCookies() {
 	}
 }
 
+// BreakerRetryAfter 熔断剩余秒数，未熔断时返回0
+func (s *ScraperService) BreakerRetryAfter() int {
+	return s.breaker.RetryAfter()
+}
+
+// Status 获取浏览器和熔断器状态
+func (s *ScraperService) Status() models.ScraperStatusResponse {
+	s.mu.Lock()
+	ready := s.browser != nil
+	s.mu.Unlock()
+
+	return models.ScraperStatusResponse{
+		BrowserReady: ready,
+		ActiveMirror: TargetBaseURL(),
+		Breaker:      s.breaker.Status(),
+	}
+}
+
+// recordScrape 记录一次抓取的结果：更新熔断器和计数，成功且期间未遇到验证页面时记录成功时间
+func (s *ScraperService) recordScrape(err error, started time.Time) {
+	s.breaker.record(err)
+	GetMetrics().recordScrape(err)
+	if err == nil && s.lastChallenge.Load() < started.UnixNano() {
+		s.lastScrapeOK.Store(time.Now().UnixNano())
+	}
+}
+
+// markChallenge 记录遇到验证页面
+func (s *ScraperService) markChallenge() {
+	s.lastChallenge.Store(time.Now().UnixNano())
+	GetMetrics().cloudflareBlocked()
+}
+
+// Availability 根据浏览器、熔断器和维护模式判断当前能否实时抓取，不实际访问站点
+// 浏览器未运行但启用了 BROWSER_IDLE_TIMEOUT 且上次初始化未失败时视为可用（下次抓取时自动启动）
+func (s *ScraperService) Availability() models.ScrapeAvailability {
+	cfg := config.Settings
+	status := s.Status()
+	maintenance := GetMaintenance().Enabled()
+
+	result := models.ScrapeAvailability{
+		BrowserMode:  cfg.BrowserMode,
+		BrowserReady: status.BrowserReady,
+		BrowserError: s.InitError(),
+		CircuitState: status.Breaker.State,
+		Maintenance:  maintenance,
+	}
+	lastOK, lastChallenge := s.lastScrapeOK.Load(), s.lastChallenge.Load()
+	if lastOK > 0 {
+		result.LastScrapeOKAt = time.Unix(0, lastOK).Format(time.RFC3339)
+	}
+	result.CloudflareBlocked = lastChallenge > lastOK
+	result.ScrapeAvailable = !maintenance &&
+		status.Breaker.RetryAfter == 0 &&
+		(status.BrowserReady || (cfg.BrowserIdleTimeout > 0 && result.BrowserError == ""))
+	return result
+}
+
 // GetPage 获取页面
 func (s *ScraperService) GetPage() (*rod.Page, error) {
 	s.mu.Lock()
@@ -449,103 +866,252 @@ func (s *ScraperService) GetPage() (*rod.Page, error) {
 	return s.page, nil
 }
 
-// GetVideoList 获取视频列表
-func (s *ScraperService) GetVideoList(pageNum int) (*VideoListResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// GetVideoList 获取视频列表，profileName 为空时根据列表URL自动选择布局配置
+func (s *ScraperService) GetVideoList(pageNum int, profileName string) (*VideoListResult, error) {
+	return s.GetVideoListFromPath(pageNum, profileName, config.Settings.VideoListPath)
+}
 
-	if s.page == nil {
-		if err := s.initializeInternal(); err != nil {
-			return nil, err
-		}
+// GetVideoListFromPath 按指定列表路径（如其他分类）获取视频列表
+// 等待其他列表抓取超过 LIST_LOCK_TIMEOUT 时返回 ErrScraperBusy，避免请求无限排队；熔断期间返回 ErrCircuitOpen，维护模式下返回 ErrMaintenance
+func (s *ScraperService) GetVideoListFromPath(pageNum int, profileName, listPath string) (*VideoListResult, error) {
+	if GetMaintenance().Enabled() {
+		return nil, ErrMaintenance
+	}
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
 	}
-	page := s.page
+	s.beginScrape()
+	defer s.endScrape()
+	started := time.Now()
+	result, err := s.getVideoListFromPath(pageNum, profileName, listPath)
+	s.recordScrape(err, started)
+	return result, err
+}
 
-	cfg := config.Settings
-	listURL := fmt.Sprintf("%s%s&page=%d", cfg.TargetBaseURL, cfg.VideoListPath, pageNum)
-	log.Printf("正在访问第%d页: %s", pageNum, listURL)
+// getVideoListFromPath 抓取列表页
+func (s *ScraperService) getVideoListFromPath(pageNum int, profileName, listPath string) (*VideoListResult, error) {
+	if !s.lockList(time.Duration(config.Settings.ListLockTimeout) * time.Second) {
+		log.Printf("等待列表抓取超时，跳过第%d页", pageNum)
+		return nil, ErrScraperBusy
+	}
+	defer s.listMu.Unlock()
 
-	// 导航到页面
-	err := page.Navigate(listURL)
+	// 未启用独立页面时与详情获取共用主页面，抓取期间持有 pageMu
+	if !config.Settings.ListDedicatedPage {
+		s.pageMu.Lock()
+		defer s.pageMu.Unlock()
+	}
+
+	page, err := s.acquireListPage()
 	if err != nil {
-		// 检测连接断开，尝试重新初始化
-		if strings.Contains(err.Error(), "closed") || strings.Contains(err.Error(), "connection") {
-			log.Println("检测到浏览器连接断开，尝试重新连接...")
-			s.page = nil
-			s.browser = nil
-			if initErr := s.initializeInternal(); initErr != nil {
-				return nil, fmt.Errorf("重新连接失败: %v", initErr)
-			}
-			page = s.page
-			// 重试导航
-			if err = page.Navigate(listURL); err != nil {
-				return nil, fmt.Errorf("导航失败: %v", err)
+		return nil, err
+	}
+
+	mirrors := GetMirrorService()
+	var listURL, title string
+
+	// 依次尝试各镜像，遇到连接失败或验证拦截时切换到下一个
+	for attempt := 0; attempt < mirrors.Count(); attempt++ {
+		base := mirrors.Active()
+		hasNext := attempt < mirrors.Count()-1
+		listURL = fmt.Sprintf("%s%s&page=%d", base, listPath, pageNum)
+		log.Printf("正在访问第%d页: %s", pageNum, listURL)
+
+		var err error
+		page, err = s.navigateListPage(page, listURL)
+		if err != nil {
+			if hasNext {
+				mirrors.Failover(base)
+				continue
 			}
-		} else {
-			return nil, fmt.Errorf("导航失败: %v", err)
+			return nil, err
 		}
-	}
 
-	// 等待页面加载
-	if err := page.WaitLoad(); err != nil {
-		log.Printf("等待页面加载失败: %v", err)
-	}
-	log.Println("等待页面加载...如果看到验证页面请手动完成")
-	time.Sleep(5 * time.Second)
+		// 等待页面加载
+		if err := page.WaitLoad(); err != nil {
+			log.Printf("等待页面加载失败: %v", err)
+		}
+		log.Println("等待页面加载...如果看到验证页面请手动完成")
+		time.Sleep(5 * time.Second)
+
+		// 检查是否遇到Cloudflare验证
+		for i := 0; i < 30; i++ {
+			info, err := page.Info()
+			if err != nil {
+				break
+			}
+			if isChallengeTitle(info.Title) {
+				log.Printf("检测到验证页面，等待用户完成验证... (%d/30)", i+1)
+				time.Sleep(1 * time.Second)
+			} else {
+				break
+			}
+		}
 
-	// 检查是否遇到Cloudflare验证
-	for i := 0; i < 30; i++ {
+		// 获取页面标题
 		info, err := page.Info()
 		if err != nil {
-			break
-		}
-		title := info.Title
-		titleLower := strings.ToLower(title)
-		if strings.Contains(titleLower, "cloudflare") ||
-			strings.Contains(titleLower, "just a moment") ||
-			strings.Contains(titleLower, "blocked") {
-			log.Printf("检测到验证页面，等待用户完成验证... (%d/30)", i+1)
-			time.Sleep(1 * time.Second)
-		} else {
-			break
+			return nil, fmt.Errorf("获取页面信息失败: %v", err)
 		}
+		title = info.Title
+
+		if isChallengeTitle(title) && hasNext {
+			log.Printf("镜像 %s 被验证页面拦截", base)
+			s.markChallenge()
+			mirrors.Failover(base)
+			continue
+		}
+		break
 	}
 
 	s.currentPageNum = pageNum
 
 	// 保存当前cookies
-	s.saveBrowserCookies()
+	s.saveBrowserCookies(page)
 
-	// 获取页面标题
-	info, err := page.Info()
-	if err != nil {
-		return nil, fmt.Errorf("获取页面信息失败: %v", err)
-	}
-	title := info.Title
 	log.Printf("页面标题: %s", title)
 
 	if strings.Contains(strings.ToLower(title), "cloudflare") ||
 		strings.Contains(strings.ToLower(title), "just a moment") {
 		log.Println("警告: 遇到Cloudflare验证页面，请在设置中更新cookies")
+		s.markChallenge()
 		s.currentPageNum = 0
 		return &VideoListResult{Videos: []models.VideoItem{}, TotalPages: 1}, nil
 	}
 
+	recordFixture("list", listURL, page)
+
 	// 获取总页数
 	totalPages := s.getTotalPages(page)
 	log.Printf("总页数: %d", totalPages)
 
-	// 使用JavaScript提取视频列表
-	result, err := page.Eval(`() => {
+	profile := resolveListProfile(profileName, listURL)
+	videos, err := s.extractListWithFallback(page, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// 列表可能还没渲染完，不是验证页面时稍等后重新提取一次
+	if delay := config.Settings.ListEmptyRetryDelayMs; len(videos) == 0 && delay > 0 {
+		log.Printf("第%d页未提取到视频，%dms 后重试一次", pageNum, delay)
+		time.Sleep(time.Duration(delay) * time.Millisecond)
+		if info, err := page.Info(); err == nil && isChallengeTitle(info.Title) {
+			log.Printf("重试前检测到验证页面: %s", info.Title)
+			s.markChallenge()
+		} else if videos, err = s.extractListWithFallback(page, profile); err != nil {
+			return nil, err
+		} else if len(videos) > 0 {
+			log.Printf("重试后提取到 %d 个视频", len(videos))
+		}
+	}
+
+	return &VideoListResult{
+		Videos:     videos,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// extractListWithFallback 按布局配置提取视频列表，未提取到视频时依次尝试其他配置
+func (s *ScraperService) extractListWithFallback(page *rod.Page, profile ListProfile) ([]models.VideoItem, error) {
+	videos, err := s.extractVideoList(page, profile)
+	if err != nil {
+		return nil, err
+	}
+	if len(videos) > 0 {
+		return videos, nil
+	}
+	for _, name := range listProfileOrder {
+		if name == profile.Name {
+			continue
+		}
+		fallback := getListProfiles()[name]
+		fallbackVideos, err := s.extractVideoList(page, fallback)
+		if err == nil && len(fallbackVideos) > 0 {
+			log.Printf("布局配置 %s 未提取到视频，改用 %s", profile.Name, name)
+			return fallbackVideos, nil
+		}
+	}
+	return videos, nil
+}
+
+// acquireListPage 获取列表抓取使用的页面，只在获取期间持有 mu
+func (s *ScraperService) acquireListPage() (*rod.Page, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.browser == nil {
+		if err := s.initializeInternal(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 未启用独立页面时沿用主页面
+	if !config.Settings.ListDedicatedPage {
+		return s.page, nil
+	}
+
+	if s.listPage == nil {
+		page, err := s.browser.Page(proto.TargetCreateTarget{URL: ""})
+		if err != nil {
+			return nil, fmt.Errorf("创建列表页面失败: %v", err)
+		}
+		page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+			UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36",
+		})
+		s.injectStealthToPage(page)
+		s.listPage = page
+	}
+	return s.listPage, nil
+}
+
+// navigateListPage 列表页导航，浏览器连接断开时自动重连（调用方需持有 listMu）
+func (s *ScraperService) navigateListPage(page *rod.Page, targetURL string) (*rod.Page, error) {
+	err := page.Navigate(targetURL)
+	if err == nil {
+		return page, nil
+	}
+
+	// 检测连接断开，尝试重新初始化
+	if strings.Contains(err.Error(), "closed") || strings.Contains(err.Error(), "connection") {
+		log.Println("检测到浏览器连接断开，尝试重新连接...")
+		s.mu.Lock()
+		s.resetBrowserLocked()
+		s.mu.Unlock()
+
+		newPage, initErr := s.acquireListPage()
+		if initErr != nil {
+			return page, fmt.Errorf("重新连接失败: %w", initErr)
+		}
+		page = newPage
+		// 重试导航
+		if err = page.Navigate(targetURL); err != nil {
+			return page, fmt.Errorf("导航失败: %v", err)
+		}
+		return page, nil
+	}
+	return page, fmt.Errorf("导航失败: %v", err)
+}
+
+// isChallengeTitle 判断页面标题是否为验证/拦截页面
+func isChallengeTitle(title string) bool {
+	titleLower := strings.ToLower(title)
+	return strings.Contains(titleLower, "cloudflare") ||
+		strings.Contains(titleLower, "just a moment") ||
+		strings.Contains(titleLower, "blocked")
+}
+
+// extractVideoList 使用指定布局配置提取视频列表
+func (s *ScraperService) extractVideoList(page *rod.Page, profile ListProfile) ([]models.VideoItem, error) {
+	result, err := page.Eval(`(p) => {
 		const videos = [];
 		const seen = new Set();
-		const columns = document.querySelectorAll('.col-xs-12.col-sm-4.col-md-3.col-lg-3');
+		const columns = document.querySelectorAll(p.column);
 
 		for (const col of columns) {
-			const card = col.querySelector('.well.well-sm.videos-text-align');
+			const card = p.card ? col.querySelector(p.card) : col;
 			if (!card) continue;
 
-			const link = card.querySelector('a[href*="viewkey"]');
+			const link = card.querySelector(p.link);
 			if (!link) continue;
 
 			const href = link.href;
@@ -555,13 +1121,13 @@ func (s *ScraperService) GetVideoList(pageNum int) (*VideoListResult, error) {
 			const videoId = match[1];
 			if (seen.has(videoId)) continue;
 
-			const img = card.querySelector('.thumb-overlay img, img.img-responsive');
-			let thumbnail = img ? img.src : null;
+			const img = card.querySelector(p.thumbnail);
+			let thumbnail = img ? (img.src || img.dataset.src || null) : null;
 
-			const titleEl = card.querySelector('.video-title');
+			const titleEl = card.querySelector(p.title);
 			let title = titleEl ? titleEl.innerText?.trim() : (link.title || 'Video');
 
-			const durationEl = card.querySelector('.duration');
+			const durationEl = card.querySelector(p.duration);
 			const duration = durationEl ? durationEl.innerText?.trim() : null;
 
 			seen.add(videoId);
@@ -574,13 +1140,13 @@ func (s *ScraperService) GetVideoList(pageNum int) (*VideoListResult, error) {
 			});
 		}
 		return videos;
-	}`)
+	}`, profile)
 	if err != nil {
 		return nil, fmt.Errorf("提取视频列表失败: %v", err)
 	}
 
-	videosData := result.Value.Val().([]interface{})
-	log.Printf("JavaScript 提取到 %d 个视频", len(videosData))
+	videosData, _ := result.Value.Val().([]interface{})
+	log.Printf("JavaScript 提取到 %d 个视频 (布局: %s)", len(videosData), profile.Name)
 
 	videos := make([]models.VideoItem, 0, len(videosData))
 	for _, v := range videosData {
@@ -595,16 +1161,14 @@ func (s *ScraperService) GetVideoList(pageNum int) (*VideoListResult, error) {
 			URL:       getString(vm, "url"),
 			Duration:  getString(vm, "duration"),
 		}
+		video.DurationSeconds = ParseDuration(video.Duration)
+		RememberUpstreamHosts(video.Thumbnail)
 		if video.Title == "" {
 			video.Title = "Video"
 		}
 		videos = append(videos, video)
 	}
-
-	return &VideoListResult{
-		Videos:     videos,
-		TotalPages: totalPages,
-	}, nil
+	return videos, nil
 }
 
 // getString 从map中获取字符串
@@ -676,164 +1240,227 @@ func (s *ScraperService) getTotalPages(page *rod.Page) int {
 	return totalPages
 }
 
-// GetVideoDetail 获取视频详情
+// GetVideoDetail 在共享页面获取视频详情，未找到视频地址时返回nil
 func (s *ScraperService) GetVideoDetail(videoURL string) (*models.VideoDetail, error) {
+	if GetMaintenance().Enabled() {
+		return nil, ErrMaintenance
+	}
+	if !s.acquireDetailSlot() {
+		return nil, ErrScraperBusy
+	}
+	defer s.pendingReqs.Add(-1)
+
+	s.beginScrape()
+	defer s.endScrape()
+
+	// 主页面同一时间只能有一个导航
+	s.pageMu.Lock()
 	page, err := s.GetPage()
 	if err != nil {
+		s.pageMu.Unlock()
 		return nil, err
 	}
 
-	s.pendingReqs++
-	defer func() { s.pendingReqs-- }()
-
 	log.Printf("正在访问视频页: %s", videoURL)
 
-	// 导航到页面
-	err = page.Navigate(videoURL)
+	// 导航到页面，连接失败或遇到验证页面时切换镜像
+	videoURL, err = s.navigateDetailPage(page, videoURL, "")
 	if err != nil {
 		log.Printf("页面导航异常 (可能正常): %v", err)
+		if err := page.WaitLoad(); err != nil {
+			log.Printf("页面加载失败: %v", err)
+		}
 	}
+	preparePlayer(page, "")
 
-	// 等待视频加载
-	if err := page.WaitLoad(); err != nil {
-		log.Printf("页面加载失败: %v", err)
-	}
-	time.Sleep(3 * time.Second)
+	recordFixture("detail", videoURL, page)
 
-	// 尝试点击播放按钮
-	playBtn, err := page.Element(".vjs-big-play-button, .play-button, #player")
-	if err == nil && playBtn != nil {
-		playBtn.Click(proto.InputMouseButtonLeft, 1)
-		time.Sleep(2 * time.Second)
+	detail := extractDetailFromPage(page, videoURL, "")
+	s.pageMu.Unlock()
+	if detail != nil {
+		detail.Format = StreamFormat(GetProxyService().DetectIsMp4(detail.M3u8URL))
 	}
 
-	// 获取视频链接
-	var videoSrc string
-
-	// 方法1: 从 .video-container 下的 source 标签获取
-	sourceEl, err := page.Element(".video-container source")
-	if err == nil && sourceEl != nil {
-		if src, err := sourceEl.Attribute("src"); err == nil && src != nil && *src != "" {
-			videoSrc = *src
-			log.Printf("从 .video-container source 找到: %s", videoSrc)
+	// 异步返回列表页，主页面正被其他抓取使用时跳过
+	go func() {
+		time.Sleep(10 * time.Second)
+		if pending := s.pendingReqs.Load(); pending > 0 {
+			log.Printf("有 %d 个请求正在进行，暂不返回列表页", pending)
+			return
 		}
-	}
-
-	// 方法2: 从 .video-container 下的 video 标签获取
-	if videoSrc == "" {
-		videoEl, err := page.Element(".video-container video")
-		if err == nil && videoEl != nil {
-			if src, err := videoEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-				log.Printf("从 .video-container video 找到: %s", videoSrc)
-			}
+		if !s.pageMu.TryLock() {
+			return
 		}
-	}
+		defer s.pageMu.Unlock()
+		log.Println("返回列表页...")
+		page.NavigateBack()
+	}()
 
-	// 方法3: 从页面内容中提取
-	if videoSrc == "" {
-		html, _ := page.HTML()
+	return detail, nil
+}
 
-		// 先尝试 mp4
-		mp4Re := regexp.MustCompile(`https?://[^\s"'<>]+\.mp4[^\s"'<>]*`)
-		matches := mp4Re.FindStringSubmatch(html)
-		if len(matches) > 0 {
-			videoSrc = matches[0]
-			log.Printf("从页面内容找到mp4: %s", videoSrc)
-		} else {
-			// 再尝试 m3u8
-			m3u8Re := regexp.MustCompile(`https?://[^\s"'<>]+\.m3u8[^\s"'<>]*`)
-			matches := m3u8Re.FindStringSubmatch(html)
-			if len(matches) > 0 {
-				videoSrc = matches[0]
-				log.Printf("从页面内容找到m3u8: %s", videoSrc)
-			}
-		}
+// probeVideoElement 从页面的video元素读取时长（秒）和分辨率
+func probeVideoElement(page *rod.Page) (int, string) {
+	result, err := page.Eval(`() => {
+		const v = document.querySelector('video');
+		if (!v) return null;
+		return {
+			duration: isFinite(v.duration) ? Math.round(v.duration) : 0,
+			width: v.videoWidth || 0,
+			height: v.videoHeight || 0
+		};
+	}`)
+	if err != nil || result.Value.Nil() {
+		return 0, ""
 	}
 
-	// 方法4: 从任意 video source 标签获取
-	if videoSrc == "" {
-		sourceEl, err := page.Element("video source")
-		if err == nil && sourceEl != nil {
-			if src, err := sourceEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-				log.Printf("从 video source 找到: %s", videoSrc)
-			}
-		}
+	var info struct {
+		Duration int `json:"duration"`
+		Width    int `json:"width"`
+		Height   int `json:"height"`
 	}
-
-	// 方法5: 从任意 video 标签的 src 获取
-	if videoSrc == "" {
-		videoEl, err := page.Element("video")
-		if err == nil && videoEl != nil {
-			if src, err := videoEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-				log.Printf("从 video src 找到: %s", videoSrc)
-			}
-		}
+	if err := result.Value.Unmarshal(&info); err != nil {
+		return 0, ""
 	}
 
-	log.Printf("最终视频链接: %s", videoSrc)
-
-	// 修复链接格式问题
-	if videoSrc != "" {
-		re := regexp.MustCompile(`\.com//+`)
-		videoSrc = re.ReplaceAllString(videoSrc, ".com/")
-		log.Printf("修复后链接: %s", videoSrc)
+	resolution := ""
+	if info.Width > 0 && info.Height > 0 {
+		resolution = fmt.Sprintf("%dx%d", info.Width, info.Height)
 	}
+	return info.Duration, resolution
+}
 
-	// 获取标题
-	var pageTitle string
-	if info, err := page.Info(); err == nil {
-		pageTitle = info.Title
+// extractMp4Fallback 播放地址为 M3U8 时，从同一播放器的 <source> 和 video.js 源列表中查找 MP4 地址，分片下载失败时改为缓存 MP4
+// 只看播放器自身的源，页面上其他视频（推荐、广告等）的 MP4 链接不会被误用
+func extractMp4Fallback(page *rod.Page, videoSrc string) string {
+	if !strings.Contains(videoSrc, ".m3u8") {
+		return ""
 	}
-	titleEl, err := page.Element("h4, .video-title, #viewvideo-title")
-	if err == nil && titleEl != nil {
-		if text, err := titleEl.Text(); err == nil && text != "" {
-			pageTitle = strings.TrimSpace(text)
+	result, err := page.Eval(`() => {
+		const sources = [];
+		const video = document.querySelector('.video-container video') || document.querySelector('video');
+		if (video) {
+			if (video.src) sources.push(video.src);
+			for (const s of video.querySelectorAll('source')) {
+				sources.push(s.getAttribute('src') || '');
+			}
 		}
+		try {
+			if (window.videojs && typeof videojs.getPlayers === 'function') {
+				for (const p of Object.values(videojs.getPlayers())) {
+					if (!p || typeof p.currentSources !== 'function') continue;
+					for (const s of p.currentSources()) sources.push((s && s.src) || '');
+				}
+			}
+		} catch (e) {}
+		return sources;
+	}`)
+	if err != nil {
+		return ""
+	}
+	var sources []string
+	if err := result.Value.Unmarshal(&sources); err != nil {
+		return ""
 	}
+	return pickMp4Source(sources)
+}
 
-	// 获取缩略图
-	var thumbnail string
-	videoEl, err := page.Element("video")
-	if err == nil && videoEl != nil {
-		if poster, err := videoEl.Attribute("poster"); err == nil && poster != nil {
-			thumbnail = *poster
+// pickMp4Source 返回源列表中第一个 http(s) 的 MP4 地址
+func pickMp4Source(sources []string) string {
+	for _, src := range sources {
+		src = strings.TrimSpace(src)
+		if strings.HasPrefix(src, "http") && strings.Contains(strings.ToLower(src), ".mp4") {
+			return duplicateSlashRe.ReplaceAllString(src, ".com/")
 		}
 	}
+	return ""
+}
 
-	// 提取视频ID
-	parsedURL, _ := url.Parse(videoURL)
-	videoID := parsedURL.Query().Get("viewkey")
-	if videoID == "" {
-		videoID = "unknown"
+// extractTags 按 SELECTORS 中的 video_tags 提取详情页的标签，去掉首尾空白和 # 前缀并去重
+func extractTags(page *rod.Page) []string {
+	selector := config.Settings.Selectors["video_tags"]
+	if selector == "" {
+		return nil
+	}
+	elements, err := page.Elements(selector)
+	if err != nil {
+		return nil
 	}
 
-	detail := &models.VideoDetail{
-		ID:          videoID,
-		Title:       pageTitle,
-		Thumbnail:   thumbnail,
-		M3u8URL:     videoSrc,
-		OriginalURL: videoURL,
+	var tags []string
+	seen := make(map[string]bool)
+	for _, el := range elements {
+		text, err := el.Text()
+		if err != nil {
+			continue
+		}
+		tag := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "#"))
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
 	}
+	return tags
+}
 
-	// 异步返回列表页
-	go func() {
-		time.Sleep(10 * time.Second)
-		if s.pendingReqs > 0 {
-			log.Printf("有 %d 个请求正在进行，暂不返回列表页", s.pendingReqs)
-			return
+// extractSubtitles 从播放器的 <track kind="subtitles|captions"> 元素和 video.js 的字幕轨道配置中提取字幕地址
+// 只看播放器自身的轨道，页面上其他位置出现的 .vtt 链接（缩略图雪碧图等）不算字幕
+func extractSubtitles(page *rod.Page) []models.Subtitle {
+	result, err := page.Eval(`() => {
+		const subs = [];
+		const seen = new Set();
+		const isSubtitle = kind => {
+			kind = (kind || 'subtitles').toLowerCase();
+			return kind === 'subtitles' || kind === 'captions';
+		};
+		const add = (src, lang, label) => {
+			if (!src) return;
+			let url;
+			try { url = new URL(src, location.href).href; } catch (e) { return; }
+			if (seen.has(url)) return;
+			seen.add(url);
+			subs.push({ lang: lang || '', label: label || '', url: url });
+		};
+		const video = document.querySelector('.video-container video') || document.querySelector('video');
+		if (video) {
+			video.querySelectorAll('track').forEach(t => {
+				if (isSubtitle(t.getAttribute('kind'))) {
+					add(t.getAttribute('src'), t.getAttribute('srclang'), t.getAttribute('label'));
+				}
+			});
 		}
-		log.Println("返回列表页...")
-		page.NavigateBack()
-	}()
+		try {
+			if (window.videojs && typeof videojs.getPlayers === 'function') {
+				for (const p of Object.values(videojs.getPlayers())) {
+					if (!p || typeof p.remoteTextTracks !== 'function') continue;
+					const tracks = p.remoteTextTracks();
+					for (let i = 0; i < tracks.length; i++) {
+						const t = tracks[i];
+						if (t && isSubtitle(t.kind)) add(t.src, t.language, t.label);
+					}
+				}
+			}
+		} catch (e) {}
+		return subs;
+	}`)
+	if err != nil || result.Value.Nil() {
+		return nil
+	}
 
-	return detail, nil
+	var subtitles []models.Subtitle
+	if err := result.Value.Unmarshal(&subtitles); err != nil {
+		return nil
+	}
+	if len(subtitles) > 0 {
+		log.Printf("找到 %d 个字幕", len(subtitles))
+	}
+	return subtitles
 }
 
-// GetVideoDetailInNewTab 在新标签页获取视频详情（用于后台预缓存）
-func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoDetail, error) {
+// openTab 创建新标签页，浏览器连接断开时自动重连
+func (s *ScraperService) openTab() (*rod.Page, error) {
 	s.mu.Lock()
 	if s.browser == nil {
 		if err := s.initializeInternal(); err != nil {
@@ -850,11 +1477,10 @@ func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoD
 		if strings.Contains(err.Error(), "closed") || strings.Contains(err.Error(), "connection") {
 			log.Println("[预缓存] 检测到浏览器连接断开，尝试重新连接...")
 			s.mu.Lock()
-			s.page = nil
-			s.browser = nil
+			s.resetBrowserLocked()
 			if initErr := s.initializeInternal(); initErr != nil {
 				s.mu.Unlock()
-				return nil, fmt.Errorf("重新连接失败: %v", initErr)
+				return nil, fmt.Errorf("重新连接失败: %w", initErr)
 			}
 			browser = s.browser
 			s.mu.Unlock()
@@ -867,94 +1493,172 @@ func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoD
 			return nil, fmt.Errorf("创建新标签页失败: %v", err)
 		}
 	}
-	defer page.Close()
+	return page, nil
+}
+
+// acquireDetailSlot 占用一个详情获取名额，已达到 MAX_PENDING_DETAIL_REQUESTS 时返回false，调用方成功后需要归还
+func (s *ScraperService) acquireDetailSlot() bool {
+	pending := s.pendingReqs.Add(1)
+	if limit := config.Settings.MaxPendingDetailRequests; limit > 0 && int(pending) > limit {
+		s.pendingReqs.Add(-1)
+		log.Printf("进行中的详情获取已达上限 (%d)，拒绝新的请求", limit)
+		return false
+	}
+	return true
+}
+
+// GetVideoDetailInNewTab 在新标签页获取视频详情（用于后台预缓存），熔断期间返回 ErrCircuitOpen，繁忙时返回 ErrScraperBusy，维护模式下返回 ErrMaintenance
+func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoDetail, error) {
+	if GetMaintenance().Enabled() {
+		return nil, ErrMaintenance
+	}
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	s.beginScrape()
+	defer s.endScrape()
+	started := time.Now()
+	detail, err := s.getVideoDetailInNewTab(videoURL, "")
+	s.recordScrape(err, started)
+	return detail, err
+}
+
+// GetVideoDetailWithCookieProfile 使用指定的cookies配置在新标签页获取视频详情，错误与 GetVideoDetailInNewTab 相同，
+// 配置不存在时返回 ErrCookieProfileNotFound
+func (s *ScraperService) GetVideoDetailWithCookieProfile(videoURL, cookieProfile string) (*models.VideoDetail, error) {
+	if GetMaintenance().Enabled() {
+		return nil, ErrMaintenance
+	}
+	// 先检查配置，避免占用熔断器的试探名额后直接返回
+	if cookieProfile != "" && cookieProfile != s.ActiveCookieProfile() {
+		if err := checkCookieProfile(cookieProfile); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	s.beginScrape()
+	defer s.endScrape()
+	started := time.Now()
+	detail, err := s.getVideoDetailInNewTab(videoURL, cookieProfile)
+	s.recordScrape(err, started)
+	return detail, err
+}
+
+// getVideoDetailInNewTab 在新标签页抓取详情页，cookieProfile 非空时使用该cookies配置，进行中的详情获取过多时返回 ErrScraperBusy
+func (s *ScraperService) getVideoDetailInNewTab(videoURL, cookieProfile string) (*models.VideoDetail, error) {
+	if !s.acquireDetailSlot() {
+		return nil, ErrScraperBusy
+	}
+	defer s.pendingReqs.Add(-1)
+
+	page, closeTab, err := s.openCookieProfileTab(cookieProfile)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTab()
 
 	// 设置页面超时
-	page = page.Timeout(60 * time.Second)
+	if timeout := config.Settings.DetailPageTimeout; timeout > 0 {
+		page = page.Timeout(time.Duration(timeout) * time.Second)
+	}
 
 	// 注入反检测脚本
 	s.injectStealthToPage(page)
 
 	log.Printf("[预缓存] 新标签页访问: %s", videoURL)
 
-	err = page.Navigate(videoURL)
+	// 连接失败或遇到验证页面时切换镜像重试
+	videoURL, err = s.navigateDetailPage(page, videoURL, "[预缓存] ")
 	if err != nil {
-		log.Printf("[预缓存] 页面导航异常: %v", err)
 		return nil, err
 	}
 
-	// 等待页面加载，带超时
-	err = page.WaitLoad()
-	if err != nil {
-		log.Printf("[预缓存] 页面加载超时: %v", err)
-	}
-
 	log.Printf("[预缓存] 页面加载完成，等待视频元素...")
-	time.Sleep(3 * time.Second)
+	preparePlayer(page, "[预缓存] ")
+
+	recordFixture("detail", videoURL, page)
 
-	// 尝试点击播放按钮
-	playBtn, err := page.Element(".vjs-big-play-button, .play-button, #player")
-	if err == nil && playBtn != nil {
-		playBtn.Click(proto.InputMouseButtonLeft, 1)
-		time.Sleep(2 * time.Second)
+	detail := extractDetailFromPage(page, videoURL, "[预缓存] ")
+	if detail != nil {
+		detail.Format = StreamFormat(GetProxyService().DetectIsMp4(detail.M3u8URL))
 	}
+	return detail, nil
+}
 
-	// 获取视频链接
-	var videoSrc string
+var (
+	// pageMp4Re 页面内容中的 MP4 地址
+	pageMp4Re = regexp.MustCompile(`https?://[^\s"'<>]+\.mp4[^\s"'<>]*`)
+	// pageM3u8Re 页面内容中的 M3U8 地址
+	pageM3u8Re = regexp.MustCompile(`https?://[^\s"'<>]+\.m3u8[^\s"'<>]*`)
+	// duplicateSlashRe 视频地址中域名后重复的斜杠
+	duplicateSlashRe = regexp.MustCompile(`\.com//+`)
+)
 
-	// 方法1-5与GetVideoDetail相同
-	sourceEl, err := page.Element(".video-container source")
-	if err == nil && sourceEl != nil {
-		if src, err := sourceEl.Attribute("src"); err == nil && src != nil && *src != "" {
-			videoSrc = *src
+// navigateDetailPage 导航到详情页并等待加载，导航失败或遇到验证页面时依次切换镜像重试，返回最终访问的地址
+// 没有可切换的镜像时，验证页面原样留给后续提取，导航错误返回给调用方
+func (s *ScraperService) navigateDetailPage(page *rod.Page, videoURL, logPrefix string) (string, error) {
+	mirrors := GetMirrorService()
+	for attempt := 0; ; attempt++ {
+		hasNext := attempt < mirrors.Count()-1
+		if err := page.Navigate(videoURL); err != nil {
+			log.Printf("%s页面导航异常: %v", logPrefix, err)
+			if !hasNext {
+				return videoURL, err
+			}
+		} else {
+			// 等待页面加载，带超时
+			if err := page.WaitLoad(); err != nil {
+				log.Printf("%s页面加载超时: %v", logPrefix, err)
+			}
+			info, err := page.Info()
+			if err != nil || !isChallengeTitle(info.Title) {
+				return videoURL, nil
+			}
+			s.markChallenge()
+			if !hasNext {
+				return videoURL, nil
+			}
+			log.Printf("%s遇到验证页面: %s", logPrefix, info.Title)
 		}
+		mirrors.Failover(mirrorBaseOf(videoURL))
+		videoURL = mirrors.RewriteToActive(videoURL)
+		log.Printf("%s切换镜像重试: %s", logPrefix, videoURL)
 	}
+}
 
+// extractDetailFromPage 从已加载的详情页提取视频地址、标题、封面等信息，未找到视频地址时返回nil
+// 元素不存在时立即跳过，不等待；不访问网络，Format 由调用方判断；logPrefix 为日志前缀
+func extractDetailFromPage(page *rod.Page, videoURL, logPrefix string) *models.VideoDetail {
+	// 获取视频链接，依次尝试：
+	// 1. .video-container 下的 source 标签
+	// 2. .video-container 下的 video 标签
+	// 3. 播放器脚本（video.js 当前源或 strencode 混淆的地址）
+	// 4. 页面内容中的 mp4/m3u8 地址
+	// 5. 任意 video source 标签
+	// 6. 任意 video 标签的 src
+	videoSrc := elementAttribute(page, detailSelectors.ContainerSource, "src")
 	if videoSrc == "" {
-		videoEl, err := page.Element(".video-container video")
-		if err == nil && videoEl != nil {
-			if src, err := videoEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-			}
-		}
+		videoSrc = elementAttribute(page, detailSelectors.ContainerVideo, "src")
+	}
+	if videoSrc == "" {
+		videoSrc = extractScriptSource(page)
 	}
-
 	if videoSrc == "" {
 		html, _ := page.HTML()
-		mp4Re := regexp.MustCompile(`https?://[^\s"'<>]+\.mp4[^\s"'<>]*`)
-		matches := mp4Re.FindStringSubmatch(html)
-		if len(matches) > 0 {
-			videoSrc = matches[0]
-		} else {
-			m3u8Re := regexp.MustCompile(`https?://[^\s"'<>]+\.m3u8[^\s"'<>]*`)
-			matches := m3u8Re.FindStringSubmatch(html)
-			if len(matches) > 0 {
-				videoSrc = matches[0]
-			}
-		}
+		videoSrc = findMediaURL(html)
 	}
-
 	if videoSrc == "" {
-		sourceEl, err := page.Element("video source")
-		if err == nil && sourceEl != nil {
-			if src, err := sourceEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-			}
-		}
+		videoSrc = elementAttribute(page, detailSelectors.Source, "src")
 	}
-
 	if videoSrc == "" {
-		videoEl, err := page.Element("video")
-		if err == nil && videoEl != nil {
-			if src, err := videoEl.Attribute("src"); err == nil && src != nil && *src != "" {
-				videoSrc = *src
-			}
-		}
+		videoSrc = elementAttribute(page, detailSelectors.Video, "src")
 	}
 
+	// 修复链接格式问题
 	if videoSrc != "" {
-		re := regexp.MustCompile(`\.com//+`)
-		videoSrc = re.ReplaceAllString(videoSrc, ".com/")
+		videoSrc = duplicateSlashRe.ReplaceAllString(videoSrc, ".com/")
 	}
 
 	// 获取标题
@@ -962,21 +1666,14 @@ func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoD
 	if info, err := page.Info(); err == nil {
 		pageTitle = info.Title
 	}
-	titleEl, err := page.Element("h4, .video-title, #viewvideo-title")
-	if err == nil && titleEl != nil {
+	if has, titleEl, _ := page.Has(detailSelectors.Title); has {
 		if text, err := titleEl.Text(); err == nil && text != "" {
 			pageTitle = strings.TrimSpace(text)
 		}
 	}
 
 	// 获取缩略图
-	var thumbnail string
-	videoEl, err := page.Element("video")
-	if err == nil && videoEl != nil {
-		if poster, err := videoEl.Attribute("poster"); err == nil && poster != nil {
-			thumbnail = *poster
-		}
-	}
+	thumbnail := elementAttribute(page, detailSelectors.Video, "poster")
 
 	// 提取视频ID
 	parsedURL, _ := url.Parse(videoURL)
@@ -985,19 +1682,169 @@ func (s *ScraperService) GetVideoDetailInNewTab(videoURL string) (*models.VideoD
 		videoID = "unknown"
 	}
 
-	if videoSrc != "" {
-		log.Printf("[预缓存] 获取到视频链接: %s", videoID)
-		return &models.VideoDetail{
-			ID:          videoID,
-			Title:       pageTitle,
-			Thumbnail:   thumbnail,
-			M3u8URL:     videoSrc,
-			OriginalURL: videoURL,
-		}, nil
-	}
-
-	log.Printf("[预缓存] 未找到视频链接: %s", videoID)
-	return nil, nil
+	if videoSrc == "" {
+		log.Printf("%s未找到视频链接: %s", logPrefix, videoID)
+		return nil
+	}
+
+	log.Printf("%s获取到视频链接: %s", logPrefix, videoID)
+	detail := &models.VideoDetail{
+		ID:          videoID,
+		Title:       pageTitle,
+		Thumbnail:   thumbnail,
+		M3u8URL:     videoSrc,
+		OriginalURL: videoURL,
+	}
+	detail.Duration, detail.Resolution = probeVideoElement(page)
+	detail.Subtitles = extractSubtitles(page)
+	detail.Mp4URL = extractMp4Fallback(page, videoSrc)
+	detail.Tags = extractTags(page)
+	rememberDetailHosts(detail)
+	return detail
+}
+
+// elementAttribute 读取页面中第一个匹配元素的属性，元素不存在时立即返回空字符串
+func elementAttribute(page *rod.Page, selector, name string) string {
+	has, el, err := page.Has(selector)
+	if err != nil || !has {
+		return ""
+	}
+	value, err := el.Attribute(name)
+	if err != nil || value == nil {
+		return ""
+	}
+	return *value
+}
+
+// findMediaURL 从页面HTML中查找视频地址，优先 MP4，其次 M3U8
+func findMediaURL(html string) string {
+	if src := pageMp4Re.FindString(html); src != "" {
+		return src
+	}
+	return pageM3u8Re.FindString(html)
+}
+
+// detailSelectorSet 详情页提取使用的选择器
+type detailSelectorSet struct {
+	ContainerSource string
+	ContainerVideo  string
+	Source          string
+	Video           string
+	Title           string
+}
+
+// detailSelectors 详情页提取和选择器检查共用的选择器
+var detailSelectors = detailSelectorSet{
+	ContainerSource: ".video-container source",
+	ContainerVideo:  ".video-container video",
+	Source:          "video source",
+	Video:           "video",
+	Title:           "h4, .video-title, #viewvideo-title",
+}
+
+// named 按选择器检查报告中的名称返回全部选择器
+func (d detailSelectorSet) named() map[string]string {
+	return map[string]string{
+		"video_container_source": d.ContainerSource,
+		"video_container_video":  d.ContainerVideo,
+		"video_source":           d.Source,
+		"video":                  d.Video,
+		"title":                  d.Title,
+	}
+}
+
+// DryRunSelectors 在新标签页访问列表页和详情页，报告各选择器的匹配情况（不缓存、不返回视频流）
+func (s *ScraperService) DryRunSelectors(listURL, detailURL string) (*models.SelectorReport, error) {
+	cfg := config.Settings
+	if listURL == "" {
+		listURL = fmt.Sprintf("%s%s&page=1", TargetBaseURL(), cfg.VideoListPath)
+	}
+
+	s.beginScrape()
+	defer s.endScrape()
+
+	page, err := s.openTab()
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	page = page.Timeout(60 * time.Second)
+	s.injectStealthToPage(page)
+
+	report := &models.SelectorReport{ListURL: listURL, DetailURL: detailURL}
+
+	// 列表页：配置的选择器和所有布局配置
+	listSelectors := make(map[string]string)
+	for name, sel := range cfg.Selectors {
+		listSelectors[name] = sel
+	}
+	for name, profile := range getListProfiles() {
+		listSelectors[name+".column"] = profile.Column
+		listSelectors[name+".card"] = profile.Card
+		listSelectors[name+".link"] = profile.Link
+		listSelectors[name+".thumbnail"] = profile.Thumbnail
+		listSelectors[name+".title"] = profile.Title
+		listSelectors[name+".duration"] = profile.Duration
+	}
+	if report.List, err = s.matchSelectors(page, listURL, listSelectors); err != nil {
+		return nil, err
+	}
+
+	if detailURL != "" {
+		pageSelectors := detailSelectors.named()
+		pageSelectors["play_button"] = defaultPlayButtonSelector
+		if sel := cfg.Selectors["play_button"]; sel != "" {
+			pageSelectors["play_button"] = sel
+		}
+		if sel := cfg.Selectors["video_tags"]; sel != "" {
+			pageSelectors["tags"] = sel
+		}
+		if report.Detail, err = s.matchSelectors(page, detailURL, pageSelectors); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// matchSelectors 导航到指定页面并统计每个选择器的匹配数量和示例文本
+func (s *ScraperService) matchSelectors(page *rod.Page, targetURL string, selectors map[string]string) (map[string]models.SelectorResult, error) {
+	log.Printf("[DryRun] 访问: %s", targetURL)
+	if err := page.Navigate(targetURL); err != nil {
+		return nil, fmt.Errorf("导航失败: %v", err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		log.Printf("[DryRun] 页面加载失败: %v", err)
+	}
+	time.Sleep(3 * time.Second)
+
+	result, err := page.Eval(`(selectors) => {
+		const report = {};
+		for (const [name, sel] of Object.entries(selectors)) {
+			if (!sel) continue;
+			try {
+				const els = Array.from(document.querySelectorAll(sel));
+				report[name] = {
+					selector: sel,
+					count: els.length,
+					samples: els.slice(0, 3).map(el =>
+						(el.innerText || el.getAttribute('src') || el.getAttribute('href') || '').trim().slice(0, 100))
+				};
+			} catch (e) {
+				report[name] = { selector: sel, count: 0, error: String(e) };
+			}
+		}
+		return report;
+	}`, selectors)
+	if err != nil {
+		return nil, fmt.Errorf("执行选择器检测失败: %v", err)
+	}
+
+	matches := make(map[string]models.SelectorResult)
+	if err := result.Value.Unmarshal(&matches); err != nil {
+		return nil, fmt.Errorf("解析选择器结果失败: %v", err)
+	}
+	return matches, nil
 }
 
 // 全局单例
@@ -0,0 +1,47 @@
+package services
+
+import "testing"
+
+func TestPickMp4Source(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		want    string
+	}{
+		{"m3u8后的mp4", []string{"https://cdn.example.com/hls/a/index.m3u8", "https://cdn.example.com/mp4/a.mp4?st=1"}, "https://cdn.example.com/mp4/a.mp4?st=1"},
+		{"修复重复斜杠", []string{"https://cdn.example.com//mp4/a.mp4"}, "https://cdn.example.com/mp4/a.mp4"},
+		{"跳过相对地址和blob", []string{"blob:https://example.com/1", "/mp4/a.mp4", " https://cdn.example.com/a.MP4 "}, "https://cdn.example.com/a.MP4"},
+		{"没有mp4", []string{"https://cdn.example.com/hls/a/index.m3u8", "https://cdn.example.com/a.webm"}, ""},
+		{"空列表", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickMp4Source(tt.sources); got != tt.want {
+				t.Fatalf("pickMp4Source = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChromeFlags(t *testing.T) {
+	flags, removed := parseChromeFlags(`disable-gpu !no-sandbox --disable-features=A,B window-size=1920,1080 user-agent="Mozilla/5.0 (X11; Linux x86_64)"`)
+	want := map[string]string{
+		"disable-gpu":                   "",
+		"disable-features":              "A,B",
+		"window-size":                   "1920,1080",
+		"user-agent":                    "Mozilla/5.0 (X11; Linux x86_64)",
+		"disable-background-networking": "",
+		"disable-dev-shm-usage":         "",
+	}
+	if len(flags) != len(want) {
+		t.Fatalf("flags = %v, want %v", flags, want)
+	}
+	for name, value := range want {
+		if got, ok := flags[name]; !ok || got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if len(removed) != 1 || removed[0] != "no-sandbox" {
+		t.Errorf("removed = %v, want [no-sandbox]", removed)
+	}
+}
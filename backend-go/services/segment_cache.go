@@ -0,0 +1,173 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// playlistIdleTimeout 播放列表索引的闲置过期时间
+const playlistIdleTimeout = 30 * time.Minute
+
+// segmentCache 分片内存缓存（也用于封面图），按总字节数限制，超出时淘汰最早写入的条目
+type segmentCache struct {
+	mu       sync.Mutex
+	entries  map[string]*segmentEntry
+	order    []string
+	size     int64
+	inflight map[string]bool
+	// 分片URL -> 所属播放列表，用于查找后续分片
+	playlists map[string]*playlistIndex
+}
+
+// segmentEntry 缓存的分片
+type segmentEntry struct {
+	content     []byte
+	contentType string
+	expiresAt   time.Time
+}
+
+// playlistIndex 播放列表中分片的顺序
+type playlistIndex struct {
+	urls      []string
+	positions map[string]int
+	lastUsed  time.Time
+}
+
+func newSegmentCache() *segmentCache {
+	return &segmentCache{
+		entries:   make(map[string]*segmentEntry),
+		inflight:  make(map[string]bool),
+		playlists: make(map[string]*playlistIndex),
+	}
+}
+
+// get 获取未过期的分片
+func (c *segmentCache) get(url string) ([]byte, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil, "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		c.removeLocked(url)
+		return nil, "", false
+	}
+	return entry.content, entry.contentType, true
+}
+
+// put 写入分片，超过 maxBytes 时淘汰最早的分片
+func (c *segmentCache) put(url string, content []byte, contentType string, ttl time.Duration, maxBytes int64) {
+	size := int64(len(content))
+	if ttl <= 0 || size > maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[url]; ok {
+		c.removeLocked(url)
+	}
+	for c.size+size > maxBytes && len(c.order) > 0 {
+		c.removeLocked(c.order[0])
+	}
+
+	c.entries[url] = &segmentEntry{
+		content:     content,
+		contentType: contentType,
+		expiresAt:   time.Now().Add(ttl),
+	}
+	c.order = append(c.order, url)
+	c.size += size
+}
+
+// removeLocked 删除分片（调用方需持有 mu）
+func (c *segmentCache) removeLocked(url string) {
+	entry, ok := c.entries[url]
+	if !ok {
+		return
+	}
+	delete(c.entries, url)
+	c.size -= int64(len(entry.content))
+	for i, u := range c.order {
+		if u == url {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// indexPlaylist 记录播放列表中分片的顺序
+func (c *segmentCache) indexPlaylist(urls []string) {
+	if len(urls) == 0 {
+		return
+	}
+
+	index := &playlistIndex{
+		urls:      urls,
+		positions: make(map[string]int, len(urls)),
+		lastUsed:  time.Now(),
+	}
+	for i, u := range urls {
+		index.positions[u] = i
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 清理闲置的播放列表索引
+	for u, idx := range c.playlists {
+		if time.Since(idx.lastUsed) > playlistIdleTimeout {
+			delete(c.playlists, u)
+		}
+	}
+	for _, u := range urls {
+		c.playlists[u] = index
+	}
+}
+
+// nextURLs 返回播放列表中指定分片之后、跳过 offset 个的 count 个分片
+func (c *segmentCache) nextURLs(url string, offset, count int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index, ok := c.playlists[url]
+	if !ok {
+		return nil
+	}
+	index.lastUsed = time.Now()
+
+	start := index.positions[url] + 1 + offset
+	if start >= len(index.urls) {
+		return nil
+	}
+	end := start + count
+	if end > len(index.urls) {
+		end = len(index.urls)
+	}
+	return append([]string(nil), index.urls[start:end]...)
+}
+
+// beginFetch 标记分片开始预取，已缓存或正在获取时返回false
+func (c *segmentCache) beginFetch(url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[url]; ok && time.Now().Before(entry.expiresAt) {
+		return false
+	}
+	if c.inflight[url] {
+		return false
+	}
+	c.inflight[url] = true
+	return true
+}
+
+// endFetch 取消分片的预取标记
+func (c *segmentCache) endFetch(url string) {
+	c.mu.Lock()
+	delete(c.inflight, url)
+	c.mu.Unlock()
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// segmentManifestName 分片清单文件名，记录下载时每个分片的原始地址和本地文件名
+const segmentManifestName = "segments.json"
+
+// manifestEntry 分片清单中的一项，按播放列表中的顺序排列
+type manifestEntry struct {
+	Original string `json:"original"`
+	Local    string `json:"local"`
+	Init     bool   `json:"init,omitempty"`
+}
+
+// saveSegmentManifest 保存分片清单
+func saveSegmentManifest(cacheDir string, entries []manifestEntry) error {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if content, err = encodeMetadata(content); err != nil {
+		return err
+	}
+	return writeFileDurable(filepath.Join(cacheDir, segmentManifestName), content)
+}
+
+// segmentEntries 获取视频的分片清单：下载中使用内存中已就绪部分的记录，否则读取 segments.json
+// 旧版缓存没有清单，返回 nil
+func (v *VideoCacheService) segmentEntries(viewkey string) []manifestEntry {
+	v.mu.RLock()
+	partial, ok := v.partialM3u8[viewkey]
+	if ok {
+		entries := append([]manifestEntry(nil), partial.entries...)
+		v.mu.RUnlock()
+		return entries
+	}
+	v.mu.RUnlock()
+
+	entries, _ := readSegmentManifest(v.getVideoCacheDir(viewkey))
+	return entries
+}
+
+// readSegmentManifest 读取缓存目录中的分片清单
+func readSegmentManifest(cacheDir string) ([]manifestEntry, error) {
+	content, err := readMetadata(filepath.Join(cacheDir, segmentManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// segmentSourceKey 比较分片来源时使用的地址：去掉查询字符串（签名、过期时间等每次获取播放列表都会变化），保留字节范围
+func segmentSourceKey(rawURL string) string {
+	base, rng := splitByteRange(rawURL)
+	if u, err := url.Parse(base); err == nil {
+		u.RawQuery = ""
+		u.Fragment = ""
+		base = u.String()
+	}
+	return base + "|" + rng
+}
+
+// reuseStoredSegments 检查上次中断的下载留下的分片能否继续使用，返回可用的分片数
+// 只有上次的分片清单中同名分片的来源与本次相同时才保留，没有清单（旧版下载）或来源不同的分片删除后重新下载
+func reuseStoredSegments(cacheDir string, planned []manifestEntry) int {
+	previous, _ := readSegmentManifest(cacheDir)
+	sources := make(map[string]string, len(previous))
+	for _, entry := range previous {
+		sources[entry.Local] = segmentSourceKey(entry.Original)
+	}
+
+	stored := 0
+	for _, entry := range planned {
+		path := filepath.Join(cacheDir, entry.Local)
+		if !segmentStored(path) {
+			continue
+		}
+		if source, ok := sources[entry.Local]; !ok || source != segmentSourceKey(entry.Original) {
+			os.Remove(path)
+			continue
+		}
+		stored++
+	}
+	return stored
+}
+
+// segmentNamer 按播放列表中的顺序给出初始化分片和媒体分片的本地文件名
+// 清单缺失或条目不足时使用播放列表中的名称
+type segmentNamer struct {
+	inits []string
+	media []string
+}
+
+// newSegmentNamer 由分片清单创建
+func newSegmentNamer(entries []manifestEntry) *segmentNamer {
+	namer := &segmentNamer{}
+	for _, entry := range entries {
+		if entry.Init {
+			namer.inits = append(namer.inits, entry.Local)
+		} else {
+			namer.media = append(namer.media, entry.Local)
+		}
+	}
+	return namer
+}
+
+// initName 下一个 #EXT-X-MAP 初始化分片的本地文件名
+func (n *segmentNamer) initName(uri string) string {
+	if len(n.inits) == 0 {
+		return uri
+	}
+	name := n.inits[0]
+	n.inits = n.inits[1:]
+	return name
+}
+
+// mediaName 下一个媒体分片的本地文件名
+func (n *segmentNamer) mediaName(line string) string {
+	if len(n.media) == 0 {
+		return line
+	}
+	name := n.media[0]
+	n.media = n.media[1:]
+	return name
+}
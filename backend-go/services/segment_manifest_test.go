@@ -0,0 +1,202 @@
+package services
+
+import (
+	"backend-go/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegmentSourceKeyIgnoresQuery(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"https://cdn.example.com/v/0.ts?token=a", "https://cdn.example.com/v/0.ts?token=b", true},
+		{"https://cdn.example.com/v/0.ts", "https://cdn.example.com/v/1.ts", false},
+		{withByteRange("https://cdn.example.com/v/all.mp4?e=1", 0, 100), withByteRange("https://cdn.example.com/v/all.mp4?e=2", 0, 100), true},
+		{withByteRange("https://cdn.example.com/v/all.mp4", 0, 100), withByteRange("https://cdn.example.com/v/all.mp4", 100, 100), false},
+	}
+	for _, tt := range tests {
+		if got := segmentSourceKey(tt.a) == segmentSourceKey(tt.b); got != tt.same {
+			t.Errorf("segmentSourceKey(%q) == segmentSourceKey(%q) = %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestReuseStoredSegments(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 上次下载：0.ts、1.ts 已写入，清单记录其来源
+	if err := saveSegmentManifest(dir, []manifestEntry{
+		{Original: "https://cdn.example.com/v/0.ts?token=old", Local: "0.ts"},
+		{Original: "https://cdn.example.com/v/1.ts?token=old", Local: "1.ts"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	writeSegment("0.ts")
+	writeSegment("1.ts")
+
+	// 本次播放列表中 1.ts 对应的分片已变化
+	planned := []manifestEntry{
+		{Original: "https://cdn.example.com/v/0.ts?token=new", Local: "0.ts"},
+		{Original: "https://cdn.example.com/v/other.ts?token=new", Local: "1.ts"},
+		{Original: "https://cdn.example.com/v/2.ts?token=new", Local: "2.ts"},
+	}
+	if stored := reuseStoredSegments(dir, planned); stored != 1 {
+		t.Fatalf("可用分片数 = %d, want 1", stored)
+	}
+	if !segmentStored(filepath.Join(dir, "0.ts")) {
+		t.Error("来源相同的分片应保留")
+	}
+	if segmentStored(filepath.Join(dir, "1.ts")) {
+		t.Error("来源不同的分片应删除")
+	}
+}
+
+func TestReuseStoredSegmentsWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0.ts"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	planned := []manifestEntry{{Original: "https://cdn.example.com/v/0.ts", Local: "0.ts"}}
+	if stored := reuseStoredSegments(dir, planned); stored != 0 {
+		t.Fatalf("没有清单时可用分片数 = %d, want 0", stored)
+	}
+	if segmentStored(filepath.Join(dir, "0.ts")) {
+		t.Error("无法确认来源的分片应删除")
+	}
+}
+
+func TestPlanSegmentEntries(t *testing.T) {
+	v := NewVideoCacheService()
+	playlist := "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\nseg0.m4s\n#EXTINF:4,\nseg1.m4s\n#EXT-X-ENDLIST\n"
+	segments := []string{"https://cdn.example.com/v/seg0.m4s", "https://cdn.example.com/v/seg1.m4s"}
+
+	entries := v.planSegmentEntries(playlist, "https://cdn.example.com/v/index.m3u8", segments)
+	if len(entries) != 3 {
+		t.Fatalf("清单条目数 = %d, want 3", len(entries))
+	}
+	if !entries[0].Init || entries[0].Original != "https://cdn.example.com/v/init.mp4" {
+		t.Errorf("初始化分片 = %+v", entries[0])
+	}
+	for i, entry := range entries[1:] {
+		if entry.Original != segments[i] || entry.Local != localSegmentName(i, segments[i]) {
+			t.Errorf("分片 %d = %+v", i, entry)
+		}
+	}
+}
+
+func TestPartialPlaylistLinesUsePlannedNames(t *testing.T) {
+	v := NewVideoCacheService()
+	playlist := "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\nseg0.m4s\n#EXTINF:4,\nseg1.m4s\n#EXT-X-ENDLIST\n"
+	segments := []string{"https://cdn.example.com/v/seg0.m4s", "https://cdn.example.com/v/seg1.m4s"}
+	planned := v.planSegmentEntries(playlist, "https://cdn.example.com/v/index.m3u8", segments)
+
+	full := localPlaylistLines(playlist, planned)
+	lines := partialPlaylistLines(full, 1)
+	content := strings.Join(lines, "\n")
+	if !strings.Contains(content, planned[0].Local) || !strings.Contains(content, planned[1].Local) {
+		t.Fatalf("边下边播列表应使用清单中的本地文件名:\n%s", content)
+	}
+	if strings.Contains(content, planned[2].Local) || strings.Contains(content, "#EXT-X-ENDLIST") {
+		t.Fatalf("边下边播列表不应包含未下载的分片:\n%s", content)
+	}
+}
+
+func TestGetPartialM3u8ServesFullPlaylistWhenMissUpstream(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+
+	v := NewVideoCacheService()
+	playlist := "#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\nseg0.m4s\n#EXTINF:4,\nseg1.m4s\n#EXTINF:4,\nseg2.m4s\n#EXT-X-ENDLIST\n"
+	segments := []string{"https://cdn.example.com/v/seg0.m4s", "https://cdn.example.com/v/seg1.m4s", "https://cdn.example.com/v/seg2.m4s"}
+	planned := v.planSegmentEntries(playlist, "https://cdn.example.com/v/index.m3u8", segments)
+	// 只下载完了初始化分片和第一个分片
+	v.partialM3u8["partialfull"] = &partialPlaylist{
+		lines:    localPlaylistLines(playlist, planned)[:6],
+		segments: 1,
+		entries:  planned[:2],
+		full:     localPlaylistLines(playlist, planned),
+	}
+
+	config.Settings.SegmentMissUpstream = true
+	content, ok := v.GetPartialM3u8("partialfull", 3)
+	if !ok {
+		t.Fatal("开启 SEGMENT_MISS_UPSTREAM 时应返回完整列表")
+	}
+	for _, want := range []string{"#EXT-X-PLAYLIST-TYPE:VOD", `URI="init.mp4"`, planned[3].Local, "#EXT-X-ENDLIST"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("完整列表缺少 %q:\n%s", want, content)
+		}
+	}
+
+	config.Settings.SegmentMissUpstream = false
+	if _, ok := v.GetPartialM3u8("partialfull", 3); ok {
+		t.Fatal("关闭时不足 PARTIAL_M3U8_MIN_SEGMENTS 不应返回列表")
+	}
+	content, ok = v.GetPartialM3u8("partialfull", 1)
+	if !ok || strings.Contains(content, "#EXT-X-ENDLIST") || strings.Contains(content, planned[2].Local) {
+		t.Fatalf("关闭时应只返回已就绪的分片:\n%s", content)
+	}
+}
+
+func TestSweepPartialM3u8(t *testing.T) {
+	saved := *config.Settings
+	defer func() { *config.Settings = saved }()
+	config.Settings.HlsPartialMaxAge = 3600
+
+	v := NewVideoCacheService()
+	v.cacheDir = t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	makeDir := func(name string, complete bool, modTime time.Time) string {
+		dir := filepath.Join(v.cacheDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "0.ts"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if complete {
+			if err := os.WriteFile(filepath.Join(dir, ".complete"), []byte("complete"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chtimes(dir, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	stale := makeDir("partialstale", false, old)
+	recent := makeDir("partialrecent", false, time.Now())
+	complete := makeDir("partialdone", true, old)
+	downloading := makeDir("partialactive", false, old)
+	v.downloadTasks["partialactive"] = make(chan struct{})
+
+	if result, err := v.SweepMp4Temp(time.Hour); err != nil || result.RemovedDirs != 0 {
+		t.Fatalf("MP4临时文件清理不应删除目录: %+v, %v", result, err)
+	}
+	result, err := v.SweepPartialM3u8(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RemovedDirs != 1 || result.FreedBytes != 4 {
+		t.Fatalf("结果 = %+v, want 1 个目录 4 字节", result)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("过期的未完成目录应删除")
+	}
+	for _, dir := range []string{recent, complete, downloading} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s 不应删除", filepath.Base(dir))
+		}
+	}
+}
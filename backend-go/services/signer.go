@@ -0,0 +1,78 @@
+package services
+
+import (
+	"backend-go/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SigningEnabled 是否启用代理URL签名
+func SigningEnabled() bool {
+	return config.Settings.URLSigningSecret != ""
+}
+
+// SessionBindingEnabled 签名链接是否绑定到签发时的会话（SIGNED_URL_BIND_SESSION）
+func SessionBindingEnabled() bool {
+	return SigningEnabled() && config.Settings.SignedURLBindSession
+}
+
+// NewSigningSession 生成签名会话ID
+func NewSigningSession() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ValidSigningSession 检查会话ID格式
+func ValidSigningSession(session string) bool {
+	if len(session) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(session)
+	return err == nil
+}
+
+// SignPath 为代理路径（可带 url 等查询参数，一并计入签名）追加过期时间和签名参数
+// session 非空时签名绑定该会话，只有同一会话的请求能通过校验；未配置密钥时原样返回
+func SignPath(path, session string) string {
+	if !SigningEnabled() {
+		return path
+	}
+	exp := strconv.FormatInt(time.Now().Add(time.Duration(config.Settings.SignedURLTTL)*time.Second).Unix(), 10)
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%sexp=%s&sig=%s", path, sep, exp, computeSignature(path, exp, session))
+}
+
+// VerifySignedPath 校验代理路径（含除 exp、sig 外的查询参数）的签名、会话和过期时间（未配置密钥时始终通过）
+func VerifySignedPath(path, exp, sig, session string) bool {
+	if !SigningEnabled() {
+		return true
+	}
+	if exp == "" || sig == "" {
+		return false
+	}
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expUnix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(computeSignature(path, exp, session)))
+}
+
+// computeSignature 计算路径签名
+func computeSignature(path, exp, session string) string {
+	mac := hmac.New(sha256.New, []byte(config.Settings.URLSigningSecret))
+	mac.Write([]byte(path + "|" + exp + "|" + session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
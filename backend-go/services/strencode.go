@@ -0,0 +1,98 @@
+package services
+
+import (
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+var (
+	// document.write(strencode2("%3c%73%6f...")) 形式，内容为 escape 编码的 <source> 标签
+	strencode2Re = regexp.MustCompile(`strencode2\(\s*["']([^"']+)["']\s*\)`)
+	// strencode("base64", "key", ...) 形式，内容为 base64 + 异或 + base64 编码的 <source> 标签
+	strencodeRe = regexp.MustCompile(`strencode\(\s*["']([^"']+)["']\s*,\s*["']([^"']+)["']`)
+	// 解码后 <source> 标签中的地址
+	sourceSrcRe = regexp.MustCompile(`src\s*=\s*["']([^"']+)["']`)
+)
+
+// extractScriptSource 从播放器脚本中获取视频地址
+// 优先读取已初始化的 video.js 播放器的当前源，其次解码页面中 strencode/strencode2 混淆的 <source> 标签
+func extractScriptSource(page *rod.Page) string {
+	result, err := page.Eval(`() => {
+		try {
+			if (window.videojs && typeof videojs.getPlayers === 'function') {
+				for (const p of Object.values(videojs.getPlayers())) {
+					const src = p && typeof p.currentSrc === 'function' ? p.currentSrc() : '';
+					if (src && !src.startsWith('blob:')) return src;
+				}
+			}
+		} catch (e) {}
+		return '';
+	}`)
+	if err == nil {
+		if src := result.Value.Str(); src != "" {
+			return src
+		}
+	}
+
+	html, err := page.HTML()
+	if err != nil {
+		return ""
+	}
+	return decodeStrencodeSource(html)
+}
+
+// decodeStrencodeSource 解码页面HTML中 strencode/strencode2 混淆的视频地址
+func decodeStrencodeSource(html string) string {
+	for _, match := range strencode2Re.FindAllStringSubmatch(html, -1) {
+		if decoded, err := url.PathUnescape(match[1]); err == nil {
+			if src := sourceFromTag(decoded); src != "" {
+				return src
+			}
+		}
+	}
+
+	for _, match := range strencodeRe.FindAllStringSubmatch(html, -1) {
+		if decoded, ok := strencode(match[1], match[2]); ok {
+			if src := sourceFromTag(decoded); src != "" {
+				return src
+			}
+		}
+	}
+	return ""
+}
+
+// strencode 还原站点的 strencode 编码：base64 解码后按 key 循环异或，再 base64 解码
+func strencode(input, key string) (string, bool) {
+	data, err := base64.StdEncoding.DecodeString(input)
+	if err != nil || key == "" {
+		return "", false
+	}
+
+	code := make([]byte, len(data))
+	for i := range data {
+		code[i] = data[i] ^ key[i%len(key)]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(code))
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// sourceFromTag 从解码后的 <source> 标签中取出 src
+func sourceFromTag(tag string) string {
+	matches := sourceSrcRe.FindStringSubmatch(tag)
+	if matches == nil {
+		return ""
+	}
+	src := strings.TrimSpace(matches[1])
+	if !strings.HasPrefix(src, "http") {
+		return ""
+	}
+	return src
+}
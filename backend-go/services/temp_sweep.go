@@ -0,0 +1,125 @@
+package services
+
+import (
+	"backend-go/models"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mp4TempSuffix MP4下载中的临时文件后缀
+const mp4TempSuffix = ".mp4.tmp"
+
+// SweepMp4Temp 删除没有进行中下载、且超过 maxAge 未修改的MP4临时文件（崩溃或取消后遗留），返回删除的文件数和释放的空间
+func (v *VideoCacheService) SweepMp4Temp(maxAge time.Duration) (*models.TempSweepResponse, error) {
+	entries, err := os.ReadDir(v.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &models.TempSweepResponse{}, nil
+		}
+		return nil, err
+	}
+
+	result := &models.TempSweepResponse{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, mp4TempSuffix) {
+			continue
+		}
+		viewkey := strings.TrimSuffix(name, mp4TempSuffix)
+		if v.IsDownloading(viewkey) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(v.cacheDir, name)); err != nil {
+			log.Printf("[Cache] 删除临时文件失败 %s: %v", name, err)
+			continue
+		}
+		result.Removed++
+		result.FreedBytes += info.Size()
+	}
+	if result.Removed > 0 {
+		log.Printf("[Cache] 清理了 %d 个未完成的MP4临时文件", result.Removed)
+	}
+	result.FreedMB = float64(result.FreedBytes) / (1024 * 1024)
+	return result, nil
+}
+
+// SweepPartialM3u8 删除没有完成标记、不在下载中、且超过 maxAge 未更新的M3U8缓存目录，返回删除的目录数和释放的空间
+// 这些目录保留给下次下载续传，长期没有再次下载时只会占用磁盘
+func (v *VideoCacheService) SweepPartialM3u8(maxAge time.Duration) (*models.TempSweepResponse, error) {
+	entries, err := os.ReadDir(v.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &models.TempSweepResponse{}, nil
+		}
+		return nil, err
+	}
+
+	result := &models.TempSweepResponse{}
+	for _, entry := range entries {
+		viewkey := entry.Name()
+		if !entry.IsDir() || !ValidViewkey(viewkey) || v.IsDownloading(viewkey) {
+			continue
+		}
+		dir := filepath.Join(v.cacheDir, viewkey)
+		if _, err := os.Stat(filepath.Join(dir, ".complete")); err == nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		size := v.getDirSize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("[Cache] 删除未完成的M3U8缓存失败 %s: %v", viewkey, err)
+			continue
+		}
+		result.RemovedDirs++
+		result.FreedBytes += size
+	}
+	if result.RemovedDirs > 0 {
+		log.Printf("[Cache] 清理了 %d 个未完成的M3U8缓存目录", result.RemovedDirs)
+	}
+	result.FreedMB = float64(result.FreedBytes) / (1024 * 1024)
+	return result, nil
+}
+
+// StartMp4TempSweep 启动时清理一次遗留的MP4临时文件，之后按间隔（秒）定期清理，间隔<=0时只在启动时清理
+// 只删除超过 maxAge（秒）未修改的文件
+func (v *VideoCacheService) StartMp4TempSweep(interval, maxAge int) {
+	age := time.Duration(maxAge) * time.Second
+	if _, err := v.SweepMp4Temp(age); err != nil {
+		log.Printf("[Cache] 清理MP4临时文件失败: %v", err)
+	}
+	GetScheduler().Register("mp4_temp_sweep", time.Duration(interval)*time.Second, func() error {
+		if _, err := v.SweepMp4Temp(age); err != nil {
+			return fmt.Errorf("清理MP4临时文件失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// StartPartialM3u8Sweep 启动时清理一次超过 maxAge（秒）未更新的未完成M3U8缓存目录，之后按间隔（秒）定期清理
+// maxAge<=0 时不清理，间隔<=0时只在启动时清理
+func (v *VideoCacheService) StartPartialM3u8Sweep(interval, maxAge int) {
+	if maxAge <= 0 {
+		return
+	}
+	age := time.Duration(maxAge) * time.Second
+	if _, err := v.SweepPartialM3u8(age); err != nil {
+		log.Printf("[Cache] 清理未完成的M3U8缓存失败: %v", err)
+	}
+	GetScheduler().Register("hls_partial_sweep", time.Duration(interval)*time.Second, func() error {
+		if _, err := v.SweepPartialM3u8(age); err != nil {
+			return fmt.Errorf("清理未完成的M3U8缓存失败: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"backend-go/config"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrThumbnailUnavailable 上游明确返回封面图不存在，失败标记有效期内不再重新下载
+var ErrThumbnailUnavailable = errors.New("封面图不可用")
+
+// defaultThumbnailPlaceholder 内置占位图（未配置 THUMBNAIL_PLACEHOLDER 时使用）
+const defaultThumbnailPlaceholder = `<svg xmlns="http://www.w3.org/2000/svg" width="320" height="180" viewBox="0 0 320 180">` +
+	`<rect width="320" height="180" fill="#2a2a2a"/>` +
+	`<path d="M136 62h48a6 6 0 0 1 6 6v44a6 6 0 0 1-6 6h-48a6 6 0 0 1-6-6V68a6 6 0 0 1 6-6zm4 44h40l-12-16-10 12-6-8z" fill="#555"/>` +
+	`</svg>`
+
+var (
+	placeholderOnce        sync.Once
+	placeholderContent     []byte
+	placeholderContentType string
+)
+
+// ThumbnailPlaceholder 获取占位图内容和类型，配置的文件读取失败时使用内置占位图
+func ThumbnailPlaceholder() ([]byte, string) {
+	placeholderOnce.Do(func() {
+		placeholderContent = []byte(defaultThumbnailPlaceholder)
+		placeholderContentType = "image/svg+xml"
+
+		path := config.Settings.ThumbnailPlaceholder
+		if path == "" {
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("[Cache] 读取占位图失败，使用内置占位图: %v", err)
+			return
+		}
+		placeholderContent = content
+		placeholderContentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+		if placeholderContentType == "" {
+			placeholderContentType = http.DetectContentType(content)
+		}
+	})
+	return placeholderContent, placeholderContentType
+}
+
+// getThumbnailFailedPath 获取封面图失败标记路径，标记内容为失败的图片地址
+func (v *VideoCacheService) getThumbnailFailedPath(viewkey string) string {
+	return filepath.Join(v.cacheDir, viewkey+".jpg.failed")
+}
+
+// thumbnailFailed 封面图是否已确认无法获取
+// 只有同一图片地址的标记在 THUMBNAIL_FAILURE_TTL 内有效，过期或地址变化时删除标记重新下载
+func (v *VideoCacheService) thumbnailFailed(viewkey, thumbnailURL string) bool {
+	if !ValidViewkey(viewkey) {
+		return false
+	}
+	markerPath := v.getThumbnailFailedPath(viewkey)
+	info, err := os.Stat(markerPath)
+	if err != nil {
+		return false
+	}
+
+	ttl := time.Duration(config.Settings.ThumbnailFailureTTL) * time.Second
+	content, err := os.ReadFile(markerPath)
+	if err == nil && ttl > 0 && time.Since(info.ModTime()) < ttl && strings.TrimSpace(string(content)) == thumbnailURL {
+		return true
+	}
+	os.Remove(markerPath)
+	return false
+}
+
+// markThumbnailFailed 记录封面图无法获取，未启用视频缓存或 THUMBNAIL_FAILURE_TTL 为0时不记录
+func (v *VideoCacheService) markThumbnailFailed(viewkey, thumbnailURL string) {
+	cfg := config.Settings
+	if !cfg.VideoCacheEnabled || cfg.ThumbnailFailureTTL <= 0 || !ValidViewkey(viewkey) {
+		return
+	}
+	os.MkdirAll(v.cacheDir, 0755)
+	if err := os.WriteFile(v.getThumbnailFailedPath(viewkey), []byte(thumbnailURL+"\n"), 0644); err != nil {
+		log.Printf("[Cache] 写入封面图失败标记失败 %s: %v", viewkey, err)
+		return
+	}
+	log.Printf("[Cache] 封面图不可用，%d秒内不再重试: %s", cfg.ThumbnailFailureTTL, viewkey)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"backend-go/models"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxUpstreamHosts 未配置白名单时记住的上游主机数上限，超出时淘汰最早记录的
+const maxUpstreamHosts = 512
+
+// upstreamHosts 未配置 PROXY_ALLOWED_HOSTS 时允许代理的CDN主机：从目标网站抓取到的视频、封面图、字幕地址
+// 以及上游播放列表中出现的主机，按记录顺序淘汰
+var upstreamHosts = struct {
+	sync.Mutex
+	order []string
+	set   map[string]bool
+}{set: make(map[string]bool)}
+
+// RememberUpstreamHosts 记录抓取结果或上游播放列表中出现的主机，未配置白名单时允许代理这些主机
+func RememberUpstreamHosts(urls ...string) {
+	upstreamHosts.Lock()
+	defer upstreamHosts.Unlock()
+	for _, raw := range urls {
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+		if upstreamHosts.set[host] {
+			continue
+		}
+		if len(upstreamHosts.order) >= maxUpstreamHosts {
+			delete(upstreamHosts.set, upstreamHosts.order[0])
+			upstreamHosts.order = upstreamHosts.order[1:]
+		}
+		upstreamHosts.order = append(upstreamHosts.order, host)
+		upstreamHosts.set[host] = true
+	}
+}
+
+// rememberDetailHosts 记录视频详情中视频、封面图和字幕所在的主机
+func rememberDetailHosts(detail *models.VideoDetail) {
+	if detail == nil {
+		return
+	}
+	urls := []string{detail.M3u8URL, detail.Mp4URL, detail.Thumbnail}
+	for _, sub := range detail.Subtitles {
+		urls = append(urls, sub.URL)
+	}
+	RememberUpstreamHosts(urls...)
+}
+
+// isUpstreamHost 主机是否为已记录的上游主机
+func isUpstreamHost(host string) bool {
+	upstreamHosts.Lock()
+	defer upstreamHosts.Unlock()
+	return upstreamHosts.set[strings.ToLower(host)]
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// 常见CDN签名中表示过期时间的查询参数（Unix时间戳）
+	expiryParams = []string{"e", "expires", "expire", "exp", "expiry", "validto", "deadline"}
+	// Akamai 等在单个token参数中携带 exp=时间戳
+	tokenExpiryRe = regexp.MustCompile(`(?:^|[~&,;])exp=(\d{10,13})`)
+)
+
+// URLExpiry 从签名URL中解析过期时间，无法识别时返回false
+// 依次查找 e/expires/exp 等参数，以及 hdnts=exp=...~ 形式的token，毫秒时间戳会自动换算
+func URLExpiry(rawURL string) (time.Time, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	query := make(url.Values)
+	for key, values := range parsed.Query() {
+		query[strings.ToLower(key)] = values
+	}
+
+	for _, key := range expiryParams {
+		if expiry, ok := parseUnixTimestamp(query.Get(key)); ok {
+			return expiry, true
+		}
+	}
+
+	for _, values := range query {
+		for _, value := range values {
+			if matches := tokenExpiryRe.FindStringSubmatch(value); matches != nil {
+				if expiry, ok := parseUnixTimestamp(matches[1]); ok {
+					return expiry, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseUnixTimestamp 解析秒或毫秒级Unix时间戳，过滤明显不是时间戳的值
+func parseUnixTimestamp(value string) (time.Time, bool) {
+	if len(value) != 10 && len(value) != 13 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	if len(value) == 13 {
+		return time.UnixMilli(n), true
+	}
+	return time.Unix(n, 0), true
+}
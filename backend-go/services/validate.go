@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrInvalidPath 参数不合法或路径超出缓存目录
+	ErrInvalidPath = errors.New("无效的路径")
+
+	viewkeyPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	// 缓存分片名：序号或 init 加扩展名（见 downloadM3u8Video）
+	segmentNamePattern = regexp.MustCompile(`^(\d+|init)\.[a-z0-9]{1,5}$`)
+)
+
+// ValidViewkey 检查 viewkey 是否只包含字母和数字
+func ValidViewkey(viewkey string) bool {
+	return viewkeyPattern.MatchString(viewkey)
+}
+
+// ValidSegmentName 检查缓存分片名是否合法（如 0.ts、12.m4s、init.mp4）
+func ValidSegmentName(name string) bool {
+	return segmentNamePattern.MatchString(name)
+}
+
+// withinDir 检查 target 是否位于 dir 之内（不含 dir 本身）
+func withinDir(dir, target string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(target))
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -3,37 +3,86 @@ package services
 import (
 	"backend-go/config"
 	"backend-go/models"
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+var (
+	// MapURIRe 匹配 #EXT-X-MAP 等标签中的 URI 属性（初始化分片地址）
+	MapURIRe = regexp.MustCompile(`URI="([^"]+)"`)
+	// segmentExtRe 允许保留的分片扩展名格式
+	segmentExtRe = regexp.MustCompile(`^\.[a-z0-9]{1,5}$`)
+)
+
+// partialPlaylist 下载中视频已就绪部分的本地播放列表
+type partialPlaylist struct {
+	lines    []string
+	segments int
+	entries  []manifestEntry
+	// 所有分片的本地文件名 -> 原始地址，尚未下载的分片被请求时从上游获取
+	sources map[string]string
+	// 包含全部分片的本地播放列表，开启 SEGMENT_MISS_UPSTREAM 时直接返回，未下载的分片从上游获取
+	full []string
+}
+
+// thumbnailFetch 进行中的封面图下载，同一图片地址的并发请求共享结果
+type thumbnailFetch struct {
+	done        chan struct{}
+	content     []byte
+	contentType string
+	err         error
+}
+
 // VideoCacheService 视频本地缓存服务
 type VideoCacheService struct {
 	downloadTasks    map[string]chan struct{}
-	downloadProgress map[string]map[string]interface{}
+	downloadQueue    *downloadQueue
+	downloadProgress map[string]*models.DownloadProgress
+	partialM3u8      map[string]*partialPlaylist
+	thumbFetches     map[string]*thumbnailFetch
+	thumbSem         chan struct{}
+	thumbMemory      *segmentCache
+	listAccess       map[int]time.Time
 	client           *http.Client
+	thumbClient      *http.Client
 	cacheDir         string
 	mu               sync.RWMutex
 }
 
 // NewVideoCacheService 创建缓存服务实例
 func NewVideoCacheService() *VideoCacheService {
-	cacheDir := "cache/videos"
+	cacheDir := CacheNamespaceDir()
+	imageConcurrent := 6
 	if config.Settings != nil {
-		cacheDir = config.Settings.VideoCacheDir
+		if config.Settings.ImageProxyConcurrent > 0 {
+			imageConcurrent = config.Settings.ImageProxyConcurrent
+		}
 	}
 	return &VideoCacheService{
 		downloadTasks:    make(map[string]chan struct{}),
-		downloadProgress: make(map[string]map[string]interface{}),
+		downloadQueue:    newDownloadQueue(),
+		downloadProgress: make(map[string]*models.DownloadProgress),
+		partialM3u8:      make(map[string]*partialPlaylist),
+		thumbFetches:     make(map[string]*thumbnailFetch),
+		thumbSem:         make(chan struct{}, imageConcurrent),
+		thumbMemory:      newSegmentCache(),
+		listAccess:       make(map[int]time.Time),
 		client: &http.Client{
 			Timeout: 300 * time.Second,
 			Transport: &http.Transport{
@@ -41,7 +90,9 @@ func NewVideoCacheService() *VideoCacheService {
 				MaxIdleConnsPerHost: 10,
 			},
 		},
-		cacheDir: cacheDir,
+		// 开启 THUMBNAIL_HOST_CHECK 时下载封面图使用，只连接公网地址
+		thumbClient: newPublicOnlyClient(300 * time.Second),
+		cacheDir:    cacheDir,
 	}
 }
 
@@ -60,11 +111,21 @@ func (v *VideoCacheService) getMp4CachePath(viewkey string) string {
 	return filepath.Join(v.cacheDir, viewkey+".mp4")
 }
 
+// getMp4TempPath 获取MP4下载中的临时文件路径
+func (v *VideoCacheService) getMp4TempPath(viewkey string) string {
+	return filepath.Join(v.cacheDir, viewkey+".mp4.tmp")
+}
+
 // getThumbnailCachePath 获取封面图缓存路径
 func (v *VideoCacheService) getThumbnailCachePath(viewkey string) string {
 	return filepath.Join(v.cacheDir, viewkey+".jpg")
 }
 
+// getSubtitleCachePath 获取字幕缓存路径
+func (v *VideoCacheService) getSubtitleCachePath(viewkey string, index int) string {
+	return filepath.Join(v.cacheDir, fmt.Sprintf("%s.sub%d.vtt", viewkey, index))
+}
+
 // getListCachePath 获取列表缓存路径
 func (v *VideoCacheService) getListCachePath(page int) string {
 	return filepath.Join(v.cacheDir, fmt.Sprintf("list_page_%d.json", page))
@@ -104,11 +165,115 @@ func (v *VideoCacheService) IsDownloading(viewkey string) bool {
 	return exists
 }
 
-// GetDownloadProgress 获取下载进度
-func (v *VideoCacheService) GetDownloadProgress(viewkey string) map[string]interface{} {
+// GetDownloadProgress 获取下载进度的副本，没有进度记录时返回false
+func (v *VideoCacheService) GetDownloadProgress(viewkey string) (models.DownloadProgress, bool) {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
-	return v.downloadProgress[viewkey]
+	progress, ok := v.downloadProgress[viewkey]
+	if !ok {
+		return models.DownloadProgress{}, false
+	}
+	return *progress, true
+}
+
+// progressSnapshotLocked 复制进度（调用方需持有 mu），避免在锁外读取下载协程正在修改的进度
+func (v *VideoCacheService) progressSnapshotLocked(viewkey string) *models.DownloadProgress {
+	progress, ok := v.downloadProgress[viewkey]
+	if !ok {
+		return nil
+	}
+	snapshot := *progress
+	return &snapshot
+}
+
+// setProgress 设置下载进度
+func (v *VideoCacheService) setProgress(viewkey string, progress models.DownloadProgress) {
+	v.mu.Lock()
+	v.downloadProgress[viewkey] = &progress
+	v.mu.Unlock()
+}
+
+// updateProgress 在锁内修改下载进度，没有进度记录时忽略
+func (v *VideoCacheService) updateProgress(viewkey string, update func(progress *models.DownloadProgress)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if progress, ok := v.downloadProgress[viewkey]; ok {
+		update(progress)
+	}
+}
+
+// ListDownloads 列出所有进行中的下载任务及其进度、速度和预计剩余时间
+func (v *VideoCacheService) ListDownloads() []models.DownloadInfo {
+	v.mu.RLock()
+	snapshots := make(map[string]*models.DownloadProgress, len(v.downloadTasks))
+	for viewkey := range v.downloadTasks {
+		snapshots[viewkey] = v.progressSnapshotLocked(viewkey)
+	}
+	v.mu.RUnlock()
+
+	now := time.Now()
+	downloads := make([]models.DownloadInfo, 0, len(snapshots))
+	for viewkey, progress := range snapshots {
+		downloads = append(downloads, v.queuedDownloadInfo(downloadInfo(viewkey, progress, now)))
+	}
+
+	sort.Slice(downloads, func(i, j int) bool {
+		if downloads[i].StartedAt != downloads[j].StartedAt {
+			return downloads[i].StartedAt < downloads[j].StartedAt
+		}
+		return downloads[i].Viewkey < downloads[j].Viewkey
+	})
+	return downloads
+}
+
+// GetDownloadInfo 获取单个进行中下载任务的进度，未在下载时返回false
+func (v *VideoCacheService) GetDownloadInfo(viewkey string) (models.DownloadInfo, bool) {
+	v.mu.RLock()
+	_, ok := v.downloadTasks[viewkey]
+	progress := v.progressSnapshotLocked(viewkey)
+	v.mu.RUnlock()
+
+	if !ok {
+		return models.DownloadInfo{}, false
+	}
+	return v.queuedDownloadInfo(downloadInfo(viewkey, progress, time.Now())), true
+}
+
+// queuedDownloadInfo 补充下载任务的优先级，仍在等待下载槽位时状态为 queued
+func (v *VideoCacheService) queuedDownloadInfo(info models.DownloadInfo) models.DownloadInfo {
+	if priority, waiting, ok := v.downloadQueue.state(info.Viewkey); ok {
+		info.Priority = priority.String()
+		if waiting {
+			info.Status = "queued"
+		}
+	}
+	return info
+}
+
+// downloadInfo 根据进度计算下载速度和预计剩余时间
+func downloadInfo(viewkey string, progress *models.DownloadProgress, now time.Time) models.DownloadInfo {
+	info := models.DownloadInfo{Viewkey: viewkey, Status: "pending", ETA: -1}
+	if progress == nil {
+		return info
+	}
+
+	info.Type = progress.Type
+	info.Status = progress.Status
+	info.Downloaded = progress.Downloaded
+	info.Total = progress.Total
+	info.Bytes = progress.Bytes
+
+	if startedAt := progress.StartedAt; !startedAt.IsZero() {
+		info.StartedAt = startedAt.Format(time.RFC3339)
+		if elapsed := now.Sub(startedAt).Seconds(); elapsed > 0 {
+			info.Speed = float64(info.Bytes) / elapsed
+			// 按已完成比例估算剩余时间（MP4 为字节数，M3U8 为分片数）
+			if info.Downloaded > 0 && info.Total > info.Downloaded {
+				info.ETA = int(elapsed * float64(info.Total-info.Downloaded) / float64(info.Downloaded))
+			}
+		}
+	}
+	return info
 }
 
 // GetCachedM3u8 获取缓存的m3u8内容
@@ -116,7 +281,7 @@ func (v *VideoCacheService) GetCachedM3u8(viewkey string) (string, error) {
 	cacheDir := v.getVideoCacheDir(viewkey)
 	m3u8Path := filepath.Join(cacheDir, "video.m3u8")
 
-	content, err := os.ReadFile(m3u8Path)
+	content, err := readMetadata(m3u8Path)
 	if err != nil {
 		return "", err
 	}
@@ -124,14 +289,95 @@ func (v *VideoCacheService) GetCachedM3u8(viewkey string) (string, error) {
 	return string(content), nil
 }
 
+// GetPartialM3u8 获取下载中视频的播放列表
+// 开启 SEGMENT_MISS_UPSTREAM 时返回包含全部分片的点播列表（带 #EXT-X-ENDLIST，可直接拖动，未下载的分片从上游获取），
+// 否则返回已就绪分片组成的直播列表（不含 #EXT-X-ENDLIST）
+func (v *VideoCacheService) GetPartialM3u8(viewkey string, minSegments int) (string, bool) {
+	v.mu.RLock()
+	partial, ok := v.partialM3u8[viewkey]
+	if ok && config.Settings.SegmentMissUpstream && len(partial.full) > 0 {
+		lines := append([]string(nil), partial.full...)
+		v.mu.RUnlock()
+		return vodPlaylist(lines), true
+	}
+	if !ok || partial.segments == 0 || partial.segments < minSegments {
+		v.mu.RUnlock()
+		return "", false
+	}
+	lines := append([]string(nil), partial.lines...)
+	v.mu.RUnlock()
+
+	var result []string
+	for _, line := range lines {
+		if line == "#EXT-X-ENDLIST" || strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE") {
+			continue
+		}
+		result = append(result, line)
+		// 标记为仅追加的直播列表，播放器会定期刷新
+		if line == "#EXTM3U" {
+			result = append(result, "#EXT-X-PLAYLIST-TYPE:EVENT")
+		}
+	}
+	return strings.Join(result, "\n"), true
+}
+
+// vodPlaylist 将本地播放列表标记为点播列表，确保以 #EXT-X-ENDLIST 结尾
+func vodPlaylist(lines []string) string {
+	var result []string
+	ended := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE") {
+			continue
+		}
+		if line == "#EXT-X-ENDLIST" {
+			ended = true
+		}
+		result = append(result, line)
+		if line == "#EXTM3U" {
+			result = append(result, "#EXT-X-PLAYLIST-TYPE:VOD")
+		}
+	}
+	if !ended {
+		result = append(result, "#EXT-X-ENDLIST")
+	}
+	return strings.Join(result, "\n")
+}
+
 // GetCachedSegment 获取缓存的分片
 func (v *VideoCacheService) GetCachedSegment(viewkey, segmentName string) ([]byte, error) {
+	if !ValidViewkey(viewkey) || !ValidSegmentName(segmentName) {
+		return nil, ErrInvalidPath
+	}
 	cacheDir := v.getVideoCacheDir(viewkey)
 	segmentPath := filepath.Join(cacheDir, segmentName)
+	if !withinDir(cacheDir, segmentPath) || !withinDir(v.cacheDir, cacheDir) {
+		return nil, ErrInvalidPath
+	}
 
 	return os.ReadFile(segmentPath)
 }
 
+// GetCachedSubtitlePath 获取缓存的字幕路径，不存在时返回空字符串
+func (v *VideoCacheService) GetCachedSubtitlePath(viewkey string, index int) string {
+	if !ValidViewkey(viewkey) {
+		return ""
+	}
+	subPath := v.getSubtitleCachePath(viewkey, index)
+	if _, err := os.Stat(subPath); err == nil {
+		return subPath
+	}
+	return ""
+}
+
+// downloadSubtitles 下载视频的字幕文件
+func (v *VideoCacheService) downloadSubtitles(viewkey string, detail *models.VideoDetail) {
+	for i, sub := range detail.Subtitles {
+		if !v.downloadSegment(sub.URL, v.getSubtitleCachePath(viewkey, i)) {
+			log.Printf("[Cache] %s: 字幕下载失败: %s", viewkey, sub.URL)
+		}
+	}
+}
+
 // GetCachedMp4Path 获取缓存的MP4路径
 func (v *VideoCacheService) GetCachedMp4Path(viewkey string) string {
 	mp4Path := v.getMp4CachePath(viewkey)
@@ -143,6 +389,9 @@ func (v *VideoCacheService) GetCachedMp4Path(viewkey string) string {
 
 // GetCachedThumbnailPath 获取缓存的封面图路径
 func (v *VideoCacheService) GetCachedThumbnailPath(viewkey string) string {
+	if !ValidViewkey(viewkey) {
+		return ""
+	}
 	thumbPath := v.getThumbnailCachePath(viewkey)
 	if _, err := os.Stat(thumbPath); err == nil {
 		return thumbPath
@@ -155,44 +404,134 @@ func (v *VideoCacheService) DownloadThumbnail(viewkey, thumbnailURL string) bool
 	if thumbnailURL == "" {
 		return false
 	}
+	if v.GetCachedThumbnailPath(viewkey) != "" {
+		return true
+	}
 
-	os.MkdirAll(v.cacheDir, 0755)
-	thumbPath := v.getThumbnailCachePath(viewkey)
+	_, _, err := v.FetchThumbnail(viewkey, thumbnailURL)
+	return err == nil
+}
 
-	if _, err := os.Stat(thumbPath); err == nil {
-		return true
+// FetchThumbnail 获取封面图内容，启用视频缓存时同时写入本地
+// 同一图片地址的并发请求合并为一次下载，结果在内存中短暂缓存（IMAGE_MEMORY_CACHE_TTL），
+// 总并发数受 IMAGE_PROXY_CONCURRENT 限制；已确认无法获取的封面图直接返回 ErrThumbnailUnavailable
+func (v *VideoCacheService) FetchThumbnail(viewkey, thumbnailURL string) ([]byte, string, error) {
+	if v.thumbnailFailed(viewkey, thumbnailURL) {
+		return nil, "", ErrThumbnailUnavailable
 	}
+	if content, contentType, ok := v.thumbMemory.get(thumbnailURL); ok {
+		v.saveThumbnail(viewkey, content)
+		return content, contentType, nil
+	}
+
+	v.mu.Lock()
+	fetch, ok := v.thumbFetches[thumbnailURL]
+	if !ok {
+		fetch = &thumbnailFetch{done: make(chan struct{})}
+		v.thumbFetches[thumbnailURL] = fetch
+	}
+	v.mu.Unlock()
+
+	if ok {
+		<-fetch.done
+	} else {
+		v.thumbSem <- struct{}{}
+		fetch.content, fetch.contentType, fetch.err = v.fetchThumbnail(viewkey, thumbnailURL)
+		<-v.thumbSem
+
+		if fetch.err == nil {
+			cfg := config.Settings
+			v.thumbMemory.put(thumbnailURL, fetch.content, fetch.contentType,
+				time.Duration(cfg.ImageMemoryCacheTTL)*time.Second, int64(cfg.ImageMemoryCacheMB)*1024*1024)
+		} else if errors.Is(fetch.err, ErrThumbnailUnavailable) {
+			// 网络错误和 5xx 可能是暂时的，不记录
+			v.markThumbnailFailed(viewkey, thumbnailURL)
+		}
+
+		v.mu.Lock()
+		delete(v.thumbFetches, thumbnailURL)
+		v.mu.Unlock()
+		close(fetch.done)
+	}
+
+	if fetch.err != nil {
+		return nil, "", fetch.err
+	}
+	v.saveThumbnail(viewkey, fetch.content)
+	return fetch.content, fetch.contentType, nil
+}
+
+// CacheWritesEnabled 是否允许写入封面图、列表和详情缓存：纯代理模式或关闭视频缓存时不落盘
+func CacheWritesEnabled() bool {
+	return !config.Settings.PureProxy && config.Settings.VideoCacheEnabled
+}
 
+// saveThumbnail 启用视频缓存且本地没有封面图时写入缓存
+func (v *VideoCacheService) saveThumbnail(viewkey string, content []byte) {
+	if !CacheWritesEnabled() || v.GetCachedThumbnailPath(viewkey) != "" {
+		return
+	}
+
+	// 先写独立的临时文件再重命名，避免返回未写完的图片，同一视频的并发写入互不干扰
+	os.MkdirAll(v.cacheDir, 0755)
+	tmp, err := os.CreateTemp(v.cacheDir, viewkey+".jpg.*.part")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(content)
+	tmp.Close()
+	if err == nil {
+		os.Chmod(tmp.Name(), 0644)
+		err = os.Rename(tmp.Name(), v.getThumbnailCachePath(viewkey))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	log.Printf("[Cache] 已缓存封面图: %s", viewkey)
+}
+
+// fetchThumbnail 从上游下载封面图
+func (v *VideoCacheService) fetchThumbnail(viewkey, thumbnailURL string) ([]byte, string, error) {
 	req, err := http.NewRequest("GET", thumbnailURL, nil)
 	if err != nil {
-		return false
+		return nil, "", err
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", config.Settings.TargetBaseURL)
+	SetAcceptLanguage(req)
+	req.Header.Set("Referer", TargetBaseURL())
 
-	resp, err := v.client.Do(req)
+	client := v.client
+	if config.Settings.ThumbnailHostCheck {
+		client = v.thumbClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("[Cache] 下载封面图失败 %s: %v", viewkey, err)
-		return false
+		return nil, "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false
+		// 只有 404/410 表示图片确实不存在；401/403 可能是防盗链或验证页面，不标记为永久失败
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+			return nil, "", fmt.Errorf("%w: %d", ErrThumbnailUnavailable, resp.StatusCode)
+		}
+		return nil, "", fmt.Errorf("获取封面图失败: %d", resp.StatusCode)
 	}
 
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false
+		return nil, "", err
 	}
 
-	if err := os.WriteFile(thumbPath, content, 0644); err != nil {
-		return false
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
 	}
 
-	log.Printf("[Cache] 已缓存封面图: %s", viewkey)
-	return true
+	return content, contentType, nil
 }
 
 // GetCachedList 获取缓存的视频列表
@@ -221,13 +560,26 @@ func (v *VideoCacheService) GetCachedList(page int, maxAge int) (map[string]inte
 	if err := json.Unmarshal(content, &data); err != nil {
 		return nil, err
 	}
+	v.touchListCache(page)
 
 	log.Printf("[Cache] 读取列表缓存: 第%d页", page)
 	return data, nil
 }
 
-// SaveListCache 保存视频列表到缓存
+// GetListCacheModTime 获取列表缓存的最后更新时间
+func (v *VideoCacheService) GetListCacheModTime(page int) (time.Time, error) {
+	info, err := os.Stat(v.getListCachePath(page))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// SaveListCache 保存视频列表到缓存，纯代理模式或关闭视频缓存时不保存
 func (v *VideoCacheService) SaveListCache(page int, data map[string]interface{}) error {
+	if !CacheWritesEnabled() {
+		return nil
+	}
 	os.MkdirAll(v.cacheDir, 0755)
 	listPath := v.getListCachePath(page)
 
@@ -239,8 +591,10 @@ func (v *VideoCacheService) SaveListCache(page int, data map[string]interface{})
 	if err := os.WriteFile(listPath, content, 0644); err != nil {
 		return err
 	}
+	v.touchListCache(page)
 
 	log.Printf("[Cache] 已保存列表缓存: 第%d页", page)
+	v.pruneListCache()
 	return nil
 }
 
@@ -255,6 +609,9 @@ func (v *VideoCacheService) getDetailPath(viewkey string) string {
 
 // GetCachedDetail 获取缓存的视频详情
 func (v *VideoCacheService) GetCachedDetail(viewkey string) (*models.VideoDetail, error) {
+	if !ValidViewkey(viewkey) {
+		return nil, ErrInvalidPath
+	}
 	// 检查M3U8格式的详情
 	cacheDir := v.getVideoCacheDir(viewkey)
 	detailPath := filepath.Join(cacheDir, "detail.json")
@@ -263,7 +620,7 @@ func (v *VideoCacheService) GetCachedDetail(viewkey string) (*models.VideoDetail
 		detailPath = filepath.Join(v.cacheDir, viewkey+".detail.json")
 	}
 
-	content, err := os.ReadFile(detailPath)
+	content, err := readMetadata(detailPath)
 	if err != nil {
 		return nil, err
 	}
@@ -272,12 +629,30 @@ func (v *VideoCacheService) GetCachedDetail(viewkey string) (*models.VideoDetail
 	if err := json.Unmarshal(content, &detail); err != nil {
 		return nil, err
 	}
+	// 重启后从保存的详情恢复允许代理的上游主机
+	rememberDetailHosts(&detail)
 
 	return &detail, nil
 }
 
-// SaveDetail 保存视频详情到缓存
+// GetCachedDetailModTime 获取详情缓存的最后更新时间
+func (v *VideoCacheService) GetCachedDetailModTime(viewkey string) (time.Time, error) {
+	detailPath := filepath.Join(v.getVideoCacheDir(viewkey), "detail.json")
+	info, err := os.Stat(detailPath)
+	if os.IsNotExist(err) {
+		info, err = os.Stat(filepath.Join(v.cacheDir, viewkey+".detail.json"))
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// SaveDetail 保存视频详情到缓存，纯代理模式或关闭视频缓存时不保存
 func (v *VideoCacheService) SaveDetail(viewkey string, detail *models.VideoDetail) error {
+	if !CacheWritesEnabled() {
+		return nil
+	}
 	var detailPath string
 	cacheDir := v.getVideoCacheDir(viewkey)
 	if _, err := os.Stat(cacheDir); err == nil {
@@ -291,49 +666,78 @@ func (v *VideoCacheService) SaveDetail(viewkey string, detail *models.VideoDetai
 	if err != nil {
 		return err
 	}
+	if content, err = encodeMetadata(content); err != nil {
+		return err
+	}
 
 	if err := os.WriteFile(detailPath, content, 0644); err != nil {
 		return err
 	}
+	// 标签记录到数据库，按标签浏览时只统计已缓存的视频；未缓存视频的详情（DETAIL_STALE_WINDOW）不记录
+	if len(detail.Tags) > 0 && v.IsCached(viewkey) {
+		if err := GetCacheDBService().SetVideoTags(viewkey, detail.Tags); err != nil {
+			log.Printf("[Cache] 保存标签失败 %s: %v", viewkey, err)
+		}
+	}
 
 	log.Printf("[Cache] 已保存详情: %s", viewkey)
 	return nil
 }
 
-// StartCacheDownload 启动后台下载任务（M3U8格式）
-func (v *VideoCacheService) StartCacheDownload(viewkey, m3u8URL, m3u8Content string, detail *models.VideoDetail) {
+// StartCacheDownload 启动后台下载任务（M3U8格式），并发下载数已满时按优先级排队
+// 已在下载时只提高其优先级
+func (v *VideoCacheService) StartCacheDownload(viewkey, m3u8URL, m3u8Content string, detail *models.VideoDetail, priority DownloadPriority) {
 	if !config.Settings.VideoCacheEnabled {
 		return
 	}
 
-	if v.IsCached(viewkey) || v.IsDownloading(viewkey) {
+	stopChan, ok := v.claimDownload(viewkey, priority)
+	if !ok {
 		return
 	}
 
-	v.mu.Lock()
-	stopChan := make(chan struct{})
-	v.downloadTasks[viewkey] = stopChan
-	v.mu.Unlock()
-
-	go v.downloadM3u8Video(viewkey, m3u8URL, m3u8Content, detail, stopChan)
+	go func() {
+		v.downloadQueue.acquire(viewkey, priority)
+		defer v.downloadQueue.release(viewkey)
+		v.downloadM3u8Video(viewkey, m3u8URL, m3u8Content, detail, stopChan)
+	}()
 }
 
-// StartMp4CacheDownload 启动后台下载任务（MP4格式）
-func (v *VideoCacheService) StartMp4CacheDownload(viewkey, mp4URL string, detail *models.VideoDetail) {
+// StartMp4CacheDownload 启动后台下载任务（MP4格式），并发下载数已满时按优先级排队
+// 已在下载时只提高其优先级
+func (v *VideoCacheService) StartMp4CacheDownload(viewkey, mp4URL string, detail *models.VideoDetail, priority DownloadPriority) {
 	if !config.Settings.VideoCacheEnabled {
 		return
 	}
 
-	if v.IsCached(viewkey) || v.IsDownloading(viewkey) {
+	stopChan, ok := v.claimDownload(viewkey, priority)
+	if !ok {
 		return
 	}
 
+	go func() {
+		v.downloadQueue.acquire(viewkey, priority)
+		defer v.downloadQueue.release(viewkey)
+		v.downloadMp4Video(viewkey, mp4URL, detail, stopChan)
+	}()
+}
+
+// claimDownload 占用视频的下载任务；已缓存或已在下载时返回false，后者同时提高排队中任务的优先级
+func (v *VideoCacheService) claimDownload(viewkey string, priority DownloadPriority) (chan struct{}, bool) {
+	if v.IsCached(viewkey) {
+		return nil, false
+	}
+
 	v.mu.Lock()
+	if _, exists := v.downloadTasks[viewkey]; exists {
+		v.mu.Unlock()
+		v.downloadQueue.promote(viewkey, priority)
+		return nil, false
+	}
 	stopChan := make(chan struct{})
 	v.downloadTasks[viewkey] = stopChan
 	v.mu.Unlock()
-
-	go v.downloadMp4Video(viewkey, mp4URL, detail, stopChan)
+	return stopChan, true
 }
 
 // downloadM3u8Video 下载M3U8视频的所有分片
@@ -341,9 +745,17 @@ func (v *VideoCacheService) downloadM3u8Video(viewkey, m3u8URL, m3u8Content stri
 	defer func() {
 		v.mu.Lock()
 		delete(v.downloadTasks, viewkey)
+		delete(v.partialM3u8, viewkey)
 		v.mu.Unlock()
 	}()
 
+	// 解析m3u8获取分片URL列表，超出可缓存的时长或分片数时不缓存
+	segments := v.parseM3u8Segments(m3u8Content, m3u8URL)
+	if reason := m3u8OverLimit(m3u8Content, len(segments)); reason != "" {
+		v.setTooLarge(viewkey, "m3u8", reason)
+		return
+	}
+
 	log.Printf("[Cache] 开始下载视频: %s", viewkey)
 	cacheDir := v.ensureCacheDir(viewkey)
 
@@ -352,103 +764,176 @@ func (v *VideoCacheService) downloadM3u8Video(viewkey, m3u8URL, m3u8Content stri
 		v.DownloadThumbnail(viewkey, detail.Thumbnail)
 	}
 
-	// 解析m3u8获取分片URL列表
-	segments := v.parseM3u8Segments(m3u8Content, m3u8URL)
+	v.setProgress(viewkey, models.DownloadProgress{
+		Type:      "m3u8",
+		Status:    "downloading",
+		Total:     int64(len(segments)),
+		StartedAt: time.Now(),
+	})
 
-	v.mu.Lock()
-	v.downloadProgress[viewkey] = map[string]interface{}{
-		"total":      len(segments),
-		"downloaded": 0,
-		"status":     "downloading",
+	// 上次中断的下载留下的分片在来源不变时直接使用，从第一个缺失的分片继续
+	planned := v.planSegmentEntries(m3u8Content, m3u8URL, segments)
+	if stored := reuseStoredSegments(cacheDir, planned); stored > 0 {
+		log.Printf("[Cache] %s: 已有 %d/%d 个分片，继续下载缺失的分片", viewkey, stored, len(planned))
+	}
+	// 开始下载前写入本次的分片清单，再次中断后据此判断已下载的分片能否继续使用
+	if err := saveSegmentManifest(cacheDir, planned); err != nil {
+		log.Printf("[Cache] %s: 保存分片清单失败: %v", viewkey, err)
+	}
+	sources := make(map[string]string, len(planned))
+	for _, entry := range planned {
+		sources[entry.Local] = entry.Original
 	}
-	v.mu.Unlock()
 
-	var localM3u8Lines []string
-	segmentIndex := 0
+	// 本地播放列表和边下边播的列表都由分片清单生成，与清单中的本地文件名一致
+	localM3u8Lines := localPlaylistLines(m3u8Content, planned)
+	// 已处理的媒体分片数
+	downloaded := 0
+	// 连续下载失败的分片数，达到 HLS_SEGMENT_FAILURE_LIMIT 时放弃
+	failures := 0
+	// 边下边播：只发布连续下载成功的分片
+	partialBroken := false
+	v.mu.Lock()
+	v.partialM3u8[viewkey] = &partialPlaylist{sources: sources, full: localM3u8Lines}
+	v.mu.Unlock()
 
-	for _, line := range strings.Split(m3u8Content, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			localM3u8Lines = append(localM3u8Lines, line)
-			continue
+	for i, entry := range planned {
+		// 下载分片（上次下载或播放时已保存的分片直接使用）
+		entryPath := filepath.Join(cacheDir, entry.Local)
+		saved := segmentStored(entryPath)
+		if !saved {
+			saved = v.downloadSegment(entry.Original, entryPath)
+			if saved && !entry.Init {
+				log.Printf("[Cache] %s: 已下载分片 %d/%d", viewkey, downloaded+1, len(segments))
+			}
 		}
 
-		if strings.HasPrefix(line, "#") {
-			localM3u8Lines = append(localM3u8Lines, line)
+		// fMP4 初始化分片
+		if entry.Init {
+			if !saved {
+				log.Printf("[Cache] %s: 初始化分片下载失败", viewkey)
+				partialBroken = true
+			}
 			continue
 		}
+		downloaded++
 
-		// 这是一个分片URL
-		if segmentIndex >= len(segments) {
-			break
+		if !saved {
+			partialBroken = true
+			failures++
+		} else {
+			failures = 0
 		}
-
-		segmentURL := segments[segmentIndex]
-		segmentName := fmt.Sprintf("%d.ts", segmentIndex)
-
-		// 下载分片
-		req, err := http.NewRequest("GET", segmentURL, nil)
-		if err == nil {
-			req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-			req.Header.Set("Referer", config.Settings.TargetBaseURL)
-
-			resp, err := v.client.Do(req)
-			if err == nil && resp.StatusCode == http.StatusOK {
-				content, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
-
-				segmentPath := filepath.Join(cacheDir, segmentName)
-				os.WriteFile(segmentPath, content, 0644)
-				log.Printf("[Cache] %s: 已下载分片 %d/%d", viewkey, segmentIndex+1, len(segments))
-			}
+		if limit := config.Settings.HlsSegmentFailureLimit; limit > 0 && failures >= limit {
+			v.abandonM3u8Download(viewkey, cacheDir, failures, detail)
+			return
 		}
 
-		localM3u8Lines = append(localM3u8Lines, segmentName)
-		segmentIndex++
+		var segmentSize int64
+		if info, err := os.Stat(entryPath); saved && err == nil {
+			segmentSize = info.Size()
+		}
 
 		v.mu.Lock()
-		v.downloadProgress[viewkey]["downloaded"] = segmentIndex
+		if progress, ok := v.downloadProgress[viewkey]; ok {
+			progress.Downloaded = int64(downloaded)
+			progress.Bytes += segmentSize
+		}
+		if !partialBroken {
+			v.partialM3u8[viewkey].lines = partialPlaylistLines(localM3u8Lines, downloaded)
+			v.partialM3u8[viewkey].segments = downloaded
+			v.partialM3u8[viewkey].entries = append([]manifestEntry(nil), planned[:i+1]...)
+		}
 		v.mu.Unlock()
 	}
 
-	// 保存本地m3u8
+	// 有分片未能下载时不标记完成，保留已下载的分片，下次缓存时从缺失的分片继续
+	if missing := missingSegments(cacheDir, planned); missing > 0 {
+		v.setDownloadError(viewkey, fmt.Errorf("%d 个分片未能下载，缓存未完成，下次缓存时继续", missing))
+		return
+	}
+
+	// 保存本地m3u8（分片和m3u8均已落盘后才写入完成标记）
 	m3u8Path := filepath.Join(cacheDir, "video.m3u8")
-	os.WriteFile(m3u8Path, []byte(strings.Join(localM3u8Lines, "\n")), 0644)
+	localM3u8, err := encodeMetadata([]byte(strings.Join(localM3u8Lines, "\n")))
+	if err == nil {
+		err = writeFileDurable(m3u8Path, localM3u8)
+	}
+	if err == nil {
+		err = saveSegmentManifest(cacheDir, planned)
+	}
+	if err != nil {
+		v.setDownloadError(viewkey, err)
+		return
+	}
+	syncDir(cacheDir)
 
 	// 创建完成标记
 	completeMarker := filepath.Join(cacheDir, ".complete")
-	os.WriteFile(completeMarker, []byte("complete"), 0644)
+	if err := writeFileDurable(completeMarker, []byte("complete")); err != nil {
+		v.setDownloadError(viewkey, err)
+		return
+	}
+	syncDir(cacheDir)
 
 	// 保存视频详情
 	if detail != nil {
 		v.SaveDetail(viewkey, detail)
+		v.downloadSubtitles(viewkey, detail)
 	}
 
 	// 计算目录大小并写入数据库
 	size := v.getDirSize(cacheDir)
-	var title, thumbnail, originalURL string
+	var title, thumbnail, originalURL, resolution string
+	var duration int
 	if detail != nil {
 		title = detail.Title
 		thumbnail = detail.Thumbnail
 		originalURL = detail.OriginalURL
+		duration = detail.Duration
+		resolution = detail.Resolution
 	}
-	GetCacheDBService().AddCachedVideo(viewkey, title, "m3u8", size, thumbnail, originalURL)
+	GetCacheDBService().AddCachedVideo(viewkey, title, "m3u8", size, thumbnail, originalURL, duration, resolution)
+
+	v.updateProgress(viewkey, func(progress *models.DownloadProgress) {
+		progress.Status = "complete"
+	})
+
+	log.Printf("[Cache] 视频下载完成: %s", viewkey)
+}
 
+// abandonM3u8Download 分片连续下载失败时放弃 M3U8 缓存
+// 详情中有 MP4 地址时在同一下载任务中改为缓存 MP4，否则记录下载失败；已下载的分片保留到 MP4 缓存完成，
+// MP4 也失败时下次缓存仍可从缺失的分片继续
+func (v *VideoCacheService) abandonM3u8Download(viewkey, cacheDir string, failures int, detail *models.VideoDetail) {
 	v.mu.Lock()
-	v.downloadProgress[viewkey]["status"] = "complete"
+	delete(v.partialM3u8, viewkey)
 	v.mu.Unlock()
 
-	log.Printf("[Cache] 视频下载完成: %s", viewkey)
+	if detail == nil || detail.Mp4URL == "" {
+		v.setDownloadError(viewkey, fmt.Errorf("连续 %d 个分片下载失败，已放弃缓存", failures))
+		return
+	}
+
+	log.Printf("[Cache] %s: 连续 %d 个分片下载失败，改为缓存MP4", viewkey, failures)
+	v.fetchMp4Video(viewkey, detail.Mp4URL, detail, "m3u8")
+	if v.GetCachedMp4Path(viewkey) != "" {
+		os.RemoveAll(cacheDir)
+	}
 }
 
-// downloadMp4Video 下载MP4视频
+// downloadMp4Video 下载MP4视频，结束后移除下载任务
 func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *models.VideoDetail, stopChan chan struct{}) {
 	defer func() {
 		v.mu.Lock()
 		delete(v.downloadTasks, viewkey)
 		v.mu.Unlock()
 	}()
+	v.fetchMp4Video(viewkey, mp4URL, detail, "")
+}
 
+// fetchMp4Video 下载MP4视频到缓存，fallbackFrom 为回退前的格式（记录在下载进度中），下载任务由调用方移除
+func (v *VideoCacheService) fetchMp4Video(viewkey, mp4URL string, detail *models.VideoDetail, fallbackFrom string) {
 	log.Printf("[Cache] 开始下载MP4: %s", viewkey)
 	os.MkdirAll(v.cacheDir, 0755)
 
@@ -457,16 +942,14 @@ func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *mod
 		v.DownloadThumbnail(viewkey, detail.Thumbnail)
 	}
 
-	mp4Path := v.getMp4CachePath(viewkey)
-	tempPath := filepath.Join(v.cacheDir, viewkey+".mp4.tmp")
+	tempPath := v.getMp4TempPath(viewkey)
 
-	v.mu.Lock()
-	v.downloadProgress[viewkey] = map[string]interface{}{
-		"status":     "downloading",
-		"downloaded": int64(0),
-		"total":      int64(0),
-	}
-	v.mu.Unlock()
+	v.setProgress(viewkey, models.DownloadProgress{
+		Type:         "mp4",
+		Status:       "downloading",
+		StartedAt:    time.Now(),
+		FallbackFrom: fallbackFrom,
+	})
 
 	req, err := http.NewRequest("GET", mp4URL, nil)
 	if err != nil {
@@ -475,7 +958,8 @@ func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *mod
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", config.Settings.TargetBaseURL)
+	SetAcceptLanguage(req)
+	req.Header.Set("Referer", TargetBaseURL())
 
 	resp, err := v.client.Do(req)
 	if err != nil {
@@ -490,9 +974,13 @@ func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *mod
 	}
 
 	totalSize := resp.ContentLength
-	v.mu.Lock()
-	v.downloadProgress[viewkey]["total"] = totalSize
-	v.mu.Unlock()
+	if reason := mp4OverLimit(totalSize); reason != "" {
+		v.setTooLarge(viewkey, "mp4", reason)
+		return
+	}
+	v.updateProgress(viewkey, func(progress *models.DownloadProgress) {
+		progress.Total = totalSize
+	})
 
 	file, err := os.Create(tempPath)
 	if err != nil {
@@ -501,18 +989,33 @@ func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *mod
 	}
 	defer file.Close()
 
-	buf := make([]byte, 512*1024)
+	writer := newDownloadWriter(file)
+	pooled := GetTransferBuffer()
+	defer PutTransferBuffer(pooled)
+	buf := *pooled
 	var downloaded int64
 
 	for {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
-			file.Write(buf[:n])
+			if _, werr := writer.Write(buf[:n]); werr != nil {
+				v.setDownloadError(viewkey, werr)
+				os.Remove(tempPath)
+				return
+			}
 			downloaded += int64(n)
 
-			v.mu.Lock()
-			v.downloadProgress[viewkey]["downloaded"] = downloaded
-			v.mu.Unlock()
+			v.updateProgress(viewkey, func(progress *models.DownloadProgress) {
+				progress.Downloaded = downloaded
+				progress.Bytes = downloaded
+			})
+
+			// 大小未知时按已下载的字节数判断上限
+			if reason := mp4OverLimit(downloaded); totalSize <= 0 && reason != "" {
+				v.setTooLarge(viewkey, "mp4", reason)
+				os.Remove(tempPath)
+				return
+			}
 		}
 		if err == io.EOF {
 			break
@@ -524,65 +1027,323 @@ func (v *VideoCacheService) downloadMp4Video(viewkey, mp4URL string, detail *mod
 		}
 	}
 
-	// 重命名为最终文件
-	os.Rename(tempPath, mp4Path)
+	v.completeMp4Download(viewkey, detail, file, writer, tempPath, downloaded)
+}
+
+// completeMp4Download 将下载完的临时文件写入磁盘并重命名为缓存文件，补充详情后写入数据库
+func (v *VideoCacheService) completeMp4Download(viewkey string, detail *models.VideoDetail, file *os.File, writer *bufio.Writer, tempPath string, downloaded int64) {
+	mp4Path := v.getMp4CachePath(viewkey)
+
+	// 写入磁盘后再重命名为最终文件，重命名后的MP4即视为已缓存
+	err := writer.Flush()
+	if err == nil {
+		err = syncFile(file)
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tempPath, mp4Path)
+	}
+	if err != nil {
+		v.setDownloadError(viewkey, err)
+		os.Remove(tempPath)
+		return
+	}
+	syncDir(v.cacheDir)
+
+	// 使用ffprobe补充时长和分辨率
+	if detail != nil && config.Settings.FFprobeEnabled {
+		if duration, resolution, err := probeMp4(mp4Path); err == nil {
+			detail.Duration = duration
+			detail.Resolution = resolution
+		} else {
+			log.Printf("[Cache] ffprobe失败 %s: %v", viewkey, err)
+		}
+	}
 
 	// 保存视频详情
 	if detail != nil {
 		v.SaveDetail(viewkey, detail)
+		v.downloadSubtitles(viewkey, detail)
 	}
 
 	// 写入数据库
-	var title, thumbnail, originalURL string
+	var title, thumbnail, originalURL, resolution string
+	var duration int
 	if detail != nil {
 		title = detail.Title
 		thumbnail = detail.Thumbnail
 		originalURL = detail.OriginalURL
+		duration = detail.Duration
+		resolution = detail.Resolution
 	}
-	GetCacheDBService().AddCachedVideo(viewkey, title, "mp4", downloaded, thumbnail, originalURL)
+	GetCacheDBService().AddCachedVideo(viewkey, title, "mp4", downloaded, thumbnail, originalURL, duration, resolution)
 
-	v.mu.Lock()
-	v.downloadProgress[viewkey]["status"] = "complete"
-	v.mu.Unlock()
+	v.updateProgress(viewkey, func(progress *models.DownloadProgress) {
+		progress.Status = "complete"
+	})
 
 	log.Printf("[Cache] MP4下载完成: %s", viewkey)
 }
 
+// probeMp4 使用ffprobe获取MP4的时长（秒）和分辨率
+func probeMp4(path string) (int, string, error) {
+	out, err := exec.Command(config.Settings.FFprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return 0, "", err
+	}
+
+	var probe struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, "", err
+	}
+
+	var duration int
+	if d, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		duration = int(d + 0.5)
+	}
+	var resolution string
+	if len(probe.Streams) > 0 && probe.Streams[0].Width > 0 {
+		resolution = fmt.Sprintf("%dx%d", probe.Streams[0].Width, probe.Streams[0].Height)
+	}
+	return duration, resolution, nil
+}
+
 // setDownloadError 设置下载错误
 func (v *VideoCacheService) setDownloadError(viewkey string, err error) {
-	v.mu.Lock()
-	v.downloadProgress[viewkey] = map[string]interface{}{
-		"status": "error",
-		"error":  err.Error(),
-	}
-	v.mu.Unlock()
+	v.setProgress(viewkey, models.DownloadProgress{
+		Status: "error",
+		Error:  err.Error(),
+	})
 	log.Printf("[Cache] 下载失败 %s: %v", viewkey, err)
+	recordRecentError("download", viewkey, err)
 }
 
 // parseM3u8Segments 解析m3u8文件获取分片URL列表
 func (v *VideoCacheService) parseM3u8Segments(content, baseURL string) []string {
 	var segments []string
 	base := v.getBaseURL(baseURL)
+	ranges := newByteRangeTracker()
 
 	for _, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
+		if line == "" || ranges.consumeTag(line) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		segments = append(segments, ranges.apply(v.resolveURL(base, line)))
+	}
+
+	return segments
+}
+
+// resolveURL 将m3u8中的相对地址解析为绝对地址
+func (v *VideoCacheService) resolveURL(base, ref string) string {
+	if strings.HasPrefix(ref, "http") {
+		return ref
+	}
+	parsed, _ := url.Parse(base)
+	refURL, _ := url.Parse(ref)
+	return parsed.ResolveReference(refURL).String()
+}
+
+// downloadSegment 下载分片到指定路径
+// 先写临时文件再重命名，避免读取到未写完的分片
+func (v *VideoCacheService) downloadSegment(segmentURL, segmentPath string) bool {
+	content, err := v.fetchSegment(segmentURL)
+	if err != nil {
+		return false
+	}
+	return writeFileDurable(segmentPath, content) == nil
+}
+
+// fetchSegment 从上游获取分片内容，地址带字节范围时只下载对应的字节
+func (v *VideoCacheService) fetchSegment(segmentURL string) ([]byte, error) {
+	segmentURL, rangeHeader := splitByteRange(segmentURL)
+	req, err := http.NewRequest("GET", segmentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	SetAcceptLanguage(req)
+	req.Header.Set("Referer", TargetBaseURL())
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	return readRangeBody(resp, rangeHeader)
+}
+
+// localSegmentName 第 index 个分片的本地文件名
+func localSegmentName(index int, segmentURL string) string {
+	if config.Settings.PreserveSegmentExt {
+		return fmt.Sprintf("%d%s", index, segmentExt(segmentURL, ".ts"))
+	}
+	return fmt.Sprintf("%d.ts", index)
+}
+
+// planSegmentEntries 按播放列表顺序列出本次下载的初始化分片和媒体分片，本地文件名与下载时相同
+func (v *VideoCacheService) planSegmentEntries(m3u8Content, m3u8URL string, segments []string) []manifestEntry {
+	var entries []manifestEntry
+	segmentIndex := 0
+	for _, line := range strings.Split(m3u8Content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MAP"):
+			var withRange func(string) string
+			line, withRange = mapByteRange(line)
+			if matches := MapURIRe.FindStringSubmatch(line); matches != nil {
+				initURL := withRange(v.resolveURL(v.getBaseURL(m3u8URL), matches[1]))
+				entries = append(entries, manifestEntry{Original: initURL, Local: "init" + segmentExt(initURL, ".mp4"), Init: true})
+			}
+		case strings.HasPrefix(line, "#"):
+		case segmentIndex < len(segments):
+			segmentURL := segments[segmentIndex]
+			entries = append(entries, manifestEntry{Original: segmentURL, Local: localSegmentName(segmentIndex, segmentURL)})
+			segmentIndex++
+		}
+	}
+	return entries
+}
+
+// localPlaylistLines 按分片清单将播放列表改写为本地文件名：去掉 BYTERANGE，初始化分片和媒体分片依次换成清单中的本地名称
+// 与下载时一样，超出清单的分片及之后的内容不保留
+func localPlaylistLines(m3u8Content string, planned []manifestEntry) []string {
+	namer := newSegmentNamer(planned)
+	var lines []string
+	for _, line := range strings.Split(m3u8Content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			continue
+		case strings.HasPrefix(line, "#EXT-X-MAP"):
+			line, _ = mapByteRange(line)
+			if matches := MapURIRe.FindStringSubmatch(line); matches != nil {
+				line = strings.Replace(line, matches[0], fmt.Sprintf(`URI="%s"`, namer.initName(matches[1])), 1)
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		case len(namer.media) == 0:
+			return lines
+		default:
+			line = namer.mediaName(line)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// partialPlaylistLines 截取本地播放列表到第 media 个媒体分片（含）为止，用于边下边播
+func partialPlaylistLines(lines []string, media int) []string {
+	count := 0
+	for i, line := range lines {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		if count++; count == media {
+			return append([]string(nil), lines[:i+1]...)
+		}
+	}
+	return append([]string(nil), lines...)
+}
 
-		var segmentURL string
-		if !strings.HasPrefix(line, "http") {
-			parsed, _ := url.Parse(base)
-			ref, _ := url.Parse(line)
-			segmentURL = parsed.ResolveReference(ref).String()
-		} else {
-			segmentURL = line
+// segmentStored 分片文件是否已存在且非空
+func segmentStored(segmentPath string) bool {
+	info, err := os.Stat(segmentPath)
+	return err == nil && info.Size() > 0
+}
+
+// missingSegments 统计缓存目录中不存在或为空的分片（含初始化分片）数量
+func missingSegments(cacheDir string, entries []manifestEntry) int {
+	missing := 0
+	for _, entry := range entries {
+		if !segmentStored(filepath.Join(cacheDir, entry.Local)) {
+			missing++
 		}
+	}
+	return missing
+}
 
-		segments = append(segments, segmentURL)
+// FetchMissingSegment 下载中视频的分片尚未缓存时从上游获取
+// SEGMENT_MISS_STORE 开启时同时保存到缓存目录；视频不在下载中或分片不属于该视频时返回 ErrVideoNotCached
+func (v *VideoCacheService) FetchMissingSegment(viewkey, segmentName string) ([]byte, error) {
+	if !ValidViewkey(viewkey) || !ValidSegmentName(segmentName) {
+		return nil, ErrInvalidPath
 	}
 
-	return segments
+	v.mu.RLock()
+	var sourceURL string
+	if partial, ok := v.partialM3u8[viewkey]; ok {
+		sourceURL = partial.sources[segmentName]
+	}
+	v.mu.RUnlock()
+	if sourceURL == "" {
+		return nil, ErrVideoNotCached
+	}
+
+	content, err := v.fetchSegment(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	if config.Settings.SegmentMissStore {
+		if err := writeFileDurable(filepath.Join(v.getVideoCacheDir(viewkey), segmentName), content); err != nil {
+			log.Printf("[Cache] 保存分片失败 %s/%s: %v", viewkey, segmentName, err)
+		}
+	}
+	return content, nil
+}
+
+// segmentExt 从分片URL获取扩展名（忽略查询参数），无法识别时返回默认值
+func segmentExt(segmentURL, fallback string) string {
+	parsed, err := url.Parse(segmentURL)
+	if err != nil {
+		return fallback
+	}
+	ext := strings.ToLower(path.Ext(parsed.Path))
+	if !segmentExtRe.MatchString(ext) || ext == ".m3u8" {
+		return fallback
+	}
+	return ext
+}
+
+// SegmentContentType 根据缓存分片的扩展名返回Content-Type
+func SegmentContentType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".m4s", ".mp4", ".m4v", ".cmfv":
+		return "video/mp4"
+	case ".m4a", ".cmfa":
+		return "audio/mp4"
+	case ".aac":
+		return "audio/aac"
+	case ".vtt":
+		return "text/vtt"
+	}
+	return "video/MP2T"
 }
 
 // getBaseURL 获取URL的基础路径
@@ -652,6 +1413,10 @@ func (v *VideoCacheService) getDirSize(path string) int64 {
 
 // DeleteCachedVideo 删除指定视频的缓存
 func (v *VideoCacheService) DeleteCachedVideo(viewkey string) bool {
+	// 避免空值或 ".." 等删除缓存目录之外的文件
+	if !ValidViewkey(viewkey) || !withinDir(v.cacheDir, v.getVideoCacheDir(viewkey)) {
+		return false
+	}
 	deleted := false
 
 	// 删除M3U8缓存目录
@@ -675,6 +1440,14 @@ func (v *VideoCacheService) DeleteCachedVideo(viewkey string) bool {
 	// 删除封面图
 	thumbPath := v.getThumbnailCachePath(viewkey)
 	os.Remove(thumbPath)
+	os.Remove(v.getThumbnailFailedPath(viewkey))
+
+	// 删除字幕
+	if subs, err := filepath.Glob(filepath.Join(v.cacheDir, viewkey+".sub*.vtt")); err == nil {
+		for _, sub := range subs {
+			os.Remove(sub)
+		}
+	}
 
 	// 从数据库删除记录
 	if deleted {
@@ -733,18 +1506,27 @@ func (v *VideoCacheService) GetCacheSize() int64 {
 }
 
 // RewriteCachedM3u8 重写缓存的m3u8文件
-func (v *VideoCacheService) RewriteCachedM3u8(content, viewkey, proxyBase string) string {
+// 分片地址按下载时记录的分片清单取本地文件名，没有清单的旧版缓存直接使用播放列表中的名称
+func (v *VideoCacheService) RewriteCachedM3u8(content, viewkey, proxyBase, session string) string {
 	var newLines []string
+	namer := newSegmentNamer(v.segmentEntries(viewkey))
 
 	for _, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXT-X-MAP") {
+			// 初始化分片
+			if matches := MapURIRe.FindStringSubmatch(line); matches != nil {
+				proxyURL := proxyBase + SignPath(fmt.Sprintf("/api/stream/cached-segment/%s/%s", viewkey, namer.initName(matches[1])), session)
+				line = strings.Replace(line, matches[0], fmt.Sprintf(`URI="%s"`, proxyURL), 1)
+			}
+		}
 		if line == "" || strings.HasPrefix(line, "#") {
 			newLines = append(newLines, line)
 			continue
 		}
 
-		// 非注释行是分片文件名
-		proxyURL := fmt.Sprintf("%s/api/stream/cached-segment/%s/%s", proxyBase, viewkey, line)
+		// 非注释行是分片
+		proxyURL := proxyBase + SignPath(fmt.Sprintf("/api/stream/cached-segment/%s/%s", viewkey, namer.mediaName(line)), session)
 		newLines = append(newLines, proxyURL)
 	}
 
@@ -13,29 +13,17 @@ export const authApi = {
 }
 
 export const videoApi = {
-  // 获取视频列表
-  getList(page = 1) {
-    return api.get('/videos', { params: { page } })
+  // 获取视频列表（refresh 为 true 时跳过缓存重新抓取）
+  getList(page = 1, refresh = false) {
+    const params = { page }
+    if (refresh) params.refresh = true
+    return api.get('/videos', { params })
   },
 
   // 获取视频详情
+  // 流地址、封面图和字幕的代理地址由详情返回（启用签名时带签名），不在前端拼接
   getDetail(videoId) {
     return api.get(`/videos/${videoId}`)
-  },
-
-  // 获取视频流地址
-  getStreamUrl(videoId) {
-    return `/api/stream/${videoId}`
-  },
-
-  // 直接获取m3u8流
-  getDirectStreamUrl(m3u8Url) {
-    return `/api/stream/direct?url=${encodeURIComponent(m3u8Url)}`
-  },
-
-  // 获取封面图代理地址
-  getThumbnailUrl(videoId) {
-    return `/api/stream/image/${videoId}`
   }
 }
 